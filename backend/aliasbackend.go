@@ -0,0 +1,411 @@
+// Aliasing implementation of the Backend interface, the applications use stable logical bucket names (ex: invoices)
+// mapped to a physical bucket and a key prefix which differ between the environments (ex: prod-invoices and tenant1/)
+
+package backend
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// BucketAlias is the physical bucket of a logical bucket and the prefix added to the keys of the logical bucket (no prefix when empty)
+type BucketAlias struct {
+	Bucket string
+	Prefix string
+}
+
+// AliasBackendConfig for the aliasing backend
+type AliasBackendConfig struct {
+	// Backend of the physical buckets
+	Backend Backend
+
+	// Physical bucket and key prefix by logical bucket name
+	Aliases map[string]BucketAlias
+
+	// Reject the buckets without alias with NoSuchBucket, they are used as physical buckets when false
+	Strict bool
+}
+
+// AliasBackend rewrites the logical bucket and the keys of the objects to the physical bucket and keys of the underlying backend
+// the keys of the listings and of the locked objects are rewritten back to logical keys
+// the presigned URLs are URLs of the physical objects
+type AliasBackend struct {
+	backend Backend
+	aliases map[string]BucketAlias
+	strict  bool
+}
+
+// ParseBucketAliases parses a list of bucket aliases separated by commas
+// ex: invoices=prod-invoices,reports=prod-documents/reports/
+// the part after the first "/" of the physical bucket is the key prefix
+func ParseBucketAliases(s string) (map[string]BucketAlias, error) {
+	result := make(map[string]BucketAlias)
+
+	for _, element := range strings.Split(s, ",") {
+		if element = strings.TrimSpace(element); element == "" {
+			continue
+		}
+
+		logicalBucket, target, found := strings.Cut(element, "=")
+		bucket, prefix, _ := strings.Cut(target, "/")
+		if !found || logicalBucket == "" || bucket == "" {
+			return nil, fmt.Errorf("invalid bucket alias %q, format is alias=bucket[/prefix]", element)
+		}
+
+		if _, ok := result[logicalBucket]; ok {
+			return nil, fmt.Errorf("duplicate bucket alias %s", logicalBucket)
+		}
+
+		result[logicalBucket] = BucketAlias{Bucket: bucket, Prefix: prefix}
+	}
+
+	return result, nil
+}
+
+// Create an aliasing backend in front of a backend
+func NewAliasBackend(config AliasBackendConfig) (*AliasBackend, error) {
+	if config.Backend == nil {
+		return nil, fmt.Errorf("the aliasing backend requires a backend")
+	}
+
+	for logicalBucket, alias := range config.Aliases {
+		if alias.Bucket == "" {
+			return nil, fmt.Errorf("no physical bucket for the bucket alias %s", logicalBucket)
+		}
+		if strings.HasPrefix(alias.Prefix, "/") {
+			return nil, fmt.Errorf("the prefix %q of the bucket alias %s can not start with a \"/\"", alias.Prefix, logicalBucket)
+		}
+	}
+
+	return &AliasBackend{
+		backend: config.Backend,
+		aliases: config.Aliases,
+		strict:  config.Strict,
+	}, nil
+}
+
+// alias of a logical bucket, a bucket without alias is a physical bucket unless the strict mode is enabled
+func (b *AliasBackend) alias(bucketName string) (BucketAlias, error) {
+	if alias, ok := b.aliases[bucketName]; ok {
+		return alias, nil
+	}
+	if b.strict {
+		return BucketAlias{}, awserr.New(s3.ErrCodeNoSuchBucket, fmt.Sprintf("Unknown bucket alias %s", bucketName), nil)
+	}
+	return BucketAlias{Bucket: bucketName}, nil
+}
+
+// physical object of a logical object, only the bucket name and the key are changed
+func (b *AliasBackend) physical(object BucketObject) (BucketObject, BucketAlias, error) {
+	alias, err := b.alias(object.BucketName)
+	if err != nil {
+		return object, alias, err
+	}
+
+	object.BucketName = alias.Bucket
+	object.Key = alias.physicalKey(object.Key)
+
+	return object, alias, nil
+}
+
+// physical key of a logical key, the leading "/" of the key is kept (ex: /folder/item -> /tenant1/folder/item)
+func (alias BucketAlias) physicalKey(key string) string {
+	if strings.HasPrefix(key, "/") {
+		return "/" + alias.Prefix + key[1:]
+	}
+	return alias.Prefix + key
+}
+
+// logical key of a physical key, the key is unchanged when it does not start with the prefix
+func (alias BucketAlias) logicalKey(key string) string {
+	if strings.HasPrefix(key, "/"+alias.Prefix) {
+		return "/" + key[len(alias.Prefix)+1:]
+	}
+	return strings.TrimPrefix(key, alias.Prefix)
+}
+
+// rewrite the physical keys of the locked objects to the logical keys
+func logicalLockedKeys(err error, logicalKeys map[string]string) error {
+	lockedErr, ok := err.(*LockedObjectsError)
+	if !ok {
+		return err
+	}
+
+	keys := make([]string, 0, len(lockedErr.Keys))
+	for _, key := range lockedErr.Keys {
+		if logicalKey, ok := logicalKeys[key]; ok {
+			key = logicalKey
+		}
+		keys = append(keys, key)
+	}
+
+	return NewLockedObjectsError(keys, lockedErr.OrigErr())
+}
+
+// Create a presigned URL for uploading a file to the physical object
+func (b *AliasBackend) CreatePresignedURLForUpload(object BucketObject, expire time.Duration, constraints UploadConstraints) (*PresignedURL, error) {
+	object, _, err := b.physical(object)
+	if err != nil {
+		return nil, err
+	}
+	return b.backend.CreatePresignedURLForUpload(object, expire, constraints)
+}
+
+// Create a presigned URL for downloading the physical object
+func (b *AliasBackend) CreatePresignedURLForDownload(object BucketObject, expire time.Duration, headers ResponseHeaders) (string, error) {
+	object, _, err := b.physical(object)
+	if err != nil {
+		return "", err
+	}
+	return b.backend.CreatePresignedURLForDownload(object, expire, headers)
+}
+
+// Delete the physical object
+func (b *AliasBackend) DeleteObject(object BucketObject) error {
+	physicalObject, _, err := b.physical(object)
+	if err != nil {
+		return err
+	}
+	return logicalLockedKeys(b.backend.DeleteObject(physicalObject), map[string]string{physicalObject.Key: object.Key})
+}
+
+// Delete the physical objects, the locked objects are reported with their logical keys
+func (b *AliasBackend) BatchDeleteObjects(objects []BucketObject) error {
+	physicalObjects := make([]BucketObject, 0, len(objects))
+	logicalKeys := make(map[string]string, len(objects))
+
+	for _, object := range objects {
+		physicalObject, _, err := b.physical(object)
+		if err != nil {
+			return err
+		}
+		physicalObjects = append(physicalObjects, physicalObject)
+		logicalKeys[physicalObject.Key] = object.Key
+	}
+
+	return logicalLockedKeys(b.backend.BatchDeleteObjects(physicalObjects), logicalKeys)
+}
+
+// Copy a physical object to another physical object
+func (b *AliasBackend) CopyObject(sourceObject BucketObject, destinationObject BucketObject) error {
+	sourceObject, _, err := b.physical(sourceObject)
+	if err != nil {
+		return err
+	}
+	destinationObject, _, err = b.physical(destinationObject)
+	if err != nil {
+		return err
+	}
+	return b.backend.CopyObject(sourceObject, destinationObject)
+}
+
+// Returns the metadata of the physical object with the logical key
+func (b *AliasBackend) StatObject(object BucketObject) (*ObjectInfo, error) {
+	physicalObject, alias, err := b.physical(object)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := b.backend.StatObject(physicalObject)
+	if err != nil {
+		return nil, err
+	}
+
+	info.Key = alias.logicalKey(info.Key)
+	return info, nil
+}
+
+// Returns one page of the objects of the physical bucket under the prefix, with the logical keys
+func (b *AliasBackend) ListObjects(bucketName string, options ListOptions) (*ObjectListing, error) {
+	alias, err := b.alias(bucketName)
+	if err != nil {
+		return nil, err
+	}
+
+	options.Prefix = alias.physicalKey(options.Prefix)
+
+	listing, err := b.backend.ListObjects(alias.Bucket, options)
+	if err != nil {
+		return nil, err
+	}
+
+	for index := range listing.Objects {
+		listing.Objects[index].Key = alias.logicalKey(listing.Objects[index].Key)
+	}
+	for index := range listing.CommonPrefixes {
+		listing.CommonPrefixes[index] = alias.logicalKey(listing.CommonPrefixes[index])
+	}
+
+	return listing, nil
+}
+
+// Initiate a multipart upload of the physical object
+func (b *AliasBackend) CreateMultipartUpload(object BucketObject) (string, error) {
+	object, _, err := b.physical(object)
+	if err != nil {
+		return "", err
+	}
+	return b.backend.CreateMultipartUpload(object)
+}
+
+// Create a presigned URL for uploading one part of a multipart upload of the physical object
+func (b *AliasBackend) CreatePresignedURLForUploadPart(object BucketObject, uploadID string, partNumber int64, expire time.Duration) (*PresignedURL, error) {
+	object, _, err := b.physical(object)
+	if err != nil {
+		return nil, err
+	}
+	return b.backend.CreatePresignedURLForUploadPart(object, uploadID, partNumber, expire)
+}
+
+// Complete a multipart upload of the physical object
+func (b *AliasBackend) CompleteMultipartUpload(object BucketObject, uploadID string, parts []CompletedPart) error {
+	object, _, err := b.physical(object)
+	if err != nil {
+		return err
+	}
+	return b.backend.CompleteMultipartUpload(object, uploadID, parts)
+}
+
+// Abort a multipart upload of the physical object
+func (b *AliasBackend) AbortMultipartUpload(object BucketObject, uploadID string) error {
+	object, _, err := b.physical(object)
+	if err != nil {
+		return err
+	}
+	return b.backend.AbortMultipartUpload(object, uploadID)
+}
+
+// Create a presigned POST policy for the physical object, or for the physical prefix when the key ends with "/"
+func (b *AliasBackend) CreatePresignedPost(object BucketObject, expire time.Duration, conditions PostConditions) (*PresignedPost, error) {
+	object, _, err := b.physical(object)
+	if err != nil {
+		return nil, err
+	}
+	return b.backend.CreatePresignedPost(object, expire, conditions)
+}
+
+// Returns the content of the physical object with the logical key
+func (b *AliasBackend) GetObject(object BucketObject, options GetOptions) (*ObjectContent, error) {
+	physicalObject, alias, err := b.physical(object)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := b.backend.GetObject(physicalObject, options)
+	if err != nil {
+		return nil, err
+	}
+
+	content.Key = alias.logicalKey(content.Key)
+	return content, nil
+}
+
+// Write the content of the physical object
+func (b *AliasBackend) PutObject(object BucketObject, body io.Reader, options PutOptions) (string, error) {
+	object, _, err := b.physical(object)
+	if err != nil {
+		return "", err
+	}
+	return b.backend.PutObject(object, body, options)
+}
+
+// Returns the tags of the physical object
+func (b *AliasBackend) GetObjectTagging(object BucketObject) (map[string]string, error) {
+	object, _, err := b.physical(object)
+	if err != nil {
+		return nil, err
+	}
+	return b.backend.GetObjectTagging(object)
+}
+
+// Replace the tags of the physical object
+func (b *AliasBackend) PutObjectTagging(object BucketObject, tags map[string]string) error {
+	object, _, err := b.physical(object)
+	if err != nil {
+		return err
+	}
+	return b.backend.PutObjectTagging(object, tags)
+}
+
+// Remove the tags of the physical object
+func (b *AliasBackend) DeleteObjectTagging(object BucketObject) error {
+	object, _, err := b.physical(object)
+	if err != nil {
+		return err
+	}
+	return b.backend.DeleteObjectTagging(object)
+}
+
+// Returns one page of the versions of the objects of the physical bucket under the prefix, with the logical keys
+func (b *AliasBackend) ListObjectVersions(bucketName string, options ListOptions) (*VersionListing, error) {
+	alias, err := b.alias(bucketName)
+	if err != nil {
+		return nil, err
+	}
+
+	options.Prefix = alias.physicalKey(options.Prefix)
+
+	listing, err := b.backend.ListObjectVersions(alias.Bucket, options)
+	if err != nil {
+		return nil, err
+	}
+
+	for index := range listing.Versions {
+		listing.Versions[index].Key = alias.logicalKey(listing.Versions[index].Key)
+	}
+	for index := range listing.CommonPrefixes {
+		listing.CommonPrefixes[index] = alias.logicalKey(listing.CommonPrefixes[index])
+	}
+
+	return listing, nil
+}
+
+// Returns the Object Lock retention of the physical object
+func (b *AliasBackend) GetObjectRetention(object BucketObject) (*ObjectRetention, error) {
+	object, _, err := b.physical(object)
+	if err != nil {
+		return nil, err
+	}
+	return b.backend.GetObjectRetention(object)
+}
+
+// Set the Object Lock retention of the physical object
+func (b *AliasBackend) PutObjectRetention(object BucketObject, retention ObjectRetention, bypassGovernance bool) error {
+	object, _, err := b.physical(object)
+	if err != nil {
+		return err
+	}
+	return b.backend.PutObjectRetention(object, retention, bypassGovernance)
+}
+
+// Returns the legal hold of the physical object
+func (b *AliasBackend) GetObjectLegalHold(object BucketObject) (bool, error) {
+	object, _, err := b.physical(object)
+	if err != nil {
+		return false, err
+	}
+	return b.backend.GetObjectLegalHold(object)
+}
+
+// Set or remove the legal hold of the physical object
+func (b *AliasBackend) PutObjectLegalHold(object BucketObject, legalHold bool) error {
+	object, _, err := b.physical(object)
+	if err != nil {
+		return err
+	}
+	return b.backend.PutObjectLegalHold(object, legalHold)
+}
+
+// Restore the physical archived object
+func (b *AliasBackend) RestoreObject(object BucketObject, options RestoreOptions) (bool, error) {
+	object, _, err := b.physical(object)
+	if err != nil {
+		return false, err
+	}
+	return b.backend.RestoreObject(object, options)
+}
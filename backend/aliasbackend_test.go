@@ -0,0 +1,119 @@
+package backend
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBucketAliases(t *testing.T) {
+	aliases, err := ParseBucketAliases(" invoices=prod-invoices, reports=prod-documents/reports/ ,")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]BucketAlias{
+		"invoices": {Bucket: "prod-invoices"},
+		"reports":  {Bucket: "prod-documents", Prefix: "reports/"},
+	}, aliases)
+
+	for _, s := range []string{"invoices", "invoices=", "=prod-invoices", "invoices=/reports/", "invoices=a,invoices=b"} {
+		_, err = ParseBucketAliases(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestBucketAliasKeys(t *testing.T) {
+	alias := BucketAlias{Bucket: "prod-documents", Prefix: "reports/"}
+
+	assert.Equal(t, "/reports/2023/jan.pdf", alias.physicalKey("/2023/jan.pdf"))
+	assert.Equal(t, "reports/2023/jan.pdf", alias.physicalKey("2023/jan.pdf"))
+	assert.Equal(t, "reports/", alias.physicalKey(""))
+
+	assert.Equal(t, "/2023/jan.pdf", alias.logicalKey("/reports/2023/jan.pdf"))
+	assert.Equal(t, "2023/jan.pdf", alias.logicalKey("reports/2023/jan.pdf"))
+	assert.Equal(t, "other/jan.pdf", alias.logicalKey("other/jan.pdf"))
+
+	alias = BucketAlias{Bucket: "prod-invoices"}
+	assert.Equal(t, "/2023/jan.pdf", alias.physicalKey("/2023/jan.pdf"))
+	assert.Equal(t, "/2023/jan.pdf", alias.logicalKey("/2023/jan.pdf"))
+}
+
+func TestAliasBackend(t *testing.T) {
+	fsBackend := newTestFSBackendWithBuckets(t, "prod-documents", "prod-invoices", "physical")
+
+	b, err := NewAliasBackend(AliasBackendConfig{
+		Backend: fsBackend,
+		Aliases: map[string]BucketAlias{
+			"reports":  {Bucket: "prod-documents", Prefix: "reports/"},
+			"invoices": {Bucket: "prod-invoices"},
+		},
+	})
+	require.NoError(t, err)
+
+	report := BucketObject{BucketName: "reports", Key: "/2023/jan.pdf"}
+
+	_, err = b.PutObject(report, strings.NewReader("january"), PutOptions{ContentType: "application/pdf"})
+	require.NoError(t, err)
+	_, err = b.PutObject(BucketObject{BucketName: "reports", Key: "/2023/feb.pdf"}, strings.NewReader("february"), PutOptions{})
+	require.NoError(t, err)
+
+	// the object is stored under the prefix of the physical bucket
+	_, err = fsBackend.StatObject(BucketObject{BucketName: "prod-documents", Key: "/reports/2023/jan.pdf"})
+	require.NoError(t, err)
+
+	info, err := b.StatObject(report)
+	require.NoError(t, err)
+	assert.Equal(t, "/2023/jan.pdf", info.Key)
+
+	content, err := b.GetObject(report, GetOptions{})
+	require.NoError(t, err)
+	content.Body.Close()
+	assert.Equal(t, "/2023/jan.pdf", content.Key)
+
+	listing, err := b.ListObjects("reports", ListOptions{Delimiter: "/"})
+	require.NoError(t, err)
+	assert.Empty(t, listing.Objects)
+	assert.Equal(t, []string{"2023/"}, listing.CommonPrefixes)
+
+	listing, err = b.ListObjects("reports", ListOptions{Prefix: "2023/"})
+	require.NoError(t, err)
+	require.Len(t, listing.Objects, 2)
+	assert.Equal(t, "2023/feb.pdf", listing.Objects[0].Key)
+	assert.Equal(t, "2023/jan.pdf", listing.Objects[1].Key)
+
+	versions, err := b.ListObjectVersions("reports", ListOptions{Prefix: "2023/j"})
+	require.NoError(t, err)
+	require.Len(t, versions.Versions, 1)
+	assert.Equal(t, "2023/jan.pdf", versions.Versions[0].Key)
+
+	// copy between two aliases
+	invoice := BucketObject{BucketName: "invoices", Key: "/jan.pdf"}
+	require.NoError(t, b.CopyObject(report, invoice))
+	_, err = fsBackend.StatObject(BucketObject{BucketName: "prod-invoices", Key: "/jan.pdf"})
+	require.NoError(t, err)
+
+	require.NoError(t, b.BatchDeleteObjects([]BucketObject{report, invoice}))
+	_, err = fsBackend.StatObject(BucketObject{BucketName: "prod-documents", Key: "/reports/2023/jan.pdf"})
+	assert.Equal(t, "NoSuchKey", errorCode(err))
+
+	// the buckets without alias are physical buckets unless the strict mode is enabled
+	_, err = b.PutObject(BucketObject{BucketName: "physical", Key: "/file"}, strings.NewReader("content"), PutOptions{})
+	require.NoError(t, err)
+
+	b, err = NewAliasBackend(AliasBackendConfig{Backend: fsBackend, Aliases: map[string]BucketAlias{"reports": {Bucket: "prod-documents"}}, Strict: true})
+	require.NoError(t, err)
+
+	_, err = b.StatObject(BucketObject{BucketName: "physical", Key: "/file"})
+	assert.Equal(t, "NoSuchBucket", errorCode(err))
+
+	_, err = b.ListObjects("physical", ListOptions{})
+	assert.Equal(t, "NoSuchBucket", errorCode(err))
+}
+
+func TestAliasBackendLockedKeys(t *testing.T) {
+	err := logicalLockedKeys(NewLockedObjectsError([]string{"/reports/jan.pdf", "/other"}, nil), map[string]string{"/reports/jan.pdf": "/jan.pdf"})
+	require.IsType(t, &LockedObjectsError{}, err)
+	assert.Equal(t, []string{"/jan.pdf", "/other"}, err.(*LockedObjectsError).Keys)
+
+	assert.Nil(t, logicalLockedKeys(nil, nil))
+}
@@ -0,0 +1,1084 @@
+// Azure Blob Storage implementation of the Backend interface, the buckets are containers and the keys are blob names
+// The backend uses the Blob REST API : the requests are authorized with the account key (Shared Key) and the presigned URLs are service SAS
+
+package backend
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Azure access tiers
+const (
+	azureTierHot     = "Hot"
+	azureTierCool    = "Cool"
+	azureTierCold    = "Cold"
+	azureTierArchive = "Archive"
+)
+
+// Azure immutability policy modes, an unlocked policy can be shortened or removed
+const (
+	azurePolicyUnlocked = "Unlocked"
+	azurePolicyLocked   = "Locked"
+)
+
+const (
+	// size of the blocks of a PutObject, a body smaller than one block is sent with a single Put Blob
+	azureBlockSize int64 = 8 * 1024 * 1024
+	// default page size of a listing as on S3
+	azureDefaultMaxKeys = 1000
+)
+
+// interval between two checks of the status of a pending copy
+var azureCopyPollInterval = 500 * time.Millisecond
+
+// default max. duration of a copy, the copy is polled by the goroutine of the request
+const azureDefaultCopyTimeout = 5 * time.Minute
+
+// the SAS of the source of a copy expires a few minutes after its timeout to tolerate the clock skew with Azure
+const azureCopySourceExpiryMargin = 5 * time.Minute
+
+// AzureBackendConfig for the Azure Blob Storage backend
+type AzureBackendConfig struct {
+	// URL of the Blob service, https://<account>.blob.core.windows.net when empty
+	// ex: http://127.0.0.1:10000/devstoreaccount1 for the Azurite emulator
+	Endpoint string
+
+	// Name and base64 encoded key of the storage account
+	AccountName string
+	AccountKey  string
+
+	// client of the requests to the Blob service, http.DefaultClient when nil
+	HTTPClient *http.Client
+
+	// max. duration of a copy, a copy still pending after it is aborted (default 5 minutes)
+	CopyTimeout time.Duration
+}
+
+// AzureBackend stores the objects in the blobs of a storage account, the keys are normalized : "/folder/item" and "folder/item" are the same blob
+type AzureBackend struct {
+	config     AzureBackendConfig
+	accountKey []byte
+	client     *http.Client
+}
+
+// Create an Azure Blob Storage backend
+func NewAzureBackend(config AzureBackendConfig) (*AzureBackend, error) {
+	if config.AccountName == "" {
+		return nil, errors.New("the Azure account name is required")
+	}
+
+	accountKey, err := base64.StdEncoding.DecodeString(config.AccountKey)
+	if err != nil || len(accountKey) == 0 {
+		return nil, errors.New("the Azure account key must be base64 encoded")
+	}
+
+	if config.Endpoint == "" {
+		config.Endpoint = "https://" + config.AccountName + ".blob.core.windows.net"
+	}
+	config.Endpoint = strings.TrimSuffix(config.Endpoint, "/")
+
+	client := config.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	if config.CopyTimeout <= 0 {
+		config.CopyTimeout = azureDefaultCopyTimeout
+	}
+
+	return &AzureBackend{config: config, accountKey: accountKey, client: client}, nil
+}
+
+// Create a SAS URL for an upload with Put Blob
+// A SAS does not sign the headers : the constraints are returned as headers to send, Azure only checks the Content-MD5
+func (b *AzureBackend) CreatePresignedURLForUpload(object BucketObject, expire time.Duration, constraints UploadConstraints) (*PresignedURL, error) {
+	cpk, scope, err := azureEncryption(object.Encryption)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := map[string]string{
+		"X-Ms-Blob-Type":   "BlockBlob",
+		"X-Ms-Access-Tier": azureTier(object.StorageClass),
+	}
+
+	for name := range cpk {
+		headers[name] = cpk.Get(name)
+	}
+	if constraints.ContentType != "" {
+		headers["Content-Type"] = constraints.ContentType
+	}
+	if constraints.ContentMD5 != "" {
+		headers["Content-Md5"] = constraints.ContentMD5
+	}
+	for name, value := range constraints.Metadata {
+		headers[http.CanonicalHeaderKey("x-ms-meta-"+name)] = value
+	}
+
+	container, blob := azureBlob(object)
+	query := b.sasQuery(container, blob, azureSAS{permissions: "cw", expiry: time.Now().Add(expire), encryptionScope: scope})
+
+	return &PresignedURL{URL: b.blobURL(container, blob) + "?" + query.Encode(), Headers: headers}, nil
+}
+
+// Create a SAS URL for a download, the response headers are overridden by the SAS
+// With SSE-C, the client has to send the customer key headers
+func (b *AzureBackend) CreatePresignedURLForDownload(object BucketObject, expire time.Duration, headers ResponseHeaders) (string, error) {
+	if _, _, err := azureEncryption(object.Encryption); err != nil {
+		return "", err
+	}
+
+	container, blob := azureBlob(object)
+	query := b.sasQuery(container, blob, azureSAS{permissions: "r", expiry: time.Now().Add(expire), versionID: object.VersionID, headers: headers})
+
+	return b.blobURL(container, blob) + "?" + query.Encode(), nil
+}
+
+// Delete a blob with its snapshots, deleting a missing blob is not an error as on S3
+func (b *AzureBackend) DeleteObject(object BucketObject) error {
+	header := make(http.Header)
+	if object.VersionID == "" {
+		header.Set("x-ms-delete-snapshots", "include")
+	}
+
+	container, blob := azureBlob(object)
+
+	response, err := b.send("DELETE", container, blob, versionQuery(object), header, nil)
+	if isObjectLockDenied(err) {
+		return NewLockedObjectsError([]string{object.Key}, err)
+	}
+	if errorCode(err) == s3.ErrCodeNoSuchKey {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return response.Body.Close()
+}
+
+// Delete several blobs one by one, the blobs protected by an immutability policy or a legal hold are reported in a single LockedObjectsError
+func (b *AzureBackend) BatchDeleteObjects(objects []BucketObject) error {
+	return deleteOneByOne(objects, b.DeleteObject)
+}
+
+// Copy a blob with a server-side copy, the source is read with a short-lived SAS and the copy is polled until it ends
+// a copy still pending before the expiry of the SAS of its source is aborted
+// Azure copies the content and the metadata of the blob but not its tags
+func (b *AzureBackend) CopyObject(sourceObject BucketObject, destinationObject BucketObject) error {
+	if sourceObject.Encryption.Mode == EncryptionSSEC || destinationObject.Encryption.Mode == EncryptionSSEC {
+		return awserr.New(ErrCodeInvalidEncryption, "SSE-C is not supported by the copies of the Azure backend", nil)
+	}
+
+	_, scope, err := azureEncryption(destinationObject.Encryption)
+	if err != nil {
+		return err
+	}
+
+	sourceContainer, sourceBlob := azureBlob(sourceObject)
+	deadline := time.Now().Add(b.config.CopyTimeout)
+	sourceQuery := b.sasQuery(sourceContainer, sourceBlob, azureSAS{permissions: "r", expiry: deadline.Add(azureCopySourceExpiryMargin), versionID: sourceObject.VersionID})
+
+	header := http.Header{
+		"X-Ms-Copy-Source": {b.blobURL(sourceContainer, sourceBlob) + "?" + sourceQuery.Encode()},
+		"X-Ms-Access-Tier": {azureTier(destinationObject.StorageClass)},
+	}
+	if scope != "" {
+		header.Set("x-ms-encryption-scope", scope)
+	}
+
+	container, blob := azureBlob(destinationObject)
+
+	response, err := b.send("PUT", container, blob, nil, header, nil)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+
+	status := response.Header.Get("x-ms-copy-status")
+	copyID := response.Header.Get("x-ms-copy-id")
+
+	for status == "pending" {
+		if time.Now().After(deadline) {
+			return b.abortCopy(container, blob, copyID, sourceObject, destinationObject)
+		}
+
+		time.Sleep(azureCopyPollInterval)
+
+		if response, err = b.send("HEAD", container, blob, nil, nil, nil); err != nil {
+			return err
+		}
+		response.Body.Close()
+
+		// another copy replaced the destination
+		if response.Header.Get("x-ms-copy-id") != copyID {
+			return nil
+		}
+		status = response.Header.Get("x-ms-copy-status")
+	}
+
+	if status != "" && status != "success" {
+		return fmt.Errorf("copy of %s to %s %s : %s", sourceObject, destinationObject, status, response.Header.Get("x-ms-copy-status-description"))
+	}
+
+	return nil
+}
+
+// abort a pending copy with Abort Copy Blob, the destination blob is left empty by Azure
+func (b *AzureBackend) abortCopy(container string, blob string, copyID string, sourceObject BucketObject, destinationObject BucketObject) error {
+	query := url.Values{"comp": {"copy"}, "copyid": {copyID}}
+	header := http.Header{"X-Ms-Copy-Action": {"abort"}}
+
+	response, err := b.send("PUT", container, blob, query, header, nil)
+	if err != nil {
+		return fmt.Errorf("copy of %s to %s not completed after %v, abort failed : %v", sourceObject, destinationObject, b.config.CopyTimeout, err)
+	}
+	response.Body.Close()
+
+	return fmt.Errorf("copy of %s to %s not completed after %v, aborted", sourceObject, destinationObject, b.config.CopyTimeout)
+}
+
+// Returns the properties and the metadata of a blob
+func (b *AzureBackend) StatObject(object BucketObject) (*ObjectInfo, error) {
+	cpk, _, err := azureEncryption(object.Encryption)
+	if err != nil {
+		return nil, err
+	}
+
+	container, blob := azureBlob(object)
+
+	response, err := b.send("HEAD", container, blob, versionQuery(object), cpk, nil)
+	if err != nil {
+		return nil, err
+	}
+	response.Body.Close()
+
+	return azureObjectInfo(object.Key, response), nil
+}
+
+// blob of a listing
+type azureBlobItem struct {
+	Name             string `xml:"Name"`
+	VersionID        string `xml:"VersionId"`
+	IsCurrentVersion bool   `xml:"IsCurrentVersion"`
+	Properties       struct {
+		LastModified  string `xml:"Last-Modified"`
+		ETag          string `xml:"Etag"`
+		ContentLength int64  `xml:"Content-Length"`
+		ContentType   string `xml:"Content-Type"`
+		AccessTier    string `xml:"AccessTier"`
+		ArchiveStatus string `xml:"ArchiveStatus"`
+	} `xml:"Properties"`
+}
+
+// XML response of a blob listing
+type azureEnumerationResults struct {
+	Blobs        []azureBlobItem `xml:"Blobs>Blob"`
+	BlobPrefixes []struct {
+		Name string `xml:"Name"`
+	} `xml:"Blobs>BlobPrefix"`
+	NextMarker string `xml:"NextMarker"`
+}
+
+// list one page of blobs, the continuation token is the marker returned by Azure
+func (b *AzureBackend) listBlobs(bucketName string, options ListOptions, include string) (*azureEnumerationResults, error) {
+	query := url.Values{
+		"restype": {"container"},
+		"comp":    {"list"},
+	}
+
+	maxKeys := options.MaxKeys
+	if maxKeys <= 0 {
+		maxKeys = azureDefaultMaxKeys
+	}
+	query.Set("maxresults", strconv.FormatInt(maxKeys, 10))
+
+	for name, value := range map[string]string{
+		"prefix":    options.Prefix,
+		"delimiter": options.Delimiter,
+		"marker":    options.ContinuationToken,
+		"include":   include,
+	} {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+
+	var results azureEnumerationResults
+	if err := b.sendXML("GET", bucketName, "", query, nil, nil, &results); err != nil {
+		return nil, err
+	}
+
+	return &results, nil
+}
+
+// Returns one page of the blobs of a container
+func (b *AzureBackend) ListObjects(bucketName string, options ListOptions) (*ObjectListing, error) {
+	results, err := b.listBlobs(bucketName, options, "")
+	if err != nil {
+		return nil, err
+	}
+
+	listing := &ObjectListing{
+		Objects:               make([]ObjectInfo, len(results.Blobs)),
+		CommonPrefixes:        make([]string, len(results.BlobPrefixes)),
+		IsTruncated:           results.NextMarker != "",
+		NextContinuationToken: results.NextMarker,
+	}
+
+	for index, blob := range results.Blobs {
+		listing.Objects[index] = blob.objectInfo()
+	}
+
+	for index, prefix := range results.BlobPrefixes {
+		listing.CommonPrefixes[index] = prefix.Name
+	}
+
+	return listing, nil
+}
+
+// upload id of a multipart upload : the id of the blocks, the access tier and the encryption scope of the blob
+// Put Block List needs the tier and the scope but the completion of the router only knows the upload id
+type azureUpload struct {
+	id    string
+	tier  string
+	scope string
+}
+
+func (u azureUpload) String() string {
+	query := url.Values{"id": {u.id}, "tier": {u.tier}}
+	if u.scope != "" {
+		query.Set("scope", u.scope)
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(query.Encode()))
+}
+
+func parseAzureUpload(uploadID string) (azureUpload, error) {
+	noSuchUpload := awserr.New(s3.ErrCodeNoSuchUpload, "The specified upload does not exist", nil)
+
+	data, err := base64.RawURLEncoding.DecodeString(uploadID)
+	if err != nil {
+		return azureUpload{}, noSuchUpload
+	}
+	query, err := url.ParseQuery(string(data))
+	if err != nil {
+		return azureUpload{}, noSuchUpload
+	}
+
+	upload := azureUpload{id: query.Get("id"), tier: query.Get("tier"), scope: query.Get("scope")}
+	if _, err := hex.DecodeString(upload.id); err != nil || len(upload.id) != 32 {
+		return azureUpload{}, noSuchUpload
+	}
+
+	return upload, nil
+}
+
+// id of a block of a multipart upload, the ids of the blocks of a blob must have the same length
+func (u azureUpload) blockID(partNumber int64) string {
+	return base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s-%05d", u.id, partNumber)))
+}
+
+// Initiate a multipart upload, the parts are uncommitted blocks of the blob until the completion
+// SSE-C is not supported : the customer key would be required by the completion
+func (b *AzureBackend) CreateMultipartUpload(object BucketObject) (string, error) {
+	if object.Encryption.Mode == EncryptionSSEC {
+		return "", awserr.New(ErrCodeInvalidEncryption, "SSE-C is not supported by the multipart uploads of the Azure backend", nil)
+	}
+
+	_, scope, err := azureEncryption(object.Encryption)
+	if err != nil {
+		return "", err
+	}
+
+	container, _ := azureBlob(object)
+
+	response, err := b.send("HEAD", container, "", url.Values{"restype": {"container"}}, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	response.Body.Close()
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+
+	return azureUpload{id: hex.EncodeToString(id), tier: azureTier(object.StorageClass), scope: scope}.String(), nil
+}
+
+// Create a SAS URL for the upload of a part with Put Block
+func (b *AzureBackend) CreatePresignedURLForUploadPart(object BucketObject, uploadID string, partNumber int64, expire time.Duration) (*PresignedURL, error) {
+	upload, err := parseAzureUpload(uploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	container, blob := azureBlob(object)
+
+	query := b.sasQuery(container, blob, azureSAS{permissions: "w", expiry: time.Now().Add(expire), encryptionScope: upload.scope})
+	query.Set("comp", "block")
+	query.Set("blockid", upload.blockID(partNumber))
+
+	return &PresignedURL{URL: b.blobURL(container, blob) + "?" + query.Encode(), Headers: map[string]string{}}, nil
+}
+
+// Commit the blocks of the parts in ascending order with Put Block List
+// Azure does not return an ETag for the blocks, the ETags of the parts are ignored
+func (b *AzureBackend) CompleteMultipartUpload(object BucketObject, uploadID string, parts []CompletedPart) error {
+	upload, err := parseAzureUpload(uploadID)
+	if err != nil {
+		return err
+	}
+
+	blockIDs := make([]string, len(parts))
+
+	for index, part := range parts {
+		if index > 0 && part.PartNumber <= parts[index-1].PartNumber {
+			return awserr.New("InvalidPartOrder", "The list of parts was not in ascending order", nil)
+		}
+		blockIDs[index] = upload.blockID(part.PartNumber)
+	}
+
+	header := http.Header{"X-Ms-Access-Tier": {upload.tier}}
+	if upload.scope != "" {
+		header.Set("x-ms-encryption-scope", upload.scope)
+	}
+
+	container, blob := azureBlob(object)
+
+	_, err = b.putBlockList(container, blob, blockIDs, header)
+
+	return err
+}
+
+// The uncommitted blocks can not be deleted, Azure garbage collects them after 7 days
+func (b *AzureBackend) AbortMultipartUpload(object BucketObject, uploadID string) error {
+	_, err := parseAzureUpload(uploadID)
+	return err
+}
+
+// POST policies are not supported
+func (b *AzureBackend) CreatePresignedPost(object BucketObject, expire time.Duration, conditions PostConditions) (*PresignedPost, error) {
+	return nil, awserr.New("NotImplemented", "POST policies are not supported by the Azure backend", nil)
+}
+
+// Returns the content of a blob, the range and the conditional headers are sent to Azure
+func (b *AzureBackend) GetObject(object BucketObject, options GetOptions) (*ObjectContent, error) {
+	header, _, err := azureEncryption(object.Encryption)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.Range != "" {
+		header.Set("Range", options.Range)
+	}
+	if options.IfNoneMatch != "" {
+		header.Set("If-None-Match", options.IfNoneMatch)
+	}
+	if !options.IfModifiedSince.IsZero() {
+		header.Set("If-Modified-Since", options.IfModifiedSince.UTC().Format(http.TimeFormat))
+	}
+
+	container, blob := azureBlob(object)
+
+	response, err := b.send("GET", container, blob, versionQuery(object), header, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ObjectContent{
+		ObjectInfo:   *azureObjectInfo(object.Key, response),
+		Body:         response.Body,
+		ContentRange: response.Header.Get("Content-Range"),
+	}, nil
+}
+
+// Upload the content of a blob, bodies larger than the part size are sent in blocks of this size
+func (b *AzureBackend) PutObject(object BucketObject, body io.Reader, options PutOptions) (string, error) {
+	cpk, scope, err := azureEncryption(object.Encryption)
+	if err != nil {
+		return "", err
+	}
+
+	header := cpk.Clone()
+	header.Set("x-ms-access-tier", azureTier(object.StorageClass))
+	if scope != "" {
+		header.Set("x-ms-encryption-scope", scope)
+	}
+	for name, value := range options.Metadata {
+		header.Set("x-ms-meta-"+name, value)
+	}
+
+	blockSize := options.PartSize
+	if blockSize <= 0 {
+		blockSize = azureBlockSize
+	}
+
+	container, blob := azureBlob(object)
+
+	block := make([]byte, blockSize)
+
+	size, err := io.ReadFull(body, block)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		// the body fits in a single block
+		header.Set("x-ms-blob-type", "BlockBlob")
+		if options.ContentType != "" {
+			header.Set("Content-Type", options.ContentType)
+		}
+
+		response, err := b.send("PUT", container, blob, nil, header, block[:size])
+		if err != nil {
+			return "", err
+		}
+		response.Body.Close()
+
+		return response.Header.Get("ETag"), nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	upload := azureUpload{id: hex.EncodeToString(id)}
+
+	var blockIDs []string
+
+	for partNumber := int64(1); size > 0; partNumber++ {
+		blockID := upload.blockID(partNumber)
+
+		response, err := b.send("PUT", container, blob, url.Values{"comp": {"block"}, "blockid": {blockID}}, cpk.Clone(), block[:size])
+		if err != nil {
+			return "", err
+		}
+		response.Body.Close()
+
+		blockIDs = append(blockIDs, blockID)
+
+		if size, err = io.ReadFull(body, block); err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return "", err
+		}
+	}
+
+	if options.ContentType != "" {
+		header.Set("x-ms-blob-content-type", options.ContentType)
+	}
+
+	return b.putBlockList(container, blob, blockIDs, header)
+}
+
+// commit a list of blocks and returns the ETag of the blob
+func (b *AzureBackend) putBlockList(container string, blob string, blockIDs []string, header http.Header) (string, error) {
+	response, err := b.send("PUT", container, blob, url.Values{"comp": {"blocklist"}}, header, azureBlockList(blockIDs))
+	if err != nil {
+		return "", err
+	}
+	response.Body.Close()
+
+	return response.Header.Get("ETag"), nil
+}
+
+// XML body of a Put Block List
+func azureBlockList(blockIDs []string) []byte {
+	var body bytes.Buffer
+
+	body.WriteString(xml.Header + "<BlockList>")
+	for _, blockID := range blockIDs {
+		body.WriteString("<Latest>" + blockID + "</Latest>")
+	}
+	body.WriteString("</BlockList>")
+
+	return body.Bytes()
+}
+
+type azureTag struct {
+	Key   string `xml:"Key"`
+	Value string `xml:"Value"`
+}
+
+// XML body of the blob tags
+type azureTags struct {
+	XMLName xml.Name `xml:"Tags"`
+	TagSet  struct {
+		Tags []azureTag `xml:"Tag"`
+	} `xml:"TagSet"`
+}
+
+// Returns the tags of a blob
+func (b *AzureBackend) GetObjectTagging(object BucketObject) (map[string]string, error) {
+	container, blob := azureBlob(object)
+
+	query := versionQuery(object)
+	query.Set("comp", "tags")
+
+	var tags azureTags
+	if err := b.sendXML("GET", container, blob, query, nil, nil, &tags); err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]string, len(tags.TagSet.Tags))
+	for _, tag := range tags.TagSet.Tags {
+		result[tag.Key] = tag.Value
+	}
+
+	return result, nil
+}
+
+// Replace the tags of a blob
+func (b *AzureBackend) PutObjectTagging(object BucketObject, tags map[string]string) error {
+	var body azureTags
+
+	for key, value := range tags {
+		body.TagSet.Tags = append(body.TagSet.Tags, azureTag{Key: key, Value: value})
+	}
+
+	data, err := xml.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	container, blob := azureBlob(object)
+
+	query := versionQuery(object)
+	query.Set("comp", "tags")
+
+	response, err := b.send("PUT", container, blob, query, http.Header{"Content-Type": {"application/xml"}}, data)
+	if err != nil {
+		return err
+	}
+	return response.Body.Close()
+}
+
+// Remove the tags of a blob
+func (b *AzureBackend) DeleteObjectTagging(object BucketObject) error {
+	return b.PutObjectTagging(object, nil)
+}
+
+// Returns one page of the versions of the blobs of a container (include=versions), Azure has no delete markers
+func (b *AzureBackend) ListObjectVersions(bucketName string, options ListOptions) (*VersionListing, error) {
+	results, err := b.listBlobs(bucketName, options, "versions")
+	if err != nil {
+		return nil, err
+	}
+
+	listing := &VersionListing{
+		Versions:              make([]ObjectVersion, len(results.Blobs)),
+		CommonPrefixes:        make([]string, len(results.BlobPrefixes)),
+		IsTruncated:           results.NextMarker != "",
+		NextContinuationToken: results.NextMarker,
+	}
+
+	for index, blob := range results.Blobs {
+		info := blob.objectInfo()
+		info.VersionID = blob.VersionID
+		listing.Versions[index] = ObjectVersion{ObjectInfo: info, IsLatest: blob.IsCurrentVersion || blob.VersionID == ""}
+	}
+
+	for index, prefix := range results.BlobPrefixes {
+		listing.CommonPrefixes[index] = prefix.Name
+	}
+
+	return listing, nil
+}
+
+// Returns the immutability policy of a blob as an Object Lock retention : an unlocked policy is a GOVERNANCE retention, a locked policy a COMPLIANCE retention
+func (b *AzureBackend) GetObjectRetention(object BucketObject) (*ObjectRetention, error) {
+	container, blob := azureBlob(object)
+
+	response, err := b.send("HEAD", container, blob, versionQuery(object), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	response.Body.Close()
+
+	return azureRetention(response.Header), nil
+}
+
+func azureRetention(header http.Header) *ObjectRetention {
+	retention := &ObjectRetention{}
+
+	if date, err := http.ParseTime(header.Get("x-ms-immutability-policy-until-date")); err == nil {
+		retention.RetainUntilDate = &date
+		retention.Mode = ObjectLockModeGovernance
+		if strings.EqualFold(header.Get("x-ms-immutability-policy-mode"), azurePolicyLocked) {
+			retention.Mode = ObjectLockModeCompliance
+		}
+	}
+
+	return retention
+}
+
+// Set or remove the immutability policy of a blob
+// Azure allows to shorten an unlocked policy, bypassGovernance is required to do it as on S3
+func (b *AzureBackend) PutObjectRetention(object BucketObject, retention ObjectRetention, bypassGovernance bool) error {
+	current, err := b.GetObjectRetention(object)
+	if err != nil {
+		return err
+	}
+
+	shortened := current.RetainUntilDate != nil && current.RetainUntilDate.After(time.Now()) &&
+		(retention.RetainUntilDate == nil || retention.RetainUntilDate.Before(*current.RetainUntilDate))
+
+	switch {
+	case shortened && current.Mode == ObjectLockModeCompliance:
+		return awserr.New("AccessDenied", "Access Denied because the COMPLIANCE retention can not be shortened or removed", nil)
+	case shortened && !bypassGovernance:
+		return awserr.New("AccessDenied", "Access Denied because the GOVERNANCE retention can only be shortened or removed with the bypass", nil)
+	}
+
+	container, blob := azureBlob(object)
+
+	query := versionQuery(object)
+	query.Set("comp", "immutabilityPolicies")
+
+	var response *http.Response
+
+	if retention.RetainUntilDate == nil {
+		response, err = b.send("DELETE", container, blob, query, nil, nil)
+	} else {
+		mode := azurePolicyUnlocked
+		if retention.Mode == ObjectLockModeCompliance {
+			mode = azurePolicyLocked
+		}
+
+		response, err = b.send("PUT", container, blob, query, http.Header{
+			"X-Ms-Immutability-Policy-Until-Date": {retention.RetainUntilDate.UTC().Format(http.TimeFormat)},
+			"X-Ms-Immutability-Policy-Mode":       {mode},
+		}, nil)
+	}
+	if err != nil {
+		return err
+	}
+
+	return response.Body.Close()
+}
+
+// Returns the legal hold of a blob
+func (b *AzureBackend) GetObjectLegalHold(object BucketObject) (bool, error) {
+	container, blob := azureBlob(object)
+
+	response, err := b.send("HEAD", container, blob, versionQuery(object), nil, nil)
+	if err != nil {
+		return false, err
+	}
+	response.Body.Close()
+
+	return response.Header.Get("x-ms-legal-hold") == "true", nil
+}
+
+// Set or remove the legal hold of a blob
+func (b *AzureBackend) PutObjectLegalHold(object BucketObject, legalHold bool) error {
+	container, blob := azureBlob(object)
+
+	query := versionQuery(object)
+	query.Set("comp", "legalhold")
+
+	response, err := b.send("PUT", container, blob, query, http.Header{"X-Ms-Legal-Hold": {strconv.FormatBool(legalHold)}}, nil)
+	if err != nil {
+		return err
+	}
+
+	return response.Body.Close()
+}
+
+// Rehydrate an archived blob to the Hot tier, the Expedited tier is the High rehydrate priority
+// The rehydration is permanent : the number of days is ignored and a rehydrated blob is no longer archived
+func (b *AzureBackend) RestoreObject(object BucketObject, options RestoreOptions) (bool, error) {
+	info, err := b.StatObject(object)
+	if err != nil {
+		return false, err
+	}
+
+	switch {
+	case info.Restore != nil && info.Restore.InProgress:
+		return false, awserr.New("RestoreAlreadyInProgress", "Object restore is already in progress", nil)
+	case !info.IsArchived():
+		return false, awserr.New("InvalidObjectState", "Restore is not allowed for the object's current storage class", nil)
+	}
+
+	priority := "Standard"
+	if options.Tier == s3.TierExpedited {
+		priority = "High"
+	}
+
+	container, blob := azureBlob(object)
+
+	query := versionQuery(object)
+	query.Set("comp", "tier")
+
+	response, err := b.send("PUT", container, blob, query, http.Header{
+		"X-Ms-Access-Tier":        {azureTierHot},
+		"X-Ms-Rehydrate-Priority": {priority},
+	}, nil)
+	if err != nil {
+		return false, err
+	}
+	response.Body.Close()
+
+	return true, nil
+}
+
+// container and normalized blob name of an object
+func azureBlob(object BucketObject) (string, string) {
+	return object.BucketName, strings.TrimPrefix(object.Key, "/")
+}
+
+// URL of a blob, or of a container when the blob is empty
+func (b *AzureBackend) blobURL(container string, blob string) string {
+	resource := "/" + container
+	if blob != "" {
+		resource += "/" + blob
+	}
+	return b.config.Endpoint + (&url.URL{Path: resource}).EscapedPath()
+}
+
+// query parameter of the version of an object
+func versionQuery(object BucketObject) url.Values {
+	query := make(url.Values)
+	if object.VersionID != "" {
+		query.Set("versionid", object.VersionID)
+	}
+	return query
+}
+
+// send a request authorized with the account key, an error response is converted to an error with an S3 error code
+func (b *AzureBackend) send(method string, container string, blob string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	rawURL := b.blobURL(container, blob)
+	if len(query) > 0 {
+		rawURL += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest(method, rawURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	for name, values := range header {
+		req.Header[http.CanonicalHeaderKey(name)] = values
+	}
+	req.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+	req.Header.Set("x-ms-version", azureAPIVersion)
+
+	if len(body) > 0 {
+		req.ContentLength = int64(len(body))
+		req.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	} else {
+		req.Body = http.NoBody
+		req.ContentLength = 0
+	}
+
+	b.signRequest(req)
+
+	response, err := b.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode >= http.StatusMultipleChoices {
+		defer response.Body.Close()
+		return nil, azureResponseError(response)
+	}
+
+	return response, nil
+}
+
+// send a request and decode its XML response
+func (b *AzureBackend) sendXML(method string, container string, blob string, query url.Values, header http.Header, body []byte, result interface{}) error {
+	response, err := b.send(method, container, blob, query, header, body)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	return xml.NewDecoder(response.Body).Decode(result)
+}
+
+// convert an Azure error response to an error with the S3 error code of the same error, the router only knows the S3 codes
+// the response of a HEAD request has no body, the Azure error code is also returned in the x-ms-error-code header
+func azureResponseError(response *http.Response) error {
+	var azureErr struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+
+	data, _ := io.ReadAll(io.LimitReader(response.Body, 64*1024))
+	_ = xml.Unmarshal(data, &azureErr)
+
+	if azureErr.Code == "" {
+		azureErr.Code = response.Header.Get("x-ms-error-code")
+	}
+	if azureErr.Message == "" {
+		azureErr.Message = http.StatusText(response.StatusCode)
+	}
+
+	origErr := fmt.Errorf("azure %s : %s", azureErr.Code, strings.TrimSpace(azureErr.Message))
+
+	var code, message string
+
+	switch {
+	case response.StatusCode == http.StatusNotModified:
+		code, message = "NotModified", "Not Modified"
+	case response.StatusCode == http.StatusRequestedRangeNotSatisfiable || azureErr.Code == "InvalidRange":
+		code, message = "InvalidRange", "The requested range is not satisfiable"
+	case azureErr.Code == "ContainerNotFound":
+		code, message = s3.ErrCodeNoSuchBucket, "The specified bucket does not exist"
+	case azureErr.Code == "BlobNotFound", response.StatusCode == http.StatusNotFound && azureErr.Code == "",
+		// Copy Blob from a missing source
+		response.StatusCode == http.StatusNotFound && azureErr.Code == "CannotVerifyCopySource":
+		code, message = s3.ErrCodeNoSuchKey, "The specified key does not exist"
+	case azureErr.Code == "BlobImmutableDueToPolicy", azureErr.Code == "BlobImmutableDueToLegalHold":
+		code, message = "AccessDenied", "Access Denied because object protected by object lock"
+	case azureErr.Code == "BlobArchived":
+		code, message = "InvalidObjectState", "The operation is not valid for the object's storage class"
+	case azureErr.Code == "BlobBeingRehydrated":
+		code, message = "RestoreAlreadyInProgress", "Object restore is already in progress"
+	case azureErr.Code == "InvalidBlockList", azureErr.Code == "InvalidBlockId":
+		code, message = "InvalidPart", "One or more of the specified parts could not be found"
+	case azureErr.Code == "Md5Mismatch":
+		code, message = "BadDigest", "The Content-MD5 you specified did not match what we received"
+	case strings.Contains(azureErr.Code, "Immutab") || strings.Contains(azureErr.Code, "Worm"):
+		code, message = "InvalidRequest", "Object Lock is not enabled on the container : "+azureErr.Message
+	case response.StatusCode == http.StatusForbidden:
+		code, message = "AccessDenied", "Access Denied"
+	case response.StatusCode == http.StatusBadRequest:
+		code, message = "InvalidArgument", azureErr.Message
+	default:
+		code, message = azureErr.Code, azureErr.Message
+	}
+
+	return awserr.NewRequestFailure(awserr.New(code, message, origErr), response.StatusCode, response.Header.Get("x-ms-request-id"))
+}
+
+// metadata of a blob from the headers of a HEAD or a GET
+func azureObjectInfo(key string, response *http.Response) *ObjectInfo {
+	header := response.Header
+
+	info := &ObjectInfo{
+		Key:         key,
+		Size:        response.ContentLength,
+		ETag:        header.Get("ETag"),
+		ContentType: header.Get("Content-Type"),
+		Metadata:    map[string]string{},
+		VersionID:   header.Get("x-ms-version-id"),
+	}
+
+	if lastModified, err := http.ParseTime(header.Get("Last-Modified")); err == nil {
+		info.LastModified = lastModified
+	}
+
+	for name := range header {
+		if metadataName, found := strings.CutPrefix(strings.ToLower(name), "x-ms-meta-"); found {
+			info.Metadata[metadataName] = header.Get(name)
+		}
+	}
+
+	info.StorageClass, info.Restore = azureStorageClass(header.Get("x-ms-access-tier"), header.Get("x-ms-archive-status"))
+
+	return info
+}
+
+// metadata of a blob of a listing, Azure returns the ETags without quotes
+func (blob azureBlobItem) objectInfo() ObjectInfo {
+	info := ObjectInfo{
+		Key:         blob.Name,
+		Size:        blob.Properties.ContentLength,
+		ETag:        fmt.Sprintf("%q", strings.Trim(blob.Properties.ETag, `"`)),
+		ContentType: blob.Properties.ContentType,
+	}
+
+	if date, err := http.ParseTime(blob.Properties.LastModified); err == nil {
+		info.LastModified = date
+	}
+
+	info.StorageClass, info.Restore = azureStorageClass(blob.Properties.AccessTier, blob.Properties.ArchiveStatus)
+
+	return info
+}
+
+// access tier of a storage class, the classes without equivalent tier are stored in the Hot tier
+func azureTier(storageClass string) string {
+	switch storageClass {
+	case s3.StorageClassStandardIa, s3.StorageClassOnezoneIa:
+		return azureTierCool
+	case s3.StorageClassGlacierIr:
+		return azureTierCold
+	case StorageClassGlacier, StorageClassDeepArchive:
+		return azureTierArchive
+	default:
+		return azureTierHot
+	}
+}
+
+// storage class of an access tier, an archived blob being rehydrated has a restore in progress
+func azureStorageClass(tier string, archiveStatus string) (string, *RestoreStatus) {
+	var restore *RestoreStatus
+	if strings.HasPrefix(archiveStatus, "rehydrate-pending-") {
+		restore = &RestoreStatus{InProgress: true}
+	}
+
+	switch tier {
+	case azureTierCool:
+		return s3.StorageClassStandardIa, restore
+	case azureTierCold:
+		return s3.StorageClassGlacierIr, restore
+	case azureTierArchive:
+		return StorageClassGlacier, restore
+	default:
+		return s3.StorageClassStandard, restore
+	}
+}
+
+// Azure headers and encryption scope of an encryption : SSE-S3 is the default encryption of Azure, SSE-C is a customer-provided key
+// and SSE-KMS is an encryption scope of the storage account named by the KMS key id
+func azureEncryption(encryption Encryption) (http.Header, string, error) {
+	header := make(http.Header)
+
+	switch encryption.Mode {
+	case "", EncryptionSSES3:
+		return header, "", nil
+	case EncryptionSSEKMS:
+		if encryption.KMSKeyID == "" {
+			return nil, "", awserr.New(ErrCodeInvalidEncryption, "SSE-KMS requires the name of an encryption scope as KMS key id on Azure", nil)
+		}
+		return header, encryption.KMSKeyID, nil
+	case EncryptionSSEC:
+		key, err := base64.StdEncoding.DecodeString(encryption.CustomerKey)
+		if err != nil || len(key) != customerKeySize {
+			return nil, "", awserr.New(ErrCodeInvalidEncryption, "SSE-C requires a base64 encoded 256 bits customer key", err)
+		}
+		digest := sha256.Sum256(key)
+
+		header.Set("x-ms-encryption-key", encryption.CustomerKey)
+		header.Set("x-ms-encryption-key-sha256", base64.StdEncoding.EncodeToString(digest[:]))
+		header.Set("x-ms-encryption-algorithm", "AES256")
+		return header, "", nil
+	default:
+		return nil, "", awserr.New(ErrCodeInvalidEncryption, fmt.Sprintf("unknown encryption mode %q", encryption.Mode), nil)
+	}
+}
+
+// S3 code of an error, empty if the error has no code
+func errorCode(err error) string {
+	if err, ok := err.(awserr.Error); ok {
+		return err.Code()
+	}
+	return ""
+}
@@ -0,0 +1,828 @@
+package backend
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// account of the Azurite emulator
+const (
+	azureTestAccount = "devstoreaccount1"
+	azureTestKey     = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw=="
+)
+
+type fakeBlob struct {
+	content       []byte
+	contentType   string
+	metadata      map[string]string
+	tags          map[string]string
+	tier          string
+	archiveStatus string
+	legalHold     bool
+	policyUntil   string
+	policyMode    string
+	lastModified  time.Time
+	etag          string
+}
+
+// Minimal Blob service checking the Shared Key and SAS signatures, the copies are pending until the first status check
+// or until they are aborted when stuckCopies is set
+type fakeAzureServer struct {
+	signer *AzureBackend
+
+	mutex       sync.Mutex
+	containers  map[string]map[string]*fakeBlob
+	blocks      map[string][]byte
+	pending     map[string]bool
+	stuckCopies bool
+	aborted     []string
+	etags       int
+}
+
+func (s *fakeAzureServer) error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("x-ms-error-code", code)
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>fake %s</Message></Error>", code, code)
+}
+
+// check the signature of a request, a request with a sig parameter is authorized by a SAS
+func (s *fakeAzureServer) authorized(r *http.Request, container string, blob string) bool {
+	query := r.URL.Query()
+
+	if query.Has("sig") {
+		return s.validSAS(query, container, blob, "")
+	}
+
+	signed := r.Clone(r.Context())
+	signed.Header.Del("Authorization")
+	if r.ContentLength > 0 {
+		signed.Header.Set("Content-Length", strconv.FormatInt(r.ContentLength, 10))
+	}
+	s.signer.signRequest(signed)
+
+	return r.Header.Get("Authorization") == signed.Header.Get("Authorization")
+}
+
+// check the signature, the expiry and the permissions of a SAS
+func (s *fakeAzureServer) validSAS(query url.Values, container string, blob string, permission string) bool {
+	expiry, err := time.Parse(time.RFC3339, query.Get("se"))
+	if err != nil || time.Now().After(expiry) {
+		return false
+	}
+	if permission != "" && !strings.Contains(query.Get("sp"), permission) {
+		return false
+	}
+
+	expected := s.signer.sasQuery(container, blob, azureSAS{
+		permissions:     query.Get("sp"),
+		expiry:          expiry,
+		versionID:       query.Get("versionid"),
+		encryptionScope: query.Get("ses"),
+		headers: ResponseHeaders{
+			ContentDisposition: query.Get("rscd"),
+			ContentType:        query.Get("rsct"),
+			CacheControl:       query.Get("rscc"),
+			ContentLanguage:    query.Get("rscl"),
+		},
+	})
+
+	return query.Get("sig") == expected.Get("sig")
+}
+
+func (s *fakeAzureServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	resource, found := strings.CutPrefix(r.URL.Path, "/"+azureTestAccount+"/")
+	if !found {
+		s.error(w, http.StatusBadRequest, "InvalidUri")
+		return
+	}
+	containerName, blobName, _ := strings.Cut(resource, "/")
+	query := r.URL.Query()
+
+	if !s.authorized(r, containerName, blobName) {
+		s.error(w, http.StatusForbidden, "AuthenticationFailed")
+		return
+	}
+
+	container, ok := s.containers[containerName]
+	if !ok {
+		s.error(w, http.StatusNotFound, "ContainerNotFound")
+		return
+	}
+
+	if blobName == "" {
+		switch {
+		case r.Method == http.MethodHead:
+			w.WriteHeader(http.StatusOK)
+		case r.Method == http.MethodGet && query.Get("comp") == "list":
+			s.list(w, container, query)
+		default:
+			s.error(w, http.StatusBadRequest, "UnsupportedHttpVerb")
+		}
+		return
+	}
+
+	blob := container[blobName]
+
+	switch {
+	case r.Method == http.MethodPut && query.Get("comp") == "block":
+		data, _ := io.ReadAll(r.Body)
+		s.blocks[containerName+"/"+blobName+"/"+query.Get("blockid")] = data
+		w.WriteHeader(http.StatusCreated)
+
+	case r.Method == http.MethodPut && query.Get("comp") == "blocklist":
+		var body struct {
+			Latest []string `xml:"Latest"`
+		}
+		data, _ := io.ReadAll(r.Body)
+		if err := xml.Unmarshal(data, &body); err != nil {
+			s.error(w, http.StatusBadRequest, "InvalidXmlDocument")
+			return
+		}
+
+		var content []byte
+		for _, blockID := range body.Latest {
+			block, ok := s.blocks[containerName+"/"+blobName+"/"+blockID]
+			if !ok {
+				s.error(w, http.StatusBadRequest, "InvalidBlockList")
+				return
+			}
+			content = append(content, block...)
+		}
+
+		s.put(w, r, container, blobName, content, r.Header.Get("x-ms-blob-content-type"))
+
+	case r.Method == http.MethodPut && query.Get("comp") == "copy" && r.Header.Get("x-ms-copy-action") == "abort":
+		if !s.pending[containerName+"/"+blobName] || query.Get("copyid") != "copy-1" {
+			s.error(w, http.StatusConflict, "NoPendingCopyOperation")
+			return
+		}
+		delete(s.pending, containerName+"/"+blobName)
+		blob.content = nil
+		s.aborted = append(s.aborted, containerName+"/"+blobName)
+		w.WriteHeader(http.StatusNoContent)
+
+	case r.Method == http.MethodPut && r.Header.Get("x-ms-copy-source") != "":
+		source, err := url.Parse(r.Header.Get("x-ms-copy-source"))
+		if err != nil {
+			s.error(w, http.StatusBadRequest, "InvalidHeaderValue")
+			return
+		}
+		sourceContainer, sourceBlob, _ := strings.Cut(strings.TrimPrefix(source.Path, "/"+azureTestAccount+"/"), "/")
+		if !s.validSAS(source.Query(), sourceContainer, sourceBlob, "r") {
+			s.error(w, http.StatusForbidden, "CannotVerifyCopySource")
+			return
+		}
+		// Azure answers CannotVerifyCopySource for a missing source
+		copied, ok := s.containers[sourceContainer][sourceBlob]
+		if !ok {
+			s.error(w, http.StatusNotFound, "CannotVerifyCopySource")
+			return
+		}
+
+		s.pending[containerName+"/"+blobName] = true
+		w.Header().Set("x-ms-copy-id", "copy-1")
+		w.Header().Set("x-ms-copy-status", "pending")
+		s.put(w, r, container, blobName, copied.content, copied.contentType)
+
+	case r.Method == http.MethodPut && query.Get("comp") == "":
+		if r.Header.Get("x-ms-blob-type") != "BlockBlob" {
+			s.error(w, http.StatusBadRequest, "MissingRequiredHeader")
+			return
+		}
+		content, _ := io.ReadAll(r.Body)
+		if contentMD5 := r.Header.Get("Content-MD5"); contentMD5 != "" {
+			digest := md5.Sum(content)
+			if base64.StdEncoding.EncodeToString(digest[:]) != contentMD5 {
+				s.error(w, http.StatusBadRequest, "Md5Mismatch")
+				return
+			}
+		}
+		s.put(w, r, container, blobName, content, r.Header.Get("Content-Type"))
+
+	case blob == nil:
+		s.error(w, http.StatusNotFound, "BlobNotFound")
+
+	case r.Method == http.MethodHead:
+		s.writeProperties(w, containerName+"/"+blobName, blob)
+		w.Header().Set("Content-Length", strconv.Itoa(len(blob.content)))
+		w.WriteHeader(http.StatusOK)
+
+	case r.Method == http.MethodGet && query.Get("comp") == "tags":
+		var tags azureTags
+		for key, value := range blob.tags {
+			tags.TagSet.Tags = append(tags.TagSet.Tags, azureTag{Key: key, Value: value})
+		}
+		data, _ := xml.Marshal(tags)
+		w.Write(data)
+
+	case r.Method == http.MethodGet:
+		if r.Header.Get("If-None-Match") == blob.etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		if blob.tier == azureTierArchive {
+			s.error(w, http.StatusConflict, "BlobArchived")
+			return
+		}
+		s.writeProperties(w, containerName+"/"+blobName, blob)
+		content, status := blob.content, http.StatusOK
+		if r.Header.Get("Range") != "" {
+			var start, end int
+			fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end)
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(content)))
+			content, status = content[start:end+1], http.StatusPartialContent
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.WriteHeader(status)
+		w.Write(content)
+
+	case r.Method == http.MethodPut && query.Get("comp") == "tags":
+		var tags azureTags
+		data, _ := io.ReadAll(r.Body)
+		if err := xml.Unmarshal(data, &tags); err != nil {
+			s.error(w, http.StatusBadRequest, "InvalidXmlDocument")
+			return
+		}
+		blob.tags = make(map[string]string)
+		for _, tag := range tags.TagSet.Tags {
+			blob.tags[tag.Key] = tag.Value
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case r.Method == http.MethodPut && query.Get("comp") == "legalhold":
+		blob.legalHold = r.Header.Get("x-ms-legal-hold") == "true"
+		w.WriteHeader(http.StatusOK)
+
+	case r.Method == http.MethodPut && query.Get("comp") == "immutabilityPolicies":
+		blob.policyUntil = r.Header.Get("x-ms-immutability-policy-until-date")
+		blob.policyMode = r.Header.Get("x-ms-immutability-policy-mode")
+		w.WriteHeader(http.StatusOK)
+
+	case r.Method == http.MethodDelete && query.Get("comp") == "immutabilityPolicies":
+		blob.policyUntil, blob.policyMode = "", ""
+		w.WriteHeader(http.StatusOK)
+
+	case r.Method == http.MethodPut && query.Get("comp") == "tier":
+		blob.archiveStatus = "rehydrate-pending-to-" + strings.ToLower(r.Header.Get("x-ms-access-tier"))
+		w.WriteHeader(http.StatusAccepted)
+
+	case r.Method == http.MethodDelete:
+		if blob.legalHold {
+			s.error(w, http.StatusConflict, "BlobImmutableDueToLegalHold")
+			return
+		}
+		delete(container, blobName)
+		w.WriteHeader(http.StatusAccepted)
+
+	default:
+		s.error(w, http.StatusBadRequest, "UnsupportedHttpVerb")
+	}
+}
+
+func (s *fakeAzureServer) put(w http.ResponseWriter, r *http.Request, container map[string]*fakeBlob, name string, content []byte, contentType string) {
+	s.etags++
+
+	blob := &fakeBlob{
+		content:      content,
+		contentType:  contentType,
+		metadata:     make(map[string]string),
+		tier:         r.Header.Get("x-ms-access-tier"),
+		lastModified: time.Now().UTC(),
+		etag:         fmt.Sprintf(`"0x%d"`, s.etags),
+	}
+	for name := range r.Header {
+		if metadataName, found := strings.CutPrefix(strings.ToLower(name), "x-ms-meta-"); found {
+			blob.metadata[metadataName] = r.Header.Get(name)
+		}
+	}
+
+	container[name] = blob
+
+	w.Header().Set("ETag", blob.etag)
+	if r.Header.Get("x-ms-copy-source") != "" {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *fakeAzureServer) writeProperties(w http.ResponseWriter, name string, blob *fakeBlob) {
+	header := w.Header()
+	header.Set("ETag", blob.etag)
+	header.Set("Content-Type", blob.contentType)
+	header.Set("Last-Modified", blob.lastModified.Format(http.TimeFormat))
+	header.Set("x-ms-access-tier", blob.tier)
+	header.Set("x-ms-legal-hold", strconv.FormatBool(blob.legalHold))
+	for key, value := range blob.metadata {
+		header.Set("x-ms-meta-"+key, value)
+	}
+	if blob.archiveStatus != "" {
+		header.Set("x-ms-archive-status", blob.archiveStatus)
+	}
+	if blob.policyUntil != "" {
+		header.Set("x-ms-immutability-policy-until-date", blob.policyUntil)
+		header.Set("x-ms-immutability-policy-mode", strings.ToLower(blob.policyMode))
+	}
+
+	// the copy completes on the first status check
+	if s.pending[name] && s.stuckCopies {
+		header.Set("x-ms-copy-id", "copy-1")
+		header.Set("x-ms-copy-status", "pending")
+	} else if s.pending[name] {
+		header.Set("x-ms-copy-id", "copy-1")
+		header.Set("x-ms-copy-status", "success")
+		delete(s.pending, name)
+	}
+}
+
+func (s *fakeAzureServer) list(w http.ResponseWriter, container map[string]*fakeBlob, query url.Values) {
+	var names []string
+	for name := range container {
+		if strings.HasPrefix(name, query.Get("prefix")) && name > query.Get("marker") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	maxResults, _ := strconv.Atoi(query.Get("maxresults"))
+	delimiter := query.Get("delimiter")
+
+	var (
+		body     strings.Builder
+		count    int
+		previous string
+	)
+
+	body.WriteString("<EnumerationResults><Blobs>")
+
+	for _, name := range names {
+		if delimiter != "" {
+			if index := strings.Index(name[len(query.Get("prefix")):], delimiter); index >= 0 {
+				prefix := name[:len(query.Get("prefix"))+index+len(delimiter)]
+				if prefix != previous {
+					if count == maxResults {
+						break
+					}
+					fmt.Fprintf(&body, "<BlobPrefix><Name>%s</Name></BlobPrefix>", prefix)
+					previous = prefix
+					count++
+				}
+				continue
+			}
+		}
+		if count == maxResults {
+			fmt.Fprintf(&body, "</Blobs><NextMarker>%s</NextMarker></EnumerationResults>", previous)
+			w.Write([]byte(body.String()))
+			return
+		}
+
+		blob := container[name]
+		fmt.Fprintf(&body, "<Blob><Name>%s</Name>", name)
+		if query.Get("include") == "versions" {
+			body.WriteString("<VersionId>2024-01-01T00:00:00.0000000Z</VersionId><IsCurrentVersion>true</IsCurrentVersion>")
+		}
+		fmt.Fprintf(&body, "<Properties><Last-Modified>%s</Last-Modified><Etag>%s</Etag><Content-Length>%d</Content-Length><Content-Type>%s</Content-Type><AccessTier>%s</AccessTier></Properties></Blob>",
+			blob.lastModified.Format(http.TimeFormat), strings.Trim(blob.etag, `"`), len(blob.content), blob.contentType, blob.tier)
+		previous = name
+		count++
+	}
+
+	body.WriteString("</Blobs><NextMarker/></EnumerationResults>")
+	w.Write([]byte(body.String()))
+}
+
+func newTestAzureBackend(t *testing.T) (*AzureBackend, *fakeAzureServer) {
+	server := &fakeAzureServer{
+		containers: map[string]map[string]*fakeBlob{"mycontainer": {}},
+		blocks:     make(map[string][]byte),
+		pending:    make(map[string]bool),
+	}
+
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+
+	b, err := NewAzureBackend(AzureBackendConfig{Endpoint: httpServer.URL + "/" + azureTestAccount + "/", AccountName: azureTestAccount, AccountKey: azureTestKey})
+	require.NoError(t, err)
+
+	server.signer = b
+
+	azureCopyPollInterval = time.Millisecond
+
+	return b, server
+}
+
+func TestNewAzureBackend(t *testing.T) {
+	b, err := NewAzureBackend(AzureBackendConfig{AccountName: "myaccount", AccountKey: azureTestKey})
+	require.NoError(t, err)
+	assert.Equal(t, azureDefaultCopyTimeout, b.config.CopyTimeout)
+	assert.Equal(t, "https://myaccount.blob.core.windows.net", b.config.Endpoint)
+
+	_, err = NewAzureBackend(AzureBackendConfig{AccountName: "myaccount", AccountKey: "not base64"})
+	assert.Error(t, err)
+
+	_, err = NewAzureBackend(AzureBackendConfig{AccountKey: azureTestKey})
+	assert.Error(t, err)
+}
+
+func TestAzureCanonicalizedResource(t *testing.T) {
+	u, err := url.Parse("http://127.0.0.1:10000/devstoreaccount1/mycontainer/my%20blob?comp=list&restype=container&include=metadata&include=versions")
+	require.NoError(t, err)
+
+	assert.Equal(t, "/devstoreaccount1/devstoreaccount1/mycontainer/my%20blob\ncomp:list\ninclude:metadata,versions\nrestype:container",
+		azureCanonicalizedResource(azureTestAccount, u))
+
+	header := http.Header{"X-Ms-Version": {azureAPIVersion}, "X-Ms-Date": {"Fri, 26 Jun 2015 23:39:12 GMT"}, "Content-Type": {"text/plain"}}
+	assert.Equal(t, "x-ms-date:Fri, 26 Jun 2015 23:39:12 GMT\nx-ms-version:2021-12-02\n", azureCanonicalizedHeaders(header))
+
+	// examples of https://learn.microsoft.com/rest/api/storageservices/authorize-with-shared-key
+	for rawURL, expected := range map[string]string{
+		"https://myaccount.blob.core.windows.net/mycontainer?restype=container&comp=metadata":                                                         "/myaccount/mycontainer\ncomp:metadata\nrestype:container",
+		"https://myaccount.blob.core.windows.net/mycontainer?restype=container&comp=list&include=snapshots&include=metadata&include=uncommittedblobs": "/myaccount/mycontainer\ncomp:list\ninclude:metadata,snapshots,uncommittedblobs\nrestype:container",
+		"https://myaccount.blob.core.windows.net/mycontainer/folder/my%20blob.txt":                                                                    "/myaccount/mycontainer/folder/my%20blob.txt",
+	} {
+		u, err := url.Parse(rawURL)
+		require.NoError(t, err)
+		assert.Equal(t, expected, azureCanonicalizedResource("myaccount", u), rawURL)
+	}
+}
+
+func TestAzurePutGetObject(t *testing.T) {
+	b, _ := newTestAzureBackend(t)
+	object := BucketObject{BucketName: "mycontainer", Key: "/folder/my file.txt"}
+
+	etag, err := b.PutObject(object, strings.NewReader("hello world"), PutOptions{ContentType: "text/plain", Metadata: map[string]string{"tenant": "tenant1"}})
+	require.NoError(t, err)
+
+	info, err := b.StatObject(object)
+	require.NoError(t, err)
+	assert.Equal(t, int64(11), info.Size)
+	assert.Equal(t, etag, info.ETag)
+	assert.Equal(t, "text/plain", info.ContentType)
+	assert.Equal(t, map[string]string{"tenant": "tenant1"}, info.Metadata)
+	assert.Equal(t, "STANDARD", info.StorageClass)
+
+	content, err := b.GetObject(object, GetOptions{Range: "bytes=6-10"})
+	require.NoError(t, err)
+	data, err := io.ReadAll(content.Body)
+	require.NoError(t, err)
+	content.Body.Close()
+	assert.Equal(t, "world", string(data))
+	assert.Equal(t, "bytes 6-10/11", content.ContentRange)
+	assert.Equal(t, int64(5), content.Size)
+
+	_, err = b.GetObject(object, GetOptions{IfNoneMatch: etag})
+	assert.Equal(t, "NotModified", errorCode(err))
+
+	_, err = b.StatObject(BucketObject{BucketName: "mycontainer", Key: "/missing"})
+	assert.Equal(t, "NoSuchKey", errorCode(err))
+
+	_, err = b.GetObject(BucketObject{BucketName: "unknown", Key: "/file"}, GetOptions{})
+	assert.Equal(t, "NoSuchBucket", errorCode(err))
+
+	_, err = b.PutObject(BucketObject{BucketName: "mycontainer", Key: "/file", Encryption: Encryption{Mode: EncryptionSSEKMS}}, strings.NewReader(""), PutOptions{})
+	assert.Equal(t, ErrCodeInvalidEncryption, errorCode(err))
+
+	// a wrong account key is rejected by the signature check
+	other, err := NewAzureBackend(AzureBackendConfig{Endpoint: b.config.Endpoint, AccountName: azureTestAccount, AccountKey: base64.StdEncoding.EncodeToString([]byte("wrong key"))})
+	require.NoError(t, err)
+	_, err = other.StatObject(object)
+	assert.Equal(t, "AccessDenied", errorCode(err))
+}
+
+func TestAzurePutObjectBlocks(t *testing.T) {
+	b, server := newTestAzureBackend(t)
+	object := BucketObject{BucketName: "mycontainer", Key: "/big", StorageClass: "STANDARD_IA"}
+
+	_, err := b.PutObject(object, strings.NewReader("hello world"), PutOptions{ContentType: "text/plain", PartSize: 4})
+	require.NoError(t, err)
+
+	assert.Len(t, server.blocks, 3)
+
+	blob := server.containers["mycontainer"]["big"]
+	assert.Equal(t, "hello world", string(blob.content))
+	assert.Equal(t, "text/plain", blob.contentType)
+	assert.Equal(t, azureTierCool, blob.tier)
+}
+
+func TestAzurePresignedURLs(t *testing.T) {
+	b, server := newTestAzureBackend(t)
+	object := BucketObject{BucketName: "mycontainer", Key: "/folder/file.txt"}
+
+	presignedURL, err := b.CreatePresignedURLForUpload(object, time.Minute, UploadConstraints{
+		ContentType: "text/plain",
+		ContentMD5:  "XrY7u+Ae7tCTyyK7j1rNww==",
+		Metadata:    map[string]string{"tenant": "tenant1"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "tenant1", presignedURL.Headers["X-Ms-Meta-Tenant"])
+
+	upload := func(presignedURL *PresignedURL, content string) int {
+		req, err := http.NewRequest("PUT", presignedURL.URL, strings.NewReader(content))
+		require.NoError(t, err)
+		for name, value := range presignedURL.Headers {
+			req.Header.Set(name, value)
+		}
+		response, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		response.Body.Close()
+		return response.StatusCode
+	}
+
+	assert.Equal(t, http.StatusBadRequest, upload(presignedURL, "hello"))
+	assert.Equal(t, http.StatusCreated, upload(presignedURL, "hello world"))
+
+	info, err := b.StatObject(object)
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain", info.ContentType)
+	assert.Equal(t, map[string]string{"tenant": "tenant1"}, info.Metadata)
+
+	// the SAS signs the path
+	tampered := *presignedURL
+	tampered.URL = strings.Replace(presignedURL.URL, "file.txt", "other.txt", 1)
+	assert.Equal(t, http.StatusForbidden, upload(&tampered, "hello world"))
+
+	downloadURL, err := b.CreatePresignedURLForDownload(object, time.Minute, ResponseHeaders{ContentDisposition: "attachment"})
+	require.NoError(t, err)
+
+	u, err := url.Parse(downloadURL)
+	require.NoError(t, err)
+	assert.Equal(t, "/devstoreaccount1/mycontainer/folder/file.txt", u.Path)
+	assert.Equal(t, "r", u.Query().Get("sp"))
+	assert.Equal(t, "attachment", u.Query().Get("rscd"))
+	assert.True(t, server.validSAS(u.Query(), "mycontainer", "folder/file.txt", "r"))
+
+	response, err := http.Get(downloadURL)
+	require.NoError(t, err)
+	data, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	assert.Equal(t, "hello world", string(data))
+}
+
+func TestAzureCopyDeleteObject(t *testing.T) {
+	b, server := newTestAzureBackend(t)
+	source := BucketObject{BucketName: "mycontainer", Key: "/folder/file"}
+	destination := BucketObject{BucketName: "mycontainer", Key: "/copy/file", StorageClass: "GLACIER"}
+
+	_, err := b.PutObject(source, strings.NewReader("content"), PutOptions{ContentType: "text/plain"})
+	require.NoError(t, err)
+
+	require.NoError(t, b.CopyObject(source, destination))
+	assert.Empty(t, server.pending)
+
+	copied := server.containers["mycontainer"]["copy/file"]
+	assert.Equal(t, "content", string(copied.content))
+	assert.Equal(t, azureTierArchive, copied.tier)
+
+	assert.Equal(t, "NoSuchKey", errorCode(b.CopyObject(BucketObject{BucketName: "mycontainer", Key: "/missing"}, destination)))
+	assert.Equal(t, ErrCodeInvalidEncryption, errorCode(b.CopyObject(source, BucketObject{BucketName: "mycontainer", Key: "/sse-c", Encryption: Encryption{Mode: EncryptionSSEC}})))
+
+	require.NoError(t, b.PutObjectLegalHold(source, true))
+
+	err = b.BatchDeleteObjects([]BucketObject{source, destination, {BucketName: "mycontainer", Key: "/missing"}})
+	require.IsType(t, &LockedObjectsError{}, err)
+	assert.Equal(t, []string{"/folder/file"}, err.(*LockedObjectsError).Keys)
+
+	require.NoError(t, b.PutObjectLegalHold(source, false))
+	require.NoError(t, b.DeleteObject(source))
+
+	assert.Empty(t, server.containers["mycontainer"])
+}
+
+func TestAzureCopyObjectTimeout(t *testing.T) {
+	b, server := newTestAzureBackend(t)
+	source := BucketObject{BucketName: "mycontainer", Key: "/file"}
+
+	_, err := b.PutObject(source, strings.NewReader("content"), PutOptions{})
+	require.NoError(t, err)
+
+	b.config.CopyTimeout = 20 * time.Millisecond
+	server.stuckCopies = true
+
+	// the copy still pending after the timeout is aborted
+	err = b.CopyObject(source, BucketObject{BucketName: "mycontainer", Key: "/copy"})
+	assert.ErrorContains(t, err, "aborted")
+	assert.Equal(t, []string{"mycontainer/copy"}, server.aborted)
+	assert.Empty(t, server.pending)
+}
+
+func TestAzureListObjects(t *testing.T) {
+	b, _ := newTestAzureBackend(t)
+
+	for _, key := range []string{"a.txt", "folder/b.txt", "folder/sub/c.txt", "other/e.txt"} {
+		_, err := b.PutObject(BucketObject{BucketName: "mycontainer", Key: key}, strings.NewReader(key), PutOptions{})
+		require.NoError(t, err)
+	}
+
+	listing, err := b.ListObjects("mycontainer", ListOptions{Prefix: "folder/", Delimiter: "/"})
+	require.NoError(t, err)
+	require.Len(t, listing.Objects, 1)
+	assert.Equal(t, "folder/b.txt", listing.Objects[0].Key)
+	assert.Equal(t, int64(12), listing.Objects[0].Size)
+	assert.True(t, strings.HasPrefix(listing.Objects[0].ETag, `"0x`))
+	assert.Equal(t, []string{"folder/sub/"}, listing.CommonPrefixes)
+	assert.False(t, listing.IsTruncated)
+
+	listing, err = b.ListObjects("mycontainer", ListOptions{MaxKeys: 2})
+	require.NoError(t, err)
+	assert.Len(t, listing.Objects, 2)
+	assert.True(t, listing.IsTruncated)
+
+	listing, err = b.ListObjects("mycontainer", ListOptions{MaxKeys: 2, ContinuationToken: listing.NextContinuationToken})
+	require.NoError(t, err)
+	assert.Equal(t, "folder/sub/c.txt", listing.Objects[0].Key)
+
+	versions, err := b.ListObjectVersions("mycontainer", ListOptions{Prefix: "other/"})
+	require.NoError(t, err)
+	require.Len(t, versions.Versions, 1)
+	assert.True(t, versions.Versions[0].IsLatest)
+	assert.NotEmpty(t, versions.Versions[0].VersionID)
+
+	_, err = b.ListObjects("unknown", ListOptions{})
+	assert.Equal(t, "NoSuchBucket", errorCode(err))
+}
+
+func TestAzureMultipartUpload(t *testing.T) {
+	b, server := newTestAzureBackend(t)
+	object := BucketObject{BucketName: "mycontainer", Key: "/multipart", StorageClass: "GLACIER_IR"}
+
+	_, err := b.CreateMultipartUpload(BucketObject{BucketName: "unknown", Key: "/multipart"})
+	assert.Equal(t, "NoSuchBucket", errorCode(err))
+
+	uploadID, err := b.CreateMultipartUpload(object)
+	require.NoError(t, err)
+
+	for partNumber, content := range map[int64]string{1: "hello ", 2: "world"} {
+		partURL, err := b.CreatePresignedURLForUploadPart(object, uploadID, partNumber, time.Minute)
+		require.NoError(t, err)
+
+		req, err := http.NewRequest("PUT", partURL.URL, strings.NewReader(content))
+		require.NoError(t, err)
+		response, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		response.Body.Close()
+		require.Equal(t, http.StatusCreated, response.StatusCode)
+	}
+
+	err = b.CompleteMultipartUpload(object, uploadID, []CompletedPart{{PartNumber: 2}, {PartNumber: 1}})
+	assert.Equal(t, "InvalidPartOrder", errorCode(err))
+
+	err = b.CompleteMultipartUpload(object, uploadID, []CompletedPart{{PartNumber: 1}, {PartNumber: 3}})
+	assert.Equal(t, "InvalidPart", errorCode(err))
+
+	require.NoError(t, b.CompleteMultipartUpload(object, uploadID, []CompletedPart{{PartNumber: 1}, {PartNumber: 2}}))
+
+	blob := server.containers["mycontainer"]["multipart"]
+	assert.Equal(t, "hello world", string(blob.content))
+	assert.Equal(t, azureTierCold, blob.tier)
+
+	assert.NoError(t, b.AbortMultipartUpload(object, uploadID))
+	assert.Equal(t, "NoSuchUpload", errorCode(b.AbortMultipartUpload(object, "unknown")))
+}
+
+func TestAzureRetentionRestore(t *testing.T) {
+	b, _ := newTestAzureBackend(t)
+	object := BucketObject{BucketName: "mycontainer", Key: "/file"}
+
+	_, err := b.PutObject(object, strings.NewReader("content"), PutOptions{})
+	require.NoError(t, err)
+
+	retention, err := b.GetObjectRetention(object)
+	require.NoError(t, err)
+	assert.Equal(t, &ObjectRetention{}, retention)
+
+	until := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+	require.NoError(t, b.PutObjectRetention(object, ObjectRetention{Mode: ObjectLockModeGovernance, RetainUntilDate: &until}, false))
+
+	retention, err = b.GetObjectRetention(object)
+	require.NoError(t, err)
+	assert.Equal(t, ObjectLockModeGovernance, retention.Mode)
+	assert.True(t, until.Equal(*retention.RetainUntilDate))
+
+	assert.Equal(t, "AccessDenied", errorCode(b.PutObjectRetention(object, ObjectRetention{}, false)))
+	require.NoError(t, b.PutObjectRetention(object, ObjectRetention{}, true))
+
+	_, err = b.RestoreObject(object, RestoreOptions{Days: 1})
+	assert.Equal(t, "InvalidObjectState", errorCode(err))
+
+	archived := BucketObject{BucketName: "mycontainer", Key: "/archived", StorageClass: StorageClassDeepArchive}
+	_, err = b.PutObject(archived, strings.NewReader("content"), PutOptions{})
+	require.NoError(t, err)
+
+	_, err = b.GetObject(archived, GetOptions{})
+	assert.Equal(t, "InvalidObjectState", errorCode(err))
+
+	started, err := b.RestoreObject(archived, RestoreOptions{Days: 1, Tier: "Expedited"})
+	require.NoError(t, err)
+	assert.True(t, started)
+
+	info, err := b.StatObject(archived)
+	require.NoError(t, err)
+	assert.Equal(t, StorageClassGlacier, info.StorageClass)
+	assert.True(t, info.Restore.InProgress)
+
+	_, err = b.RestoreObject(archived, RestoreOptions{Days: 1})
+	assert.Equal(t, "RestoreAlreadyInProgress", errorCode(err))
+}
+
+func TestAzureTagging(t *testing.T) {
+	b, _ := newTestAzureBackend(t)
+	object := BucketObject{BucketName: "mycontainer", Key: "/file"}
+
+	_, err := b.PutObject(object, strings.NewReader("content"), PutOptions{})
+	require.NoError(t, err)
+
+	require.NoError(t, b.PutObjectTagging(object, map[string]string{"tenant": "tenant1"}))
+
+	tags, err := b.GetObjectTagging(object)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"tenant": "tenant1"}, tags)
+
+	require.NoError(t, b.DeleteObjectTagging(object))
+
+	tags, err = b.GetObjectTagging(object)
+	require.NoError(t, err)
+	assert.Empty(t, tags)
+}
+
+// HMAC-SHA256 of a string to sign as documented by Microsoft, independent of the signer
+func azureTestSignature(t *testing.T, stringToSign string) string {
+	key, err := base64.StdEncoding.DecodeString(azureTestKey)
+	require.NoError(t, err)
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(stringToSign))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Shared Key signature of a request, the string to sign is written as specified by Microsoft
+func TestAzureSharedKeySignature(t *testing.T) {
+	b, err := NewAzureBackend(AzureBackendConfig{AccountName: "myaccount", AccountKey: azureTestKey})
+	require.NoError(t, err)
+
+	req, err := http.NewRequest("PUT", "https://myaccount.blob.core.windows.net/mycontainer/myblob?comp=block&blockid=QUFBQQ%3D%3D", strings.NewReader("hello world"))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set("X-Ms-Date", "Fri, 26 Jun 2015 23:39:12 GMT")
+	req.Header.Set("X-Ms-Version", "2015-02-21")
+	req.Header.Set("X-Ms-Blob-Type", "BlockBlob")
+
+	b.signRequest(req)
+
+	stringToSign := "PUT\n\n\n11\n\ntext/plain\n\n\n\n\n\n\n" +
+		"x-ms-blob-type:BlockBlob\nx-ms-date:Fri, 26 Jun 2015 23:39:12 GMT\nx-ms-version:2015-02-21\n" +
+		"/myaccount/mycontainer/myblob\nblockid:QUFBQQ==\ncomp:block"
+	assert.Equal(t, "SharedKey myaccount:"+azureTestSignature(t, stringToSign), req.Header.Get("Authorization"))
+
+	// an empty body has an empty Content-Length since the version 2015-02-21
+	req, err = http.NewRequest("HEAD", "https://myaccount.blob.core.windows.net/mycontainer/myblob", nil)
+	require.NoError(t, err)
+	req.Header.Set("X-Ms-Date", "Fri, 26 Jun 2015 23:39:12 GMT")
+	req.Header.Set("X-Ms-Version", "2015-02-21")
+
+	b.signRequest(req)
+
+	stringToSign = "HEAD\n\n\n\n\n\n\n\n\n\n\n\nx-ms-date:Fri, 26 Jun 2015 23:39:12 GMT\nx-ms-version:2015-02-21\n/myaccount/mycontainer/myblob"
+	assert.Equal(t, "SharedKey myaccount:"+azureTestSignature(t, stringToSign), req.Header.Get("Authorization"))
+}
+
+// service SAS of a blob, the string to sign is written as specified by https://learn.microsoft.com/rest/api/storageservices/create-service-sas
+func TestAzureSASSignature(t *testing.T) {
+	b, err := NewAzureBackend(AzureBackendConfig{AccountName: "myaccount", AccountKey: azureTestKey})
+	require.NoError(t, err)
+
+	expiry := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	query := b.sasQuery("mycontainer", "folder/file.txt", azureSAS{permissions: "r", expiry: expiry, headers: ResponseHeaders{ContentDisposition: "attachment"}})
+
+	stringToSign := "r\n\n2023-01-02T03:04:05Z\n/blob/myaccount/mycontainer/folder/file.txt\n\n\n\n2021-12-02\nb\n\n\n\nattachment\n\n\n"
+	assert.Equal(t, azureTestSignature(t, stringToSign), query.Get("sig"))
+	assert.Equal(t, url.Values{
+		"sv": {"2021-12-02"}, "sp": {"r"}, "se": {"2023-01-02T03:04:05Z"}, "sr": {"b"}, "rscd": {"attachment"}, "sig": {query.Get("sig")},
+	}, query)
+
+	// the version id of a blob version is signed in place of the snapshot time
+	query = b.sasQuery("mycontainer", "file", azureSAS{permissions: "r", expiry: expiry, versionID: "2023-01-01T00:00:00.0000000Z", encryptionScope: "myscope"})
+
+	stringToSign = "r\n\n2023-01-02T03:04:05Z\n/blob/myaccount/mycontainer/file\n\n\n\n2021-12-02\nbv\n2023-01-01T00:00:00.0000000Z\nmyscope\n\n\n\n\n"
+	assert.Equal(t, azureTestSignature(t, stringToSign), query.Get("sig"))
+}
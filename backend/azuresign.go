@@ -0,0 +1,156 @@
+// Shared Key authorization and service SAS of the Azure Blob Storage backend
+
+package backend
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// version of the Azure Blob Storage REST API (cold tier, immutability policies, tags, versions)
+const azureAPIVersion = "2021-12-02"
+
+// HMAC-SHA256 of a string to sign with the account key, base64 encoded
+func (b *AzureBackend) hmac(stringToSign string) string {
+	mac := hmac.New(sha256.New, b.accountKey)
+	mac.Write([]byte(stringToSign))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// sign a request with the Shared Key scheme, the x-ms-date and x-ms-version headers must be set
+// https://learn.microsoft.com/rest/api/storageservices/authorize-with-shared-key
+func (b *AzureBackend) signRequest(req *http.Request) {
+	contentLength := ""
+	if req.ContentLength > 0 {
+		contentLength = req.Header.Get("Content-Length")
+		if contentLength == "" {
+			contentLength = strconv.FormatInt(req.ContentLength, 10)
+		}
+	}
+
+	stringToSign := strings.Join([]string{
+		req.Method,
+		req.Header.Get("Content-Encoding"),
+		req.Header.Get("Content-Language"),
+		contentLength,
+		req.Header.Get("Content-MD5"),
+		req.Header.Get("Content-Type"),
+		"", // Date, x-ms-date is used
+		req.Header.Get("If-Modified-Since"),
+		req.Header.Get("If-Match"),
+		req.Header.Get("If-None-Match"),
+		req.Header.Get("If-Unmodified-Since"),
+		req.Header.Get("Range"),
+		azureCanonicalizedHeaders(req.Header) + azureCanonicalizedResource(b.config.AccountName, req.URL),
+	}, "\n")
+
+	req.Header.Set("Authorization", "SharedKey "+b.config.AccountName+":"+b.hmac(stringToSign))
+}
+
+// x-ms-* headers sorted by name, one "name:value\n" per header
+func azureCanonicalizedHeaders(header http.Header) string {
+	var names []string
+	for name := range header {
+		if name = strings.ToLower(name); strings.HasPrefix(name, "x-ms-") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var result strings.Builder
+	for _, name := range names {
+		result.WriteString(name + ":" + strings.TrimSpace(header.Get(name)) + "\n")
+	}
+	return result.String()
+}
+
+// "/account/path" followed by the query parameters sorted by name, one "\nname:value1,value2" per parameter
+func azureCanonicalizedResource(account string, u *url.URL) string {
+	var result strings.Builder
+	result.WriteString("/" + account + u.EscapedPath())
+
+	query := u.Query()
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		values := append([]string(nil), query[name]...)
+		sort.Strings(values)
+		result.WriteString("\n" + strings.ToLower(name) + ":" + strings.Join(values, ","))
+	}
+	return result.String()
+}
+
+// parameters of a service SAS of a blob
+type azureSAS struct {
+	permissions     string
+	expiry          time.Time
+	versionID       string
+	encryptionScope string
+	headers         ResponseHeaders
+}
+
+// query parameters of a service SAS of a blob, the response headers are overridden by the rscc, rscd, rscl and rsct parameters
+// https://learn.microsoft.com/rest/api/storageservices/create-service-sas
+func (b *AzureBackend) sasQuery(container string, blob string, sas azureSAS) url.Values {
+	var (
+		expiry   = sas.expiry.UTC().Format(time.RFC3339)
+		resource = "b"
+	)
+
+	if sas.versionID != "" {
+		resource = "bv"
+	}
+
+	stringToSign := strings.Join([]string{
+		sas.permissions,
+		"", // start
+		expiry,
+		"/blob/" + b.config.AccountName + "/" + container + "/" + blob,
+		"", // stored access policy
+		"", // ip
+		"", // protocol
+		azureAPIVersion,
+		resource,
+		sas.versionID,
+		sas.encryptionScope,
+		sas.headers.CacheControl,
+		sas.headers.ContentDisposition,
+		"", // content encoding
+		sas.headers.ContentLanguage,
+		sas.headers.ContentType,
+	}, "\n")
+
+	query := url.Values{
+		"sv":  {azureAPIVersion},
+		"sp":  {sas.permissions},
+		"se":  {expiry},
+		"sr":  {resource},
+		"sig": {b.hmac(stringToSign)},
+	}
+
+	for name, value := range map[string]string{
+		"versionid": sas.versionID,
+		"ses":       sas.encryptionScope,
+		"rscc":      sas.headers.CacheControl,
+		"rscd":      sas.headers.ContentDisposition,
+		"rscl":      sas.headers.ContentLanguage,
+		"rsct":      sas.headers.ContentType,
+	} {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+
+	return query
+}
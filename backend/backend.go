@@ -2,39 +2,270 @@ package backend
 
 import (
 	"fmt"
+	"io"
+	"strings"
 	"time"
 )
 
 // Backend provides an interface for S3
 type Backend interface {
 	// CreatePresignedURLForUpload creates a presigned URL for uploading file to the bucket
-	CreatePresignedURLForUpload(object BucketObject, expire time.Duration) (string, error)
+	// the constraints are signed as headers, the client has to send the returned headers with the upload
+	CreatePresignedURLForUpload(object BucketObject, expire time.Duration, constraints UploadConstraints) (*PresignedURL, error)
 
 	// CreatePresignedURLForDownload creates a presigned URL for downloading file from the bucket
-	CreatePresignedURLForDownload(object BucketObject, expire time.Duration) (string, error)
+	// the response headers (Content-Disposition, Content-Type ...) returned by the download can be overridden, zero values are ignored
+	CreatePresignedURLForDownload(object BucketObject, expire time.Duration, headers ResponseHeaders) (string, error)
 
 	// DeleteObject delete an object in a bucket
+	// returns a *LockedObjectsError if the object is protected by Object Lock
 	DeleteObject(object BucketObject) error
 
 	// BatchDeleteObject delete an object in a bucket
+	// returns a *LockedObjectsError if some objects are protected by Object Lock
 	BatchDeleteObjects(objects []BucketObject) error
 
 	// CopyObject copies one item from a bucket to another
 	// sourceObject : source object (ex: mybucket and /folder/item)
 	// destinationObject : destination object (ex: mybucket and /folder/item2)
 	CopyObject(sourceObject BucketObject, destinationObject BucketObject) error
+
+	// StatObject returns the metadata of an object (size, etag, content type, user metadata ...)
+	StatObject(object BucketObject) (*ObjectInfo, error)
+
+	// ListObjects returns one page of the objects of a bucket matching the options (prefix, delimiter ...)
+	ListObjects(bucketName string, options ListOptions) (*ObjectListing, error)
+
+	// CreateMultipartUpload initiates a multipart upload and returns its upload id
+	CreateMultipartUpload(object BucketObject) (string, error)
+
+	// CreatePresignedURLForUploadPart creates a presigned URL for uploading one part of a multipart upload
+	// and returns the headers the client has to send with it (ex: SSE-C)
+	CreatePresignedURLForUploadPart(object BucketObject, uploadID string, partNumber int64, expire time.Duration) (*PresignedURL, error)
+
+	// CompleteMultipartUpload assembles the uploaded parts into the final object
+	CompleteMultipartUpload(object BucketObject, uploadID string, parts []CompletedPart) error
+
+	// AbortMultipartUpload aborts a multipart upload and frees the uploaded parts
+	AbortMultipartUpload(object BucketObject, uploadID string) error
+
+	// CreatePresignedPost creates a presigned POST policy for uploading file to the bucket from a browser form
+	CreatePresignedPost(object BucketObject, expire time.Duration, conditions PostConditions) (*PresignedPost, error)
+
+	// GetObject returns the content of an object as a stream, the caller has to close the body
+	GetObject(object BucketObject, options GetOptions) (*ObjectContent, error)
+
+	// PutObject writes the content of an object from a stream and returns its ETag
+	PutObject(object BucketObject, body io.Reader, options PutOptions) (string, error)
+
+	// GetObjectTagging returns the tags of an object
+	GetObjectTagging(object BucketObject) (map[string]string, error)
+
+	// PutObjectTagging replaces the tags of an object
+	PutObjectTagging(object BucketObject, tags map[string]string) error
+
+	// DeleteObjectTagging removes all the tags of an object
+	DeleteObjectTagging(object BucketObject) error
+
+	// ListObjectVersions returns one page of the versions and delete markers of the objects of a bucket
+	ListObjectVersions(bucketName string, options ListOptions) (*VersionListing, error)
+
+	// GetObjectRetention returns the Object Lock retention of an object, empty when the object has no retention
+	GetObjectRetention(object BucketObject) (*ObjectRetention, error)
+
+	// PutObjectRetention sets the Object Lock retention of an object, an empty retention removes it
+	// bypassGovernance allows to shorten or remove a GOVERNANCE retention
+	PutObjectRetention(object BucketObject, retention ObjectRetention, bypassGovernance bool) error
+
+	// GetObjectLegalHold returns true if a legal hold is set on an object
+	GetObjectLegalHold(object BucketObject) (bool, error)
+
+	// PutObjectLegalHold sets or removes the legal hold of an object
+	PutObjectLegalHold(object BucketObject, legalHold bool) error
+
+	// RestoreObject restores temporarily an archived object (GLACIER, DEEP_ARCHIVE storage classes)
+	// returns true if the restore is started, false if the object is already restored (only the expiry is updated)
+	RestoreObject(object BucketObject, options RestoreOptions) (bool, error)
 }
 
 // BucketObject is a tuple containing an object key (ex: /folder/item) and a bucket name (ex: mybucket)
+// and optionally a version id for versioned buckets (latest version when empty)
+// and the server-side encryption of the object (default encryption of the bucket when empty)
+// and the storage class of the object written by an upload or a copy (STANDARD when empty)
 type BucketObject struct {
-	BucketName string
-	Key        string
+	BucketName   string
+	Key          string
+	VersionID    string
+	Encryption   Encryption
+	StorageClass string
 }
 
 func (b BucketObject) String() string {
+	if b.VersionID != "" {
+		return fmt.Sprintf("%s (%s, version %s)", b.BucketName, b.Key, b.VersionID)
+	}
 	return fmt.Sprintf("%s (%s)", b.BucketName, b.Key)
 }
 
+// FullPath returns /bucket/key, the key may start with a "/" (ex: /folder/item) or not (ex: folder/item as returned by a listing)
 func (b BucketObject) FullPath() string {
-	return fmt.Sprintf("/%s%s", b.BucketName, b.Key)
+	return fmt.Sprintf("/%s/%s", b.BucketName, strings.TrimPrefix(b.Key, "/"))
+}
+
+// Server-side encryption modes
+const (
+	EncryptionSSES3  = "AES256"
+	EncryptionSSEKMS = "aws:kms"
+	EncryptionSSEC   = "SSE-C"
+)
+
+// Encryption defines the server-side encryption of an object, no encryption (or the default one) when Mode is empty
+// KMSKeyID is the KMS key of SSE-KMS (default KMS key when empty), CustomerKey is the base64 encoded 256 bits key of SSE-C
+type Encryption struct {
+	Mode        string
+	KMSKeyID    string
+	CustomerKey string
+}
+
+// ObjectInfo contains the metadata of an object stored in a bucket
+type ObjectInfo struct {
+	Key          string            `json:"key"`
+	Size         int64             `json:"size"`
+	ETag         string            `json:"etag"`
+	ContentType  string            `json:"contentType"`
+	LastModified time.Time         `json:"lastModified"`
+	Metadata     map[string]string `json:"metadata"`
+	VersionID    string            `json:"versionId,omitempty"`
+	StorageClass string            `json:"storageClass,omitempty"`
+	Restore      *RestoreStatus    `json:"restore,omitempty"`
+}
+
+// IsArchived returns true if the content of the object can not be read until it is restored
+func (info ObjectInfo) IsArchived() bool {
+	if info.StorageClass != StorageClassGlacier && info.StorageClass != StorageClassDeepArchive {
+		return false
+	}
+	return info.Restore == nil || info.Restore.InProgress
+}
+
+// Archive storage classes, the objects must be restored before being read
+const (
+	StorageClassGlacier     = "GLACIER"
+	StorageClassDeepArchive = "DEEP_ARCHIVE"
+)
+
+// RestoreStatus is the status of the restore of an archived object, ExpiryDate is set once the object is restored
+type RestoreStatus struct {
+	InProgress bool       `json:"inProgress"`
+	ExpiryDate *time.Time `json:"expiryDate,omitempty"`
+}
+
+// ObjectRetention is the Object Lock retention of an object : the mode (GOVERNANCE or COMPLIANCE) and the date until the object is locked
+type ObjectRetention struct {
+	Mode            string     `json:"mode,omitempty"`
+	RetainUntilDate *time.Time `json:"retainUntilDate,omitempty"`
+}
+
+// RestoreOptions defines the number of days a restored object is available and the retrieval tier (Standard, Bulk, Expedited)
+type RestoreOptions struct {
+	Days int64
+	Tier string
+}
+
+// ListOptions defines the filtering and pagination of an object listing
+type ListOptions struct {
+	Prefix            string
+	Delimiter         string
+	MaxKeys           int64
+	ContinuationToken string
+}
+
+// ObjectListing is one page of an object listing, CommonPrefixes are filled when a delimiter is used
+type ObjectListing struct {
+	Objects               []ObjectInfo `json:"objects"`
+	CommonPrefixes        []string     `json:"commonPrefixes"`
+	IsTruncated           bool         `json:"isTruncated"`
+	NextContinuationToken string       `json:"nextContinuationToken,omitempty"`
+}
+
+// CompletedPart is a part of a multipart upload identified by its number and the ETag returned on upload
+type CompletedPart struct {
+	PartNumber int64  `json:"partNumber"`
+	ETag       string `json:"etag"`
+}
+
+// PostConditions restricts the uploads allowed by a presigned POST policy, zero values mean no restriction
+// When the key of the object ends with "/", the key is used as a key prefix and the browser chooses the file name
+type PostConditions struct {
+	ContentLengthMin  int64
+	ContentLengthMax  int64
+	ContentTypePrefix string
+}
+
+// PresignedPost contains the url and the form fields a browser has to send for a presigned POST upload
+type PresignedPost struct {
+	URL    string            `json:"url"`
+	Fields map[string]string `json:"fields"`
+}
+
+// GetOptions defines the conditional and range headers of a download, zero values are ignored
+type GetOptions struct {
+	Range           string
+	IfNoneMatch     string
+	IfModifiedSince time.Time
+}
+
+// ObjectContent is the streamed content of an object, Size is the size of the body (the range size for a partial content)
+type ObjectContent struct {
+	ObjectInfo
+	Body         io.ReadCloser
+	ContentRange string
+}
+
+// PutOptions defines the content type and user metadata of an upload
+// Bodies larger than PartSize are uploaded in parts of this size (backend default when 0)
+// S3 parts are at least 5MB (s3manager.MinUploadPartSize), a smaller part size is raised to this minimum
+type PutOptions struct {
+	ContentType string
+	Metadata    map[string]string
+	PartSize    int64
+}
+
+// UploadConstraints restricts the uploads allowed by a presigned URL, zero values mean no restriction
+// ContentMD5 and ChecksumSHA256 are the base64 encoded digests of the content
+type UploadConstraints struct {
+	ContentType    string
+	ContentLength  int64
+	ContentMD5     string
+	ChecksumSHA256 string
+	Metadata       map[string]string
+}
+
+// PresignedURL contains a presigned url and the headers the client has to send with the request
+type PresignedURL struct {
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+}
+
+// ResponseHeaders overrides the headers of the response of a presigned download, zero values are ignored
+type ResponseHeaders struct {
+	ContentDisposition string
+	ContentType        string
+	CacheControl       string
+	ContentLanguage    string
+}
+
+// ObjectVersion is a version of an object or a delete marker
+type ObjectVersion struct {
+	ObjectInfo
+	IsLatest       bool `json:"isLatest"`
+	IsDeleteMarker bool `json:"isDeleteMarker"`
+}
+
+// VersionListing is one page of a version listing, CommonPrefixes are filled when a delimiter is used
+type VersionListing struct {
+	Versions              []ObjectVersion `json:"versions"`
+	CommonPrefixes        []string        `json:"commonPrefixes"`
+	IsTruncated           bool            `json:"isTruncated"`
+	NextContinuationToken string          `json:"nextContinuationToken,omitempty"`
 }
@@ -0,0 +1,896 @@
+package backendtest
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/mirakl/s3proxy/backend"
+)
+
+// MemoryError makes a method of the memory backend fail with Err
+// Bucket and Key restrict the error to the calls on this bucket or this key, every call fails when they are empty
+type MemoryError struct {
+	Method string
+	Bucket string
+	Key    string
+	Err    error
+}
+
+// MemoryBackendConfig defines the buckets created by the memory backend and the errors returned by its methods
+type MemoryBackendConfig struct {
+	Buckets []string
+	Errors  []MemoryError
+}
+
+// MemoryCall is a call of a method of the memory backend with the objects of the call
+// the objects of a listing only contain the bucket name, the objects of a copy are the source and the destination
+type MemoryCall struct {
+	Method  string
+	Objects []backend.BucketObject
+}
+
+// MemoryBackend is an in-memory implementation of the Backend interface for the hermetic tests
+// the objects are really stored, copied and deleted and every call is recorded
+type MemoryBackend struct {
+	mu      sync.Mutex
+	buckets map[string]map[string]*memoryObject
+	uploads map[string]*memoryUpload
+	errors  []MemoryError
+	calls   []MemoryCall
+	nextID  int
+}
+
+// object stored by the memory backend
+type memoryObject struct {
+	content      []byte
+	etag         string
+	contentType  string
+	metadata     map[string]string
+	tags         map[string]string
+	lastModified time.Time
+	storageClass string
+	restore      *backend.RestoreStatus
+	retention    backend.ObjectRetention
+	legalHold    bool
+}
+
+// multipart upload of the memory backend
+type memoryUpload struct {
+	object backend.BucketObject
+	parts  map[int64][]byte
+}
+
+// version id of the objects, the memory backend is not versioned
+const memoryNullVersion = "null"
+
+// Create an in-memory backend with the buckets and the errors of the configuration
+func NewMemoryBackend(config ...MemoryBackendConfig) *MemoryBackend {
+	b := &MemoryBackend{
+		buckets: make(map[string]map[string]*memoryObject),
+		uploads: make(map[string]*memoryUpload),
+	}
+
+	for _, c := range config {
+		for _, bucket := range c.Buckets {
+			b.buckets[bucket] = make(map[string]*memoryObject)
+		}
+		b.errors = append(b.errors, c.Errors...)
+	}
+
+	return b
+}
+
+// CreateBucket creates an empty bucket, an existing bucket is not modified
+func (b *MemoryBackend) CreateBucket(bucket string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.buckets[bucket]; !ok {
+		b.buckets[bucket] = make(map[string]*memoryObject)
+	}
+}
+
+// SetErrors replaces the errors returned by the methods, without argument the methods do not fail anymore
+func (b *MemoryBackend) SetErrors(errors ...MemoryError) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.errors = errors
+}
+
+// Calls returns the calls of the methods in their order
+func (b *MemoryBackend) Calls() []MemoryCall {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return append([]MemoryCall(nil), b.calls...)
+}
+
+// CallsOf returns the calls of a method in their order
+func (b *MemoryBackend) CallsOf(method string) []MemoryCall {
+	var calls []MemoryCall
+
+	for _, call := range b.Calls() {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+
+	return calls
+}
+
+// ResetCalls forgets the recorded calls
+func (b *MemoryBackend) ResetCalls() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.calls = nil
+}
+
+// Content returns the content of an object and false if the object does not exist
+func (b *MemoryBackend) Content(bucket string, key string) ([]byte, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if object, ok := b.buckets[bucket][key]; ok {
+		return append([]byte(nil), object.content...), true
+	}
+	return nil, false
+}
+
+// Keys returns the sorted keys of the objects of a bucket
+func (b *MemoryBackend) Keys(bucket string) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.sortedKeys(bucket, "")
+}
+
+// record a call and returns the configured error of the call if any, the lock must be held
+func (b *MemoryBackend) call(method string, objects ...backend.BucketObject) error {
+	b.calls = append(b.calls, MemoryCall{Method: method, Objects: objects})
+
+	for _, e := range b.errors {
+		if e.Method != method {
+			continue
+		}
+		for _, object := range objects {
+			if (e.Bucket == "" || e.Bucket == object.BucketName) && (e.Key == "" || e.Key == object.Key) {
+				return e.Err
+			}
+		}
+	}
+
+	return nil
+}
+
+// returns the bucket of an object, the lock must be held
+func (b *MemoryBackend) bucket(name string) (map[string]*memoryObject, error) {
+	bucket, ok := b.buckets[name]
+	if !ok {
+		return nil, awserr.New(s3.ErrCodeNoSuchBucket, "The specified bucket does not exist", nil)
+	}
+	return bucket, nil
+}
+
+// returns an object, the lock must be held
+func (b *MemoryBackend) object(object backend.BucketObject) (*memoryObject, error) {
+	bucket, err := b.bucket(object.BucketName)
+	if err != nil {
+		return nil, err
+	}
+
+	if object.VersionID != "" && object.VersionID != memoryNullVersion {
+		return nil, awserr.New("NoSuchVersion", "The specified version does not exist", nil)
+	}
+
+	stored, ok := bucket[object.Key]
+	if !ok {
+		return nil, awserr.New(s3.ErrCodeNoSuchKey, "The specified key does not exist", nil)
+	}
+
+	return stored, nil
+}
+
+// store an object, the lock must be held
+func (b *MemoryBackend) store(object backend.BucketObject, stored *memoryObject) error {
+	bucket, err := b.bucket(object.BucketName)
+	if err != nil {
+		return err
+	}
+
+	if stored.etag == "" {
+		sum := md5.Sum(stored.content)
+		stored.etag = fmt.Sprintf("%q", hex.EncodeToString(sum[:]))
+	}
+	if stored.metadata == nil {
+		stored.metadata = map[string]string{}
+	}
+	stored.lastModified = time.Now().UTC()
+	stored.storageClass = object.StorageClass
+
+	bucket[object.Key] = stored
+
+	return nil
+}
+
+// sorted keys of a bucket with a prefix, the lock must be held
+func (b *MemoryBackend) sortedKeys(bucket string, prefix string) []string {
+	keys := make([]string, 0, len(b.buckets[bucket]))
+
+	for key := range b.buckets[bucket] {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+func (o *memoryObject) info(key string) *backend.ObjectInfo {
+	metadata := make(map[string]string, len(o.metadata))
+	for name, value := range o.metadata {
+		metadata[name] = value
+	}
+
+	return &backend.ObjectInfo{
+		Key:          key,
+		Size:         int64(len(o.content)),
+		ETag:         o.etag,
+		ContentType:  o.contentType,
+		LastModified: o.lastModified,
+		Metadata:     metadata,
+		StorageClass: o.storageClass,
+		Restore:      o.restore,
+	}
+}
+
+// an object with a legal hold or a retention in the future can not be deleted
+func (o *memoryObject) isLocked() bool {
+	return o.legalHold || o.retention.RetainUntilDate != nil && o.retention.RetainUntilDate.After(time.Now())
+}
+
+// fake URL of a presigned request, the memory backend does not serve them
+func memoryURL(method string, object backend.BucketObject, expire time.Duration, query url.Values) string {
+	if query == nil {
+		query = make(url.Values)
+	}
+	query.Set("method", method)
+	query.Set("expires", strconv.FormatInt(int64(expire.Seconds()), 10))
+
+	return fmt.Sprintf("memory://%s/%s?%s", object.BucketName, strings.TrimPrefix(object.Key, "/"), query.Encode())
+}
+
+// Returns a fake upload URL, the constraints are returned as headers
+func (b *MemoryBackend) CreatePresignedURLForUpload(object backend.BucketObject, expire time.Duration, constraints backend.UploadConstraints) (*backend.PresignedURL, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.call("CreatePresignedURLForUpload", object); err != nil {
+		return nil, err
+	}
+
+	headers := make(map[string]string)
+	if constraints.ContentType != "" {
+		headers["content-type"] = constraints.ContentType
+	}
+	if constraints.ContentLength > 0 {
+		headers["content-length"] = strconv.FormatInt(constraints.ContentLength, 10)
+	}
+	if constraints.ContentMD5 != "" {
+		headers["content-md5"] = constraints.ContentMD5
+	}
+	if constraints.ChecksumSHA256 != "" {
+		headers["x-amz-checksum-sha256"] = constraints.ChecksumSHA256
+	}
+	for name, value := range constraints.Metadata {
+		headers["x-amz-meta-"+name] = value
+	}
+
+	return &backend.PresignedURL{URL: memoryURL("PUT", object, expire, nil), Headers: headers}, nil
+}
+
+// Returns a fake download URL with the response headers as query parameters
+func (b *MemoryBackend) CreatePresignedURLForDownload(object backend.BucketObject, expire time.Duration, headers backend.ResponseHeaders) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.call("CreatePresignedURLForDownload", object); err != nil {
+		return "", err
+	}
+
+	query := make(url.Values)
+	for name, value := range map[string]string{
+		"versionId":                    object.VersionID,
+		"response-content-disposition": headers.ContentDisposition,
+		"response-content-type":        headers.ContentType,
+		"response-cache-control":       headers.CacheControl,
+		"response-content-language":    headers.ContentLanguage,
+	} {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+
+	return memoryURL("GET", object, expire, query), nil
+}
+
+// Delete an object, deleting a missing object is not an error as on S3
+func (b *MemoryBackend) DeleteObject(object backend.BucketObject) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.call("DeleteObject", object); err != nil {
+		return err
+	}
+
+	bucket, err := b.bucket(object.BucketName)
+	if err != nil {
+		return err
+	}
+
+	if stored, ok := bucket[object.Key]; ok && stored.isLocked() {
+		return backend.NewLockedObjectsError([]string{object.Key}, nil)
+	}
+
+	delete(bucket, object.Key)
+
+	return nil
+}
+
+// Delete several objects, the locked objects are not deleted and reported by a LockedObjectsError
+func (b *MemoryBackend) BatchDeleteObjects(objects []backend.BucketObject) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.call("BatchDeleteObjects", objects...); err != nil {
+		return err
+	}
+
+	var lockedKeys []string
+
+	for _, object := range objects {
+		bucket, err := b.bucket(object.BucketName)
+		if err != nil {
+			return err
+		}
+
+		if stored, ok := bucket[object.Key]; ok && stored.isLocked() {
+			lockedKeys = append(lockedKeys, object.Key)
+			continue
+		}
+
+		delete(bucket, object.Key)
+	}
+
+	if len(lockedKeys) > 0 {
+		return backend.NewLockedObjectsError(lockedKeys, nil)
+	}
+
+	return nil
+}
+
+// Copy an object with its content type, its metadata and its tags
+func (b *MemoryBackend) CopyObject(sourceObject backend.BucketObject, destinationObject backend.BucketObject) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.call("CopyObject", sourceObject, destinationObject); err != nil {
+		return err
+	}
+
+	source, err := b.object(sourceObject)
+	if err != nil {
+		return err
+	}
+
+	copied := &memoryObject{
+		content:     source.content,
+		etag:        source.etag,
+		contentType: source.contentType,
+		metadata:    source.metadata,
+		tags:        source.tags,
+	}
+
+	return b.store(destinationObject, copied)
+}
+
+// Returns the metadata of an object
+func (b *MemoryBackend) StatObject(object backend.BucketObject) (*backend.ObjectInfo, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.call("StatObject", object); err != nil {
+		return nil, err
+	}
+
+	stored, err := b.object(object)
+	if err != nil {
+		return nil, err
+	}
+
+	return stored.info(object.Key), nil
+}
+
+// Returns one page of the objects of a bucket, the continuation token is the last key (or common prefix) of the previous page
+func (b *MemoryBackend) ListObjects(bucketName string, options backend.ListOptions) (*backend.ObjectListing, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.call("ListObjects", backend.BucketObject{BucketName: bucketName}); err != nil {
+		return nil, err
+	}
+
+	return b.list(bucketName, options)
+}
+
+// list the objects of a bucket, the lock must be held
+func (b *MemoryBackend) list(bucketName string, options backend.ListOptions) (*backend.ObjectListing, error) {
+	bucket, err := b.bucket(bucketName)
+	if err != nil {
+		return nil, err
+	}
+
+	maxKeys := int(options.MaxKeys)
+	if maxKeys <= 0 {
+		maxKeys = 1000
+	}
+
+	listing := &backend.ObjectListing{Objects: []backend.ObjectInfo{}, CommonPrefixes: []string{}}
+	last := ""
+
+	for _, key := range b.sortedKeys(bucketName, options.Prefix) {
+		token := options.ContinuationToken
+		if token != "" && (key <= token || options.Delimiter != "" && strings.HasSuffix(token, options.Delimiter) && strings.HasPrefix(key, token)) {
+			continue
+		}
+
+		commonPrefix := ""
+		if options.Delimiter != "" {
+			if index := strings.Index(key[len(options.Prefix):], options.Delimiter); index >= 0 {
+				commonPrefix = key[:len(options.Prefix)+index+len(options.Delimiter)]
+			}
+		}
+
+		if commonPrefix != "" && commonPrefix == last {
+			continue
+		}
+
+		if len(listing.Objects)+len(listing.CommonPrefixes) == maxKeys {
+			listing.IsTruncated = true
+			listing.NextContinuationToken = last
+			break
+		}
+
+		if commonPrefix != "" {
+			listing.CommonPrefixes = append(listing.CommonPrefixes, commonPrefix)
+			last = commonPrefix
+			continue
+		}
+
+		listing.Objects = append(listing.Objects, *bucket[key].info(key))
+		last = key
+	}
+
+	return listing, nil
+}
+
+// Initiate a multipart upload, the parts are uploaded with UploadPart
+func (b *MemoryBackend) CreateMultipartUpload(object backend.BucketObject) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.call("CreateMultipartUpload", object); err != nil {
+		return "", err
+	}
+
+	if _, err := b.bucket(object.BucketName); err != nil {
+		return "", err
+	}
+
+	b.nextID++
+	uploadID := fmt.Sprintf("upload-%d", b.nextID)
+	b.uploads[uploadID] = &memoryUpload{object: object, parts: make(map[int64][]byte)}
+
+	return uploadID, nil
+}
+
+// returns a multipart upload of an object, the lock must be held
+func (b *MemoryBackend) upload(object backend.BucketObject, uploadID string) (*memoryUpload, error) {
+	upload, ok := b.uploads[uploadID]
+	if !ok || upload.object.BucketName != object.BucketName || upload.object.Key != object.Key {
+		return nil, awserr.New(s3.ErrCodeNoSuchUpload, "The specified upload does not exist", nil)
+	}
+	return upload, nil
+}
+
+// Returns a fake upload URL of a part
+func (b *MemoryBackend) CreatePresignedURLForUploadPart(object backend.BucketObject, uploadID string, partNumber int64, expire time.Duration) (*backend.PresignedURL, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.call("CreatePresignedURLForUploadPart", object); err != nil {
+		return nil, err
+	}
+
+	if _, err := b.upload(object, uploadID); err != nil {
+		return nil, err
+	}
+
+	query := url.Values{"uploadId": {uploadID}, "partNumber": {strconv.FormatInt(partNumber, 10)}}
+
+	return &backend.PresignedURL{URL: memoryURL("PUT", object, expire, query), Headers: map[string]string{}}, nil
+}
+
+// UploadPart stores a part of a multipart upload as a client would do with the presigned URL and returns its ETag
+func (b *MemoryBackend) UploadPart(object backend.BucketObject, uploadID string, partNumber int64, content []byte) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	upload, err := b.upload(object, uploadID)
+	if err != nil {
+		return "", err
+	}
+
+	upload.parts[partNumber] = append([]byte(nil), content...)
+	sum := md5.Sum(content)
+
+	return fmt.Sprintf("%q", hex.EncodeToString(sum[:])), nil
+}
+
+// Assemble the uploaded parts into the object
+func (b *MemoryBackend) CompleteMultipartUpload(object backend.BucketObject, uploadID string, parts []backend.CompletedPart) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.call("CompleteMultipartUpload", object); err != nil {
+		return err
+	}
+
+	upload, err := b.upload(object, uploadID)
+	if err != nil {
+		return err
+	}
+
+	var content, digests bytes.Buffer
+
+	for index, part := range parts {
+		if index > 0 && part.PartNumber <= parts[index-1].PartNumber {
+			return awserr.New("InvalidPartOrder", "The list of parts was not in ascending order", nil)
+		}
+
+		data, ok := upload.parts[part.PartNumber]
+		sum := md5.Sum(data)
+		if !ok || strings.Trim(part.ETag, "\"") != hex.EncodeToString(sum[:]) {
+			return awserr.New("InvalidPart", fmt.Sprintf("Part %d not found or ETag does not match", part.PartNumber), nil)
+		}
+
+		content.Write(data)
+		digests.Write(sum[:])
+	}
+
+	delete(b.uploads, uploadID)
+
+	// ETag of a multipart object as on S3 : MD5 of the MD5 of the parts followed by the number of parts
+	sum := md5.Sum(digests.Bytes())
+	etag := fmt.Sprintf("\"%s-%d\"", hex.EncodeToString(sum[:]), len(parts))
+
+	return b.store(upload.object, &memoryObject{content: content.Bytes(), etag: etag})
+}
+
+// Abort a multipart upload and forget its parts
+func (b *MemoryBackend) AbortMultipartUpload(object backend.BucketObject, uploadID string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.call("AbortMultipartUpload", object); err != nil {
+		return err
+	}
+
+	if _, err := b.upload(object, uploadID); err != nil {
+		return err
+	}
+
+	delete(b.uploads, uploadID)
+
+	return nil
+}
+
+// Returns a fake POST policy, the conditions are returned as fields
+func (b *MemoryBackend) CreatePresignedPost(object backend.BucketObject, expire time.Duration, conditions backend.PostConditions) (*backend.PresignedPost, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.call("CreatePresignedPost", object); err != nil {
+		return nil, err
+	}
+
+	key := strings.TrimPrefix(object.Key, "/")
+	if strings.HasSuffix(key, "/") {
+		key += "${filename}"
+	}
+
+	fields := map[string]string{"key": key, "policy": "memory"}
+	if conditions.ContentTypePrefix != "" {
+		fields["Content-Type"] = conditions.ContentTypePrefix
+	}
+
+	return &backend.PresignedPost{URL: memoryURL("POST", backend.BucketObject{BucketName: object.BucketName}, expire, nil), Fields: fields}, nil
+}
+
+// Returns the content of an object, honors "bytes=start-end" ranges and the conditional options
+func (b *MemoryBackend) GetObject(object backend.BucketObject, options backend.GetOptions) (*backend.ObjectContent, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.call("GetObject", object); err != nil {
+		return nil, err
+	}
+
+	stored, err := b.object(object)
+	if err != nil {
+		return nil, err
+	}
+
+	if stored.isArchived() {
+		return nil, awserr.New("InvalidObjectState", "The operation is not valid for the object's storage class", nil)
+	}
+
+	info := stored.info(object.Key)
+
+	if options.IfNoneMatch != "" && options.IfNoneMatch == info.ETag ||
+		!options.IfModifiedSince.IsZero() && !info.LastModified.Truncate(time.Second).After(options.IfModifiedSince) {
+		return nil, awserr.NewRequestFailure(awserr.New("NotModified", "Not Modified", nil), 304, "")
+	}
+
+	content := &backend.ObjectContent{ObjectInfo: *info, Body: io.NopCloser(bytes.NewReader(stored.content))}
+
+	if options.Range != "" {
+		var start, end int64
+		if _, err := fmt.Sscanf(options.Range, "bytes=%d-%d", &start, &end); err != nil || start > end || start >= info.Size {
+			return nil, awserr.NewRequestFailure(awserr.New("InvalidRange", "The requested range is not satisfiable", nil), 416, "")
+		}
+		end = min(end, info.Size-1)
+
+		content.Body = io.NopCloser(bytes.NewReader(stored.content[start : end+1]))
+		content.Size = end - start + 1
+		content.ContentRange = fmt.Sprintf("bytes %d-%d/%d", start, end, info.Size)
+	}
+
+	return content, nil
+}
+
+func (o *memoryObject) isArchived() bool {
+	return o.info("").IsArchived()
+}
+
+// Store the content of an object
+func (b *MemoryBackend) PutObject(object backend.BucketObject, body io.Reader, options backend.PutOptions) (string, error) {
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.call("PutObject", object); err != nil {
+		return "", err
+	}
+
+	stored := &memoryObject{content: content, contentType: options.ContentType, metadata: options.Metadata}
+	if err := b.store(object, stored); err != nil {
+		return "", err
+	}
+
+	return stored.etag, nil
+}
+
+// Returns the tags of an object
+func (b *MemoryBackend) GetObjectTagging(object backend.BucketObject) (map[string]string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.call("GetObjectTagging", object); err != nil {
+		return nil, err
+	}
+
+	stored, err := b.object(object)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make(map[string]string, len(stored.tags))
+	for name, value := range stored.tags {
+		tags[name] = value
+	}
+
+	return tags, nil
+}
+
+// Replace the tags of an object
+func (b *MemoryBackend) PutObjectTagging(object backend.BucketObject, tags map[string]string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.call("PutObjectTagging", object); err != nil {
+		return err
+	}
+
+	stored, err := b.object(object)
+	if err != nil {
+		return err
+	}
+
+	stored.tags = tags
+
+	return nil
+}
+
+// Remove the tags of an object
+func (b *MemoryBackend) DeleteObjectTagging(object backend.BucketObject) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.call("DeleteObjectTagging", object); err != nil {
+		return err
+	}
+
+	stored, err := b.object(object)
+	if err != nil {
+		return err
+	}
+
+	stored.tags = nil
+
+	return nil
+}
+
+// The memory backend is not versioned, each object is listed as its single "null" version as on an unversioned bucket
+func (b *MemoryBackend) ListObjectVersions(bucketName string, options backend.ListOptions) (*backend.VersionListing, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.call("ListObjectVersions", backend.BucketObject{BucketName: bucketName}); err != nil {
+		return nil, err
+	}
+
+	objects, err := b.list(bucketName, options)
+	if err != nil {
+		return nil, err
+	}
+
+	listing := &backend.VersionListing{
+		Versions:              make([]backend.ObjectVersion, len(objects.Objects)),
+		CommonPrefixes:        objects.CommonPrefixes,
+		IsTruncated:           objects.IsTruncated,
+		NextContinuationToken: objects.NextContinuationToken,
+	}
+
+	for index, object := range objects.Objects {
+		object.VersionID = memoryNullVersion
+		listing.Versions[index] = backend.ObjectVersion{ObjectInfo: object, IsLatest: true}
+	}
+
+	return listing, nil
+}
+
+// Returns the retention of an object, empty when the object has no retention
+func (b *MemoryBackend) GetObjectRetention(object backend.BucketObject) (*backend.ObjectRetention, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.call("GetObjectRetention", object); err != nil {
+		return nil, err
+	}
+
+	stored, err := b.object(object)
+	if err != nil {
+		return nil, err
+	}
+
+	retention := stored.retention
+	return &retention, nil
+}
+
+// Set the retention of an object, a COMPLIANCE retention can not be shortened and a GOVERNANCE retention only with bypassGovernance
+func (b *MemoryBackend) PutObjectRetention(object backend.BucketObject, retention backend.ObjectRetention, bypassGovernance bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.call("PutObjectRetention", object); err != nil {
+		return err
+	}
+
+	stored, err := b.object(object)
+	if err != nil {
+		return err
+	}
+
+	current := stored.retention
+	shortened := current.RetainUntilDate != nil && current.RetainUntilDate.After(time.Now()) &&
+		(retention.RetainUntilDate == nil || retention.RetainUntilDate.Before(*current.RetainUntilDate) || retention.Mode != current.Mode)
+
+	if shortened && (current.Mode == backend.ObjectLockModeCompliance || !bypassGovernance) {
+		return awserr.New("AccessDenied", "Access Denied because object protected by object lock.", nil)
+	}
+
+	stored.retention = retention
+
+	return nil
+}
+
+// Returns true if a legal hold is set on an object
+func (b *MemoryBackend) GetObjectLegalHold(object backend.BucketObject) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.call("GetObjectLegalHold", object); err != nil {
+		return false, err
+	}
+
+	stored, err := b.object(object)
+	if err != nil {
+		return false, err
+	}
+
+	return stored.legalHold, nil
+}
+
+// Set or remove the legal hold of an object
+func (b *MemoryBackend) PutObjectLegalHold(object backend.BucketObject, legalHold bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.call("PutObjectLegalHold", object); err != nil {
+		return err
+	}
+
+	stored, err := b.object(object)
+	if err != nil {
+		return err
+	}
+
+	stored.legalHold = legalHold
+
+	return nil
+}
+
+// Restore an archived object, the restore is immediately completed
+// returns true on the first restore and false once the object is restored (the expiry is updated)
+func (b *MemoryBackend) RestoreObject(object backend.BucketObject, options backend.RestoreOptions) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.call("RestoreObject", object); err != nil {
+		return false, err
+	}
+
+	stored, err := b.object(object)
+	if err != nil {
+		return false, err
+	}
+
+	if stored.storageClass != backend.StorageClassGlacier && stored.storageClass != backend.StorageClassDeepArchive {
+		return false, awserr.New("InvalidObjectState", "Restore is not allowed for the object's current storage class", nil)
+	}
+
+	started := stored.restore == nil
+	expiryDate := time.Now().UTC().AddDate(0, 0, int(options.Days))
+	stored.restore = &backend.RestoreStatus{ExpiryDate: &expiryDate}
+
+	return started, nil
+}
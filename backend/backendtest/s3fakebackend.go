@@ -2,6 +2,11 @@
 package backendtest
 
 import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
 	"strings"
 	"time"
 
@@ -42,29 +47,54 @@ type S3FakeBackend struct {
 }
 
 // Create presigned url for upload just like for a real s3 backend
-func (b *S3FakeBackend) CreatePresignedURLForUpload(object backend.BucketObject, expire time.Duration) (string, error) {
-	return b.s3Backend.CreatePresignedURLForUpload(object, expire)
+func (b *S3FakeBackend) CreatePresignedURLForUpload(object backend.BucketObject, expire time.Duration, constraints backend.UploadConstraints) (*backend.PresignedURL, error) {
+	return b.s3Backend.CreatePresignedURLForUpload(object, expire, constraints)
 }
 
 // Create presigned url for download just like for a real s3 backend
-func (b *S3FakeBackend) CreatePresignedURLForDownload(object backend.BucketObject, expire time.Duration) (string, error) {
-	return b.s3Backend.CreatePresignedURLForDownload(object, expire)
+func (b *S3FakeBackend) CreatePresignedURLForDownload(object backend.BucketObject, expire time.Duration, headers backend.ResponseHeaders) (string, error) {
+	return b.s3Backend.CreatePresignedURLForDownload(object, expire, headers)
 }
 
 // Delete action for an object in a bucket, in our case does nothing because no real backend
+// panics when the keyword "error" is used, returns an access denied error for the keyword "forbidden"
+// and an object locked error for the keyword "locked"
 func (b *S3FakeBackend) DeleteObject(object backend.BucketObject) error {
 	if strings.Contains(object.Key, "error") {
 		panic("Fake panic :))")
 	}
+	if strings.Contains(object.Key, "forbidden") {
+		return awserr.New("AccessDenied", "Access Denied", nil)
+	}
+	if strings.Contains(object.Key, "locked") {
+		return backend.NewLockedObjectsError([]string{object.Key}, nil)
+	}
+	if strings.Contains(object.BucketName, "notfound") {
+		return awserr.New(s3.ErrCodeNoSuchBucket, "No such bucket", nil)
+	}
+	if strings.Contains(object.VersionID, "notfound") {
+		return awserr.New("NoSuchVersion", "No such version", nil)
+	}
 	return nil
 }
 
+// Fake batch delete, does nothing except returning an object locked error with the keys containing the keyword "locked"
 func (b *S3FakeBackend) BatchDeleteObjects(objects []backend.BucketObject) error {
-	_ = objects
+	var lockedKeys []string
+
+	for _, object := range objects {
+		if strings.Contains(object.Key, "locked") {
+			lockedKeys = append(lockedKeys, object.Key)
+		}
+	}
+
+	if len(lockedKeys) > 0 {
+		return backend.NewLockedObjectsError(lockedKeys, nil)
+	}
 	return nil
 }
 
-// Fake copy, does nothing except returning some errors when the keyword "notfound" are used
+// Fake copy, does nothing except returning some errors when the keyword "notfound" are used (also for the version)
 func (b *S3FakeBackend) CopyObject(sourceObject backend.BucketObject, destinationObject backend.BucketObject) error {
 	if strings.Contains(sourceObject.BucketName, "notfound") || strings.Contains(destinationObject.BucketName, "notfound") {
 		return awserr.New(s3.ErrCodeNoSuchBucket, "No such bucket", nil)
@@ -72,5 +102,282 @@ func (b *S3FakeBackend) CopyObject(sourceObject backend.BucketObject, destinatio
 	if strings.Contains(sourceObject.Key, "notfound") {
 		return awserr.New(s3.ErrCodeNoSuchKey, "No such key", nil)
 	}
+	if strings.Contains(sourceObject.VersionID, "notfound") {
+		return awserr.New("NoSuchVersion", "No such version", nil)
+	}
+	return nil
+}
+
+// Fake stat, returns a static object info except when the keyword "notfound" is used
+// The keywords "archived", "restoring" and "restored" in the key return a GLACIER object with the corresponding restore status
+func (b *S3FakeBackend) StatObject(object backend.BucketObject) (*backend.ObjectInfo, error) {
+	if strings.Contains(object.BucketName, "notfound") {
+		return nil, awserr.New(s3.ErrCodeNoSuchBucket, "No such bucket", nil)
+	}
+	if strings.Contains(object.Key, "notfound") {
+		return nil, awserr.New(s3.ErrCodeNoSuchKey, "No such key", nil)
+	}
+	if strings.Contains(object.VersionID, "notfound") {
+		return nil, awserr.New("NoSuchVersion", "No such version", nil)
+	}
+	info := &backend.ObjectInfo{
+		Key:          object.Key,
+		Size:         1024,
+		ETag:         "\"d41d8cd98f00b204e9800998ecf8427e\"",
+		ContentType:  "binary/octet-stream",
+		LastModified: time.Date(2018, time.January, 1, 0, 0, 0, 0, time.UTC),
+		Metadata:     map[string]string{"Owner": "s3proxy"},
+		VersionID:    object.VersionID,
+	}
+
+	switch {
+	case strings.Contains(object.Key, "archived"):
+		info.StorageClass = backend.StorageClassGlacier
+	case strings.Contains(object.Key, "restoring"):
+		info.StorageClass = backend.StorageClassGlacier
+		info.Restore = &backend.RestoreStatus{InProgress: true}
+	case strings.Contains(object.Key, "restored"):
+		expiryDate := time.Date(2018, time.January, 2, 0, 0, 0, 0, time.UTC)
+		info.StorageClass = backend.StorageClassGlacier
+		info.Restore = &backend.RestoreStatus{ExpiryDate: &expiryDate}
+	}
+
+	return info, nil
+}
+
+// Fake listing, returns 3 objects and 1 common prefix (when a delimiter is used) under the requested prefix
+// max keys is honored with a continuation token containing the index of the next object
+func (b *S3FakeBackend) ListObjects(bucketName string, options backend.ListOptions) (*backend.ObjectListing, error) {
+	if strings.Contains(bucketName, "notfound") {
+		return nil, awserr.New(s3.ErrCodeNoSuchBucket, "No such bucket", nil)
+	}
+
+	objects := make([]backend.ObjectInfo, 3)
+	for index := range objects {
+		objects[index] = backend.ObjectInfo{
+			Key:          fmt.Sprintf("%sfile%d", options.Prefix, index+1),
+			Size:         1024,
+			ETag:         "\"d41d8cd98f00b204e9800998ecf8427e\"",
+			LastModified: time.Date(2018, time.January, 1, 0, 0, 0, 0, time.UTC),
+		}
+	}
+
+	start := 0
+	if options.ContinuationToken != "" {
+		var err error
+		if start, err = strconv.Atoi(options.ContinuationToken); err != nil || start > len(objects) {
+			return nil, awserr.New("InvalidArgument", "The continuation token provided is incorrect", nil)
+		}
+	}
+
+	end := len(objects)
+	if options.MaxKeys > 0 && start+int(options.MaxKeys) < end {
+		end = start + int(options.MaxKeys)
+	}
+
+	listing := &backend.ObjectListing{
+		Objects:        objects[start:end],
+		CommonPrefixes: []string{},
+		IsTruncated:    end < len(objects),
+	}
+
+	if listing.IsTruncated {
+		listing.NextContinuationToken = strconv.Itoa(end)
+	}
+
+	if options.Delimiter != "" {
+		listing.CommonPrefixes = append(listing.CommonPrefixes, options.Prefix+"folder"+options.Delimiter)
+	}
+
+	return listing, nil
+}
+
+// Fake multipart upload initiation, returns a static upload id except when the keyword "notfound" is used
+func (b *S3FakeBackend) CreateMultipartUpload(object backend.BucketObject) (string, error) {
+	if strings.Contains(object.BucketName, "notfound") {
+		return "", awserr.New(s3.ErrCodeNoSuchBucket, "No such bucket", nil)
+	}
+	return "fake-upload-id", nil
+}
+
+// Create presigned url for an upload part just like for a real s3 backend
+func (b *S3FakeBackend) CreatePresignedURLForUploadPart(object backend.BucketObject, uploadID string, partNumber int64, expire time.Duration) (*backend.PresignedURL, error) {
+	return b.s3Backend.CreatePresignedURLForUploadPart(object, uploadID, partNumber, expire)
+}
+
+// Fake multipart upload completion, returns some errors when the keyword "notfound" is used for the upload id
+func (b *S3FakeBackend) CompleteMultipartUpload(object backend.BucketObject, uploadID string, parts []backend.CompletedPart) error {
+	if strings.Contains(uploadID, "notfound") {
+		return awserr.New(s3.ErrCodeNoSuchUpload, "No such upload", nil)
+	}
+	return nil
+}
+
+// Fake multipart upload abort, returns some errors when the keyword "notfound" is used for the upload id
+func (b *S3FakeBackend) AbortMultipartUpload(object backend.BucketObject, uploadID string) error {
+	if strings.Contains(uploadID, "notfound") {
+		return awserr.New(s3.ErrCodeNoSuchUpload, "No such upload", nil)
+	}
+	return nil
+}
+
+// Create presigned post policy just like for a real s3 backend
+func (b *S3FakeBackend) CreatePresignedPost(object backend.BucketObject, expire time.Duration, conditions backend.PostConditions) (*backend.PresignedPost, error) {
+	return b.s3Backend.CreatePresignedPost(object, expire, conditions)
+}
+
+// Content of all the objects of the fake backend
+const FakeObjectContent = "s3proxy fake content"
+
+// Fake get, streams a static content, honors "bytes=start-end" ranges and If-None-Match
+// and returns some errors when the keyword "notfound" is used
+func (b *S3FakeBackend) GetObject(object backend.BucketObject, options backend.GetOptions) (*backend.ObjectContent, error) {
+	info, err := b.StatObject(object)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.IfNoneMatch != "" && options.IfNoneMatch == info.ETag {
+		return nil, awserr.NewRequestFailure(awserr.New("NotModified", "Not Modified", nil), 304, "")
+	}
+
+	content := &backend.ObjectContent{
+		ObjectInfo: *info,
+		Body:       io.NopCloser(strings.NewReader(FakeObjectContent)),
+	}
+	content.Size = int64(len(FakeObjectContent))
+
+	if options.Range != "" {
+		var start, end int64
+		if _, err := fmt.Sscanf(options.Range, "bytes=%d-%d", &start, &end); err != nil || start > end || end >= content.Size {
+			return nil, awserr.NewRequestFailure(awserr.New("InvalidRange", "The requested range is not satisfiable", nil), 416, "")
+		}
+
+		content.Body = io.NopCloser(strings.NewReader(FakeObjectContent[start : end+1]))
+		content.ContentRange = fmt.Sprintf("bytes %d-%d/%d", start, end, content.Size)
+		content.Size = end - start + 1
+	}
+
+	return content, nil
+}
+
+// Fake put, reads the whole body and returns its MD5 as ETag
+// returns some errors when the keyword "notfound" is used
+func (b *S3FakeBackend) PutObject(object backend.BucketObject, body io.Reader, options backend.PutOptions) (string, error) {
+	if strings.Contains(object.BucketName, "notfound") {
+		return "", awserr.New(s3.ErrCodeNoSuchBucket, "No such bucket", nil)
+	}
+
+	h := md5.New()
+	if _, err := io.Copy(h, body); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%q", hex.EncodeToString(h.Sum(nil))), nil
+}
+
+// Fake tags, returns a static tag set except when the keyword "notfound" is used
+func (b *S3FakeBackend) GetObjectTagging(object backend.BucketObject) (map[string]string, error) {
+	if _, err := b.StatObject(object); err != nil {
+		return nil, err
+	}
+	return map[string]string{"classification": "internal"}, nil
+}
+
+// Fake tags update, does nothing except returning some errors when the keyword "notfound" is used
+func (b *S3FakeBackend) PutObjectTagging(object backend.BucketObject, tags map[string]string) error {
+	_, err := b.StatObject(object)
+	return err
+}
+
+// Fake tags removal, does nothing except returning some errors when the keyword "notfound" is used
+func (b *S3FakeBackend) DeleteObjectTagging(object backend.BucketObject) error {
+	_, err := b.StatObject(object)
+	return err
+}
+
+// Fake version listing, returns 2 versions and a delete marker for each object of the fake listing
+func (b *S3FakeBackend) ListObjectVersions(bucketName string, options backend.ListOptions) (*backend.VersionListing, error) {
+	objects, err := b.ListObjects(bucketName, options)
+	if err != nil {
+		return nil, err
+	}
+
+	listing := &backend.VersionListing{
+		Versions:              make([]backend.ObjectVersion, 0, 3*len(objects.Objects)),
+		CommonPrefixes:        objects.CommonPrefixes,
+		IsTruncated:           objects.IsTruncated,
+		NextContinuationToken: objects.NextContinuationToken,
+	}
+
+	for _, object := range objects.Objects {
+		deleteMarker := backend.ObjectVersion{ObjectInfo: backend.ObjectInfo{Key: object.Key, LastModified: object.LastModified, VersionID: "v3"}, IsLatest: true, IsDeleteMarker: true}
+		listing.Versions = append(listing.Versions, deleteMarker)
+
+		for _, version := range []string{"v2", "v1"} {
+			object.VersionID = version
+			listing.Versions = append(listing.Versions, backend.ObjectVersion{ObjectInfo: object})
+		}
+	}
+
+	return listing, nil
+}
+
+// Fake restore, the restore is started for the "archived" keys, already done for the "restored" keys and in progress for the "restoring" keys
+// other objects are not archived
+func (b *S3FakeBackend) RestoreObject(object backend.BucketObject, options backend.RestoreOptions) (bool, error) {
+	info, err := b.StatObject(object)
+	if err != nil {
+		return false, err
+	}
+
+	switch {
+	case info.Restore == nil && info.IsArchived():
+		return true, nil
+	case info.Restore != nil && info.Restore.InProgress:
+		return false, awserr.New("RestoreAlreadyInProgress", "Object restore is already in progress", nil)
+	case info.Restore != nil:
+		return false, nil
+	default:
+		return false, awserr.New("InvalidObjectState", "Restore is not allowed for the object's current storage class", nil)
+	}
+}
+
+// Fake retention, returns a COMPLIANCE retention until 2099 for the "locked" keys, no retention for the other objects
+// and some errors when the keyword "notfound" is used
+func (b *S3FakeBackend) GetObjectRetention(object backend.BucketObject) (*backend.ObjectRetention, error) {
+	if _, err := b.StatObject(object); err != nil {
+		return nil, err
+	}
+	if strings.Contains(object.Key, "locked") {
+		retainUntilDate := time.Date(2099, time.January, 1, 0, 0, 0, 0, time.UTC)
+		return &backend.ObjectRetention{Mode: backend.ObjectLockModeCompliance, RetainUntilDate: &retainUntilDate}, nil
+	}
+	return &backend.ObjectRetention{}, nil
+}
+
+// Fake retention update, does nothing except returning an access denied error when the retention of a "locked" key is changed
+// and some errors when the keyword "notfound" is used
+func (b *S3FakeBackend) PutObjectRetention(object backend.BucketObject, retention backend.ObjectRetention, bypassGovernance bool) error {
+	if _, err := b.StatObject(object); err != nil {
+		return err
+	}
+	if strings.Contains(object.Key, "locked") {
+		return awserr.New("AccessDenied", "Access Denied because object protected by object lock.", nil)
+	}
 	return nil
 }
+
+// Fake legal hold, set for the "locked" keys and some errors when the keyword "notfound" is used
+func (b *S3FakeBackend) GetObjectLegalHold(object backend.BucketObject) (bool, error) {
+	if _, err := b.StatObject(object); err != nil {
+		return false, err
+	}
+	return strings.Contains(object.Key, "locked"), nil
+}
+
+// Fake legal hold update, does nothing except returning some errors when the keyword "notfound" is used
+func (b *S3FakeBackend) PutObjectLegalHold(object backend.BucketObject, legalHold bool) error {
+	_, err := b.StatObject(object)
+	return err
+}
@@ -0,0 +1,254 @@
+// Failover implementation of the Backend interface : the presigned download URLs are issued by a secondary backend
+// (ex: a replica in another region) while the primary backend is unhealthy. The health of both backends is checked
+// in background by listing a bucket, the other operations are always done on the primary backend
+
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// default interval between two health checks of a backend
+	defaultHealthCheckInterval = 10 * time.Second
+	// default max. duration of a health check
+	defaultHealthCheckTimeout = 5 * time.Second
+	// default number of consecutive failed health checks before a backend is unhealthy
+	defaultFailureThreshold = 3
+)
+
+// FailoverBackendConfig for the failover backend
+type FailoverBackendConfig struct {
+	// Backend of all the operations while it is healthy
+	Primary Backend
+
+	// Backend of the presigned download URLs while the primary backend is unhealthy
+	Secondary Backend
+
+	// Bucket of both backends listed by the health checks, a failed listing is a failed health check
+	HealthCheckBucket string
+
+	// Interval between two health checks and max. duration of a health check, 10s and 5s when 0
+	HealthCheckInterval time.Duration
+	HealthCheckTimeout  time.Duration
+
+	// Number of consecutive failed health checks before a backend is unhealthy, 3 when 0
+	// a backend is healthy again after one successful health check
+	FailureThreshold int
+
+	// Check that the object exists before issuing its download URL, the URL of the other backend is issued when
+	// the object is not found (ex: not yet replicated on the secondary backend)
+	CheckObject bool
+}
+
+// FailoverBackend issues the presigned download URLs with the secondary backend when the primary backend is unhealthy
+// and the secondary backend is healthy, the health transitions are logged
+// the downloads of a specific version always use the primary backend : the version ids differ between the backends
+// the stats done before issuing a download URL follow the same choice, the other operations are executed by the embedded primary backend
+type FailoverBackend struct {
+	Backend
+
+	primary   *monitoredBackend
+	secondary *monitoredBackend
+
+	healthCheckBucket   string
+	healthCheckInterval time.Duration
+	healthCheckTimeout  time.Duration
+	failureThreshold    int
+	checkObject         bool
+
+	mutex sync.Mutex
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// backend with its health, the fields are protected by the mutex of the failover backend
+type monitoredBackend struct {
+	name     string
+	backend  Backend
+	healthy  bool
+	failures int
+	checking bool
+}
+
+// Create a failover backend, the backends are healthy until their health checks fail
+// Close stops the health checks
+func NewFailoverBackend(config FailoverBackendConfig) (*FailoverBackend, error) {
+	if config.Primary == nil || config.Secondary == nil {
+		return nil, errors.New("the failover backend requires a primary and a secondary backend")
+	}
+	if config.HealthCheckBucket == "" {
+		return nil, errors.New("the failover backend requires a health check bucket")
+	}
+
+	if config.HealthCheckInterval <= 0 {
+		config.HealthCheckInterval = defaultHealthCheckInterval
+	}
+	if config.HealthCheckTimeout <= 0 {
+		config.HealthCheckTimeout = defaultHealthCheckTimeout
+	}
+	if config.FailureThreshold <= 0 {
+		config.FailureThreshold = defaultFailureThreshold
+	}
+
+	b := &FailoverBackend{
+		Backend:             config.Primary,
+		primary:             &monitoredBackend{name: "primary", backend: config.Primary, healthy: true},
+		secondary:           &monitoredBackend{name: "secondary", backend: config.Secondary, healthy: true},
+		healthCheckBucket:   config.HealthCheckBucket,
+		healthCheckInterval: config.HealthCheckInterval,
+		healthCheckTimeout:  config.HealthCheckTimeout,
+		failureThreshold:    config.FailureThreshold,
+		checkObject:         config.CheckObject,
+		stop:                make(chan struct{}),
+		done:                make(chan struct{}),
+	}
+
+	go b.run()
+
+	return b, nil
+}
+
+// Close stops the health checks
+func (b *FailoverBackend) Close() {
+	close(b.stop)
+	<-b.done
+}
+
+// check the health of both backends at each interval
+func (b *FailoverBackend) run() {
+	defer close(b.done)
+
+	ticker := time.NewTicker(b.healthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		b.check(b.primary)
+		b.check(b.secondary)
+
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// list one key of the health check bucket, a backend which does not answer before the timeout fails the check
+// a new check is not started while the previous one is still running
+func (b *FailoverBackend) check(m *monitoredBackend) {
+	b.mutex.Lock()
+	checking := m.checking
+	m.checking = true
+	b.mutex.Unlock()
+
+	if checking {
+		b.recordCheck(m, errors.New("the previous health check is still running"))
+		return
+	}
+
+	result := make(chan error, 1)
+
+	go func() {
+		_, err := m.backend.ListObjects(b.healthCheckBucket, ListOptions{MaxKeys: 1})
+
+		b.mutex.Lock()
+		m.checking = false
+		b.mutex.Unlock()
+
+		result <- err
+	}()
+
+	select {
+	case err := <-result:
+		b.recordCheck(m, err)
+	case <-time.After(b.healthCheckTimeout):
+		b.recordCheck(m, fmt.Errorf("no answer after %v", b.healthCheckTimeout))
+	}
+}
+
+// update the health of a backend with the result of a health check and log the transitions
+func (b *FailoverBackend) recordCheck(m *monitoredBackend, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if err == nil {
+		if !m.healthy {
+			log.Infof("Failover : the %s backend is healthy again after %d failed health check(s)", m.name, m.failures)
+		}
+		m.healthy = true
+		m.failures = 0
+		return
+	}
+
+	m.failures++
+	if m.healthy && m.failures >= b.failureThreshold {
+		m.healthy = false
+		log.Errorf("Failover : the %s backend is unhealthy after %d failed health check(s) : %v", m.name, m.failures, err)
+	}
+}
+
+// returns true if the backend is healthy
+func (b *FailoverBackend) isHealthy(m *monitoredBackend) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return m.healthy
+}
+
+// returns the backend of the downloads and the other backend : the primary backend, or the secondary backend when
+// the primary backend is unhealthy and the secondary backend is healthy
+func (b *FailoverBackend) choose() (*monitoredBackend, *monitoredBackend) {
+	if !b.isHealthy(b.primary) && b.isHealthy(b.secondary) {
+		return b.secondary, b.primary
+	}
+	return b.primary, b.secondary
+}
+
+// Returns the metadata of an object with the backend of the downloads, so that the stat done before issuing a download URL
+// (ex: archived check) does not wait for an unhealthy primary backend
+// with CheckObject, the metadata of the other healthy backend is returned when the object can not be found on the chosen backend
+func (b *FailoverBackend) StatObject(object BucketObject) (*ObjectInfo, error) {
+	if object.VersionID != "" {
+		return b.primary.backend.StatObject(object)
+	}
+
+	chosen, other := b.choose()
+
+	info, err := chosen.backend.StatObject(object)
+	if err != nil && b.checkObject && b.isHealthy(other) {
+		if otherInfo, otherErr := other.backend.StatObject(object); otherErr == nil {
+			return otherInfo, nil
+		}
+	}
+	return info, err
+}
+
+// Create a presigned URL for downloading a file with the primary backend, or with the secondary backend when the primary backend is unhealthy
+// with CheckObject, the URL of the other healthy backend is issued when the object can not be found on the chosen backend
+func (b *FailoverBackend) CreatePresignedURLForDownload(object BucketObject, expire time.Duration, headers ResponseHeaders) (string, error) {
+	if object.VersionID != "" {
+		return b.primary.backend.CreatePresignedURLForDownload(object, expire, headers)
+	}
+
+	chosen, other := b.choose()
+
+	if b.checkObject {
+		if _, err := chosen.backend.StatObject(object); err != nil {
+			if !b.isHealthy(other) {
+				return "", err
+			}
+			if _, otherErr := other.backend.StatObject(object); otherErr != nil {
+				return "", err
+			}
+
+			log.Warningf("Failover : %s not found on the %s backend (%v), download URL of the %s backend", object, chosen.name, err, other.name)
+			chosen = other
+		}
+	}
+
+	return chosen.backend.CreatePresignedURLForDownload(object, expire, headers)
+}
@@ -0,0 +1,196 @@
+package backend
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// backend whose listings and stats fail while it is down, the other operations are done by the backend
+type downBackend struct {
+	Backend
+
+	mutex sync.Mutex
+	down  bool
+}
+
+func (b *downBackend) setDown(down bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.down = down
+}
+
+func (b *downBackend) error() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.down {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func (b *downBackend) ListObjects(bucketName string, options ListOptions) (*ObjectListing, error) {
+	if err := b.error(); err != nil {
+		return nil, err
+	}
+	return b.Backend.ListObjects(bucketName, options)
+}
+
+func (b *downBackend) StatObject(object BucketObject) (*ObjectInfo, error) {
+	if err := b.error(); err != nil {
+		return nil, err
+	}
+	return b.Backend.StatObject(object)
+}
+
+// FS backend whose download URLs start with the base URL
+func newTestDownBackend(t *testing.T, baseURL string, buckets ...string) *downBackend {
+	root := t.TempDir()
+	for _, bucket := range buckets {
+		require.NoError(t, os.Mkdir(filepath.Join(root, bucket), 0o755))
+	}
+
+	b, err := NewFSBackend(FSBackendConfig{Root: root, BaseURL: baseURL})
+	require.NoError(t, err)
+
+	return &downBackend{Backend: b}
+}
+
+func newTestFailoverBackend(t *testing.T, primary Backend, secondary Backend, checkObject bool) *FailoverBackend {
+	b, err := NewFailoverBackend(FailoverBackendConfig{
+		Primary:             primary,
+		Secondary:           secondary,
+		HealthCheckBucket:   "health",
+		HealthCheckInterval: 5 * time.Millisecond,
+		FailureThreshold:    2,
+		CheckObject:         checkObject,
+	})
+	require.NoError(t, err)
+
+	return b
+}
+
+func downloadURL(t *testing.T, b Backend, object BucketObject) string {
+	url, err := b.CreatePresignedURLForDownload(object, time.Minute, ResponseHeaders{})
+	require.NoError(t, err)
+
+	return url
+}
+
+func TestNewFailoverBackend(t *testing.T) {
+	fsBackend := newTestFSBackendWithBuckets(t)
+
+	_, err := NewFailoverBackend(FailoverBackendConfig{Primary: fsBackend, HealthCheckBucket: "health"})
+	assert.Error(t, err)
+
+	_, err = NewFailoverBackend(FailoverBackendConfig{Primary: fsBackend, Secondary: fsBackend})
+	assert.ErrorContains(t, err, "health check bucket")
+}
+
+func TestFailoverBackend(t *testing.T) {
+	primary := newTestDownBackend(t, "http://primary/", "health", "mybucket")
+	secondary := newTestDownBackend(t, "http://secondary/", "health", "mybucket")
+
+	b := newTestFailoverBackend(t, primary, secondary, false)
+	defer b.Close()
+
+	file := BucketObject{BucketName: "mybucket", Key: "/file"}
+	assert.True(t, strings.HasPrefix(downloadURL(t, b, file), "http://primary/"))
+
+	// the download URLs are issued by the secondary backend while the primary backend is unhealthy
+	primary.setDown(true)
+	assert.Eventually(t, func() bool { return !b.isHealthy(b.primary) }, time.Second, 5*time.Millisecond)
+	assert.True(t, strings.HasPrefix(downloadURL(t, b, file), "http://secondary/"))
+
+	// the stats are done by the secondary backend, the other operations and the downloads of a version stay on the primary backend
+	_, err := b.StatObject(file)
+	assert.Equal(t, "NoSuchKey", errorCode(err))
+	assert.True(t, strings.HasPrefix(downloadURL(t, b, BucketObject{BucketName: "mybucket", Key: "/file", VersionID: "v1"}), "http://primary/"))
+	_, err = b.StatObject(BucketObject{BucketName: "mybucket", Key: "/file", VersionID: "v1"})
+	assert.ErrorContains(t, err, "connection refused")
+	_, err = b.ListObjects("mybucket", ListOptions{})
+	assert.ErrorContains(t, err, "connection refused")
+
+	// the primary backend is kept when both backends are unhealthy
+	secondary.setDown(true)
+	assert.Eventually(t, func() bool { return !b.isHealthy(b.secondary) }, time.Second, 5*time.Millisecond)
+	assert.True(t, strings.HasPrefix(downloadURL(t, b, file), "http://primary/"))
+
+	primary.setDown(false)
+	secondary.setDown(false)
+	assert.Eventually(t, func() bool { return b.isHealthy(b.primary) && b.isHealthy(b.secondary) }, time.Second, 5*time.Millisecond)
+	assert.True(t, strings.HasPrefix(downloadURL(t, b, file), "http://primary/"))
+}
+
+func TestFailoverBackendCheckObject(t *testing.T) {
+	primary := newTestDownBackend(t, "http://primary/", "health", "mybucket")
+	secondary := newTestDownBackend(t, "http://secondary/", "health", "mybucket")
+
+	b := newTestFailoverBackend(t, primary, secondary, true)
+	defer b.Close()
+
+	replicated := BucketObject{BucketName: "mybucket", Key: "/replicated"}
+	putReplicated(t, replicated, "replicated", primary, secondary)
+	notReplicated := BucketObject{BucketName: "mybucket", Key: "/not-replicated"}
+	putReplicated(t, notReplicated, "not replicated", primary)
+
+	assert.True(t, strings.HasPrefix(downloadURL(t, b, notReplicated), "http://primary/"))
+
+	_, err := b.CreatePresignedURLForDownload(BucketObject{BucketName: "mybucket", Key: "/missing"}, time.Minute, ResponseHeaders{})
+	assert.Equal(t, "NoSuchKey", errorCode(err))
+
+	primary.setDown(true)
+	assert.Eventually(t, func() bool { return !b.isHealthy(b.primary) }, time.Second, 5*time.Millisecond)
+	assert.True(t, strings.HasPrefix(downloadURL(t, b, replicated), "http://secondary/"))
+
+	// the object missing on the secondary backend is not issued by the unhealthy primary backend
+	_, err = b.CreatePresignedURLForDownload(notReplicated, time.Minute, ResponseHeaders{})
+	assert.Equal(t, "NoSuchKey", errorCode(err))
+
+	// the object missing on the secondary backend is issued by the primary backend when it is healthy again
+	primary.setDown(false)
+	assert.Eventually(t, func() bool { return b.isHealthy(b.primary) }, time.Second, 5*time.Millisecond)
+	assert.True(t, strings.HasPrefix(downloadURL(t, b, notReplicated), "http://primary/"))
+}
+
+func TestFailoverBackendCheckTimeout(t *testing.T) {
+	primary := newTestDownBackend(t, "http://primary/", "health")
+	secondary := newTestDownBackend(t, "http://secondary/", "health")
+
+	b := &FailoverBackend{
+		primary:            &monitoredBackend{name: "primary", backend: &slowBackend{Backend: primary, delay: 50 * time.Millisecond}, healthy: true},
+		secondary:          &monitoredBackend{name: "secondary", backend: secondary, healthy: true},
+		healthCheckBucket:  "health",
+		healthCheckTimeout: 5 * time.Millisecond,
+		failureThreshold:   2,
+	}
+
+	// a check still running fails the next check without starting a new listing
+	b.check(b.primary)
+	b.check(b.primary)
+	assert.False(t, b.isHealthy(b.primary))
+
+	b.check(b.secondary)
+	assert.True(t, b.isHealthy(b.secondary))
+}
+
+// backend whose listings answer after the delay
+type slowBackend struct {
+	Backend
+
+	delay time.Duration
+}
+
+func (b *slowBackend) ListObjects(bucketName string, options ListOptions) (*ObjectListing, error) {
+	time.Sleep(b.delay)
+	return b.Backend.ListObjects(bucketName, options)
+}
@@ -0,0 +1,1020 @@
+// Local filesystem implementation of the Backend interface for the developer laptops and the CI without S3 or Minio
+// A filesystem can not presign, the URLs are signed by s3proxy with HMAC-SHA256 and served by the /api/v1/fs/ routes
+
+package backend
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// FSPathPrefix is the path of the routes serving the signed URLs of the filesystem backend
+const FSPathPrefix = "/api/v1/fs/"
+
+// query parameters of the signed URLs
+const (
+	fsExpiresParam   = "expires"
+	fsSignatureParam = "signature"
+)
+
+// directory of the internal files (metadata, multipart uploads, temporary files) in the root directory
+// a bucket name can not start with a dot so it never conflicts with a bucket
+const fsInternalDir = ".s3proxy"
+
+// version id of the objects of an unversioned bucket
+const fsNullVersion = "null"
+
+// default page size of a listing as on S3
+const fsDefaultMaxKeys = 1000
+
+// FSBackendConfig for the filesystem backend
+type FSBackendConfig struct {
+	// Directory of the buckets, each bucket is a sub-directory (ex: /var/lib/s3proxy/mybucket)
+	Root string
+
+	// URL of s3proxy used in the signed URLs (ex: http://localhost:8080)
+	BaseURL string
+
+	// HMAC key of the signed URLs, a random key is generated when empty (the URLs are invalidated by a restart)
+	SigningKey []byte
+}
+
+// FSBackend stores the objects in a directory tree, the key of an object is its path in the bucket directory
+// the keys are normalized : "/folder/item" and "folder/item" are the same object
+type FSBackend struct {
+	config FSBackendConfig
+}
+
+// metadata of an object stored next to the objects in the internal directory
+type fsMetadata struct {
+	ETag        string            `json:"etag"`
+	ContentType string            `json:"contentType,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+}
+
+// multipart upload stored in the internal directory with its parts
+type fsUpload struct {
+	BucketName string `json:"bucket"`
+	Key        string `json:"key"`
+}
+
+// Create a filesystem backend, the root directory must exist
+func NewFSBackend(config FSBackendConfig) (*FSBackend, error) {
+	info, err := os.Stat(config.Root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", config.Root)
+	}
+
+	if len(config.SigningKey) == 0 {
+		config.SigningKey = make([]byte, 32)
+		if _, err := rand.Read(config.SigningKey); err != nil {
+			return nil, err
+		}
+	}
+
+	config.BaseURL = strings.TrimSuffix(config.BaseURL, "/")
+
+	return &FSBackend{config: config}, nil
+}
+
+// Create a signed URL for an upload served by PUT /api/v1/fs/:bucket/*key
+// the constraints are signed as query parameters and checked by the upload
+func (b *FSBackend) CreatePresignedURLForUpload(object BucketObject, expire time.Duration, constraints UploadConstraints) (*PresignedURL, error) {
+	if err := fsCheckEncryption(object); err != nil {
+		return nil, err
+	}
+
+	key, err := fsKey(object)
+	if err != nil {
+		return nil, err
+	}
+
+	query := make(url.Values)
+	headers := make(map[string]string)
+
+	if constraints.ContentType != "" {
+		query.Set("contentType", constraints.ContentType)
+		headers["Content-Type"] = constraints.ContentType
+	}
+	if constraints.ContentLength > 0 {
+		query.Set("contentLength", strconv.FormatInt(constraints.ContentLength, 10))
+	}
+	if constraints.ContentMD5 != "" {
+		query.Set("contentMD5", constraints.ContentMD5)
+	}
+	if constraints.ChecksumSHA256 != "" {
+		query.Set("checksumSHA256", constraints.ChecksumSHA256)
+	}
+	for name, value := range constraints.Metadata {
+		query.Set("x-amz-meta-"+name, value)
+	}
+
+	return &PresignedURL{URL: b.signedURL("PUT", object.BucketName, key, expire, query), Headers: headers}, nil
+}
+
+// Create a signed URL for a download served by GET /api/v1/fs/:bucket/*key
+func (b *FSBackend) CreatePresignedURLForDownload(object BucketObject, expire time.Duration, headers ResponseHeaders) (string, error) {
+	if err := fsCheckEncryption(object); err != nil {
+		return "", err
+	}
+
+	key, err := fsKey(object)
+	if err != nil {
+		return "", err
+	}
+
+	query := make(url.Values)
+
+	for name, value := range map[string]string{
+		"versionId":                    object.VersionID,
+		"response-content-disposition": headers.ContentDisposition,
+		"response-content-type":        headers.ContentType,
+		"response-cache-control":       headers.CacheControl,
+		"response-content-language":    headers.ContentLanguage,
+	} {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+
+	return b.signedURL("GET", object.BucketName, key, expire, query), nil
+}
+
+// build a signed URL, the signature covers the method, the path, the expiry and the other query parameters
+func (b *FSBackend) signedURL(method string, bucket string, key string, expire time.Duration, query url.Values) string {
+	urlPath := FSPathPrefix + bucket + "/" + key
+
+	query.Set(fsExpiresParam, strconv.FormatInt(time.Now().Add(expire).Unix(), 10))
+	query.Set(fsSignatureParam, b.sign(method, urlPath, query))
+
+	return b.config.BaseURL + (&url.URL{Path: urlPath}).EscapedPath() + "?" + query.Encode()
+}
+
+// HMAC-SHA256 of the request, the signature parameter is ignored
+func (b *FSBackend) sign(method string, urlPath string, query url.Values) string {
+	signed := make(url.Values, len(query))
+	for name, values := range query {
+		if name != fsSignatureParam {
+			signed[name] = values
+		}
+	}
+
+	mac := hmac.New(sha256.New, b.config.SigningKey)
+	fmt.Fprintf(mac, "%s\n%s\n%s", method, urlPath, signed.Encode())
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignedURL checks the signature and the expiry of a request on a signed URL
+// returns an error with the code SignatureDoesNotMatch or AccessDenied (expired URL)
+func (b *FSBackend) VerifySignedURL(method string, u *url.URL) error {
+	query := u.Query()
+
+	if !hmac.Equal([]byte(query.Get(fsSignatureParam)), []byte(b.sign(method, u.Path, query))) {
+		return awserr.New("SignatureDoesNotMatch", "The request signature does not match", nil)
+	}
+
+	expires, err := strconv.ParseInt(query.Get(fsExpiresParam), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return awserr.New("AccessDenied", "Request has expired", nil)
+	}
+
+	return nil
+}
+
+// Delete an object, deleting a missing object is not an error as on S3
+func (b *FSBackend) DeleteObject(object BucketObject) error {
+	if err := fsCheckVersion(object); err != nil {
+		return err
+	}
+
+	bucketPath, key, err := b.bucketPath(object)
+	if err != nil {
+		return err
+	}
+
+	objectPath := filepath.Join(bucketPath, filepath.FromSlash(key))
+
+	// a directory is not an object
+	if info, err := os.Stat(objectPath); err != nil || info.IsDir() {
+		return nil
+	}
+
+	if err := os.Remove(objectPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := os.Remove(b.metadataPath(object.BucketName, key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	removeEmptyDirs(filepath.Dir(objectPath), bucketPath)
+
+	return nil
+}
+
+// Delete several objects, stops at the first error
+func (b *FSBackend) BatchDeleteObjects(objects []BucketObject) error {
+	for _, object := range objects {
+		if err := b.DeleteObject(object); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Copy an object with its metadata and its tags
+func (b *FSBackend) CopyObject(sourceObject BucketObject, destinationObject BucketObject) error {
+	if err := fsCheckEncryption(destinationObject); err != nil {
+		return err
+	}
+
+	file, metadata, err := b.open(sourceObject)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = b.write(destinationObject, file, metadata, UploadConstraints{})
+
+	return err
+}
+
+// Returns the metadata of an object
+func (b *FSBackend) StatObject(object BucketObject) (*ObjectInfo, error) {
+	file, metadata, err := b.open(object)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return fsObjectInfo(object.Key, file, metadata)
+}
+
+// Returns one page of the objects of a bucket, the continuation token is the last key (or common prefix) of the previous page
+func (b *FSBackend) ListObjects(bucketName string, options ListOptions) (*ObjectListing, error) {
+	bucketPath, _, err := b.bucketPath(BucketObject{BucketName: bucketName})
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+
+	err = filepath.WalkDir(bucketPath, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.Type().IsRegular() {
+			relativePath, _ := filepath.Rel(bucketPath, filePath)
+			if key := filepath.ToSlash(relativePath); strings.HasPrefix(key, options.Prefix) {
+				keys = append(keys, key)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(keys)
+
+	maxKeys := int(options.MaxKeys)
+	if maxKeys <= 0 {
+		maxKeys = fsDefaultMaxKeys
+	}
+
+	listing := &ObjectListing{Objects: []ObjectInfo{}, CommonPrefixes: []string{}}
+	last := ""
+
+	for _, key := range keys {
+		token := options.ContinuationToken
+		if token != "" && (key <= token || options.Delimiter != "" && strings.HasSuffix(token, options.Delimiter) && strings.HasPrefix(key, token)) {
+			continue
+		}
+
+		commonPrefix := ""
+		if options.Delimiter != "" {
+			if index := strings.Index(key[len(options.Prefix):], options.Delimiter); index >= 0 {
+				commonPrefix = key[:len(options.Prefix)+index+len(options.Delimiter)]
+			}
+		}
+
+		if commonPrefix != "" && commonPrefix == last {
+			continue
+		}
+
+		if len(listing.Objects)+len(listing.CommonPrefixes) == maxKeys {
+			listing.IsTruncated = true
+			listing.NextContinuationToken = last
+			break
+		}
+
+		if commonPrefix != "" {
+			listing.CommonPrefixes = append(listing.CommonPrefixes, commonPrefix)
+			last = commonPrefix
+			continue
+		}
+
+		info, err := b.StatObject(BucketObject{BucketName: bucketName, Key: key})
+		if err != nil {
+			return nil, err
+		}
+
+		listing.Objects = append(listing.Objects, *info)
+		last = key
+	}
+
+	return listing, nil
+}
+
+// Initiate a multipart upload, the parts are stored in the internal directory until the completion
+func (b *FSBackend) CreateMultipartUpload(object BucketObject) (string, error) {
+	if err := fsCheckEncryption(object); err != nil {
+		return "", err
+	}
+
+	_, key, err := b.bucketPath(object)
+	if err != nil {
+		return "", err
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	uploadID := hex.EncodeToString(id)
+
+	if err := os.MkdirAll(b.uploadPath(uploadID), 0o755); err != nil {
+		return "", err
+	}
+
+	return uploadID, writeJSON(filepath.Join(b.uploadPath(uploadID), "upload.json"), fsUpload{BucketName: object.BucketName, Key: key})
+}
+
+// Create a signed URL for the upload of a part served by PUT /api/v1/fs/:bucket/*key?uploadId=...&partNumber=...
+func (b *FSBackend) CreatePresignedURLForUploadPart(object BucketObject, uploadID string, partNumber int64, expire time.Duration) (*PresignedURL, error) {
+	key, err := b.checkUpload(object, uploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{
+		"uploadId":   {uploadID},
+		"partNumber": {strconv.FormatInt(partNumber, 10)},
+	}
+
+	return &PresignedURL{URL: b.signedURL("PUT", object.BucketName, key, expire, query), Headers: map[string]string{}}, nil
+}
+
+// UploadPart stores a part of a multipart upload and returns its ETag
+func (b *FSBackend) UploadPart(object BucketObject, uploadID string, partNumber int64, body io.Reader) (string, error) {
+	if _, err := b.checkUpload(object, uploadID); err != nil {
+		return "", err
+	}
+
+	file, err := os.CreateTemp(b.uploadPath(uploadID), "part-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(file.Name())
+
+	digest := md5.New()
+
+	_, err = io.Copy(io.MultiWriter(file, digest), body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.Rename(file.Name(), b.partPath(uploadID, partNumber)); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%q", hex.EncodeToString(digest.Sum(nil))), nil
+}
+
+// Assemble the parts in ascending order, the ETag is computed as on S3 : MD5 of the MD5 of the parts followed by the number of parts
+func (b *FSBackend) CompleteMultipartUpload(object BucketObject, uploadID string, parts []CompletedPart) error {
+	if _, err := b.checkUpload(object, uploadID); err != nil {
+		return err
+	}
+
+	var (
+		paths   []string
+		digests []byte
+	)
+
+	for index, part := range parts {
+		if index > 0 && part.PartNumber <= parts[index-1].PartNumber {
+			return awserr.New("InvalidPartOrder", "The list of parts was not in ascending order", nil)
+		}
+
+		partPath := b.partPath(uploadID, part.PartNumber)
+
+		digest, err := fileMD5(partPath)
+		if errors.Is(err, fs.ErrNotExist) {
+			return awserr.New("InvalidPart", fmt.Sprintf("Part %d not found", part.PartNumber), err)
+		}
+		if err != nil {
+			return err
+		}
+		if etag := hex.EncodeToString(digest); strings.Trim(part.ETag, "\"") != etag {
+			return awserr.New("InvalidPart", fmt.Sprintf("ETag of the part %d does not match", part.PartNumber), nil)
+		}
+
+		paths = append(paths, partPath)
+		digests = append(digests, digest...)
+	}
+
+	multipartDigest := md5.Sum(digests)
+	metadata := fsMetadata{ETag: fmt.Sprintf("\"%s-%d\"", hex.EncodeToString(multipartDigest[:]), len(parts))}
+
+	reader := &fsPartsReader{paths: paths}
+	defer reader.Close()
+
+	if _, err := b.write(object, reader, metadata, UploadConstraints{}); err != nil {
+		return err
+	}
+
+	return os.RemoveAll(b.uploadPath(uploadID))
+}
+
+// MD5 digest of the content of a file
+func fileMD5(filePath string) ([]byte, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	digest := md5.New()
+	if _, err := io.Copy(digest, file); err != nil {
+		return nil, err
+	}
+	return digest.Sum(nil), nil
+}
+
+// reader of the parts of a multipart upload, each part is opened in turn and closed once read
+// so that a single part file is open at a time
+type fsPartsReader struct {
+	paths []string
+	file  *os.File
+}
+
+func (r *fsPartsReader) Read(p []byte) (int, error) {
+	for {
+		if r.file == nil {
+			if len(r.paths) == 0 {
+				return 0, io.EOF
+			}
+			file, err := os.Open(r.paths[0])
+			if err != nil {
+				return 0, err
+			}
+			r.file, r.paths = file, r.paths[1:]
+		}
+
+		n, err := r.file.Read(p)
+		if err == io.EOF {
+			err = r.Close()
+			if n > 0 || err != nil {
+				return n, err
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+// Close closes the part being read
+func (r *fsPartsReader) Close() error {
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+// Abort a multipart upload and delete its parts
+func (b *FSBackend) AbortMultipartUpload(object BucketObject, uploadID string) error {
+	if _, err := b.checkUpload(object, uploadID); err != nil {
+		return err
+	}
+	return os.RemoveAll(b.uploadPath(uploadID))
+}
+
+// POST policies are not supported
+func (b *FSBackend) CreatePresignedPost(object BucketObject, expire time.Duration, conditions PostConditions) (*PresignedPost, error) {
+	return nil, awserr.New("NotImplemented", "POST policies are not supported by the filesystem backend", nil)
+}
+
+// Returns the content of an object, honors the ranges and the conditional headers
+func (b *FSBackend) GetObject(object BucketObject, options GetOptions) (*ObjectContent, error) {
+	if err := fsCheckEncryption(object); err != nil {
+		return nil, err
+	}
+
+	file, metadata, err := b.open(object)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := fsObjectInfo(object.Key, file, metadata)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if options.IfNoneMatch != "" && options.IfNoneMatch == info.ETag ||
+		!options.IfModifiedSince.IsZero() && !info.LastModified.Truncate(time.Second).After(options.IfModifiedSince) {
+		file.Close()
+		return nil, awserr.NewRequestFailure(awserr.New("NotModified", "Not Modified", nil), 304, "")
+	}
+
+	content := &ObjectContent{ObjectInfo: *info, Body: file}
+
+	if options.Range != "" {
+		start, end, ok := parseRange(options.Range, info.Size)
+		if !ok {
+			file.Close()
+			return nil, awserr.NewRequestFailure(awserr.New("InvalidRange", "The requested range is not satisfiable", nil), 416, "")
+		}
+
+		content.Size = end - start + 1
+		content.ContentRange = fmt.Sprintf("bytes %d-%d/%d", start, end, info.Size)
+		content.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.NewSectionReader(file, start, content.Size), file}
+	}
+
+	return content, nil
+}
+
+// parse a single range "bytes=start-end", "bytes=start-" or "bytes=-suffix"
+func parseRange(s string, size int64) (int64, int64, bool) {
+	spec, found := strings.CutPrefix(s, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return 0, 0, false
+	}
+
+	first, last, found := strings.Cut(spec, "-")
+	if !found {
+		return 0, 0, false
+	}
+
+	if first == "" {
+		suffix, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || suffix <= 0 || size == 0 {
+			return 0, 0, false
+		}
+		return max(size-suffix, 0), size - 1, true
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start >= size {
+		return 0, 0, false
+	}
+
+	end := size - 1
+	if last != "" {
+		if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+			return 0, 0, false
+		}
+		end = min(end, size-1)
+	}
+
+	return start, end, true
+}
+
+// Write the content of an object and returns its ETag
+func (b *FSBackend) PutObject(object BucketObject, body io.Reader, options PutOptions) (string, error) {
+	return b.UploadObject(object, body, options, UploadConstraints{})
+}
+
+// UploadObject writes the content of an object uploaded with a signed URL, the object is not modified if the content does not match the constraints
+// (size, MD5 or SHA-256 digests), the error code is then IncompleteBody or BadDigest
+func (b *FSBackend) UploadObject(object BucketObject, body io.Reader, options PutOptions, constraints UploadConstraints) (string, error) {
+	if err := fsCheckEncryption(object); err != nil {
+		return "", err
+	}
+
+	return b.write(object, body, fsMetadata{ContentType: options.ContentType, Metadata: options.Metadata}, constraints)
+}
+
+// Returns the tags of an object
+func (b *FSBackend) GetObjectTagging(object BucketObject) (map[string]string, error) {
+	file, metadata, err := b.open(object)
+	if err != nil {
+		return nil, err
+	}
+	file.Close()
+
+	if metadata.Tags == nil {
+		return map[string]string{}, nil
+	}
+	return metadata.Tags, nil
+}
+
+// Replace the tags of an object
+func (b *FSBackend) PutObjectTagging(object BucketObject, tags map[string]string) error {
+	return b.updateMetadata(object, func(metadata *fsMetadata) {
+		metadata.Tags = tags
+	})
+}
+
+// Remove the tags of an object
+func (b *FSBackend) DeleteObjectTagging(object BucketObject) error {
+	return b.updateMetadata(object, func(metadata *fsMetadata) {
+		metadata.Tags = nil
+	})
+}
+
+// The filesystem is not versioned, each object is listed as its single "null" version as on an unversioned S3 bucket
+func (b *FSBackend) ListObjectVersions(bucketName string, options ListOptions) (*VersionListing, error) {
+	objects, err := b.ListObjects(bucketName, options)
+	if err != nil {
+		return nil, err
+	}
+
+	listing := &VersionListing{
+		Versions:              make([]ObjectVersion, len(objects.Objects)),
+		CommonPrefixes:        objects.CommonPrefixes,
+		IsTruncated:           objects.IsTruncated,
+		NextContinuationToken: objects.NextContinuationToken,
+	}
+
+	for index, object := range objects.Objects {
+		object.VersionID = fsNullVersion
+		listing.Versions[index] = ObjectVersion{ObjectInfo: object, IsLatest: true}
+	}
+
+	return listing, nil
+}
+
+// error of the Object Lock operations, as on a bucket without Object Lock
+var errFSObjectLock = awserr.New("InvalidRequest", "Object Lock is not supported by the filesystem backend", nil)
+
+// Object Lock is not supported
+func (b *FSBackend) GetObjectRetention(object BucketObject) (*ObjectRetention, error) {
+	return nil, errFSObjectLock
+}
+
+// Object Lock is not supported
+func (b *FSBackend) PutObjectRetention(object BucketObject, retention ObjectRetention, bypassGovernance bool) error {
+	return errFSObjectLock
+}
+
+// Object Lock is not supported
+func (b *FSBackend) GetObjectLegalHold(object BucketObject) (bool, error) {
+	return false, errFSObjectLock
+}
+
+// Object Lock is not supported
+func (b *FSBackend) PutObjectLegalHold(object BucketObject, legalHold bool) error {
+	return errFSObjectLock
+}
+
+// The objects are never archived
+func (b *FSBackend) RestoreObject(object BucketObject, options RestoreOptions) (bool, error) {
+	if _, err := b.StatObject(object); err != nil {
+		return false, err
+	}
+	return false, awserr.New("InvalidObjectState", "Restore is not allowed for the object's current storage class", nil)
+}
+
+// normalized key of an object : without leading "/" and without "." or ".." elements
+func fsKey(object BucketObject) (string, error) {
+	key := strings.TrimPrefix(path.Clean("/"+object.Key), "/")
+	if key == "" {
+		return "", awserr.New("InvalidArgument", "Invalid key "+object.Key, nil)
+	}
+	return key, nil
+}
+
+// directory of the bucket of an object and the normalized key of the object, the directory must exist
+func (b *FSBackend) bucketPath(object BucketObject) (string, string, error) {
+	bucket := object.BucketName
+	if bucket == "" || strings.HasPrefix(bucket, ".") || strings.ContainsAny(bucket, `/\`) {
+		return "", "", awserr.New("InvalidBucketName", "Invalid bucket name "+bucket, nil)
+	}
+
+	bucketPath := filepath.Join(b.config.Root, bucket)
+	if info, err := os.Stat(bucketPath); err != nil || !info.IsDir() {
+		return "", "", awserr.New(s3.ErrCodeNoSuchBucket, "The specified bucket does not exist", err)
+	}
+
+	if object.Key == "" {
+		return bucketPath, "", nil
+	}
+
+	key, err := fsKey(object)
+	return bucketPath, key, err
+}
+
+func (b *FSBackend) metadataPath(bucket string, key string) string {
+	return filepath.Join(b.config.Root, fsInternalDir, "metadata", bucket, filepath.FromSlash(key)+".json")
+}
+
+func (b *FSBackend) uploadPath(uploadID string) string {
+	return filepath.Join(b.config.Root, fsInternalDir, "uploads", uploadID)
+}
+
+func (b *FSBackend) partPath(uploadID string, partNumber int64) string {
+	return filepath.Join(b.uploadPath(uploadID), strconv.FormatInt(partNumber, 10))
+}
+
+// check the upload exists and belongs to the object, returns the normalized key
+func (b *FSBackend) checkUpload(object BucketObject, uploadID string) (string, error) {
+	_, key, err := b.bucketPath(object)
+	if err != nil {
+		return "", err
+	}
+
+	// the upload id is checked before being used in a path
+	var upload fsUpload
+	if _, err := hex.DecodeString(uploadID); err != nil || uploadID == "" ||
+		readJSON(filepath.Join(b.uploadPath(uploadID), "upload.json"), &upload) != nil ||
+		upload.BucketName != object.BucketName || upload.Key != key {
+		return "", awserr.New(s3.ErrCodeNoSuchUpload, "The specified upload does not exist", nil)
+	}
+
+	return key, nil
+}
+
+// open the content of an object and read its metadata
+func (b *FSBackend) open(object BucketObject) (*os.File, fsMetadata, error) {
+	var metadata fsMetadata
+
+	if err := fsCheckVersion(object); err != nil {
+		return nil, metadata, err
+	}
+
+	bucketPath, key, err := b.bucketPath(object)
+	if err != nil {
+		return nil, metadata, err
+	}
+
+	file, err := os.Open(filepath.Join(bucketPath, filepath.FromSlash(key)))
+	if err == nil {
+		var info os.FileInfo
+		if info, err = file.Stat(); err == nil && info.IsDir() {
+			file.Close()
+			err = fs.ErrNotExist
+		}
+	}
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, metadata, awserr.New(s3.ErrCodeNoSuchKey, "The specified key does not exist", err)
+		}
+		return nil, metadata, err
+	}
+
+	// a file copied in the bucket directory without s3proxy has no metadata
+	if err := readJSON(b.metadataPath(object.BucketName, key), &metadata); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		file.Close()
+		return nil, metadata, err
+	}
+
+	return file, metadata, nil
+}
+
+// write the content of an object in a temporary file renamed once the content is checked
+func (b *FSBackend) write(object BucketObject, body io.Reader, metadata fsMetadata, constraints UploadConstraints) (string, error) {
+	bucketPath, key, err := b.bucketPath(object)
+	if err != nil {
+		return "", err
+	}
+
+	tmpDir := filepath.Join(b.config.Root, fsInternalDir, "tmp")
+	if err := os.MkdirAll(tmpDir, 0o755); err != nil {
+		return "", err
+	}
+
+	file, err := os.CreateTemp(tmpDir, "object-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(file.Name())
+
+	var (
+		md5Digest    = md5.New()
+		sha256Digest = sha256.New()
+	)
+
+	size, err := io.Copy(io.MultiWriter(file, md5Digest, sha256Digest), body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if err := checkConstraints(size, md5Digest, sha256Digest, constraints); err != nil {
+		return "", err
+	}
+
+	if metadata.ETag == "" {
+		metadata.ETag = fmt.Sprintf("%q", hex.EncodeToString(md5Digest.Sum(nil)))
+	}
+
+	objectPath := filepath.Join(bucketPath, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(objectPath), 0o755); err != nil {
+		return "", err
+	}
+
+	// the metadata is written in a temp file before the content is renamed, then renamed just after it :
+	// a failed metadata write leaves the previous object unchanged, and a failed metadata rename removes the new content
+	metadataPath := b.metadataPath(object.BucketName, key)
+	metadataTmpPath, err := writeTempJSON(metadataPath, metadata)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(metadataTmpPath)
+
+	if err := os.Rename(file.Name(), objectPath); err != nil {
+		return "", err
+	}
+
+	if err := os.Rename(metadataTmpPath, metadataPath); err != nil {
+		if removeErr := os.Remove(objectPath); removeErr != nil {
+			log.Errorf("Failed to remove the content of %s without metadata : %v", object, removeErr)
+		}
+		return "", err
+	}
+
+	return metadata.ETag, nil
+}
+
+// check the size and the digests of an uploaded content
+func checkConstraints(size int64, md5Digest hash.Hash, sha256Digest hash.Hash, constraints UploadConstraints) error {
+	if constraints.ContentLength > 0 && size != constraints.ContentLength {
+		return awserr.New("IncompleteBody", fmt.Sprintf("The body size %d does not match the signed content length %d", size, constraints.ContentLength), nil)
+	}
+
+	if constraints.ContentMD5 != "" && base64.StdEncoding.EncodeToString(md5Digest.Sum(nil)) != constraints.ContentMD5 {
+		return awserr.New("BadDigest", "The Content-MD5 you specified did not match what we received", nil)
+	}
+
+	if constraints.ChecksumSHA256 != "" && base64.StdEncoding.EncodeToString(sha256Digest.Sum(nil)) != constraints.ChecksumSHA256 {
+		return awserr.New("BadDigest", "The SHA-256 checksum you specified did not match what we received", nil)
+	}
+
+	return nil
+}
+
+// read, modify and write the metadata of an existing object
+func (b *FSBackend) updateMetadata(object BucketObject, update func(metadata *fsMetadata)) error {
+	file, metadata, err := b.open(object)
+	if err != nil {
+		return err
+	}
+
+	if metadata.ETag == "" {
+		info, err := fsObjectInfo(object.Key, file, metadata)
+		if err != nil {
+			file.Close()
+			return err
+		}
+		metadata.ETag = info.ETag
+	}
+	file.Close()
+
+	update(&metadata)
+
+	key, _ := fsKey(object)
+
+	return writeJSON(b.metadataPath(object.BucketName, key), metadata)
+}
+
+// metadata of an opened object
+func fsObjectInfo(key string, file *os.File, metadata fsMetadata) (*ObjectInfo, error) {
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	info := &ObjectInfo{
+		Key:          key,
+		Size:         stat.Size(),
+		ETag:         metadata.ETag,
+		ContentType:  metadata.ContentType,
+		LastModified: stat.ModTime().UTC(),
+		Metadata:     metadata.Metadata,
+	}
+
+	// weak ETag of the files without metadata, computing their MD5 would be too slow for a listing
+	if info.ETag == "" {
+		info.ETag = fmt.Sprintf("\"%x-%x\"", stat.ModTime().UnixNano(), stat.Size())
+	}
+	if info.ContentType == "" {
+		info.ContentType = "application/octet-stream"
+	}
+	if info.Metadata == nil {
+		info.Metadata = map[string]string{}
+	}
+
+	return info, nil
+}
+
+// the filesystem is not versioned, only the "null" version exists
+func fsCheckVersion(object BucketObject) error {
+	if object.VersionID != "" && object.VersionID != fsNullVersion {
+		return awserr.New("NoSuchVersion", "The specified version does not exist", nil)
+	}
+	return nil
+}
+
+// server-side encryption is not supported
+func fsCheckEncryption(object BucketObject) error {
+	if object.Encryption.Mode != "" {
+		return awserr.New(ErrCodeInvalidEncryption, "server-side encryption is not supported by the filesystem backend", nil)
+	}
+	return nil
+}
+
+// remove the empty directories from dir up to root (excluded)
+func removeEmptyDirs(dir string, root string) {
+	for dir != root && strings.HasPrefix(dir, root) {
+		if os.Remove(dir) != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+func readJSON(filePath string, value interface{}) error {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, value)
+}
+
+// write a JSON file atomically : a temp file of the same directory is renamed so that a reader never sees a partial file
+func writeJSON(filePath string, value interface{}) error {
+	tmpPath, err := writeTempJSON(filePath, value)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+
+	return os.Rename(tmpPath, filePath)
+}
+
+// write a JSON value in a temp file of the directory of the file path and returns the path of the temp file
+func writeTempJSON(filePath string, value interface{}) (string, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+		return "", err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(filePath), ".tmp-")
+	if err != nil {
+		return "", err
+	}
+
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(file.Name(), 0o644)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+
+	return file.Name(), nil
+}
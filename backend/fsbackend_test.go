@@ -0,0 +1,277 @@
+package backend
+
+import (
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const fsTestBucket = "mybucket"
+
+func newTestFSBackend(t *testing.T) *FSBackend {
+	root := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(root, fsTestBucket), 0o755))
+
+	b, err := NewFSBackend(FSBackendConfig{Root: root, BaseURL: "http://localhost:8080/"})
+	require.NoError(t, err)
+
+	return b
+}
+
+func readContent(t *testing.T, b *FSBackend, key string, options GetOptions) string {
+	content, err := b.GetObject(BucketObject{BucketName: fsTestBucket, Key: key}, options)
+	require.NoError(t, err)
+	defer content.Body.Close()
+
+	data, err := io.ReadAll(content.Body)
+	require.NoError(t, err)
+
+	return string(data)
+}
+
+func TestFSPutGetObject(t *testing.T) {
+	b := newTestFSBackend(t)
+	object := BucketObject{BucketName: fsTestBucket, Key: "/folder/file.txt"}
+
+	etag, err := b.PutObject(object, strings.NewReader("hello world"), PutOptions{ContentType: "text/plain", Metadata: map[string]string{"tenant": "tenant1"}})
+	require.NoError(t, err)
+	assert.Equal(t, `"5eb63bbbe01eeed093cb22bb8f5acdc3"`, etag)
+
+	info, err := b.StatObject(object)
+	require.NoError(t, err)
+	assert.Equal(t, int64(11), info.Size)
+	assert.Equal(t, etag, info.ETag)
+	assert.Equal(t, "text/plain", info.ContentType)
+	assert.Equal(t, map[string]string{"tenant": "tenant1"}, info.Metadata)
+
+	// the metadata is written atomically, no temp file is left
+	files, err := filepath.Glob(filepath.Join(b.config.Root, fsInternalDir, "metadata", fsTestBucket, "folder", "*"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{b.metadataPath(fsTestBucket, "folder/file.txt")}, files)
+
+	// the leading "/" of the key is ignored
+	assert.Equal(t, "hello world", readContent(t, b, "folder/file.txt", GetOptions{}))
+	assert.Equal(t, "world", readContent(t, b, object.Key, GetOptions{Range: "bytes=6-"}))
+	assert.Equal(t, "hello", readContent(t, b, object.Key, GetOptions{Range: "bytes=0-4"}))
+	assert.Equal(t, "ld", readContent(t, b, object.Key, GetOptions{Range: "bytes=-2"}))
+
+	_, err = b.GetObject(object, GetOptions{Range: "bytes=20-30"})
+	assert.Equal(t, "InvalidRange", errorCode(err))
+
+	_, err = b.GetObject(object, GetOptions{IfNoneMatch: etag})
+	assert.Equal(t, "NotModified", errorCode(err))
+
+	_, err = b.GetObject(BucketObject{BucketName: fsTestBucket, Key: "/folder"}, GetOptions{})
+	assert.Equal(t, "NoSuchKey", errorCode(err))
+
+	_, err = b.StatObject(BucketObject{BucketName: "unknown", Key: object.Key})
+	assert.Equal(t, "NoSuchBucket", errorCode(err))
+
+	_, err = b.StatObject(BucketObject{BucketName: fsTestBucket, Key: object.Key, VersionID: "v1"})
+	assert.Equal(t, "NoSuchVersion", errorCode(err))
+
+	_, err = b.PutObject(BucketObject{BucketName: fsTestBucket, Key: "/file", Encryption: Encryption{Mode: EncryptionSSES3}}, strings.NewReader(""), PutOptions{})
+	assert.Equal(t, ErrCodeInvalidEncryption, errorCode(err))
+}
+
+func TestFSKeyTraversal(t *testing.T) {
+	b := newTestFSBackend(t)
+
+	_, err := b.PutObject(BucketObject{BucketName: fsTestBucket, Key: "/../../escaped"}, strings.NewReader("content"), PutOptions{})
+	require.NoError(t, err)
+
+	assert.FileExists(t, filepath.Join(b.config.Root, fsTestBucket, "escaped"))
+
+	_, err = b.PutObject(BucketObject{BucketName: "..", Key: "/file"}, strings.NewReader("content"), PutOptions{})
+	assert.Equal(t, "InvalidBucketName", errorCode(err))
+}
+
+func TestFSUploadObjectConstraints(t *testing.T) {
+	b := newTestFSBackend(t)
+	object := BucketObject{BucketName: fsTestBucket, Key: "/file"}
+
+	_, err := b.UploadObject(object, strings.NewReader("hello"), PutOptions{}, UploadConstraints{ContentLength: 4})
+	assert.Equal(t, "IncompleteBody", errorCode(err))
+
+	_, err = b.UploadObject(object, strings.NewReader("hello"), PutOptions{}, UploadConstraints{ContentMD5: "1B2M2Y8AsgTpgAmY7PhCfg=="})
+	assert.Equal(t, "BadDigest", errorCode(err))
+
+	// the object is not written when the content does not match
+	_, err = b.StatObject(object)
+	assert.Equal(t, "NoSuchKey", errorCode(err))
+
+	_, err = b.UploadObject(object, strings.NewReader(""), PutOptions{}, UploadConstraints{
+		ContentMD5:     "1B2M2Y8AsgTpgAmY7PhCfg==",
+		ChecksumSHA256: "47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=",
+	})
+	assert.NoError(t, err)
+}
+
+func TestFSCopyDeleteObject(t *testing.T) {
+	b := newTestFSBackend(t)
+	source := BucketObject{BucketName: fsTestBucket, Key: "/folder/file"}
+	destination := BucketObject{BucketName: fsTestBucket, Key: "/copy/file"}
+
+	_, err := b.PutObject(source, strings.NewReader("content"), PutOptions{ContentType: "text/plain"})
+	require.NoError(t, err)
+	require.NoError(t, b.PutObjectTagging(source, map[string]string{"tenant": "tenant1"}))
+
+	require.NoError(t, b.CopyObject(source, destination))
+	assert.Equal(t, "content", readContent(t, b, destination.Key, GetOptions{}))
+
+	tags, err := b.GetObjectTagging(destination)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"tenant": "tenant1"}, tags)
+
+	assert.Equal(t, "NoSuchKey", errorCode(b.CopyObject(BucketObject{BucketName: fsTestBucket, Key: "/missing"}, destination)))
+
+	require.NoError(t, b.BatchDeleteObjects([]BucketObject{source, destination}))
+	require.NoError(t, b.DeleteObject(source))
+
+	_, err = b.StatObject(destination)
+	assert.Equal(t, "NoSuchKey", errorCode(err))
+
+	// the empty directories are removed
+	entries, err := os.ReadDir(filepath.Join(b.config.Root, fsTestBucket))
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestFSListObjects(t *testing.T) {
+	b := newTestFSBackend(t)
+
+	for _, key := range []string{"a.txt", "folder/b.txt", "folder/sub/c.txt", "folder/d.txt", "other/e.txt"} {
+		_, err := b.PutObject(BucketObject{BucketName: fsTestBucket, Key: key}, strings.NewReader(key), PutOptions{})
+		require.NoError(t, err)
+	}
+
+	keys := func(listing *ObjectListing) []string {
+		var result []string
+		for _, object := range listing.Objects {
+			result = append(result, object.Key)
+		}
+		return result
+	}
+
+	listing, err := b.ListObjects(fsTestBucket, ListOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a.txt", "folder/b.txt", "folder/d.txt", "folder/sub/c.txt", "other/e.txt"}, keys(listing))
+
+	listing, err = b.ListObjects(fsTestBucket, ListOptions{Prefix: "folder/", Delimiter: "/"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"folder/b.txt", "folder/d.txt"}, keys(listing))
+	assert.Equal(t, []string{"folder/sub/"}, listing.CommonPrefixes)
+
+	// pagination with a common prefix
+	listing, err = b.ListObjects(fsTestBucket, ListOptions{Delimiter: "/", MaxKeys: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a.txt"}, keys(listing))
+	assert.Equal(t, []string{"folder/"}, listing.CommonPrefixes)
+	assert.True(t, listing.IsTruncated)
+
+	listing, err = b.ListObjects(fsTestBucket, ListOptions{Delimiter: "/", MaxKeys: 2, ContinuationToken: listing.NextContinuationToken})
+	require.NoError(t, err)
+	assert.Empty(t, listing.Objects)
+	assert.Equal(t, []string{"other/"}, listing.CommonPrefixes)
+	assert.False(t, listing.IsTruncated)
+
+	_, err = b.ListObjects("unknown", ListOptions{})
+	assert.Equal(t, "NoSuchBucket", errorCode(err))
+}
+
+func TestFSMultipartUpload(t *testing.T) {
+	b := newTestFSBackend(t)
+	object := BucketObject{BucketName: fsTestBucket, Key: "/multipart"}
+
+	uploadID, err := b.CreateMultipartUpload(object)
+	require.NoError(t, err)
+
+	etag1, err := b.UploadPart(object, uploadID, 1, strings.NewReader("hello "))
+	require.NoError(t, err)
+	etag2, err := b.UploadPart(object, uploadID, 2, strings.NewReader("world"))
+	require.NoError(t, err)
+
+	err = b.CompleteMultipartUpload(object, uploadID, []CompletedPart{{PartNumber: 2, ETag: etag2}, {PartNumber: 1, ETag: etag1}})
+	assert.Equal(t, "InvalidPartOrder", errorCode(err))
+
+	err = b.CompleteMultipartUpload(object, uploadID, []CompletedPart{{PartNumber: 1, ETag: etag2}})
+	assert.Equal(t, "InvalidPart", errorCode(err))
+
+	require.NoError(t, b.CompleteMultipartUpload(object, uploadID, []CompletedPart{{PartNumber: 1, ETag: etag1}, {PartNumber: 2, ETag: etag2}}))
+	assert.Equal(t, "hello world", readContent(t, b, object.Key, GetOptions{}))
+
+	info, err := b.StatObject(object)
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(info.ETag, `-2"`))
+
+	assert.Equal(t, "NoSuchUpload", errorCode(b.AbortMultipartUpload(object, uploadID)))
+	assert.Equal(t, "NoSuchUpload", errorCode(b.AbortMultipartUpload(object, "../../mybucket")))
+}
+
+func TestFSPartsReader(t *testing.T) {
+	dir := t.TempDir()
+
+	var paths []string
+	for index, content := range []string{"hello ", "", "world"} {
+		path := filepath.Join(dir, strconv.Itoa(index))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+		paths = append(paths, path)
+	}
+
+	// a single part is open at a time
+	reader := &fsPartsReader{paths: paths}
+	buffer := make([]byte, 4)
+
+	n, err := reader.Read(buffer)
+	require.NoError(t, err)
+	assert.Equal(t, "hell", string(buffer[:n]))
+	assert.Equal(t, paths[1:], reader.paths)
+
+	rest, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "o world", string(rest))
+	assert.Nil(t, reader.file)
+
+	assert.NoError(t, reader.Close())
+}
+
+func TestFSSignedURL(t *testing.T) {
+	b := newTestFSBackend(t)
+	object := BucketObject{BucketName: fsTestBucket, Key: "/folder/my file.txt"}
+
+	presignedURL, err := b.CreatePresignedURLForUpload(object, time.Minute, UploadConstraints{ContentType: "text/plain", Metadata: map[string]string{"tenant": "tenant1"}})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"Content-Type": "text/plain"}, presignedURL.Headers)
+
+	u, err := url.Parse(presignedURL.URL)
+	require.NoError(t, err)
+	assert.Equal(t, "localhost:8080", u.Host)
+	assert.Equal(t, "/api/v1/fs/mybucket/folder/my file.txt", u.Path)
+	assert.Equal(t, "tenant1", u.Query().Get("x-amz-meta-tenant"))
+
+	assert.NoError(t, b.VerifySignedURL("PUT", u))
+	assert.Equal(t, "SignatureDoesNotMatch", errorCode(b.VerifySignedURL("GET", u)))
+
+	// a constraint can not be modified
+	query := u.Query()
+	query.Set("contentType", "text/html")
+	tampered := *u
+	tampered.RawQuery = query.Encode()
+	assert.Equal(t, "SignatureDoesNotMatch", errorCode(b.VerifySignedURL("PUT", &tampered)))
+
+	downloadURL, err := b.CreatePresignedURLForDownload(object, -time.Minute, ResponseHeaders{ContentDisposition: "attachment"})
+	require.NoError(t, err)
+
+	u, err = url.Parse(downloadURL)
+	require.NoError(t, err)
+	assert.Equal(t, "attachment", u.Query().Get("response-content-disposition"))
+	assert.Equal(t, "AccessDenied", errorCode(b.VerifySignedURL("GET", u)))
+}
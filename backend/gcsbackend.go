@@ -0,0 +1,982 @@
+// Google Cloud Storage implementation of the Backend interface
+// The backend uses the XML API for the contents of the objects (as S3) and the JSON API for the metadata and the rewrites,
+// the requests are authorized with an OAuth token of a service account and the presigned URLs are V4 signed URLs
+
+package backend
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// GCS storage classes
+const (
+	gcsStorageClassStandard = "STANDARD"
+	gcsStorageClassNearline = "NEARLINE"
+	gcsStorageClassColdline = "COLDLINE"
+	gcsStorageClassArchive  = "ARCHIVE"
+)
+
+const (
+	// size of the parts of a PutObject, a body smaller than one part is sent with a single upload
+	gcsPartSize int64 = 8 * 1024 * 1024
+	// GCS has no object tags, the tags are stored as custom metadata with this prefix
+	gcsTagPrefix = "s3proxy-tag-"
+)
+
+// GCSBackendConfig for the Google Cloud Storage backend
+type GCSBackendConfig struct {
+	// URL of the Cloud Storage API, https://storage.googleapis.com when empty
+	Endpoint string
+
+	// Path of the JSON key file of the service account, its private key signs the URLs and the OAuth token requests
+	CredentialsFile string
+
+	// client of the requests to Cloud Storage, http.DefaultClient when nil
+	HTTPClient *http.Client
+}
+
+// GCSBackend stores the objects in Cloud Storage buckets, the keys are normalized : "/folder/item" and "folder/item" are the same object
+// the version id of an object is its generation
+type GCSBackend struct {
+	config      GCSBackendConfig
+	endpoint    *url.URL
+	origin      string
+	credentials gcsCredentials
+	privateKey  *rsa.PrivateKey
+	client      *http.Client
+
+	tokenMutex  sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+// Create a Google Cloud Storage backend with the credentials of a service account
+func NewGCSBackend(config GCSBackendConfig) (*GCSBackend, error) {
+	credentials, privateKey, err := readGCSCredentials(config.CredentialsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Endpoint == "" {
+		config.Endpoint = "https://storage.googleapis.com"
+	}
+	config.Endpoint = strings.TrimSuffix(config.Endpoint, "/")
+
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid GCS endpoint %q", config.Endpoint)
+	}
+
+	client := config.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &GCSBackend{
+		config:      config,
+		endpoint:    endpoint,
+		origin:      endpoint.Scheme + "://" + endpoint.Host,
+		credentials: credentials,
+		privateKey:  privateKey,
+		client:      client,
+	}, nil
+}
+
+// Create a V4 signed URL for an upload, the constraints are signed as headers so GCS rejects the uploads which do not send the same headers
+// the SHA-256 checksum is not supported by GCS and is not checked
+func (b *GCSBackend) CreatePresignedURLForUpload(object BucketObject, expire time.Duration, constraints UploadConstraints) (*PresignedURL, error) {
+	header, err := b.writeHeaders(object)
+	if err != nil {
+		return nil, err
+	}
+
+	if constraints.ContentType != "" {
+		header.Set("Content-Type", constraints.ContentType)
+	}
+	if constraints.ContentLength > 0 {
+		header.Set("Content-Length", strconv.FormatInt(constraints.ContentLength, 10))
+	}
+	if constraints.ContentMD5 != "" {
+		header.Set("Content-MD5", constraints.ContentMD5)
+	}
+	for name, value := range constraints.Metadata {
+		header.Set("x-goog-meta-"+name, value)
+	}
+
+	headers := make(map[string]string, len(header))
+	for name := range header {
+		headers[name] = header.Get(name)
+	}
+
+	bucket, name := gcsObject(object)
+
+	signedURL, err := b.signedURL("PUT", bucket, name, expire, headers, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PresignedURL{URL: signedURL, Headers: headers}, nil
+}
+
+// Create a V4 signed URL for a download, GCS only overrides the Content-Disposition and the Content-Type of the response
+// With SSE-C, the client has to send the customer key headers
+func (b *GCSBackend) CreatePresignedURLForDownload(object BucketObject, expire time.Duration, headers ResponseHeaders) (string, error) {
+	if _, _, err := gcsEncryption(object.Encryption); err != nil {
+		return "", err
+	}
+
+	query := gcsGeneration(object)
+	if headers.ContentDisposition != "" {
+		query.Set("response-content-disposition", headers.ContentDisposition)
+	}
+	if headers.ContentType != "" {
+		query.Set("response-content-type", headers.ContentType)
+	}
+
+	bucket, name := gcsObject(object)
+
+	return b.signedURL("GET", bucket, name, expire, nil, query)
+}
+
+// Delete an object, deleting a missing object is not an error as on S3
+func (b *GCSBackend) DeleteObject(object BucketObject) error {
+	bucket, name := gcsObject(object)
+
+	response, err := b.send("DELETE", b.xmlPath(bucket, name), gcsGeneration(object), nil, nil)
+	if isObjectLockDenied(err) {
+		return NewLockedObjectsError([]string{object.Key}, err)
+	}
+	if errorCode(err) == s3.ErrCodeNoSuchKey {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return response.Body.Close()
+}
+
+// Delete several objects one by one, the objects under a hold or a retention are reported in a single LockedObjectsError
+func (b *GCSBackend) BatchDeleteObjects(objects []BucketObject) error {
+	return deleteOneByOne(objects, b.DeleteObject)
+}
+
+// Copy an object with rewrites, GCS copies large objects in several calls which continue the previous one with a rewrite token
+// the metadata of the source are copied
+func (b *GCSBackend) CopyObject(sourceObject BucketObject, destinationObject BucketObject) error {
+	header, kmsKeyName, err := gcsEncryption(destinationObject.Encryption)
+	if err != nil {
+		return err
+	}
+
+	sourceHeader, _, err := gcsEncryption(sourceObject.Encryption)
+	if err != nil {
+		return err
+	}
+	if sourceObject.Encryption.Mode == EncryptionSSEC {
+		for name := range sourceHeader {
+			header.Set(strings.Replace(name, "X-Goog-", "X-Goog-Copy-Source-", 1), sourceHeader.Get(name))
+		}
+	}
+
+	query := make(url.Values)
+	if sourceObject.VersionID != "" {
+		query.Set("sourceGeneration", sourceObject.VersionID)
+	}
+	if kmsKeyName != "" {
+		query.Set("destinationKmsKeyName", kmsKeyName)
+	}
+
+	var destination interface{}
+	if destinationObject.StorageClass != "" {
+		destination = map[string]string{"storageClass": gcsStorageClass(destinationObject.StorageClass)}
+	}
+
+	sourceBucket, sourceName := gcsObject(sourceObject)
+	destinationBucket, destinationName := gcsObject(destinationObject)
+
+	resource := b.jsonPath(sourceBucket, sourceName) + "/rewriteTo" + strings.TrimPrefix(b.jsonPath(destinationBucket, destinationName), b.endpoint.Path+"/storage/v1")
+
+	for {
+		var result struct {
+			Done         bool   `json:"done"`
+			RewriteToken string `json:"rewriteToken"`
+		}
+
+		if err := b.sendJSON("POST", resource, query, header, destination, &result); err != nil {
+			return err
+		}
+		if result.Done {
+			return nil
+		}
+
+		query.Set("rewriteToken", result.RewriteToken)
+	}
+}
+
+// object resource of the JSON API
+type gcsObjectResource struct {
+	Name          string            `json:"name"`
+	Generation    string            `json:"generation"`
+	Size          string            `json:"size"`
+	MD5Hash       string            `json:"md5Hash"`
+	ETag          string            `json:"etag"`
+	ContentType   string            `json:"contentType"`
+	Updated       time.Time         `json:"updated"`
+	TimeDeleted   string            `json:"timeDeleted"`
+	StorageClass  string            `json:"storageClass"`
+	Metadata      map[string]string `json:"metadata"`
+	TemporaryHold bool              `json:"temporaryHold"`
+	Retention     *gcsRetention     `json:"retention"`
+}
+
+// retention of an object, an unlocked retention can be shortened or removed with overrideUnlockedRetention
+type gcsRetention struct {
+	Mode            string    `json:"mode"`
+	RetainUntilTime time.Time `json:"retainUntilTime"`
+}
+
+// metadata of an object of the JSON API, the ETag is the MD5 of the content as on S3 (the GCS ETag for the composite objects)
+func (resource gcsObjectResource) objectInfo() ObjectInfo {
+	size, _ := strconv.ParseInt(resource.Size, 10, 64)
+
+	info := ObjectInfo{
+		Key:          resource.Name,
+		Size:         size,
+		ETag:         fmt.Sprintf("%q", resource.ETag),
+		ContentType:  resource.ContentType,
+		LastModified: resource.Updated,
+		Metadata:     map[string]string{},
+		VersionID:    resource.Generation,
+		StorageClass: s3StorageClass(resource.StorageClass),
+	}
+
+	if digest, err := base64.StdEncoding.DecodeString(resource.MD5Hash); err == nil && len(digest) == md5.Size {
+		info.ETag = fmt.Sprintf("%q", hex.EncodeToString(digest))
+	}
+
+	for name, value := range resource.Metadata {
+		if !strings.HasPrefix(name, gcsTagPrefix) {
+			info.Metadata[name] = value
+		}
+	}
+
+	return info
+}
+
+// get the object resource of an object
+func (b *GCSBackend) getObjectResource(object BucketObject) (*gcsObjectResource, error) {
+	header, _, err := gcsEncryption(object.Encryption)
+	if err != nil {
+		return nil, err
+	}
+
+	bucket, name := gcsObject(object)
+
+	var resource gcsObjectResource
+	if err := b.sendJSON("GET", b.jsonPath(bucket, name), gcsGeneration(object), header, nil, &resource); err != nil {
+		return nil, err
+	}
+
+	return &resource, nil
+}
+
+// Returns the metadata of an object
+func (b *GCSBackend) StatObject(object BucketObject) (*ObjectInfo, error) {
+	resource, err := b.getObjectResource(object)
+	if err != nil {
+		return nil, err
+	}
+
+	info := resource.objectInfo()
+	info.Key = object.Key
+
+	return &info, nil
+}
+
+// response of an object listing of the JSON API
+type gcsObjectList struct {
+	Items         []gcsObjectResource `json:"items"`
+	Prefixes      []string            `json:"prefixes"`
+	NextPageToken string              `json:"nextPageToken"`
+}
+
+// list one page of objects, the continuation token is the page token returned by GCS
+func (b *GCSBackend) listObjects(bucketName string, options ListOptions, versions bool) (*gcsObjectList, error) {
+	query := make(url.Values)
+
+	for name, value := range map[string]string{
+		"prefix":    options.Prefix,
+		"delimiter": options.Delimiter,
+		"pageToken": options.ContinuationToken,
+	} {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+	if options.MaxKeys > 0 {
+		query.Set("maxResults", strconv.FormatInt(options.MaxKeys, 10))
+	}
+	if versions {
+		query.Set("versions", "true")
+	}
+
+	var list gcsObjectList
+	if err := b.sendJSON("GET", b.jsonPath(bucketName, "")+"/o", query, nil, nil, &list); err != nil {
+		return nil, err
+	}
+
+	return &list, nil
+}
+
+// Returns one page of the objects of a bucket
+func (b *GCSBackend) ListObjects(bucketName string, options ListOptions) (*ObjectListing, error) {
+	list, err := b.listObjects(bucketName, options, false)
+	if err != nil {
+		return nil, err
+	}
+
+	listing := &ObjectListing{
+		Objects:               make([]ObjectInfo, len(list.Items)),
+		CommonPrefixes:        append([]string{}, list.Prefixes...),
+		IsTruncated:           list.NextPageToken != "",
+		NextContinuationToken: list.NextPageToken,
+	}
+
+	for index, resource := range list.Items {
+		listing.Objects[index] = resource.objectInfo()
+		listing.Objects[index].VersionID = ""
+	}
+
+	return listing, nil
+}
+
+// Initiate a multipart upload with the XML API, it is compatible with the S3 multipart uploads
+func (b *GCSBackend) CreateMultipartUpload(object BucketObject) (string, error) {
+	header, err := b.writeHeaders(object)
+	if err != nil {
+		return "", err
+	}
+
+	bucket, name := gcsObject(object)
+
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := b.sendXML("POST", b.xmlPath(bucket, name), url.Values{"uploads": {""}}, header, nil, &result); err != nil {
+		return "", err
+	}
+
+	return result.UploadID, nil
+}
+
+// Create a V4 signed URL for the upload of a part
+// With SSE-C, the customer key headers used to create the multipart upload are signed and returned
+func (b *GCSBackend) CreatePresignedURLForUploadPart(object BucketObject, uploadID string, partNumber int64, expire time.Duration) (*PresignedURL, error) {
+	header, _, err := gcsEncryption(object.Encryption)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := make(map[string]string, len(header))
+	for name := range header {
+		headers[name] = header.Get(name)
+	}
+
+	bucket, name := gcsObject(object)
+
+	signedURL, err := b.signedURL("PUT", bucket, name, expire, headers, url.Values{
+		"uploadId":   {uploadID},
+		"partNumber": {strconv.FormatInt(partNumber, 10)},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &PresignedURL{URL: signedURL, Headers: headers}, nil
+}
+
+// XML body of the completion of a multipart upload
+type gcsCompleteMultipartUpload struct {
+	XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+	Parts   []CompletedPart `xml:"Part"`
+}
+
+// Complete a multipart upload, parts must be sorted by part number
+func (b *GCSBackend) CompleteMultipartUpload(object BucketObject, uploadID string, parts []CompletedPart) error {
+	_, err := b.completeMultipartUpload(object, uploadID, parts)
+	return err
+}
+
+func (b *GCSBackend) completeMultipartUpload(object BucketObject, uploadID string, parts []CompletedPart) (string, error) {
+	body, err := xml.Marshal(gcsCompleteMultipartUpload{Parts: parts})
+	if err != nil {
+		return "", err
+	}
+
+	bucket, name := gcsObject(object)
+
+	var result struct {
+		ETag string `xml:"ETag"`
+	}
+	if err := b.sendXML("POST", b.xmlPath(bucket, name), url.Values{"uploadId": {uploadID}}, nil, body, &result); err != nil {
+		return "", err
+	}
+
+	return result.ETag, nil
+}
+
+// Abort a multipart upload and delete its parts
+func (b *GCSBackend) AbortMultipartUpload(object BucketObject, uploadID string) error {
+	bucket, name := gcsObject(object)
+
+	response, err := b.send("DELETE", b.xmlPath(bucket, name), url.Values{"uploadId": {uploadID}}, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	return response.Body.Close()
+}
+
+// POST policies are not supported
+func (b *GCSBackend) CreatePresignedPost(object BucketObject, expire time.Duration, conditions PostConditions) (*PresignedPost, error) {
+	return nil, awserr.New("NotImplemented", "POST policies are not supported by the GCS backend", nil)
+}
+
+// Returns the content of an object with the XML API, the range and the conditional headers are sent to GCS
+func (b *GCSBackend) GetObject(object BucketObject, options GetOptions) (*ObjectContent, error) {
+	header, _, err := gcsEncryption(object.Encryption)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.Range != "" {
+		header.Set("Range", options.Range)
+	}
+	if options.IfNoneMatch != "" {
+		header.Set("If-None-Match", options.IfNoneMatch)
+	}
+	if !options.IfModifiedSince.IsZero() {
+		header.Set("If-Modified-Since", options.IfModifiedSince.UTC().Format(http.TimeFormat))
+	}
+
+	bucket, name := gcsObject(object)
+
+	response, err := b.send("GET", b.xmlPath(bucket, name), gcsGeneration(object), header, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	info := ObjectInfo{
+		Key:          object.Key,
+		Size:         response.ContentLength,
+		ETag:         response.Header.Get("ETag"),
+		ContentType:  response.Header.Get("Content-Type"),
+		Metadata:     map[string]string{},
+		VersionID:    response.Header.Get("x-goog-generation"),
+		StorageClass: s3StorageClass(response.Header.Get("x-goog-storage-class")),
+	}
+
+	if lastModified, err := http.ParseTime(response.Header.Get("Last-Modified")); err == nil {
+		info.LastModified = lastModified
+	}
+
+	for name := range response.Header {
+		if metadataName, found := strings.CutPrefix(strings.ToLower(name), "x-goog-meta-"); found && !strings.HasPrefix(metadataName, gcsTagPrefix) {
+			info.Metadata[metadataName] = response.Header.Get(name)
+		}
+	}
+
+	return &ObjectContent{ObjectInfo: info, Body: response.Body, ContentRange: response.Header.Get("Content-Range")}, nil
+}
+
+// Upload the content of an object with the XML API, bodies larger than the part size are sent with a multipart upload
+func (b *GCSBackend) PutObject(object BucketObject, body io.Reader, options PutOptions) (string, error) {
+	header, err := b.writeHeaders(object)
+	if err != nil {
+		return "", err
+	}
+
+	partSize := options.PartSize
+	if partSize <= 0 {
+		partSize = gcsPartSize
+	}
+
+	bucket, name := gcsObject(object)
+
+	part := make([]byte, partSize)
+
+	size, err := io.ReadFull(body, part)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		// the body fits in a single part
+		if options.ContentType != "" {
+			header.Set("Content-Type", options.ContentType)
+		}
+		for name, value := range options.Metadata {
+			header.Set("x-goog-meta-"+name, value)
+		}
+
+		response, err := b.send("PUT", b.xmlPath(bucket, name), nil, header, part[:size])
+		if err != nil {
+			return "", err
+		}
+		response.Body.Close()
+
+		return response.Header.Get("ETag"), nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// the content type and the metadata are set by the initiation of the multipart upload
+	initiateHeader := header.Clone()
+	if options.ContentType != "" {
+		initiateHeader.Set("Content-Type", options.ContentType)
+	}
+	for name, value := range options.Metadata {
+		initiateHeader.Set("x-goog-meta-"+name, value)
+	}
+
+	var initiated struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := b.sendXML("POST", b.xmlPath(bucket, name), url.Values{"uploads": {""}}, initiateHeader, nil, &initiated); err != nil {
+		return "", err
+	}
+
+	var parts []CompletedPart
+
+	// the storage class and the KMS key are set by the initiation, the customer key is sent with each part
+	partHeader, _, _ := gcsEncryption(object.Encryption)
+
+	for partNumber := int64(1); size > 0; partNumber++ {
+		query := url.Values{"uploadId": {initiated.UploadID}, "partNumber": {strconv.FormatInt(partNumber, 10)}}
+
+		response, err := b.send("PUT", b.xmlPath(bucket, name), query, partHeader, part[:size])
+		if err != nil {
+			return "", b.abortMultipartUpload(object, initiated.UploadID, err)
+		}
+		response.Body.Close()
+
+		parts = append(parts, CompletedPart{PartNumber: partNumber, ETag: response.Header.Get("ETag")})
+
+		if size, err = io.ReadFull(body, part); err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return "", b.abortMultipartUpload(object, initiated.UploadID, err)
+		}
+	}
+
+	return b.completeMultipartUpload(object, initiated.UploadID, parts)
+}
+
+// abort a multipart upload after the error of an upload, a failed abort is logged and added to the message of the error
+// the S3 error code of the upload error is kept so that the router maps it
+func (b *GCSBackend) abortMultipartUpload(object BucketObject, uploadID string, err error) error {
+	abortErr := b.AbortMultipartUpload(object, uploadID)
+	if abortErr == nil {
+		return err
+	}
+
+	log.Errorf("Failed to abort the multipart upload %s of %s, its parts are left on GCS : %v", uploadID, object, abortErr)
+
+	msg := fmt.Sprintf("abort of the multipart upload %s failed: %v", uploadID, abortErr)
+	if aerr, ok := err.(awserr.Error); ok {
+		return awserr.New(aerr.Code(), aerr.Message()+" ("+msg+")", aerr.OrigErr())
+	}
+	return fmt.Errorf("%w (%s)", err, msg)
+}
+
+// Returns the tags of an object, stored in its custom metadata
+func (b *GCSBackend) GetObjectTagging(object BucketObject) (map[string]string, error) {
+	resource, err := b.getObjectResource(object)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make(map[string]string)
+	for name, value := range resource.Metadata {
+		if tag, found := strings.CutPrefix(name, gcsTagPrefix); found {
+			tags[tag] = value
+		}
+	}
+
+	return tags, nil
+}
+
+// Replace the tags of an object, the previous tags are removed from its custom metadata
+func (b *GCSBackend) PutObjectTagging(object BucketObject, tags map[string]string) error {
+	resource, err := b.getObjectResource(object)
+	if err != nil {
+		return err
+	}
+
+	// a patch removes the metadata set to null
+	metadata := make(map[string]interface{})
+	for name := range resource.Metadata {
+		if strings.HasPrefix(name, gcsTagPrefix) {
+			metadata[name] = nil
+		}
+	}
+	for tag, value := range tags {
+		metadata[gcsTagPrefix+tag] = value
+	}
+
+	return b.patchObject(object, nil, map[string]interface{}{"metadata": metadata})
+}
+
+// Remove the tags of an object
+func (b *GCSBackend) DeleteObjectTagging(object BucketObject) error {
+	return b.PutObjectTagging(object, nil)
+}
+
+// Returns one page of the generations of the objects of a bucket, GCS has no delete markers
+// a noncurrent generation has a deletion time
+func (b *GCSBackend) ListObjectVersions(bucketName string, options ListOptions) (*VersionListing, error) {
+	list, err := b.listObjects(bucketName, options, true)
+	if err != nil {
+		return nil, err
+	}
+
+	listing := &VersionListing{
+		Versions:              make([]ObjectVersion, len(list.Items)),
+		CommonPrefixes:        append([]string{}, list.Prefixes...),
+		IsTruncated:           list.NextPageToken != "",
+		NextContinuationToken: list.NextPageToken,
+	}
+
+	for index, resource := range list.Items {
+		listing.Versions[index] = ObjectVersion{ObjectInfo: resource.objectInfo(), IsLatest: resource.TimeDeleted == ""}
+	}
+
+	return listing, nil
+}
+
+// Returns the retention of an object : an unlocked retention is a GOVERNANCE retention, a locked retention a COMPLIANCE retention
+func (b *GCSBackend) GetObjectRetention(object BucketObject) (*ObjectRetention, error) {
+	resource, err := b.getObjectResource(BucketObject{BucketName: object.BucketName, Key: object.Key, VersionID: object.VersionID})
+	if err != nil {
+		return nil, err
+	}
+
+	retention := &ObjectRetention{}
+
+	if resource.Retention != nil {
+		retainUntilDate := resource.Retention.RetainUntilTime
+		retention.RetainUntilDate = &retainUntilDate
+		retention.Mode = ObjectLockModeGovernance
+		if resource.Retention.Mode == "Locked" {
+			retention.Mode = ObjectLockModeCompliance
+		}
+	}
+
+	return retention, nil
+}
+
+// Set or remove the retention of an object, bypassGovernance allows to shorten or remove an unlocked retention
+func (b *GCSBackend) PutObjectRetention(object BucketObject, retention ObjectRetention, bypassGovernance bool) error {
+	query := make(url.Values)
+	if bypassGovernance {
+		query.Set("overrideUnlockedRetention", "true")
+	}
+
+	var value *gcsRetention
+	if retention.RetainUntilDate != nil {
+		value = &gcsRetention{Mode: "Unlocked", RetainUntilTime: retention.RetainUntilDate.UTC()}
+		if retention.Mode == ObjectLockModeCompliance {
+			value.Mode = "Locked"
+		}
+	}
+
+	return b.patchObject(object, query, map[string]interface{}{"retention": value})
+}
+
+// Returns the temporary hold of an object
+func (b *GCSBackend) GetObjectLegalHold(object BucketObject) (bool, error) {
+	resource, err := b.getObjectResource(BucketObject{BucketName: object.BucketName, Key: object.Key, VersionID: object.VersionID})
+	if err != nil {
+		return false, err
+	}
+	return resource.TemporaryHold, nil
+}
+
+// Set or remove the temporary hold of an object
+func (b *GCSBackend) PutObjectLegalHold(object BucketObject, legalHold bool) error {
+	return b.patchObject(object, nil, map[string]interface{}{"temporaryHold": legalHold})
+}
+
+// The objects of the GCS storage classes (ARCHIVE included) are always readable, they are never restored
+func (b *GCSBackend) RestoreObject(object BucketObject, options RestoreOptions) (bool, error) {
+	if _, err := b.getObjectResource(object); err != nil {
+		return false, err
+	}
+	return false, awserr.New("InvalidObjectState", "Restore is not allowed for the object's current storage class", nil)
+}
+
+// patch the metadata of an object with the JSON API
+func (b *GCSBackend) patchObject(object BucketObject, query url.Values, patch map[string]interface{}) error {
+	bucket, name := gcsObject(object)
+
+	if query == nil {
+		query = make(url.Values)
+	}
+	if object.VersionID != "" {
+		query.Set("generation", object.VersionID)
+	}
+
+	return b.sendJSON("PATCH", b.jsonPath(bucket, name), query, nil, patch, nil)
+}
+
+// bucket and normalized name of an object
+func gcsObject(object BucketObject) (string, string) {
+	return object.BucketName, strings.TrimPrefix(object.Key, "/")
+}
+
+// path of an object in the XML API, the path of a bucket when the name is empty
+func (b *GCSBackend) xmlPath(bucket string, name string) string {
+	resource := b.endpoint.Path + "/" + gcsEscape(bucket)
+	if name != "" {
+		resource += "/" + gcsEscapePath(name)
+	}
+	return resource
+}
+
+// path of an object in the JSON API, the path of a bucket when the name is empty
+func (b *GCSBackend) jsonPath(bucket string, name string) string {
+	resource := b.endpoint.Path + "/storage/v1/b/" + gcsEscape(bucket)
+	if name != "" {
+		resource += "/o/" + gcsEscape(name)
+	}
+	return resource
+}
+
+// query parameter of the generation of an object
+func gcsGeneration(object BucketObject) url.Values {
+	query := make(url.Values)
+	if object.VersionID != "" {
+		query.Set("generation", object.VersionID)
+	}
+	return query
+}
+
+// headers of an upload : storage class and encryption
+func (b *GCSBackend) writeHeaders(object BucketObject) (http.Header, error) {
+	header, kmsKeyName, err := gcsEncryption(object.Encryption)
+	if err != nil {
+		return nil, err
+	}
+
+	if kmsKeyName != "" {
+		header.Set("x-goog-encryption-kms-key-name", kmsKeyName)
+	}
+	if object.StorageClass != "" {
+		header.Set("x-goog-storage-class", gcsStorageClass(object.StorageClass))
+	}
+
+	return header, nil
+}
+
+// send a request authorized with the OAuth token of the service account, an error response is converted to an error with an S3 error code
+func (b *GCSBackend) send(method string, resource string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	token, err := b.accessToken()
+	if err != nil {
+		return nil, err
+	}
+
+	rawURL := b.origin + resource
+	if len(query) > 0 {
+		rawURL += "?" + gcsCanonicalQuery(query)
+	}
+
+	req, err := http.NewRequest(method, rawURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	for name, values := range header {
+		req.Header[http.CanonicalHeaderKey(name)] = values
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	if len(body) == 0 {
+		req.Body = http.NoBody
+		req.ContentLength = 0
+	}
+
+	response, err := b.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode >= http.StatusMultipleChoices {
+		defer response.Body.Close()
+		return nil, gcsResponseError(response)
+	}
+
+	return response, nil
+}
+
+// send a request with an optional JSON body and decode its JSON response if result is not nil
+func (b *GCSBackend) sendJSON(method string, resource string, query url.Values, header http.Header, body interface{}, result interface{}) error {
+	var data []byte
+
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+		header = header.Clone()
+		if header == nil {
+			header = make(http.Header)
+		}
+		header.Set("Content-Type", "application/json")
+	}
+
+	response, err := b.send(method, resource, query, header, data)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(response.Body).Decode(result)
+}
+
+// send a request and decode its XML response
+func (b *GCSBackend) sendXML(method string, resource string, query url.Values, header http.Header, body []byte, result interface{}) error {
+	response, err := b.send(method, resource, query, header, body)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	return xml.NewDecoder(response.Body).Decode(result)
+}
+
+// convert a GCS error response to an error with an S3 error code, the router only knows the S3 codes
+// the XML API returns the S3 error codes, the JSON API only returns the http status and a message
+func gcsResponseError(response *http.Response) error {
+	var (
+		xmlErr struct {
+			Code    string `xml:"Code"`
+			Message string `xml:"Message"`
+		}
+		jsonErr struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+	)
+
+	data, _ := io.ReadAll(io.LimitReader(response.Body, 64*1024))
+	if xml.Unmarshal(data, &xmlErr) != nil && json.Unmarshal(data, &jsonErr) == nil {
+		xmlErr.Message = jsonErr.Error.Message
+	}
+	if xmlErr.Message == "" {
+		xmlErr.Message = http.StatusText(response.StatusCode)
+	}
+
+	origErr := fmt.Errorf("gcs %d %s : %s", response.StatusCode, xmlErr.Code, xmlErr.Message)
+	message := strings.ToLower(xmlErr.Message)
+
+	var code string
+
+	switch {
+	case response.StatusCode == http.StatusNotModified:
+		code, xmlErr.Message = "NotModified", "Not Modified"
+	case response.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		code, xmlErr.Message = "InvalidRange", "The requested range is not satisfiable"
+	case response.StatusCode == http.StatusForbidden && (strings.Contains(message, "hold") || strings.Contains(message, "retention")):
+		code, xmlErr.Message = "AccessDenied", "Access Denied because object protected by object lock"
+	case xmlErr.Code != "":
+		code = xmlErr.Code
+	// the JSON API answers "No such object: bucket/name" for a missing object
+	case response.StatusCode == http.StatusNotFound && !strings.HasPrefix(message, "no such object") && strings.Contains(message, "bucket"):
+		code, xmlErr.Message = s3.ErrCodeNoSuchBucket, "The specified bucket does not exist"
+	case response.StatusCode == http.StatusNotFound:
+		code, xmlErr.Message = s3.ErrCodeNoSuchKey, "The specified key does not exist"
+	case response.StatusCode == http.StatusForbidden, response.StatusCode == http.StatusUnauthorized:
+		code = "AccessDenied"
+	case response.StatusCode == http.StatusBadRequest:
+		code = "InvalidArgument"
+	case response.StatusCode == http.StatusPreconditionFailed:
+		code = "PreconditionFailed"
+	default:
+		code = http.StatusText(response.StatusCode)
+	}
+
+	return awserr.NewRequestFailure(awserr.New(code, xmlErr.Message, origErr), response.StatusCode, response.Header.Get("X-Guploader-Uploadid"))
+}
+
+// GCS storage class of an S3 storage class, the classes without equivalent are stored in the STANDARD class
+func gcsStorageClass(storageClass string) string {
+	switch storageClass {
+	case s3.StorageClassStandardIa, s3.StorageClassOnezoneIa:
+		return gcsStorageClassNearline
+	case s3.StorageClassGlacierIr:
+		return gcsStorageClassColdline
+	case StorageClassGlacier, StorageClassDeepArchive:
+		return gcsStorageClassArchive
+	default:
+		return gcsStorageClassStandard
+	}
+}
+
+// S3 storage class of a GCS storage class, the GCS classes are readable without restore as the GLACIER_IR class
+func s3StorageClass(storageClass string) string {
+	switch storageClass {
+	case gcsStorageClassNearline:
+		return s3.StorageClassStandardIa
+	case gcsStorageClassColdline, gcsStorageClassArchive:
+		return s3.StorageClassGlacierIr
+	default:
+		return s3.StorageClassStandard
+	}
+}
+
+// GCS headers and KMS key of an encryption : SSE-S3 is the default encryption of GCS, SSE-C is a customer-supplied key
+// and SSE-KMS a Cloud KMS key (required, projects/.../cryptoKeys/...)
+func gcsEncryption(encryption Encryption) (http.Header, string, error) {
+	header := make(http.Header)
+
+	switch encryption.Mode {
+	case "", EncryptionSSES3:
+		return header, "", nil
+	case EncryptionSSEKMS:
+		if encryption.KMSKeyID == "" {
+			return nil, "", awserr.New(ErrCodeInvalidEncryption, "SSE-KMS requires the name of a Cloud KMS key as KMS key id on GCS", nil)
+		}
+		return header, encryption.KMSKeyID, nil
+	case EncryptionSSEC:
+		key, err := base64.StdEncoding.DecodeString(encryption.CustomerKey)
+		if err != nil || len(key) != customerKeySize {
+			return nil, "", awserr.New(ErrCodeInvalidEncryption, "SSE-C requires a base64 encoded 256 bits customer key", err)
+		}
+		digest := sha256.Sum256(key)
+
+		header.Set("x-goog-encryption-algorithm", "AES256")
+		header.Set("x-goog-encryption-key", encryption.CustomerKey)
+		header.Set("x-goog-encryption-key-sha256", base64.StdEncoding.EncodeToString(digest[:]))
+		return header, "", nil
+	default:
+		return nil, "", awserr.New(ErrCodeInvalidEncryption, fmt.Sprintf("unknown encryption mode %q", encryption.Mode), nil)
+	}
+}
@@ -0,0 +1,833 @@
+package backend
+
+import (
+	"crypto"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const gcsTestAccount = "s3proxy@myproject.iam.gserviceaccount.com"
+
+type fakeGCSObject struct {
+	content      []byte
+	contentType  string
+	metadata     map[string]string
+	storageClass string
+	generation   int64
+	hold         bool
+	retention    *gcsRetention
+	updated      time.Time
+}
+
+func (o *fakeGCSObject) resource(name string) gcsObjectResource {
+	digest := md5.Sum(o.content)
+	return gcsObjectResource{
+		Name:          name,
+		Generation:    strconv.FormatInt(o.generation, 10),
+		Size:          strconv.Itoa(len(o.content)),
+		MD5Hash:       base64.StdEncoding.EncodeToString(digest[:]),
+		ETag:          "CAE=",
+		ContentType:   o.contentType,
+		Updated:       o.updated,
+		StorageClass:  o.storageClass,
+		Metadata:      o.metadata,
+		TemporaryHold: o.hold,
+		Retention:     o.retention,
+	}
+}
+
+func (o *fakeGCSObject) etag() string {
+	digest := md5.Sum(o.content)
+	return fmt.Sprintf("%q", hex.EncodeToString(digest[:]))
+}
+
+// Minimal Cloud Storage server (token endpoint, XML and JSON APIs) checking the OAuth tokens and the V4 signatures
+// the rewrites are done in two calls
+type fakeGCSServer struct {
+	publicKey *rsa.PublicKey
+
+	mutex       sync.Mutex
+	buckets     map[string]map[string]*fakeGCSObject
+	uploads     map[string]map[int64][]byte
+	generations int64
+	tokens      int
+	rewrites    int
+	// part number whose upload fails and failure of the aborts
+	failPart  int64
+	failAbort bool
+}
+
+func (s *fakeGCSServer) xmlError(w http.ResponseWriter, status int, code string, message string) {
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, message)
+}
+
+func (s *fakeGCSServer) jsonError(w http.ResponseWriter, status int, message string) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]interface{}{"code": status, "message": message}})
+}
+
+// check the JWT assertion of a token request
+func (s *fakeGCSServer) token(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(r.PostFormValue("assertion"), ".")
+	if len(parts) != 3 || r.PostFormValue("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	claims, _ := base64.RawURLEncoding.DecodeString(parts[1])
+
+	if rsa.VerifyPKCS1v15(s.publicKey, crypto.SHA256, digest[:], signature) != nil || !strings.Contains(string(claims), gcsTestAccount) {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"error":"invalid_grant"}`)
+		return
+	}
+
+	s.tokens++
+	fmt.Fprint(w, `{"access_token":"token-1","expires_in":3600,"token_type":"Bearer"}`)
+}
+
+// check the V4 signature and the expiry of a signed URL
+func (s *fakeGCSServer) validSignature(r *http.Request) bool {
+	query := r.URL.Query()
+
+	headers := make(map[string]string)
+	for _, name := range strings.Split(query.Get("X-Goog-SignedHeaders"), ";") {
+		if name == "host" {
+			headers[name] = r.Host
+		} else {
+			headers[name] = r.Header.Get(name)
+		}
+	}
+
+	date, err := time.Parse("20060102T150405Z", query.Get("X-Goog-Date"))
+	expires, _ := strconv.Atoi(query.Get("X-Goog-Expires"))
+	if err != nil || time.Now().After(date.Add(time.Duration(expires)*time.Second)) {
+		return false
+	}
+
+	digest := sha256.Sum256([]byte(gcsStringToSign(r.Method, r.URL.EscapedPath(), query, headers)))
+	signature, _ := hex.DecodeString(query.Get("X-Goog-Signature"))
+
+	return rsa.VerifyPKCS1v15(s.publicKey, crypto.SHA256, digest[:], signature) == nil
+}
+
+func (s *fakeGCSServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if r.URL.Path == "/token" {
+		s.token(w, r)
+		return
+	}
+
+	if r.URL.Query().Has("X-Goog-Signature") {
+		if !s.validSignature(r) {
+			s.xmlError(w, http.StatusForbidden, "SignatureDoesNotMatch", "invalid signature")
+			return
+		}
+	} else if r.Header.Get("Authorization") != "Bearer token-1" {
+		s.xmlError(w, http.StatusUnauthorized, "AuthenticationRequired", "invalid token")
+		return
+	}
+
+	var segments []string
+	for _, segment := range strings.Split(strings.TrimPrefix(r.URL.EscapedPath(), "/"), "/") {
+		segment, _ = url.PathUnescape(segment)
+		segments = append(segments, segment)
+	}
+
+	if len(segments) > 3 && segments[0] == "storage" && segments[1] == "v1" && segments[2] == "b" {
+		s.serveJSON(w, r, segments[3:])
+		return
+	}
+	s.serveXML(w, r, segments[0], strings.Join(segments[1:], "/"))
+}
+
+func (s *fakeGCSServer) put(bucket map[string]*fakeGCSObject, name string, content []byte, header http.Header) *fakeGCSObject {
+	s.generations++
+
+	object := &fakeGCSObject{
+		content:      content,
+		contentType:  header.Get("Content-Type"),
+		metadata:     make(map[string]string),
+		storageClass: header.Get("x-goog-storage-class"),
+		generation:   s.generations,
+		updated:      time.Now().UTC().Truncate(time.Second),
+	}
+	if object.storageClass == "" {
+		object.storageClass = gcsStorageClassStandard
+	}
+	for name := range header {
+		if metadataName, found := strings.CutPrefix(strings.ToLower(name), "x-goog-meta-"); found {
+			object.metadata[metadataName] = header.Get(name)
+		}
+	}
+
+	bucket[name] = object
+	return object
+}
+
+func (s *fakeGCSServer) serveXML(w http.ResponseWriter, r *http.Request, bucketName string, name string) {
+	query := r.URL.Query()
+
+	bucket, ok := s.buckets[bucketName]
+	if !ok {
+		s.xmlError(w, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist.")
+		return
+	}
+	object := bucket[name]
+
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		uploadID := fmt.Sprintf("upload-%d", len(s.uploads)+1)
+		s.uploads[uploadID] = make(map[int64][]byte)
+		s.uploads[uploadID][0] = []byte(r.Header.Get("Content-Type") + "|" + r.Header.Get("x-goog-storage-class"))
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", uploadID)
+
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		parts, ok := s.uploads[query.Get("uploadId")]
+		if !ok {
+			s.xmlError(w, http.StatusNotFound, "NoSuchUpload", "The requested upload was not found.")
+			return
+		}
+		partNumber, _ := strconv.ParseInt(query.Get("partNumber"), 10, 64)
+		if partNumber == s.failPart {
+			s.xmlError(w, http.StatusForbidden, "AccessDenied", "Access denied.")
+			return
+		}
+		parts[partNumber], _ = io.ReadAll(r.Body)
+		digest := md5.Sum(parts[partNumber])
+		w.Header().Set("ETag", fmt.Sprintf("%q", hex.EncodeToString(digest[:])))
+
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		parts, ok := s.uploads[query.Get("uploadId")]
+		if !ok {
+			s.xmlError(w, http.StatusNotFound, "NoSuchUpload", "The requested upload was not found.")
+			return
+		}
+		var body gcsCompleteMultipartUpload
+		data, _ := io.ReadAll(r.Body)
+		if err := xml.Unmarshal(data, &body); err != nil {
+			s.xmlError(w, http.StatusBadRequest, "MalformedXML", err.Error())
+			return
+		}
+		var content []byte
+		for index, part := range body.Parts {
+			if index > 0 && part.PartNumber <= body.Parts[index-1].PartNumber {
+				s.xmlError(w, http.StatusBadRequest, "InvalidPartOrder", "The list of parts was not in ascending order.")
+				return
+			}
+			data, ok := parts[part.PartNumber]
+			digest := md5.Sum(data)
+			if !ok || strings.Trim(part.ETag, `"`) != hex.EncodeToString(digest[:]) {
+				s.xmlError(w, http.StatusBadRequest, "InvalidPart", "One or more of the specified parts could not be found.")
+				return
+			}
+			content = append(content, data...)
+		}
+		contentType, storageClass, _ := strings.Cut(string(parts[0]), "|")
+		created := s.put(bucket, name, content, http.Header{"Content-Type": {contentType}, "X-Goog-Storage-Class": {storageClass}})
+		delete(s.uploads, query.Get("uploadId"))
+		fmt.Fprintf(w, "<CompleteMultipartUploadResult><ETag>%s</ETag></CompleteMultipartUploadResult>", created.etag())
+
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		if s.failAbort {
+			s.xmlError(w, http.StatusInternalServerError, "InternalError", "Internal error.")
+			return
+		}
+		delete(s.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+
+	case r.Method == http.MethodPut:
+		content, _ := io.ReadAll(r.Body)
+		if contentMD5 := r.Header.Get("Content-MD5"); contentMD5 != "" {
+			digest := md5.Sum(content)
+			if base64.StdEncoding.EncodeToString(digest[:]) != contentMD5 {
+				s.xmlError(w, http.StatusBadRequest, "BadDigest", "The MD5 you specified did not match what was received.")
+				return
+			}
+		}
+		w.Header().Set("ETag", s.put(bucket, name, content, r.Header).etag())
+
+	case object == nil:
+		s.xmlError(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+
+	case r.Method == http.MethodGet:
+		if r.Header.Get("If-None-Match") == object.etag() {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		header := w.Header()
+		header.Set("ETag", object.etag())
+		header.Set("Content-Type", object.contentType)
+		header.Set("Last-Modified", object.updated.Format(http.TimeFormat))
+		header.Set("x-goog-generation", strconv.FormatInt(object.generation, 10))
+		header.Set("x-goog-storage-class", object.storageClass)
+		for key, value := range object.metadata {
+			header.Set("x-goog-meta-"+key, value)
+		}
+		if disposition := r.URL.Query().Get("response-content-disposition"); disposition != "" {
+			header.Set("Content-Disposition", disposition)
+		}
+		content, status := object.content, http.StatusOK
+		if r.Header.Get("Range") != "" {
+			var start, end int
+			fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end)
+			header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(content)))
+			content, status = content[start:end+1], http.StatusPartialContent
+		}
+		header.Set("Content-Length", strconv.Itoa(len(content)))
+		w.WriteHeader(status)
+		w.Write(content)
+
+	case r.Method == http.MethodDelete:
+		if object.hold {
+			s.xmlError(w, http.StatusForbidden, "AccessDenied", fmt.Sprintf("Object '%s/%s' is under active Temporary hold and cannot be deleted, overwritten or archived until hold is removed.", bucketName, name))
+			return
+		}
+		delete(bucket, name)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		s.xmlError(w, http.StatusNotImplemented, "NotImplemented", r.Method)
+	}
+}
+
+func (s *fakeGCSServer) serveJSON(w http.ResponseWriter, r *http.Request, segments []string) {
+	query := r.URL.Query()
+
+	bucket, ok := s.buckets[segments[0]]
+	if !ok {
+		s.jsonError(w, http.StatusNotFound, "The specified bucket does not exist.")
+		return
+	}
+
+	// list : b/{bucket}/o
+	if len(segments) == 2 {
+		s.list(w, bucket, query)
+		return
+	}
+
+	name := segments[2]
+	object := bucket[name]
+	if object == nil {
+		s.jsonError(w, http.StatusNotFound, "No such object: "+segments[0]+"/"+name)
+		return
+	}
+
+	switch {
+	// rewrite : b/{bucket}/o/{object}/rewriteTo/b/{bucket}/o/{object}
+	case r.Method == http.MethodPost && len(segments) == 8 && segments[3] == "rewriteTo":
+		destination, ok := s.buckets[segments[5]]
+		if !ok {
+			s.jsonError(w, http.StatusNotFound, "The specified bucket does not exist.")
+			return
+		}
+		s.rewrites++
+		if query.Get("rewriteToken") == "" {
+			json.NewEncoder(w).Encode(map[string]interface{}{"done": false, "rewriteToken": "token"})
+			return
+		}
+		var body struct {
+			StorageClass string `json:"storageClass"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		header := http.Header{"Content-Type": {object.contentType}, "X-Goog-Storage-Class": {body.StorageClass}}
+		for key, value := range object.metadata {
+			header.Set("x-goog-meta-"+key, value)
+		}
+		created := s.put(destination, segments[7], object.content, header)
+		json.NewEncoder(w).Encode(map[string]interface{}{"done": true, "resource": created.resource(segments[7])})
+
+	case r.Method == http.MethodGet:
+		json.NewEncoder(w).Encode(object.resource(name))
+
+	case r.Method == http.MethodPatch:
+		var patch map[string]json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+			s.jsonError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if value, ok := patch["metadata"]; ok {
+			var metadata map[string]*string
+			json.Unmarshal(value, &metadata)
+			for key, value := range metadata {
+				if value == nil {
+					delete(object.metadata, key)
+				} else {
+					object.metadata[key] = *value
+				}
+			}
+		}
+		if value, ok := patch["temporaryHold"]; ok {
+			json.Unmarshal(value, &object.hold)
+		}
+		if value, ok := patch["retention"]; ok {
+			var retention *gcsRetention
+			json.Unmarshal(value, &retention)
+			shortened := object.retention != nil && (retention == nil || retention.RetainUntilTime.Before(object.retention.RetainUntilTime))
+			if shortened && query.Get("overrideUnlockedRetention") != "true" {
+				s.jsonError(w, http.StatusForbidden, "Object retention can not be reduced without overrideUnlockedRetention")
+				return
+			}
+			object.retention = retention
+		}
+		json.NewEncoder(w).Encode(object.resource(name))
+
+	default:
+		s.jsonError(w, http.StatusNotImplemented, r.Method)
+	}
+}
+
+func (s *fakeGCSServer) list(w http.ResponseWriter, bucket map[string]*fakeGCSObject, query url.Values) {
+	var (
+		prefix    = query.Get("prefix")
+		delimiter = query.Get("delimiter")
+		list      gcsObjectList
+		names     []string
+	)
+
+	for name := range bucket {
+		if strings.HasPrefix(name, prefix) && name > query.Get("pageToken") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	maxResults, _ := strconv.Atoi(query.Get("maxResults"))
+
+	for _, name := range names {
+		if maxResults > 0 && len(list.Items)+len(list.Prefixes) == maxResults {
+			list.NextPageToken = names[0]
+			if len(list.Items) > 0 {
+				list.NextPageToken = list.Items[len(list.Items)-1].Name
+			}
+			break
+		}
+		if delimiter != "" {
+			if index := strings.Index(name[len(prefix):], delimiter); index >= 0 {
+				commonPrefix := name[:len(prefix)+index+len(delimiter)]
+				if len(list.Prefixes) == 0 || list.Prefixes[len(list.Prefixes)-1] != commonPrefix {
+					list.Prefixes = append(list.Prefixes, commonPrefix)
+				}
+				continue
+			}
+		}
+		list.Items = append(list.Items, bucket[name].resource(name))
+	}
+
+	json.NewEncoder(w).Encode(list)
+}
+
+func newTestGCSBackend(t *testing.T) (*GCSBackend, *fakeGCSServer) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	server := &fakeGCSServer{
+		publicKey: &privateKey.PublicKey,
+		buckets:   map[string]map[string]*fakeGCSObject{"mybucket": {}},
+		uploads:   make(map[string]map[int64][]byte),
+	}
+
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+
+	credentialsFile := writeGCSCredentials(t, privateKey, httpServer.URL+"/token")
+
+	b, err := NewGCSBackend(GCSBackendConfig{Endpoint: httpServer.URL, CredentialsFile: credentialsFile})
+	require.NoError(t, err)
+
+	return b, server
+}
+
+// write a service account key file as downloaded from the Google Cloud console
+func writeGCSCredentials(t *testing.T, privateKey *rsa.PrivateKey, tokenURI string) string {
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	require.NoError(t, err)
+
+	data, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"project_id":     "myproject",
+		"private_key_id": "1234",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"client_email":   gcsTestAccount,
+		"token_uri":      tokenURI,
+	})
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+
+	return path
+}
+
+func TestNewGCSBackend(t *testing.T) {
+	_, err := NewGCSBackend(GCSBackendConfig{CredentialsFile: filepath.Join(t.TempDir(), "missing.json")})
+	assert.Error(t, err)
+
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"type":"authorized_user"}`), 0o600))
+
+	_, err = NewGCSBackend(GCSBackendConfig{CredentialsFile: path})
+	assert.ErrorContains(t, err, "not a service account key file")
+}
+
+func TestGCSCanonicalQuery(t *testing.T) {
+	query := url.Values{
+		"X-Goog-Signature":             {"ignored"},
+		"response-content-disposition": {`attachment; filename="my file.txt"`},
+		"X-Goog-Algorithm":             {gcsSigningAlgorithm},
+	}
+
+	assert.Equal(t, "X-Goog-Algorithm=GOOG4-RSA-SHA256&response-content-disposition=attachment%3B%20filename%3D%22my%20file.txt%22", gcsCanonicalQuery(query))
+	assert.Equal(t, "folder/my%20file%2B%281%29.txt", gcsEscapePath("folder/my file+(1).txt"))
+}
+
+// V4 signing example of https://cloud.google.com/storage/docs/access-control/signing-urls-manually
+// the canonical request is written as documented by Google, independent of the signer
+func TestGCSStringToSign(t *testing.T) {
+	query := url.Values{
+		"X-Goog-Algorithm":     {"GOOG4-RSA-SHA256"},
+		"X-Goog-Credential":    {"example@example-project.iam.gserviceaccount.com/20181026/us/storage/goog4_request"},
+		"X-Goog-Date":          {"20181026T211942Z"},
+		"X-Goog-Expires":       {"900"},
+		"X-Goog-SignedHeaders": {"host"},
+	}
+
+	canonicalQuery := "X-Goog-Algorithm=GOOG4-RSA-SHA256" +
+		"&X-Goog-Credential=example%40example-project.iam.gserviceaccount.com%2F20181026%2Fus%2Fstorage%2Fgoog4_request" +
+		"&X-Goog-Date=20181026T211942Z&X-Goog-Expires=900&X-Goog-SignedHeaders=host"
+	assert.Equal(t, canonicalQuery, gcsCanonicalQuery(query))
+
+	canonicalRequest := "GET\n/example-bucket/cat.jpeg\n" + canonicalQuery + "\nhost:storage.googleapis.com\n\nhost\nUNSIGNED-PAYLOAD"
+	digest := sha256.Sum256([]byte(canonicalRequest))
+
+	assert.Equal(t, "GOOG4-RSA-SHA256\n20181026T211942Z\n20181026/us/storage/goog4_request\n"+hex.EncodeToString(digest[:]),
+		gcsStringToSign("GET", "/example-bucket/cat.jpeg", query, map[string]string{"host": "storage.googleapis.com"}))
+
+	// the signed headers are sorted by name and their values are trimmed
+	query.Set("X-Goog-SignedHeaders", "content-type;host;x-goog-meta-tenant")
+	canonicalRequest = "PUT\n/example-bucket/folder/my%20file.txt\n" + gcsCanonicalQuery(query) +
+		"\ncontent-type:text/plain\nhost:storage.googleapis.com\nx-goog-meta-tenant:tenant1\n\ncontent-type;host;x-goog-meta-tenant\nUNSIGNED-PAYLOAD"
+	digest = sha256.Sum256([]byte(canonicalRequest))
+
+	assert.Equal(t, "GOOG4-RSA-SHA256\n20181026T211942Z\n20181026/us/storage/goog4_request\n"+hex.EncodeToString(digest[:]),
+		gcsStringToSign("PUT", "/example-bucket/folder/my%20file.txt", query, map[string]string{
+			"host": "storage.googleapis.com", "x-goog-meta-tenant": " tenant1 ", "content-type": "text/plain",
+		}))
+}
+
+func TestGCSPutGetObject(t *testing.T) {
+	b, server := newTestGCSBackend(t)
+	object := BucketObject{BucketName: "mybucket", Key: "/folder/my file.txt"}
+
+	etag, err := b.PutObject(object, strings.NewReader("hello world"), PutOptions{ContentType: "text/plain", Metadata: map[string]string{"tenant": "tenant1"}})
+	require.NoError(t, err)
+	assert.Equal(t, `"5eb63bbbe01eeed093cb22bb8f5acdc3"`, etag)
+
+	info, err := b.StatObject(object)
+	require.NoError(t, err)
+	assert.Equal(t, int64(11), info.Size)
+	assert.Equal(t, etag, info.ETag)
+	assert.Equal(t, "text/plain", info.ContentType)
+	assert.Equal(t, map[string]string{"tenant": "tenant1"}, info.Metadata)
+	assert.Equal(t, "STANDARD", info.StorageClass)
+	assert.Equal(t, "1", info.VersionID)
+
+	content, err := b.GetObject(object, GetOptions{Range: "bytes=6-10"})
+	require.NoError(t, err)
+	data, err := io.ReadAll(content.Body)
+	require.NoError(t, err)
+	content.Body.Close()
+	assert.Equal(t, "world", string(data))
+	assert.Equal(t, "bytes 6-10/11", content.ContentRange)
+	assert.Equal(t, map[string]string{"tenant": "tenant1"}, content.Metadata)
+
+	_, err = b.GetObject(object, GetOptions{IfNoneMatch: etag})
+	assert.Equal(t, "NotModified", errorCode(err))
+
+	_, err = b.StatObject(BucketObject{BucketName: "mybucket", Key: "/missing"})
+	assert.Equal(t, "NoSuchKey", errorCode(err))
+
+	_, err = b.StatObject(BucketObject{BucketName: "unknown", Key: "/file"})
+	assert.Equal(t, "NoSuchBucket", errorCode(err))
+
+	_, err = b.GetObject(BucketObject{BucketName: "unknown", Key: "/file"}, GetOptions{})
+	assert.Equal(t, "NoSuchBucket", errorCode(err))
+
+	_, err = b.PutObject(BucketObject{BucketName: "mybucket", Key: "/file", Encryption: Encryption{Mode: EncryptionSSEKMS}}, strings.NewReader(""), PutOptions{})
+	assert.Equal(t, ErrCodeInvalidEncryption, errorCode(err))
+
+	// the access token is cached
+	assert.Equal(t, 1, server.tokens)
+}
+
+func TestGCSPutObjectMultipart(t *testing.T) {
+	b, server := newTestGCSBackend(t)
+	object := BucketObject{BucketName: "mybucket", Key: "/big", StorageClass: "STANDARD_IA"}
+
+	etag, err := b.PutObject(object, strings.NewReader("hello world"), PutOptions{ContentType: "text/plain", PartSize: 4})
+	require.NoError(t, err)
+
+	created := server.buckets["mybucket"]["big"]
+	assert.Equal(t, "hello world", string(created.content))
+	assert.Equal(t, "text/plain", created.contentType)
+	assert.Equal(t, gcsStorageClassNearline, created.storageClass)
+	assert.Equal(t, created.etag(), etag)
+	assert.Empty(t, server.uploads)
+}
+
+func TestGCSPutObjectMultipartFailedAbort(t *testing.T) {
+	b, server := newTestGCSBackend(t)
+	object := BucketObject{BucketName: "mybucket", Key: "/big"}
+
+	// the upload is aborted after a failed part
+	server.failPart = 2
+	_, err := b.PutObject(object, strings.NewReader("hello world"), PutOptions{PartSize: 4})
+	assert.Equal(t, "AccessDenied", errorCode(err))
+	assert.Empty(t, server.uploads)
+
+	// a failed abort is added to the error, the code of the part error is kept
+	server.failAbort = true
+	_, err = b.PutObject(object, strings.NewReader("hello world"), PutOptions{PartSize: 4})
+	assert.Equal(t, "AccessDenied", errorCode(err))
+	assert.ErrorContains(t, err, "abort of the multipart upload upload-1 failed")
+	assert.Len(t, server.uploads, 1)
+}
+
+func TestGCSSignedURLs(t *testing.T) {
+	b, _ := newTestGCSBackend(t)
+	object := BucketObject{BucketName: "mybucket", Key: "/folder/my file.txt", StorageClass: "GLACIER"}
+
+	presignedURL, err := b.CreatePresignedURLForUpload(object, time.Minute, UploadConstraints{
+		ContentType: "text/plain",
+		ContentMD5:  "XrY7u+Ae7tCTyyK7j1rNww==",
+		Metadata:    map[string]string{"tenant": "tenant1"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"Content-Type":         "text/plain",
+		"Content-Md5":          "XrY7u+Ae7tCTyyK7j1rNww==",
+		"X-Goog-Meta-Tenant":   "tenant1",
+		"X-Goog-Storage-Class": "ARCHIVE",
+	}, presignedURL.Headers)
+
+	upload := func(rawURL string, headers map[string]string, content string) int {
+		req, err := http.NewRequest("PUT", rawURL, strings.NewReader(content))
+		require.NoError(t, err)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		response, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		response.Body.Close()
+		return response.StatusCode
+	}
+
+	// the signed headers are required
+	assert.Equal(t, http.StatusForbidden, upload(presignedURL.URL, map[string]string{"Content-Type": "text/html"}, "hello world"))
+	assert.Equal(t, http.StatusForbidden, upload(strings.Replace(presignedURL.URL, "folder", "other", 1), presignedURL.Headers, "hello world"))
+	assert.Equal(t, http.StatusBadRequest, upload(presignedURL.URL, presignedURL.Headers, "hello"))
+	assert.Equal(t, http.StatusOK, upload(presignedURL.URL, presignedURL.Headers, "hello world"))
+
+	info, err := b.StatObject(object)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"tenant": "tenant1"}, info.Metadata)
+	assert.Equal(t, "GLACIER_IR", info.StorageClass)
+
+	downloadURL, err := b.CreatePresignedURLForDownload(object, time.Minute, ResponseHeaders{ContentDisposition: "attachment"})
+	require.NoError(t, err)
+
+	u, err := url.Parse(downloadURL)
+	require.NoError(t, err)
+	assert.Equal(t, "/mybucket/folder/my%20file.txt", u.EscapedPath())
+	assert.Equal(t, gcsTestAccount+"/"+time.Now().UTC().Format("20060102")+"/auto/storage/goog4_request", u.Query().Get("X-Goog-Credential"))
+	assert.Equal(t, "60", u.Query().Get("X-Goog-Expires"))
+
+	response, err := http.Get(downloadURL)
+	require.NoError(t, err)
+	data, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	assert.Equal(t, "hello world", string(data))
+	assert.Equal(t, "attachment", response.Header.Get("Content-Disposition"))
+
+	_, err = b.CreatePresignedURLForDownload(object, 8*24*time.Hour, ResponseHeaders{})
+	assert.Error(t, err)
+}
+
+func TestGCSCopyDeleteObject(t *testing.T) {
+	b, server := newTestGCSBackend(t)
+	source := BucketObject{BucketName: "mybucket", Key: "/folder/file"}
+	destination := BucketObject{BucketName: "mybucket", Key: "/copy/file", StorageClass: "GLACIER_IR"}
+
+	_, err := b.PutObject(source, strings.NewReader("content"), PutOptions{ContentType: "text/plain", Metadata: map[string]string{"tenant": "tenant1"}})
+	require.NoError(t, err)
+
+	require.NoError(t, b.CopyObject(source, destination))
+	assert.Equal(t, 2, server.rewrites)
+
+	copied := server.buckets["mybucket"]["copy/file"]
+	assert.Equal(t, "content", string(copied.content))
+	assert.Equal(t, map[string]string{"tenant": "tenant1"}, copied.metadata)
+	assert.Equal(t, gcsStorageClassColdline, copied.storageClass)
+
+	assert.Equal(t, "NoSuchKey", errorCode(b.CopyObject(BucketObject{BucketName: "mybucket", Key: "/missing"}, destination)))
+
+	require.NoError(t, b.PutObjectLegalHold(source, true))
+
+	legalHold, err := b.GetObjectLegalHold(source)
+	require.NoError(t, err)
+	assert.True(t, legalHold)
+
+	err = b.BatchDeleteObjects([]BucketObject{source, destination, {BucketName: "mybucket", Key: "/missing"}})
+	require.IsType(t, &LockedObjectsError{}, err)
+	assert.Equal(t, []string{"/folder/file"}, err.(*LockedObjectsError).Keys)
+
+	require.NoError(t, b.PutObjectLegalHold(source, false))
+	require.NoError(t, b.DeleteObject(source))
+
+	assert.Empty(t, server.buckets["mybucket"])
+}
+
+func TestGCSListObjects(t *testing.T) {
+	b, _ := newTestGCSBackend(t)
+
+	for _, key := range []string{"a.txt", "folder/b.txt", "folder/sub/c.txt", "other/e.txt"} {
+		_, err := b.PutObject(BucketObject{BucketName: "mybucket", Key: key}, strings.NewReader(key), PutOptions{})
+		require.NoError(t, err)
+	}
+
+	listing, err := b.ListObjects("mybucket", ListOptions{Prefix: "folder/", Delimiter: "/"})
+	require.NoError(t, err)
+	require.Len(t, listing.Objects, 1)
+	assert.Equal(t, "folder/b.txt", listing.Objects[0].Key)
+	assert.Equal(t, int64(12), listing.Objects[0].Size)
+	assert.Empty(t, listing.Objects[0].VersionID)
+	assert.Equal(t, []string{"folder/sub/"}, listing.CommonPrefixes)
+	assert.False(t, listing.IsTruncated)
+
+	listing, err = b.ListObjects("mybucket", ListOptions{MaxKeys: 2})
+	require.NoError(t, err)
+	assert.Len(t, listing.Objects, 2)
+	assert.True(t, listing.IsTruncated)
+
+	listing, err = b.ListObjects("mybucket", ListOptions{MaxKeys: 2, ContinuationToken: listing.NextContinuationToken})
+	require.NoError(t, err)
+	assert.Equal(t, "folder/sub/c.txt", listing.Objects[0].Key)
+
+	versions, err := b.ListObjectVersions("mybucket", ListOptions{Prefix: "other/"})
+	require.NoError(t, err)
+	require.Len(t, versions.Versions, 1)
+	assert.True(t, versions.Versions[0].IsLatest)
+	assert.Equal(t, "4", versions.Versions[0].VersionID)
+
+	_, err = b.ListObjects("unknown", ListOptions{})
+	assert.Equal(t, "NoSuchBucket", errorCode(err))
+}
+
+func TestGCSMultipartUpload(t *testing.T) {
+	b, server := newTestGCSBackend(t)
+	object := BucketObject{BucketName: "mybucket", Key: "/multipart"}
+
+	uploadID, err := b.CreateMultipartUpload(object)
+	require.NoError(t, err)
+
+	var parts []CompletedPart
+
+	for partNumber, content := range []string{"hello ", "world"} {
+		partURL, err := b.CreatePresignedURLForUploadPart(object, uploadID, int64(partNumber+1), time.Minute)
+		require.NoError(t, err)
+
+		req, err := http.NewRequest("PUT", partURL.URL, strings.NewReader(content))
+		require.NoError(t, err)
+		response, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		response.Body.Close()
+		require.Equal(t, http.StatusOK, response.StatusCode)
+
+		parts = append(parts, CompletedPart{PartNumber: int64(partNumber + 1), ETag: response.Header.Get("ETag")})
+	}
+
+	err = b.CompleteMultipartUpload(object, uploadID, []CompletedPart{parts[1], parts[0]})
+	assert.Equal(t, "InvalidPartOrder", errorCode(err))
+
+	require.NoError(t, b.CompleteMultipartUpload(object, uploadID, parts))
+	assert.Equal(t, "hello world", string(server.buckets["mybucket"]["multipart"].content))
+
+	assert.Equal(t, "NoSuchUpload", errorCode(b.CompleteMultipartUpload(object, uploadID, parts)))
+
+	uploadID, err = b.CreateMultipartUpload(object)
+	require.NoError(t, err)
+	require.NoError(t, b.AbortMultipartUpload(object, uploadID))
+	assert.Empty(t, server.uploads)
+}
+
+func TestGCSTaggingRetention(t *testing.T) {
+	b, _ := newTestGCSBackend(t)
+	object := BucketObject{BucketName: "mybucket", Key: "/file"}
+
+	_, err := b.PutObject(object, strings.NewReader("content"), PutOptions{Metadata: map[string]string{"tenant": "tenant1"}})
+	require.NoError(t, err)
+
+	require.NoError(t, b.PutObjectTagging(object, map[string]string{"status": "draft", "owner": "me"}))
+	require.NoError(t, b.PutObjectTagging(object, map[string]string{"status": "published"}))
+
+	tags, err := b.GetObjectTagging(object)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"status": "published"}, tags)
+
+	// the tags are not user metadata
+	info, err := b.StatObject(object)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"tenant": "tenant1"}, info.Metadata)
+
+	require.NoError(t, b.DeleteObjectTagging(object))
+	tags, err = b.GetObjectTagging(object)
+	require.NoError(t, err)
+	assert.Empty(t, tags)
+
+	retention, err := b.GetObjectRetention(object)
+	require.NoError(t, err)
+	assert.Equal(t, &ObjectRetention{}, retention)
+
+	until := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+	require.NoError(t, b.PutObjectRetention(object, ObjectRetention{Mode: ObjectLockModeCompliance, RetainUntilDate: &until}, false))
+
+	retention, err = b.GetObjectRetention(object)
+	require.NoError(t, err)
+	assert.Equal(t, ObjectLockModeCompliance, retention.Mode)
+	assert.True(t, until.Equal(*retention.RetainUntilDate))
+
+	assert.Equal(t, "AccessDenied", errorCode(b.PutObjectRetention(object, ObjectRetention{}, false)))
+	require.NoError(t, b.PutObjectRetention(object, ObjectRetention{}, true))
+
+	_, err = b.RestoreObject(object, RestoreOptions{Days: 1})
+	assert.Equal(t, "InvalidObjectState", errorCode(err))
+}
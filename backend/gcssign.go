@@ -0,0 +1,246 @@
+// Service account credentials and V4 signed URLs of the Google Cloud Storage backend
+
+package backend
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// token endpoint used when the service account file has no token_uri
+	gcsDefaultTokenURI = "https://oauth2.googleapis.com/token"
+	// OAuth scope of the access tokens
+	gcsScope = "https://www.googleapis.com/auth/devstorage.full_control"
+	// algorithm of the V4 signatures
+	gcsSigningAlgorithm = "GOOG4-RSA-SHA256"
+	// max. expiry of a V4 signed URL (7 days)
+	gcsMaxExpiry = 7 * 24 * time.Hour
+)
+
+// service account key file downloaded from the Google Cloud console
+type gcsCredentials struct {
+	Type        string `json:"type"`
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// read a service account key file and parse its private key
+func readGCSCredentials(path string) (gcsCredentials, *rsa.PrivateKey, error) {
+	var credentials gcsCredentials
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return credentials, nil, err
+	}
+	if err := json.Unmarshal(data, &credentials); err != nil {
+		return credentials, nil, fmt.Errorf("invalid service account file %s : %v", path, err)
+	}
+	if credentials.Type != "service_account" || credentials.ClientEmail == "" {
+		return credentials, nil, fmt.Errorf("%s is not a service account key file", path)
+	}
+	if credentials.TokenURI == "" {
+		credentials.TokenURI = gcsDefaultTokenURI
+	}
+
+	block, _ := pem.Decode([]byte(credentials.PrivateKey))
+	if block == nil {
+		return credentials, nil, fmt.Errorf("invalid private key in %s", path)
+	}
+
+	// the keys generated by Google are PKCS #8 keys
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		if key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			return credentials, nil, fmt.Errorf("invalid private key in %s : %v", path, err)
+		}
+	}
+
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return credentials, nil, fmt.Errorf("the private key of %s is not a RSA key", path)
+	}
+
+	return credentials, rsaKey, nil
+}
+
+// RSA-SHA256 signature of a message with the private key of the service account
+func (b *GCSBackend) sign(message string) ([]byte, error) {
+	digest := sha256.Sum256([]byte(message))
+	return rsa.SignPKCS1v15(rand.Reader, b.privateKey, crypto.SHA256, digest[:])
+}
+
+// returns an OAuth access token of the service account, the token is requested with a signed JWT and cached until it expires
+// https://developers.google.com/identity/protocols/oauth2/service-account#httprest
+func (b *GCSBackend) accessToken() (string, error) {
+	b.tokenMutex.Lock()
+	defer b.tokenMutex.Unlock()
+
+	now := time.Now()
+	if b.token != "" && now.Before(b.tokenExpiry) {
+		return b.token, nil
+	}
+
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss":   b.credentials.ClientEmail,
+		"scope": gcsScope,
+		"aud":   b.credentials.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`)) + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	signature, err := b.sign(unsigned)
+	if err != nil {
+		return "", err
+	}
+
+	response, err := b.client.PostForm(b.credentials.TokenURI, url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {unsigned + "." + base64.RawURLEncoding.EncodeToString(signature)},
+	})
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+		Error       string `json:"error"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("invalid response of the token endpoint %s : %v", b.credentials.TokenURI, err)
+	}
+	if response.StatusCode != http.StatusOK || token.AccessToken == "" {
+		return "", fmt.Errorf("the token endpoint %s refused the service account %s : %s", b.credentials.TokenURI, b.credentials.ClientEmail, token.Error)
+	}
+
+	// the token is renewed one minute before its expiry
+	b.token = token.AccessToken
+	b.tokenExpiry = now.Add(time.Duration(token.ExpiresIn)*time.Second - time.Minute)
+
+	return b.token, nil
+}
+
+// create a V4 signed URL of the XML API, the headers are signed and have to be sent by the client
+// https://cloud.google.com/storage/docs/access-control/signing-urls-manually
+func (b *GCSBackend) signedURL(method string, bucket string, name string, expire time.Duration, headers map[string]string, query url.Values) (string, error) {
+	if expire > gcsMaxExpiry {
+		return "", errors.New("the expiry of a GCS signed URL can not exceed 7 days")
+	}
+
+	var (
+		now             = time.Now().UTC()
+		credentialScope = now.Format("20060102") + "/auto/storage/goog4_request"
+		resource        = b.xmlPath(bucket, name)
+		signedHeaders   = map[string]string{"host": b.endpoint.Host}
+	)
+
+	for name, value := range headers {
+		signedHeaders[strings.ToLower(name)] = value
+	}
+
+	signed := make(url.Values, len(query)+5)
+	for name, values := range query {
+		signed[name] = values
+	}
+	signed.Set("X-Goog-Algorithm", gcsSigningAlgorithm)
+	signed.Set("X-Goog-Credential", b.credentials.ClientEmail+"/"+credentialScope)
+	signed.Set("X-Goog-Date", now.Format("20060102T150405Z"))
+	signed.Set("X-Goog-Expires", strconv.FormatInt(int64(expire/time.Second), 10))
+	signed.Set("X-Goog-SignedHeaders", gcsSignedHeaderNames(signedHeaders))
+
+	signature, err := b.sign(gcsStringToSign(method, resource, signed, signedHeaders))
+	if err != nil {
+		return "", err
+	}
+
+	return b.origin + resource + "?" + gcsCanonicalQuery(signed) + "&X-Goog-Signature=" + hex.EncodeToString(signature), nil
+}
+
+// string to sign of a V4 signed URL, the payload is not signed
+func gcsStringToSign(method string, resource string, query url.Values, headers map[string]string) string {
+	var canonicalHeaders strings.Builder
+
+	signedHeaderNames := gcsSignedHeaderNames(headers)
+	for _, name := range strings.Split(signedHeaderNames, ";") {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		resource,
+		gcsCanonicalQuery(query),
+		canonicalHeaders.String(),
+		signedHeaderNames,
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+
+	digest := sha256.Sum256([]byte(canonicalRequest))
+
+	credential := query.Get("X-Goog-Credential")
+	credentialScope := credential[strings.Index(credential, "/")+1:]
+
+	return strings.Join([]string{gcsSigningAlgorithm, query.Get("X-Goog-Date"), credentialScope, hex.EncodeToString(digest[:])}, "\n")
+}
+
+// lowercase names of the signed headers sorted and separated by ";"
+func gcsSignedHeaderNames(headers map[string]string) string {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ";")
+}
+
+// query parameters sorted by name and percent-encoded, the X-Goog-Signature parameter is ignored
+func gcsCanonicalQuery(query url.Values) string {
+	var parameters []string
+	for name, values := range query {
+		if name == "X-Goog-Signature" {
+			continue
+		}
+		for _, value := range values {
+			parameters = append(parameters, gcsEscape(name)+"="+gcsEscape(value))
+		}
+	}
+	sort.Strings(parameters)
+	return strings.Join(parameters, "&")
+}
+
+// percent-encode all the characters except the unreserved ones (A-Z a-z 0-9 - . _ ~)
+func gcsEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+// percent-encode an object name, the "/" separators are kept
+func gcsEscapePath(name string) string {
+	segments := strings.Split(name, "/")
+	for index, segment := range segments {
+		segments[index] = gcsEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,552 @@
+// Replicating implementation of the Backend interface for the disaster recovery : the deletes and the copies done on the primary backend
+// are replayed on a secondary backend (another region or another provider). The operations not yet replicated are kept in a queue on disk
+// (one JSON file per operation) so that they survive a restart, and are retried in order until they succeed. The operations failing
+// with a permanent error or too many times are moved to a dead letter directory so that they do not block the next operations
+
+package backend
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	logging "github.com/op/go-logging"
+)
+
+var (
+	log = logging.MustGetLogger("s3proxy")
+)
+
+// Replication modes
+const (
+	// the operation is replicated on the secondary backend before returning, a failed replication is queued
+	ReplicationSync = "sync"
+	// the operation is queued and replicated in background
+	ReplicationAsync = "async"
+)
+
+const (
+	// default interval between two retries of the queued operations
+	defaultReplicationRetryInterval = 30 * time.Second
+	// default number of attempts of an operation before it is moved to the dead letters
+	defaultReplicationMaxAttempts = 120
+	// directory of the dead letters in the queue directory
+	deadLetterDirName = "dead-letter"
+)
+
+// replicated methods
+const (
+	replicateDeleteObject       = "DeleteObject"
+	replicateBatchDeleteObjects = "BatchDeleteObjects"
+	replicateCopyObject         = "CopyObject"
+)
+
+// ReplicatingBackendConfig for the replicating backend
+type ReplicatingBackendConfig struct {
+	// Backend of the reads and of the writes, its errors are returned
+	Primary Backend
+
+	// Backend on which the deletes and the copies are replayed
+	Secondary Backend
+
+	// ReplicationSync or ReplicationAsync, ReplicationSync when empty
+	Mode string
+
+	// Directory of the queue of the operations not yet replicated, created when missing and only readable by the owner
+	// the SSE-C keys are never written : a queued copy of an SSE-C object fails and is moved to the dead letters
+	// the operations which can not be replicated are moved to its "dead-letter" sub-directory
+	QueueDir string
+
+	// Interval between two retries of the queued operations, 30s when 0
+	RetryInterval time.Duration
+
+	// Number of attempts of an operation failing with a temporary error before it is moved to the dead letters, 120 when 0
+	MaxAttempts int
+}
+
+// ReplicationStatus is the state of the replication on the secondary backend
+type ReplicationStatus struct {
+	Mode string `json:"mode"`
+	// number of operations waiting to be replicated (async operations and failed replications)
+	QueuedOperations int `json:"queuedOperations"`
+	// age in seconds of the oldest queued operation, 0 when the queue is empty
+	LagSeconds float64 `json:"lagSeconds"`
+	// number of replicated operations and of failed replication attempts since the start
+	Replicated      int64      `json:"replicated"`
+	Failures        int64      `json:"failures"`
+	LastReplication *time.Time `json:"lastReplication,omitempty"`
+	LastFailure     *time.Time `json:"lastFailure,omitempty"`
+	LastError       string     `json:"lastError,omitempty"`
+	// number of operations moved to the dead letter directory, they are not replicated anymore
+	DeadLetters   int    `json:"deadLetters"`
+	DeadLetterDir string `json:"deadLetterDir"`
+}
+
+// ReplicatingBackend executes the deletes and the copies on the primary backend then on the secondary backend
+// the other operations (reads, uploads, tags, Object Lock ...) are only executed by the embedded primary backend
+// the operations on a specific version are not replicated : the version ids differ between the backends
+type ReplicatingBackend struct {
+	Backend
+
+	secondary     Backend
+	mode          string
+	queueDir      string
+	deadLetterDir string
+	retryInterval time.Duration
+	maxAttempts   int
+
+	mutex    sync.Mutex
+	queue    []*replicationOperation
+	sequence int64
+	status   ReplicationStatus
+
+	wakeUp chan struct{}
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// operation to replicate on the secondary backend, the objects of a copy are the source and the destination
+type replicationOperation struct {
+	ID       string         `json:"id"`
+	Method   string         `json:"method"`
+	Objects  []BucketObject `json:"objects"`
+	Created  time.Time      `json:"created"`
+	Attempts int            `json:"attempts"`
+	// error of the last attempt of a dead letter
+	Error string `json:"error,omitempty"`
+}
+
+func (op *replicationOperation) String() string {
+	objects := make([]string, 0, len(op.Objects))
+	for _, object := range op.Objects {
+		objects = append(objects, object.String())
+	}
+	return fmt.Sprintf("%s %s", op.Method, strings.Join(objects, ", "))
+}
+
+// Create a replicating backend, the operations left in the queue directory by a previous run are replicated first
+// Close stops the replication in background
+func NewReplicatingBackend(config ReplicatingBackendConfig) (*ReplicatingBackend, error) {
+	if config.Primary == nil || config.Secondary == nil {
+		return nil, errors.New("the replicating backend requires a primary and a secondary backend")
+	}
+	if config.QueueDir == "" {
+		return nil, errors.New("the replicating backend requires a queue directory")
+	}
+
+	switch config.Mode {
+	case "":
+		config.Mode = ReplicationSync
+	case ReplicationSync, ReplicationAsync:
+	default:
+		return nil, fmt.Errorf("invalid replication mode %q, must be %s or %s", config.Mode, ReplicationSync, ReplicationAsync)
+	}
+
+	if config.RetryInterval <= 0 {
+		config.RetryInterval = defaultReplicationRetryInterval
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = defaultReplicationMaxAttempts
+	}
+
+	deadLetterDir := filepath.Join(config.QueueDir, deadLetterDirName)
+	if err := os.MkdirAll(deadLetterDir, 0o700); err != nil {
+		return nil, err
+	}
+
+	b := &ReplicatingBackend{
+		Backend:       config.Primary,
+		secondary:     config.Secondary,
+		mode:          config.Mode,
+		queueDir:      config.QueueDir,
+		deadLetterDir: deadLetterDir,
+		retryInterval: config.RetryInterval,
+		maxAttempts:   config.MaxAttempts,
+		status:        ReplicationStatus{Mode: config.Mode, DeadLetterDir: deadLetterDir},
+		wakeUp:        make(chan struct{}, 1),
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+
+	if err := b.loadQueue(); err != nil {
+		return nil, err
+	}
+	if len(b.queue) > 0 {
+		log.Infof("Replication : %d operation(s) left in the queue %s", len(b.queue), b.queueDir)
+	}
+
+	go b.run()
+
+	return b, nil
+}
+
+// read the queued operations in their order
+func (b *ReplicatingBackend) loadQueue() error {
+	files, err := filepath.Glob(filepath.Join(b.queueDir, "*.json"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		var op replicationOperation
+		if err := readJSON(file, &op); err != nil {
+			return fmt.Errorf("invalid replication queue file %s : %v", file, err)
+		}
+		b.queue = append(b.queue, &op)
+	}
+
+	deadLetters, err := filepath.Glob(filepath.Join(b.deadLetterDir, "*.json"))
+	if err != nil {
+		return err
+	}
+	b.status.DeadLetters = len(deadLetters)
+
+	return nil
+}
+
+// Close stops the replication in background, the queued operations are replicated by the next start
+func (b *ReplicatingBackend) Close() {
+	close(b.stop)
+	<-b.done
+}
+
+// Returns the state of the replication
+func (b *ReplicatingBackend) Status() ReplicationStatus {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	status := b.status
+	status.QueuedOperations = len(b.queue)
+	if len(b.queue) > 0 {
+		status.LagSeconds = time.Since(b.queue[0].Created).Seconds()
+	}
+
+	return status
+}
+
+// replicate an operation done on the primary backend, the operation is queued in async mode or when older operations are still queued
+// the versioned objects of a batch delete are left out, the other operations on a version are not replicated
+func (b *ReplicatingBackend) replicate(method string, objects ...BucketObject) {
+	replicated := make([]BucketObject, 0, len(objects))
+	for _, object := range objects {
+		if object.VersionID == "" {
+			replicated = append(replicated, object)
+			continue
+		}
+
+		log.Warningf("Replication : %s %s not replicated, the version ids differ between the backends", method, object)
+		if method != replicateBatchDeleteObjects {
+			return
+		}
+	}
+	if len(replicated) == 0 {
+		return
+	}
+	objects = replicated
+
+	op := &replicationOperation{Method: method, Objects: objects, Created: time.Now().UTC()}
+
+	b.mutex.Lock()
+	queued := b.mode == ReplicationAsync || len(b.queue) > 0
+	b.mutex.Unlock()
+
+	if !queued {
+		err := b.apply(op)
+		b.recordAttempt(op, err)
+		if err == nil {
+			return
+		}
+	}
+
+	// the SSE-C keys are only kept in memory by the request
+	op.Objects = withoutCustomerKeys(op.Objects)
+
+	b.enqueue(op)
+}
+
+// returns a copy of the objects without their SSE-C keys
+func withoutCustomerKeys(objects []BucketObject) []BucketObject {
+	stripped := make([]BucketObject, len(objects))
+	for i, object := range objects {
+		object.Encryption.CustomerKey = ""
+		stripped[i] = object
+	}
+	return stripped
+}
+
+// add an operation to the queue and wake up the replication in background
+func (b *ReplicatingBackend) enqueue(op *replicationOperation) {
+	b.mutex.Lock()
+	b.sequence++
+	op.ID = fmt.Sprintf("%020d-%06d", op.Created.UnixNano(), b.sequence%1000000)
+	b.queue = append(b.queue, op)
+	b.mutex.Unlock()
+
+	// the operation stays in the memory queue when it can not be written, it is lost by a restart
+	if err := b.writeOperation(b.queueDir, op); err != nil {
+		log.Errorf("Replication : failed to write %s in the queue %s : %v", op, b.queueDir, err)
+	}
+
+	select {
+	case b.wakeUp <- struct{}{}:
+	default:
+	}
+}
+
+// write an operation in its file of the queue or of the dead letter directory, the file is replaced atomically
+func (b *ReplicatingBackend) writeOperation(dir string, op *replicationOperation) error {
+	b.mutex.Lock()
+	data, err := json.Marshal(op)
+	b.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	file := filepath.Join(dir, op.ID+".json")
+	if err := os.WriteFile(file+".tmp", data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(file+".tmp", file)
+}
+
+// replicate the queued operations until the queue is empty, at each wake up and at each retry interval
+func (b *ReplicatingBackend) run() {
+	defer close(b.done)
+
+	ticker := time.NewTicker(b.retryInterval)
+	defer ticker.Stop()
+
+	for {
+		b.drain()
+
+		select {
+		case <-b.stop:
+			return
+		case <-b.wakeUp:
+		case <-ticker.C:
+		}
+	}
+}
+
+// replicate the queued operations in their order, stops at the first temporary failure to keep the order
+// an operation failing with a permanent error or too many times is moved to the dead letters
+func (b *ReplicatingBackend) drain() {
+	for {
+		b.mutex.Lock()
+		if len(b.queue) == 0 {
+			b.mutex.Unlock()
+			return
+		}
+		op := b.queue[0]
+		b.mutex.Unlock()
+
+		err := b.apply(op)
+		attempts := b.recordAttempt(op, err)
+
+		_, locked := err.(*LockedObjectsError)
+		deadLetter := err != nil && !locked && (isPermanentError(err) || attempts >= b.maxAttempts)
+
+		if err != nil && !locked && !deadLetter {
+			if err := b.writeOperation(b.queueDir, op); err != nil {
+				log.Errorf("Replication : failed to write %s in the queue %s : %v", op, b.queueDir, err)
+			}
+			return
+		}
+
+		b.mutex.Lock()
+		b.queue = b.queue[1:]
+		b.mutex.Unlock()
+
+		switch {
+		case deadLetter:
+			b.moveToDeadLetters(op, err)
+		case locked:
+			// a locked object of the secondary backend will never be deleted, the operation is dropped
+			log.Warningf("Replication : %s dropped, the objects are locked on the secondary backend", op)
+		case attempts > 1:
+			log.Infof("Replication : %s replicated after %d attempts, lag %v", op, attempts, time.Since(op.Created).Round(time.Millisecond))
+		}
+
+		if err := os.Remove(filepath.Join(b.queueDir, op.ID+".json")); err != nil && !os.IsNotExist(err) {
+			log.Errorf("Replication : failed to remove %s from the queue %s : %v", op, b.queueDir, err)
+		}
+	}
+}
+
+// write an operation which can not be replicated in the dead letter directory with its last error
+func (b *ReplicatingBackend) moveToDeadLetters(op *replicationOperation, err error) {
+	b.mutex.Lock()
+	op.Error = err.Error()
+	b.mutex.Unlock()
+
+	log.Errorf("Replication : %s moved to the dead letters %s after %d attempt(s) : %v", op, b.deadLetterDir, op.Attempts, err)
+
+	if err := b.writeOperation(b.deadLetterDir, op); err != nil {
+		log.Errorf("Replication : failed to write %s in the dead letters %s : %v", op, b.deadLetterDir, err)
+	}
+
+	b.mutex.Lock()
+	b.status.DeadLetters++
+	b.mutex.Unlock()
+}
+
+// returns true if the error of the secondary backend will not disappear with a retry : a client error (4xx status
+// or code of a client error without status) other than a throttling, a timeout or a conflict
+func isPermanentError(err error) bool {
+	awsErr, ok := err.(awserr.Error)
+	if !ok {
+		return false
+	}
+
+	switch awsErr.Code() {
+	case "SlowDown", "Throttling", "ThrottlingException", "TooManyRequests", "RequestTimeout", "RequestTimeTooSkewed", "OperationAborted":
+		return false
+	}
+
+	if requestErr, ok := err.(awserr.RequestFailure); ok {
+		switch status := requestErr.StatusCode(); status {
+		case http.StatusRequestTimeout, http.StatusConflict, http.StatusTooManyRequests:
+			return false
+		default:
+			return status >= 400 && status < 500
+		}
+	}
+
+	switch awsErr.Code() {
+	case s3.ErrCodeNoSuchBucket, s3.ErrCodeNoSuchKey, "AccessDenied", "InvalidArgument", "InvalidRequest", "EntityTooLarge", "TotalPartsExceeded", ErrCodeInvalidEncryption:
+		return true
+	}
+	return false
+}
+
+// update the counters of the status with the result of a replication attempt, returns the number of attempts of the operation
+func (b *ReplicatingBackend) recordAttempt(op *replicationOperation, err error) int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	now := time.Now().UTC()
+	op.Attempts++
+
+	if err == nil {
+		b.status.Replicated++
+		b.status.LastReplication = &now
+		return op.Attempts
+	}
+
+	b.status.Failures++
+	b.status.LastFailure = &now
+	b.status.LastError = fmt.Sprintf("%s : %v", op, err)
+
+	log.Errorf("Replication : failed to replicate %s (attempt %d, lag %v) : %v", op, op.Attempts, now.Sub(op.Created).Round(time.Millisecond), err)
+
+	return op.Attempts
+}
+
+// execute an operation on the secondary backend
+// when the source of a copy is missing on the secondary backend (ex: uploaded with a presigned URL of the primary backend)
+// the destination object is streamed from the primary backend, the copy is done when the destination has been deleted since
+func (b *ReplicatingBackend) apply(op *replicationOperation) error {
+	switch op.Method {
+	case replicateDeleteObject:
+		return b.secondary.DeleteObject(op.Objects[0])
+
+	case replicateBatchDeleteObjects:
+		return b.secondary.BatchDeleteObjects(op.Objects)
+
+	case replicateCopyObject:
+		for _, object := range op.Objects {
+			if object.Encryption.Mode == EncryptionSSEC && object.Encryption.CustomerKey == "" {
+				return awserr.New(ErrCodeInvalidEncryption, fmt.Sprintf("the SSE-C key of %s is not kept by the replication queue", object), nil)
+			}
+		}
+
+		err := b.secondary.CopyObject(op.Objects[0], op.Objects[1])
+		if !isNoSuchKey(err) {
+			return err
+		}
+		if err = streamCopy(b.Backend, op.Objects[1], b.secondary, op.Objects[1]); isNoSuchKey(err) {
+			return nil
+		}
+		return err
+
+	default:
+		return fmt.Errorf("unknown replicated method %s", op.Method)
+	}
+}
+
+// returns true if the error is a missing object
+func isNoSuchKey(err error) bool {
+	if err, ok := err.(awserr.Error); ok {
+		return err.Code() == s3.ErrCodeNoSuchKey
+	}
+	return false
+}
+
+// Delete an object on the primary backend then on the secondary backend, a locked object is not replicated
+func (b *ReplicatingBackend) DeleteObject(object BucketObject) error {
+	if err := b.Backend.DeleteObject(object); err != nil {
+		return err
+	}
+
+	b.replicate(replicateDeleteObject, object)
+	return nil
+}
+
+// Delete objects on the primary backend then on the secondary backend, the locked objects are not replicated
+func (b *ReplicatingBackend) BatchDeleteObjects(objects []BucketObject) error {
+	err := b.Backend.BatchDeleteObjects(objects)
+
+	lockedErr, locked := err.(*LockedObjectsError)
+	if err != nil && !locked {
+		return err
+	}
+
+	deleted := objects
+	if locked {
+		// the locked objects and the other failures kept in the original error are not deleted
+		failedKeys := make(map[string]bool, len(lockedErr.Keys))
+		for _, key := range lockedErr.Keys {
+			failedKeys[key] = true
+		}
+		if batchErr, ok := lockedErr.OrigErr().(*s3manager.BatchError); ok {
+			for _, element := range batchErr.Errors {
+				failedKeys[aws.StringValue(element.Key)] = true
+			}
+		}
+
+		deleted = nil
+		for _, object := range objects {
+			if !failedKeys[object.Key] {
+				deleted = append(deleted, object)
+			}
+		}
+	}
+
+	if len(deleted) > 0 {
+		b.replicate(replicateBatchDeleteObjects, deleted...)
+	}
+
+	return err
+}
+
+// Copy an object on the primary backend then on the secondary backend
+func (b *ReplicatingBackend) CopyObject(sourceObject BucketObject, destinationObject BucketObject) error {
+	if err := b.Backend.CopyObject(sourceObject, destinationObject); err != nil {
+		return err
+	}
+
+	b.replicate(replicateCopyObject, sourceObject, destinationObject)
+	return nil
+}
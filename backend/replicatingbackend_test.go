@@ -0,0 +1,369 @@
+package backend
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// backend whose deletes and copies fail with the error, the other operations are done by the backend
+type faultyBackend struct {
+	Backend
+
+	mutex sync.Mutex
+	err   error
+}
+
+func (b *faultyBackend) setError(err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.err = err
+}
+
+func (b *faultyBackend) error() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.err
+}
+
+func (b *faultyBackend) DeleteObject(object BucketObject) error {
+	if err := b.error(); err != nil {
+		return err
+	}
+	return b.Backend.DeleteObject(object)
+}
+
+func (b *faultyBackend) BatchDeleteObjects(objects []BucketObject) error {
+	if err := b.error(); err != nil {
+		return err
+	}
+	return b.Backend.BatchDeleteObjects(objects)
+}
+
+func (b *faultyBackend) CopyObject(sourceObject BucketObject, destinationObject BucketObject) error {
+	if err := b.error(); err != nil {
+		return err
+	}
+	return b.Backend.CopyObject(sourceObject, destinationObject)
+}
+
+func newTestReplicatingBackend(t *testing.T, mode string, queueDir string, primary Backend, secondary Backend) *ReplicatingBackend {
+	b, err := NewReplicatingBackend(ReplicatingBackendConfig{
+		Primary:       primary,
+		Secondary:     secondary,
+		Mode:          mode,
+		QueueDir:      queueDir,
+		RetryInterval: 10 * time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	return b
+}
+
+// put the same object in both backends
+func putReplicated(t *testing.T, object BucketObject, content string, backends ...Backend) {
+	for _, b := range backends {
+		_, err := b.PutObject(object, strings.NewReader(content), PutOptions{ContentType: "text/plain"})
+		require.NoError(t, err)
+	}
+}
+
+func exists(b Backend, object BucketObject) bool {
+	_, err := b.StatObject(object)
+	return err == nil
+}
+
+func TestNewReplicatingBackend(t *testing.T) {
+	fsBackend := newTestFSBackendWithBuckets(t)
+
+	_, err := NewReplicatingBackend(ReplicatingBackendConfig{Primary: fsBackend, QueueDir: t.TempDir()})
+	assert.Error(t, err)
+
+	_, err = NewReplicatingBackend(ReplicatingBackendConfig{Primary: fsBackend, Secondary: fsBackend})
+	assert.Error(t, err)
+
+	_, err = NewReplicatingBackend(ReplicatingBackendConfig{Primary: fsBackend, Secondary: fsBackend, QueueDir: t.TempDir(), Mode: "later"})
+	assert.ErrorContains(t, err, "invalid replication mode")
+}
+
+func TestReplicatingBackendSync(t *testing.T) {
+	primary := newTestFSBackendWithBuckets(t, "mybucket")
+	secondary := newTestFSBackendWithBuckets(t, "mybucket")
+
+	b := newTestReplicatingBackend(t, "", t.TempDir(), primary, secondary)
+	defer b.Close()
+
+	file1 := BucketObject{BucketName: "mybucket", Key: "/file1"}
+	file2 := BucketObject{BucketName: "mybucket", Key: "/file2"}
+	putReplicated(t, file1, "file1", primary, secondary)
+	putReplicated(t, file2, "file2", primary, secondary)
+
+	copied := BucketObject{BucketName: "mybucket", Key: "/copy"}
+	require.NoError(t, b.CopyObject(file1, copied))
+	assert.True(t, exists(secondary, copied))
+
+	require.NoError(t, b.DeleteObject(file1))
+	assert.False(t, exists(secondary, file1))
+
+	require.NoError(t, b.BatchDeleteObjects([]BucketObject{file2, copied}))
+	assert.False(t, exists(secondary, file2))
+	assert.False(t, exists(secondary, copied))
+
+	// the object uploaded only on the primary backend is streamed to the secondary backend
+	uploaded := BucketObject{BucketName: "mybucket", Key: "/uploaded"}
+	putReplicated(t, uploaded, "uploaded", primary)
+	require.NoError(t, b.CopyObject(uploaded, copied))
+
+	info, err := secondary.StatObject(copied)
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain", info.ContentType)
+	assert.False(t, exists(secondary, uploaded))
+
+	status := b.Status()
+	assert.Equal(t, ReplicationSync, status.Mode)
+	assert.Equal(t, int64(4), status.Replicated)
+	assert.Zero(t, status.Failures)
+	assert.Zero(t, status.QueuedOperations)
+
+	// the errors of the primary backend are returned and the operation is not replicated
+	assert.Equal(t, "NoSuchKey", errorCode(b.CopyObject(file1, BucketObject{BucketName: "mybucket", Key: "/copy2"})))
+	assert.Equal(t, int64(4), b.Status().Replicated)
+}
+
+func TestReplicatingBackendBatchDeleteFailures(t *testing.T) {
+	primary := &faultyBackend{Backend: newTestFSBackendWithBuckets(t, "mybucket")}
+	secondary := newTestFSBackendWithBuckets(t, "mybucket")
+
+	b := newTestReplicatingBackend(t, "", t.TempDir(), primary, secondary)
+	defer b.Close()
+
+	locked := BucketObject{BucketName: "mybucket", Key: "/locked"}
+	failed := BucketObject{BucketName: "mybucket", Key: "/failed"}
+	deleted := BucketObject{BucketName: "mybucket", Key: "/deleted"}
+	for _, object := range []BucketObject{locked, failed, deleted} {
+		putReplicated(t, object, "content", secondary)
+	}
+
+	// the locked objects and the other failures of the primary backend are not deleted on the secondary backend
+	primary.setError(NewLockedObjectsError([]string{"/locked"}, s3manager.NewBatchError("BatchedDeleteIncomplete", "some objects have failed to be deleted.", []s3manager.Error{
+		{OrigErr: awserr.New("InternalError", "internal error", nil), Bucket: aws.String("mybucket"), Key: aws.String("/failed")},
+	})))
+	assert.Equal(t, ErrCodeObjectLocked, errorCode(b.BatchDeleteObjects([]BucketObject{locked, failed, deleted})))
+
+	assert.True(t, exists(secondary, locked))
+	assert.True(t, exists(secondary, failed))
+	assert.False(t, exists(secondary, deleted))
+}
+
+func TestReplicatingBackendVersions(t *testing.T) {
+	primary := newTestFSBackendWithBuckets(t, "mybucket")
+	secondary := newTestFSBackendWithBuckets(t, "mybucket")
+
+	b := newTestReplicatingBackend(t, "", t.TempDir(), primary, secondary)
+	defer b.Close()
+
+	file1 := BucketObject{BucketName: "mybucket", Key: "/file1"}
+	file2 := BucketObject{BucketName: "mybucket", Key: "/file2"}
+	putReplicated(t, file1, "file1", secondary)
+	putReplicated(t, file2, "file2", secondary)
+
+	// only the versioned objects of a batch delete are left out
+	b.replicate(replicateBatchDeleteObjects, file1, BucketObject{BucketName: "mybucket", Key: "/file2", VersionID: "v1"})
+	assert.False(t, exists(secondary, file1))
+	assert.True(t, exists(secondary, file2))
+
+	// the other operations on a version are not replicated
+	b.replicate(replicateCopyObject, BucketObject{BucketName: "mybucket", Key: "/file2", VersionID: "v1"}, file1)
+	assert.False(t, exists(secondary, file1))
+	assert.Equal(t, int64(1), b.Status().Replicated)
+}
+
+func TestReplicatingBackendRetry(t *testing.T) {
+	primary := newTestFSBackendWithBuckets(t, "mybucket")
+	secondary := &faultyBackend{Backend: newTestFSBackendWithBuckets(t, "mybucket")}
+	queueDir := t.TempDir()
+
+	b := newTestReplicatingBackend(t, ReplicationSync, queueDir, primary, secondary)
+	defer b.Close()
+
+	file1 := BucketObject{BucketName: "mybucket", Key: "/file1"}
+	file2 := BucketObject{BucketName: "mybucket", Key: "/file2"}
+	putReplicated(t, file1, "file1", primary, secondary)
+	putReplicated(t, file2, "file2", primary, secondary)
+
+	secondary.setError(errors.New("region unavailable"))
+
+	// the primary operation succeeds and the failed replication is queued on disk
+	require.NoError(t, b.DeleteObject(file1))
+	assert.True(t, exists(secondary, file1))
+
+	assert.Eventually(t, func() bool { return b.Status().Failures >= 2 }, time.Second, 5*time.Millisecond)
+
+	// the next operations are queued behind to keep the order
+	require.NoError(t, b.DeleteObject(file2))
+
+	status := b.Status()
+	assert.Equal(t, 2, status.QueuedOperations)
+	assert.Greater(t, status.LagSeconds, float64(0))
+	assert.Contains(t, status.LastError, "region unavailable")
+
+	files, err := filepath.Glob(filepath.Join(queueDir, "*.json"))
+	require.NoError(t, err)
+	assert.Len(t, files, 2)
+
+	secondary.setError(nil)
+
+	assert.Eventually(t, func() bool { return b.Status().QueuedOperations == 0 }, time.Second, 5*time.Millisecond)
+	assert.False(t, exists(secondary, file1))
+	assert.False(t, exists(secondary, file2))
+
+	files, err = filepath.Glob(filepath.Join(queueDir, "*.json"))
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestReplicatingBackendAsync(t *testing.T) {
+	primary := newTestFSBackendWithBuckets(t, "mybucket")
+	secondary := &faultyBackend{Backend: newTestFSBackendWithBuckets(t, "mybucket")}
+	queueDir := t.TempDir()
+
+	file1 := BucketObject{BucketName: "mybucket", Key: "/file1"}
+	putReplicated(t, file1, "file1", primary, secondary)
+
+	secondary.setError(errors.New("region unavailable"))
+
+	b := newTestReplicatingBackend(t, ReplicationAsync, queueDir, primary, secondary)
+	require.NoError(t, b.CopyObject(file1, BucketObject{BucketName: "mybucket", Key: "/copy"}))
+	require.NoError(t, b.DeleteObject(file1))
+	b.Close()
+
+	assert.Equal(t, 2, b.Status().QueuedOperations)
+
+	// the queue survives a restart and is replicated in order
+	secondary.setError(nil)
+
+	b = newTestReplicatingBackend(t, ReplicationAsync, queueDir, primary, secondary)
+	defer b.Close()
+
+	assert.Eventually(t, func() bool { return b.Status().QueuedOperations == 0 }, time.Second, 5*time.Millisecond)
+	assert.True(t, exists(secondary, BucketObject{BucketName: "mybucket", Key: "/copy"}))
+	assert.False(t, exists(secondary, file1))
+	assert.Equal(t, int64(2), b.Status().Replicated)
+}
+
+func TestReplicatingBackendLockedSecondary(t *testing.T) {
+	primary := newTestFSBackendWithBuckets(t, "mybucket")
+	secondary := &faultyBackend{Backend: newTestFSBackendWithBuckets(t, "mybucket")}
+
+	b := newTestReplicatingBackend(t, ReplicationSync, t.TempDir(), primary, secondary)
+	defer b.Close()
+
+	file1 := BucketObject{BucketName: "mybucket", Key: "/file1"}
+	putReplicated(t, file1, "file1", primary, secondary)
+
+	// a locked object of the secondary backend is not retried
+	secondary.setError(NewLockedObjectsError([]string{"/file1"}, nil))
+	require.NoError(t, b.DeleteObject(file1))
+
+	assert.Eventually(t, func() bool { return b.Status().QueuedOperations == 0 }, time.Second, 5*time.Millisecond)
+	assert.True(t, exists(secondary, file1))
+}
+
+func TestReplicatingBackendDeadLetters(t *testing.T) {
+	primary := newTestFSBackendWithBuckets(t, "mybucket")
+	secondary := &faultyBackend{Backend: newTestFSBackendWithBuckets(t, "mybucket")}
+	queueDir := t.TempDir()
+
+	b, err := NewReplicatingBackend(ReplicatingBackendConfig{
+		Primary:       primary,
+		Secondary:     secondary,
+		QueueDir:      queueDir,
+		RetryInterval: 10 * time.Millisecond,
+		MaxAttempts:   3,
+	})
+	require.NoError(t, err)
+
+	file1 := BucketObject{BucketName: "mybucket", Key: "/file1"}
+	file2 := BucketObject{BucketName: "mybucket", Key: "/file2"}
+	file3 := BucketObject{BucketName: "mybucket", Key: "/file3"}
+	putReplicated(t, file1, "file1", primary, secondary)
+	putReplicated(t, file2, "file2", primary, secondary)
+	putReplicated(t, file3, "file3", primary, secondary)
+
+	// a permanent error does not block the next operations
+	secondary.setError(awserr.NewRequestFailure(awserr.New("AccessDenied", "Access Denied", nil), 403, ""))
+	require.NoError(t, b.DeleteObject(file1))
+	assert.Eventually(t, func() bool { return b.Status().DeadLetters == 1 }, time.Second, 5*time.Millisecond)
+
+	// a temporary error is retried until the max. attempts
+	secondary.setError(awserr.NewRequestFailure(awserr.New("SlowDown", "Please reduce your request rate", nil), 503, ""))
+	require.NoError(t, b.DeleteObject(file2))
+	assert.Eventually(t, func() bool { return b.Status().DeadLetters == 2 }, time.Second, 5*time.Millisecond)
+
+	secondary.setError(nil)
+	require.NoError(t, b.DeleteObject(file3))
+	assert.False(t, exists(secondary, file3))
+
+	status := b.Status()
+	assert.Zero(t, status.QueuedOperations)
+	assert.Equal(t, filepath.Join(queueDir, "dead-letter"), status.DeadLetterDir)
+	assert.True(t, exists(secondary, file1))
+	assert.True(t, exists(secondary, file2))
+
+	files, err := filepath.Glob(filepath.Join(queueDir, "dead-letter", "*.json"))
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+
+	var op replicationOperation
+	require.NoError(t, readJSON(files[0], &op))
+	assert.Equal(t, replicateDeleteObject, op.Method)
+	assert.Contains(t, op.Error, "AccessDenied")
+
+	// the dead letters are counted after a restart
+	b.Close()
+	b = newTestReplicatingBackend(t, ReplicationSync, queueDir, primary, secondary)
+	defer b.Close()
+	assert.Equal(t, 2, b.Status().DeadLetters)
+}
+
+func TestReplicatingBackendCustomerKeys(t *testing.T) {
+	primary := newTestFSBackendWithBuckets(t, "mybucket")
+	secondary := &faultyBackend{Backend: newTestFSBackendWithBuckets(t, "mybucket")}
+	queueDir := t.TempDir()
+
+	b := newTestReplicatingBackend(t, ReplicationAsync, queueDir, primary, secondary)
+	defer b.Close()
+
+	secondary.setError(errors.New("region unavailable"))
+
+	// the copy is done by the primary backend with the key, only the queued operation is checked
+	encryption := Encryption{Mode: EncryptionSSEC, CustomerKey: "c2VjcmV0LWN1c3RvbWVyLWtleS0zMi1ieXRlcy1sb25n"}
+	b.replicate(replicateCopyObject,
+		BucketObject{BucketName: "mybucket", Key: "/source", Encryption: encryption},
+		BucketObject{BucketName: "mybucket", Key: "/copy", Encryption: encryption})
+
+	files, err := filepath.Glob(filepath.Join(queueDir, "*.json"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	data, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), encryption.CustomerKey)
+
+	// the replay without the key fails and is moved to the dead letters
+	secondary.setError(nil)
+	assert.Eventually(t, func() bool { return b.Status().DeadLetters == 1 }, time.Second, 5*time.Millisecond)
+	assert.Contains(t, b.Status().LastError, "SSE-C key")
+}
@@ -0,0 +1,413 @@
+// Routing implementation of the Backend interface, each bucket is served by one of several named backends
+// ex: the on-prem buckets on Minio and the other ones on AWS
+
+package backend
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// RoutingBackendConfig for the routing backend
+type RoutingBackendConfig struct {
+	// Backends by name (ex: aws, minio)
+	Backends map[string]Backend
+
+	// Name of the backend of the buckets by bucket name or by wildcard pattern (ex: media=minio,archive-*=aws)
+	// an exact name takes precedence over the patterns, the longest matching pattern takes precedence over the shorter ones
+	Routes map[string]string
+
+	// Name of the backend of the buckets matching no route, the unknown buckets do not exist when empty
+	DefaultBackend string
+}
+
+// RoutingBackend dispatches the operations to the backend of the bucket of the objects
+// a copy between two buckets of different backends is streamed from the source backend to the destination backend
+type RoutingBackend struct {
+	backends       map[string]Backend
+	routes         map[string]string
+	patterns       []bucketPattern
+	defaultBackend string
+}
+
+// route of the buckets matching a wildcard pattern
+type bucketPattern struct {
+	pattern string
+	backend string
+}
+
+// ParseBucketRoutes parses a list of bucket routes separated by commas
+// ex: media=minio,archive-*=aws,logs-??=aws
+// the patterns use the syntax of path.Match (*, ? and [] character classes)
+func ParseBucketRoutes(s string) (map[string]string, error) {
+	result := make(map[string]string)
+
+	for _, element := range strings.Split(s, ",") {
+		if element = strings.TrimSpace(element); element == "" {
+			continue
+		}
+
+		bucket, backendName, found := strings.Cut(element, "=")
+		if !found || bucket == "" || backendName == "" {
+			return nil, fmt.Errorf("invalid bucket route %q, format is bucket=backend", element)
+		}
+
+		if _, ok := result[bucket]; ok {
+			return nil, fmt.Errorf("duplicate bucket route for %s", bucket)
+		}
+
+		result[bucket] = backendName
+	}
+
+	return result, nil
+}
+
+// Create a routing backend, every route must name one of the backends
+func NewRoutingBackend(config RoutingBackendConfig) (*RoutingBackend, error) {
+	b := &RoutingBackend{
+		backends:       config.Backends,
+		routes:         make(map[string]string),
+		defaultBackend: config.DefaultBackend,
+	}
+
+	if _, ok := b.backends[b.defaultBackend]; b.defaultBackend != "" && !ok {
+		return nil, fmt.Errorf("unknown default backend %s", b.defaultBackend)
+	}
+
+	for bucket, backendName := range config.Routes {
+		if _, ok := b.backends[backendName]; !ok {
+			return nil, fmt.Errorf("unknown backend %s for bucket %s", backendName, bucket)
+		}
+
+		if !strings.ContainsAny(bucket, "*?[") {
+			b.routes[bucket] = backendName
+			continue
+		}
+
+		if _, err := path.Match(bucket, ""); err != nil {
+			return nil, fmt.Errorf("invalid bucket pattern %q : %v", bucket, err)
+		}
+		b.patterns = append(b.patterns, bucketPattern{pattern: bucket, backend: backendName})
+	}
+
+	// the most specific patterns first, the order of the patterns of the same length is the alphabetical order
+	sort.Slice(b.patterns, func(i, j int) bool {
+		if len(b.patterns[i].pattern) != len(b.patterns[j].pattern) {
+			return len(b.patterns[i].pattern) > len(b.patterns[j].pattern)
+		}
+		return b.patterns[i].pattern < b.patterns[j].pattern
+	})
+
+	return b, nil
+}
+
+// Returns the name of the backend of a bucket, NoSuchBucket when the bucket matches no route and there is no default backend
+func (b *RoutingBackend) BackendName(bucketName string) (string, error) {
+	if backendName, ok := b.routes[bucketName]; ok {
+		return backendName, nil
+	}
+
+	for _, route := range b.patterns {
+		if matched, _ := path.Match(route.pattern, bucketName); matched {
+			return route.backend, nil
+		}
+	}
+
+	if b.defaultBackend != "" {
+		return b.defaultBackend, nil
+	}
+
+	return "", awserr.New(s3.ErrCodeNoSuchBucket, fmt.Sprintf("No backend for the bucket %s", bucketName), nil)
+}
+
+// backend of a bucket
+func (b *RoutingBackend) backend(bucketName string) (Backend, error) {
+	backendName, err := b.BackendName(bucketName)
+	if err != nil {
+		return nil, err
+	}
+	return b.backends[backendName], nil
+}
+
+// Create a presigned URL for uploading a file with the backend of the bucket
+func (b *RoutingBackend) CreatePresignedURLForUpload(object BucketObject, expire time.Duration, constraints UploadConstraints) (*PresignedURL, error) {
+	s3Backend, err := b.backend(object.BucketName)
+	if err != nil {
+		return nil, err
+	}
+	return s3Backend.CreatePresignedURLForUpload(object, expire, constraints)
+}
+
+// Create a presigned URL for downloading a file with the backend of the bucket
+func (b *RoutingBackend) CreatePresignedURLForDownload(object BucketObject, expire time.Duration, headers ResponseHeaders) (string, error) {
+	s3Backend, err := b.backend(object.BucketName)
+	if err != nil {
+		return "", err
+	}
+	return s3Backend.CreatePresignedURLForDownload(object, expire, headers)
+}
+
+// Delete an object with the backend of the bucket
+func (b *RoutingBackend) DeleteObject(object BucketObject) error {
+	s3Backend, err := b.backend(object.BucketName)
+	if err != nil {
+		return err
+	}
+	return s3Backend.DeleteObject(object)
+}
+
+// Delete the objects with one batch delete per backend, the locked objects of all the backends are reported in a single LockedObjectsError
+// nothing is deleted when a bucket has no backend
+func (b *RoutingBackend) BatchDeleteObjects(objects []BucketObject) error {
+	var (
+		backendNames []string
+		batches      = make(map[string][]BucketObject)
+	)
+
+	for _, object := range objects {
+		backendName, err := b.BackendName(object.BucketName)
+		if err != nil {
+			return err
+		}
+		if _, ok := batches[backendName]; !ok {
+			backendNames = append(backendNames, backendName)
+		}
+		batches[backendName] = append(batches[backendName], object)
+	}
+
+	var lockedErr *LockedObjectsError
+
+	for _, backendName := range backendNames {
+		err := b.backends[backendName].BatchDeleteObjects(batches[backendName])
+		if locked, ok := err.(*LockedObjectsError); ok {
+			if lockedErr == nil {
+				lockedErr = NewLockedObjectsError(nil, locked.OrigErr())
+			}
+			lockedErr.Keys = append(lockedErr.Keys, locked.Keys...)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if lockedErr != nil {
+		return lockedErr
+	}
+	return nil
+}
+
+// Copy an object with the backend of the buckets, or stream it from the source backend to the destination backend
+// the tags, the retention and the legal hold are not copied by a streamed copy
+func (b *RoutingBackend) CopyObject(sourceObject BucketObject, destinationObject BucketObject) error {
+	sourceBackendName, err := b.BackendName(sourceObject.BucketName)
+	if err != nil {
+		return err
+	}
+	destinationBackendName, err := b.BackendName(destinationObject.BucketName)
+	if err != nil {
+		return err
+	}
+
+	if sourceBackendName == destinationBackendName {
+		return b.backends[sourceBackendName].CopyObject(sourceObject, destinationObject)
+	}
+
+	return streamCopy(b.backends[sourceBackendName], sourceObject, b.backends[destinationBackendName], destinationObject)
+}
+
+// copy an object by reading it from the source backend and writing it to the destination backend, the content type and the metadata are kept
+func streamCopy(sourceBackend Backend, sourceObject BucketObject, destinationBackend Backend, destinationObject BucketObject) error {
+	content, err := sourceBackend.GetObject(sourceObject, GetOptions{})
+	if err != nil {
+		return err
+	}
+	defer content.Body.Close()
+
+	_, err = destinationBackend.PutObject(destinationObject, content.Body, PutOptions{
+		ContentType: content.ContentType,
+		Metadata:    content.Metadata,
+		PartSize:    streamCopyPartSize(content.Size),
+	})
+	return err
+}
+
+// part size of a streamed copy, the default part size of the destination backend (at least 5MB) unless the object
+// needs more than the max. number of parts of a multipart upload
+func streamCopyPartSize(size int64) int64 {
+	partSize := (size + maxCopyParts - 1) / maxCopyParts
+	if partSize <= s3manager.MinUploadPartSize {
+		return 0
+	}
+	return partSize
+}
+
+// Returns the metadata of an object with the backend of the bucket
+func (b *RoutingBackend) StatObject(object BucketObject) (*ObjectInfo, error) {
+	s3Backend, err := b.backend(object.BucketName)
+	if err != nil {
+		return nil, err
+	}
+	return s3Backend.StatObject(object)
+}
+
+// Returns one page of the objects of a bucket with the backend of the bucket
+func (b *RoutingBackend) ListObjects(bucketName string, options ListOptions) (*ObjectListing, error) {
+	s3Backend, err := b.backend(bucketName)
+	if err != nil {
+		return nil, err
+	}
+	return s3Backend.ListObjects(bucketName, options)
+}
+
+// Initiate a multipart upload with the backend of the bucket
+func (b *RoutingBackend) CreateMultipartUpload(object BucketObject) (string, error) {
+	s3Backend, err := b.backend(object.BucketName)
+	if err != nil {
+		return "", err
+	}
+	return s3Backend.CreateMultipartUpload(object)
+}
+
+// Create a presigned URL for uploading one part of a multipart upload with the backend of the bucket
+func (b *RoutingBackend) CreatePresignedURLForUploadPart(object BucketObject, uploadID string, partNumber int64, expire time.Duration) (*PresignedURL, error) {
+	s3Backend, err := b.backend(object.BucketName)
+	if err != nil {
+		return nil, err
+	}
+	return s3Backend.CreatePresignedURLForUploadPart(object, uploadID, partNumber, expire)
+}
+
+// Complete a multipart upload with the backend of the bucket
+func (b *RoutingBackend) CompleteMultipartUpload(object BucketObject, uploadID string, parts []CompletedPart) error {
+	s3Backend, err := b.backend(object.BucketName)
+	if err != nil {
+		return err
+	}
+	return s3Backend.CompleteMultipartUpload(object, uploadID, parts)
+}
+
+// Abort a multipart upload with the backend of the bucket
+func (b *RoutingBackend) AbortMultipartUpload(object BucketObject, uploadID string) error {
+	s3Backend, err := b.backend(object.BucketName)
+	if err != nil {
+		return err
+	}
+	return s3Backend.AbortMultipartUpload(object, uploadID)
+}
+
+// Create a presigned POST policy with the backend of the bucket
+func (b *RoutingBackend) CreatePresignedPost(object BucketObject, expire time.Duration, conditions PostConditions) (*PresignedPost, error) {
+	s3Backend, err := b.backend(object.BucketName)
+	if err != nil {
+		return nil, err
+	}
+	return s3Backend.CreatePresignedPost(object, expire, conditions)
+}
+
+// Returns the content of an object with the backend of the bucket
+func (b *RoutingBackend) GetObject(object BucketObject, options GetOptions) (*ObjectContent, error) {
+	s3Backend, err := b.backend(object.BucketName)
+	if err != nil {
+		return nil, err
+	}
+	return s3Backend.GetObject(object, options)
+}
+
+// Write the content of an object with the backend of the bucket
+func (b *RoutingBackend) PutObject(object BucketObject, body io.Reader, options PutOptions) (string, error) {
+	s3Backend, err := b.backend(object.BucketName)
+	if err != nil {
+		return "", err
+	}
+	return s3Backend.PutObject(object, body, options)
+}
+
+// Returns the tags of an object with the backend of the bucket
+func (b *RoutingBackend) GetObjectTagging(object BucketObject) (map[string]string, error) {
+	s3Backend, err := b.backend(object.BucketName)
+	if err != nil {
+		return nil, err
+	}
+	return s3Backend.GetObjectTagging(object)
+}
+
+// Replace the tags of an object with the backend of the bucket
+func (b *RoutingBackend) PutObjectTagging(object BucketObject, tags map[string]string) error {
+	s3Backend, err := b.backend(object.BucketName)
+	if err != nil {
+		return err
+	}
+	return s3Backend.PutObjectTagging(object, tags)
+}
+
+// Remove the tags of an object with the backend of the bucket
+func (b *RoutingBackend) DeleteObjectTagging(object BucketObject) error {
+	s3Backend, err := b.backend(object.BucketName)
+	if err != nil {
+		return err
+	}
+	return s3Backend.DeleteObjectTagging(object)
+}
+
+// Returns one page of the versions of the objects of a bucket with the backend of the bucket
+func (b *RoutingBackend) ListObjectVersions(bucketName string, options ListOptions) (*VersionListing, error) {
+	s3Backend, err := b.backend(bucketName)
+	if err != nil {
+		return nil, err
+	}
+	return s3Backend.ListObjectVersions(bucketName, options)
+}
+
+// Returns the Object Lock retention of an object with the backend of the bucket
+func (b *RoutingBackend) GetObjectRetention(object BucketObject) (*ObjectRetention, error) {
+	s3Backend, err := b.backend(object.BucketName)
+	if err != nil {
+		return nil, err
+	}
+	return s3Backend.GetObjectRetention(object)
+}
+
+// Set the Object Lock retention of an object with the backend of the bucket
+func (b *RoutingBackend) PutObjectRetention(object BucketObject, retention ObjectRetention, bypassGovernance bool) error {
+	s3Backend, err := b.backend(object.BucketName)
+	if err != nil {
+		return err
+	}
+	return s3Backend.PutObjectRetention(object, retention, bypassGovernance)
+}
+
+// Returns the legal hold of an object with the backend of the bucket
+func (b *RoutingBackend) GetObjectLegalHold(object BucketObject) (bool, error) {
+	s3Backend, err := b.backend(object.BucketName)
+	if err != nil {
+		return false, err
+	}
+	return s3Backend.GetObjectLegalHold(object)
+}
+
+// Set or remove the legal hold of an object with the backend of the bucket
+func (b *RoutingBackend) PutObjectLegalHold(object BucketObject, legalHold bool) error {
+	s3Backend, err := b.backend(object.BucketName)
+	if err != nil {
+		return err
+	}
+	return s3Backend.PutObjectLegalHold(object, legalHold)
+}
+
+// Restore an archived object with the backend of the bucket
+func (b *RoutingBackend) RestoreObject(object BucketObject, options RestoreOptions) (bool, error) {
+	s3Backend, err := b.backend(object.BucketName)
+	if err != nil {
+		return false, err
+	}
+	return s3Backend.RestoreObject(object, options)
+}
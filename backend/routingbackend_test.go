@@ -0,0 +1,162 @@
+package backend
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// filesystem backend with the buckets
+func newTestFSBackendWithBuckets(t *testing.T, buckets ...string) *FSBackend {
+	root := t.TempDir()
+	for _, bucket := range buckets {
+		require.NoError(t, os.Mkdir(filepath.Join(root, bucket), 0o755))
+	}
+
+	b, err := NewFSBackend(FSBackendConfig{Root: root, BaseURL: "http://localhost:8080/"})
+	require.NoError(t, err)
+
+	return b
+}
+
+func TestParseBucketRoutes(t *testing.T) {
+	routes, err := ParseBucketRoutes(" media=minio, archive-*=aws ,")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"media": "minio", "archive-*": "aws"}, routes)
+
+	routes, err = ParseBucketRoutes("")
+	require.NoError(t, err)
+	assert.Empty(t, routes)
+
+	for _, s := range []string{"media", "media=", "=minio", "media=minio,media=aws"} {
+		_, err = ParseBucketRoutes(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestNewRoutingBackend(t *testing.T) {
+	backends := map[string]Backend{"aws": newTestFSBackendWithBuckets(t)}
+
+	_, err := NewRoutingBackend(RoutingBackendConfig{Backends: backends, Routes: map[string]string{"media": "minio"}})
+	assert.ErrorContains(t, err, "unknown backend minio")
+
+	_, err = NewRoutingBackend(RoutingBackendConfig{Backends: backends, DefaultBackend: "minio"})
+	assert.ErrorContains(t, err, "unknown default backend minio")
+
+	_, err = NewRoutingBackend(RoutingBackendConfig{Backends: backends, Routes: map[string]string{"media-[": "aws"}})
+	assert.ErrorContains(t, err, "invalid bucket pattern")
+}
+
+func TestRoutingBackendName(t *testing.T) {
+	backends := map[string]Backend{
+		"aws":   newTestFSBackendWithBuckets(t),
+		"minio": newTestFSBackendWithBuckets(t),
+		"gcs":   newTestFSBackendWithBuckets(t),
+	}
+
+	b, err := NewRoutingBackend(RoutingBackendConfig{
+		Backends: backends,
+		Routes: map[string]string{
+			"media":           "minio",
+			"media-*":         "minio",
+			"media-archive-*": "gcs",
+			"media-archive-1": "aws",
+		},
+	})
+	require.NoError(t, err)
+
+	for bucket, expected := range map[string]string{
+		"media":           "minio",
+		"media-eu":        "minio",
+		"media-archive-2": "gcs",
+		"media-archive-1": "aws",
+	} {
+		backendName, err := b.BackendName(bucket)
+		require.NoError(t, err)
+		assert.Equal(t, expected, backendName, bucket)
+	}
+
+	_, err = b.BackendName("other")
+	assert.Equal(t, "NoSuchBucket", errorCode(err))
+
+	_, err = b.StatObject(BucketObject{BucketName: "other", Key: "/file"})
+	assert.Equal(t, "NoSuchBucket", errorCode(err))
+
+	b, err = NewRoutingBackend(RoutingBackendConfig{Backends: backends, Routes: map[string]string{"media": "minio"}, DefaultBackend: "aws"})
+	require.NoError(t, err)
+
+	backendName, err := b.BackendName("other")
+	require.NoError(t, err)
+	assert.Equal(t, "aws", backendName)
+}
+
+func TestRoutingBackendDispatch(t *testing.T) {
+	aws := newTestFSBackendWithBuckets(t, "documents", "archive-2023")
+	minio := newTestFSBackendWithBuckets(t, "media")
+
+	b, err := NewRoutingBackend(RoutingBackendConfig{
+		Backends:       map[string]Backend{"aws": aws, "minio": minio},
+		Routes:         map[string]string{"media": "minio"},
+		DefaultBackend: "aws",
+	})
+	require.NoError(t, err)
+
+	media := BucketObject{BucketName: "media", Key: "/video.mp4"}
+	document := BucketObject{BucketName: "documents", Key: "/doc.pdf"}
+
+	_, err = b.PutObject(media, strings.NewReader("video"), PutOptions{ContentType: "video/mp4", Metadata: map[string]string{"tenant": "tenant1"}})
+	require.NoError(t, err)
+	_, err = b.PutObject(document, strings.NewReader("document"), PutOptions{})
+	require.NoError(t, err)
+
+	// each object is stored by the backend of its bucket
+	_, err = minio.StatObject(media)
+	require.NoError(t, err)
+	_, err = aws.StatObject(document)
+	require.NoError(t, err)
+
+	listing, err := b.ListObjects("media", ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, listing.Objects, 1)
+	assert.Equal(t, "video.mp4", listing.Objects[0].Key)
+
+	// the copy between two backends is streamed with the content type and the metadata
+	copied := BucketObject{BucketName: "archive-2023", Key: "/video.mp4"}
+	require.NoError(t, b.CopyObject(media, copied))
+
+	info, err := aws.StatObject(copied)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), info.Size)
+	assert.Equal(t, "video/mp4", info.ContentType)
+	assert.Equal(t, map[string]string{"tenant": "tenant1"}, info.Metadata)
+
+	// the copy in the same backend is done by the backend
+	require.NoError(t, b.CopyObject(document, BucketObject{BucketName: "archive-2023", Key: "/doc.pdf"}))
+
+	assert.Equal(t, "NoSuchKey", errorCode(b.CopyObject(BucketObject{BucketName: "media", Key: "/missing"}, copied)))
+
+	require.NoError(t, b.BatchDeleteObjects([]BucketObject{media, document, copied}))
+
+	_, err = minio.StatObject(media)
+	assert.Equal(t, "NoSuchKey", errorCode(err))
+	_, err = aws.StatObject(document)
+	assert.Equal(t, "NoSuchKey", errorCode(err))
+	_, err = aws.StatObject(BucketObject{BucketName: "archive-2023", Key: "/doc.pdf"})
+	require.NoError(t, err)
+}
+
+func TestStreamCopyPartSize(t *testing.T) {
+	// default part size of the destination backend
+	assert.Equal(t, int64(0), streamCopyPartSize(0))
+	assert.Equal(t, int64(0), streamCopyPartSize(48*1024*1024*1024))
+	assert.Equal(t, int64(0), streamCopyPartSize(maxCopyParts*s3manager.MinUploadPartSize))
+
+	// at most 10000 parts
+	assert.Equal(t, int64(s3manager.MinUploadPartSize+1), streamCopyPartSize(maxCopyParts*s3manager.MinUploadPartSize+1))
+	assert.Equal(t, int64(500*1024*1024), streamCopyPartSize(maxCopyParts*500*1024*1024))
+}
@@ -3,10 +3,21 @@
 package backend
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
@@ -21,6 +32,9 @@ type S3BackendConfig struct {
 	SecretKey        string
 	DisableSSL       bool
 	S3ForcePathStyle bool
+
+	// Encryption of the buckets, the requests on these buckets can not use another encryption
+	BucketEncryption map[string]Encryption
 }
 
 // s3backend which will implement Backend interface
@@ -44,12 +58,18 @@ func newS3Backend(config []S3BackendConfig) (*S3Backend, error) {
 	} else if len(config) == 1 {
 		s3BackendConfig = config[0]
 		s3Config = &aws.Config{
-			Credentials:      credentials.NewStaticCredentials(config[0].AccessKey, config[0].SecretKey, ""),
-			Endpoint:         aws.String(config[0].Host),
 			DisableSSL:       aws.Bool(config[0].DisableSSL),
 			S3ForcePathStyle: aws.Bool(config[0].S3ForcePathStyle),
 		}
 
+		// without host and credentials (ex: only the bucket encryption is configured), the defaults of the SDK are used
+		if config[0].Host != "" {
+			s3Config.Endpoint = aws.String(config[0].Host)
+		}
+		if config[0].AccessKey != "" || config[0].SecretKey != "" {
+			s3Config.Credentials = credentials.NewStaticCredentials(config[0].AccessKey, config[0].SecretKey, "")
+		}
+
 		if config[0].Region != "" {
 			s3Config.Region = aws.String(config[0].Region)
 		}
@@ -76,22 +96,117 @@ func newS3Backend(config []S3BackendConfig) (*S3Backend, error) {
 	}, nil
 }
 
+// optional version id of an object, nil for the latest version
+func versionID(object BucketObject) *string {
+	if object.VersionID == "" {
+		return nil
+	}
+	return aws.String(object.VersionID)
+}
+
+// optional storage class of an object, nil for the default storage class
+func storageClass(object BucketObject) *string {
+	if object.StorageClass == "" {
+		return nil
+	}
+	return aws.String(object.StorageClass)
+}
+
+// copy source of an object : /bucket/key with the version id if any
+func copySource(object BucketObject) string {
+	if object.VersionID == "" {
+		return object.FullPath()
+	}
+	return object.FullPath() + "?versionId=" + url.QueryEscape(object.VersionID)
+}
+
 // Create a presigned url for an upload of an object
-func (b *S3Backend) CreatePresignedURLForUpload(object BucketObject, expire time.Duration) (string, error) {
-	req, _ := b.client.PutObjectRequest(&s3.PutObjectInput{
-		Bucket: aws.String(object.BucketName),
-		Key:    aws.String(object.Key),
-	})
+// The constraints are signed as headers (not hoisted in the query) so S3 rejects the uploads which do not send the same headers
+func (b *S3Backend) CreatePresignedURLForUpload(object BucketObject, expire time.Duration, constraints UploadConstraints) (*PresignedURL, error) {
+	sse, err := b.serverSideEncryption(object)
+	if err != nil {
+		return nil, err
+	}
 
-	return req.Presign(expire)
+	input := &s3.PutObjectInput{
+		Bucket:               aws.String(object.BucketName),
+		Key:                  aws.String(object.Key),
+		ServerSideEncryption: sse.mode,
+		SSEKMSKeyId:          sse.kmsKeyID,
+		SSECustomerAlgorithm: sse.customerAlgorithm,
+		SSECustomerKey:       sse.customerKey,
+		StorageClass:         storageClass(object),
+	}
+
+	if constraints.ContentType != "" {
+		input.ContentType = aws.String(constraints.ContentType)
+	}
+	if constraints.ContentLength > 0 {
+		input.ContentLength = aws.Int64(constraints.ContentLength)
+	}
+	if constraints.ContentMD5 != "" {
+		input.ContentMD5 = aws.String(constraints.ContentMD5)
+	}
+	if len(constraints.Metadata) > 0 {
+		input.Metadata = aws.StringMap(constraints.Metadata)
+	}
+
+	req, _ := b.client.PutObjectRequest(input)
+	req.NotHoist = true
+
+	// not supported by the PutObjectInput of this SDK version
+	if constraints.ChecksumSHA256 != "" {
+		req.HTTPRequest.Header.Set("X-Amz-Checksum-Sha256", constraints.ChecksumSHA256)
+	}
+
+	url, signedHeaders, err := req.PresignRequest(expire)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PresignedURL{URL: url, Headers: presignedHeaders(signedHeaders)}, nil
+}
+
+// headers of a presigned request the client has to send, the first value of each header
+func presignedHeaders(signedHeaders http.Header) map[string]string {
+	headers := make(map[string]string, len(signedHeaders))
+	for name, values := range signedHeaders {
+		if len(values) > 0 {
+			headers[http.CanonicalHeaderKey(name)] = values[0]
+		}
+	}
+	return headers
 }
 
 // Create a presigned url for a download of an object
-func (b *S3Backend) CreatePresignedURLForDownload(object BucketObject, expire time.Duration) (string, error) {
-	req, _ := b.client.GetObjectRequest(&s3.GetObjectInput{
-		Bucket: aws.String(object.BucketName),
-		Key:    aws.String(object.Key),
-	})
+func (b *S3Backend) CreatePresignedURLForDownload(object BucketObject, expire time.Duration, headers ResponseHeaders) (string, error) {
+	sse, err := b.serverSideEncryption(object)
+	if err != nil {
+		return "", err
+	}
+
+	input := &s3.GetObjectInput{
+		Bucket:               aws.String(object.BucketName),
+		Key:                  aws.String(object.Key),
+		VersionId:            versionID(object),
+		SSECustomerAlgorithm: sse.customerAlgorithm,
+		SSECustomerKey:       sse.customerKey,
+	}
+
+	if headers.ContentDisposition != "" {
+		input.ResponseContentDisposition = aws.String(headers.ContentDisposition)
+	}
+	if headers.ContentType != "" {
+		input.ResponseContentType = aws.String(headers.ContentType)
+	}
+	if headers.CacheControl != "" {
+		input.ResponseCacheControl = aws.String(headers.CacheControl)
+	}
+	if headers.ContentLanguage != "" {
+		input.ResponseContentLanguage = aws.String(headers.ContentLanguage)
+	}
+
+	req, _ := b.client.GetObjectRequest(input)
 
 	return req.Presign(expire)
 }
@@ -100,10 +215,14 @@ func (b *S3Backend) CreatePresignedURLForDownload(object BucketObject, expire ti
 func (b *S3Backend) DeleteObject(object BucketObject) error {
 
 	_, err := b.client.DeleteObject(&s3.DeleteObjectInput{
-		Bucket: aws.String(object.BucketName),
-		Key:    aws.String(object.Key),
+		Bucket:    aws.String(object.BucketName),
+		Key:       aws.String(object.Key),
+		VersionId: versionID(object),
 	})
 
+	if isObjectLockDenied(err) {
+		return NewLockedObjectsError([]string{object.Key}, err)
+	}
 	if err != nil {
 		return err
 	}
@@ -125,8 +244,9 @@ func (b *S3Backend) BatchDeleteObjects(objects []BucketObject) error {
 	for index, element := range objects {
 		objectsToDelete[index] = s3manager.BatchDeleteObject{
 			Object: &s3.DeleteObjectInput{
-				Key:    aws.String(element.Key),
-				Bucket: aws.String(element.BucketName),
+				Key:       aws.String(element.Key),
+				Bucket:    aws.String(element.BucketName),
+				VersionId: versionID(element),
 			},
 		}
 	}
@@ -135,17 +255,628 @@ func (b *S3Backend) BatchDeleteObjects(objects []BucketObject) error {
 		Objects: objectsToDelete,
 	})
 
-	return err
+	return batchDeleteError(err)
 }
 
-// Copy item from source to destination bucket
+const (
+	// max. size of an object copied with a single CopyObject call
+	maxSingleCopySize int64 = 5 * 1024 * 1024 * 1024
+	// size of the parts of a multipart copy, increased for huge objects to stay under the max. number of parts
+	copyPartSize int64 = 512 * 1024 * 1024
+	// max. number of parts of a multipart upload
+	maxCopyParts int64 = 10000
+	// number of parts copied in parallel
+	copyConcurrency = 10
+)
+
+// Copy item from source to destination bucket, objects larger than 5GB are copied with a multipart copy
 func (b *S3Backend) CopyObject(sourceObject BucketObject, destinationObject BucketObject) error {
 
-	_, err := b.client.CopyObject(&s3.CopyObjectInput{
-		CopySource: aws.String(sourceObject.FullPath()),
-		Bucket:     aws.String(destinationObject.BucketName),
-		Key:        aws.String(destinationObject.Key),
+	sourceSSE, err := b.serverSideEncryption(sourceObject)
+	if err != nil {
+		return err
+	}
+	destinationSSE, err := b.serverSideEncryption(destinationObject)
+	if err != nil {
+		return err
+	}
+
+	// on error (ex: not found), let CopyObject report the error
+	info, err := b.StatObject(sourceObject)
+	if err == nil && info.Size > maxSingleCopySize {
+		return b.copyObjectMultipart(sourceObject, destinationObject, info, sourceSSE, destinationSSE)
+	}
+
+	_, err = b.client.CopyObject(&s3.CopyObjectInput{
+		CopySource:                     aws.String(copySource(sourceObject)),
+		Bucket:                         aws.String(destinationObject.BucketName),
+		Key:                            aws.String(destinationObject.Key),
+		ServerSideEncryption:           destinationSSE.mode,
+		SSEKMSKeyId:                    destinationSSE.kmsKeyID,
+		SSECustomerAlgorithm:           destinationSSE.customerAlgorithm,
+		SSECustomerKey:                 destinationSSE.customerKey,
+		CopySourceSSECustomerAlgorithm: sourceSSE.customerAlgorithm,
+		CopySourceSSECustomerKey:       sourceSSE.customerKey,
+		StorageClass:                   storageClass(destinationObject),
 	})
 
 	return err
 }
+
+// Copy an object with a multipart upload whose parts are copied in parallel with UploadPartCopy
+func (b *S3Backend) copyObjectMultipart(sourceObject BucketObject, destinationObject BucketObject, info *ObjectInfo, sourceSSE sseParams, destinationSSE sseParams) error {
+
+	partSize := copyPartSize
+	if minPartSize := (info.Size + maxCopyParts - 1) / maxCopyParts; minPartSize > partSize {
+		partSize = minPartSize
+	}
+
+	input := &s3.CreateMultipartUploadInput{
+		Bucket:               aws.String(destinationObject.BucketName),
+		Key:                  aws.String(destinationObject.Key),
+		ServerSideEncryption: destinationSSE.mode,
+		SSEKMSKeyId:          destinationSSE.kmsKeyID,
+		SSECustomerAlgorithm: destinationSSE.customerAlgorithm,
+		SSECustomerKey:       destinationSSE.customerKey,
+		StorageClass:         storageClass(destinationObject),
+	}
+
+	// a multipart upload does not copy the content type and user metadata of the source
+	if info.ContentType != "" {
+		input.ContentType = aws.String(info.ContentType)
+	}
+	if len(info.Metadata) > 0 {
+		input.Metadata = aws.StringMap(info.Metadata)
+	}
+
+	upload, err := b.client.CreateMultipartUpload(input)
+	if err != nil {
+		return err
+	}
+
+	partCount := (info.Size + partSize - 1) / partSize
+	parts := make([]*s3.CompletedPart, partCount)
+	errs := make(chan error, partCount)
+	semaphore := make(chan struct{}, copyConcurrency)
+
+	var (
+		wg     sync.WaitGroup
+		failed atomic.Bool
+	)
+
+	for index := int64(0); index < partCount; index++ {
+		start := index * partSize
+		end := start + partSize - 1
+		if end >= info.Size {
+			end = info.Size - 1
+		}
+
+		// the next parts are not copied once a part failed
+		semaphore <- struct{}{}
+		if failed.Load() {
+			<-semaphore
+			break
+		}
+
+		wg.Add(1)
+
+		go func(index int64, start int64, end int64) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			output, err := b.client.UploadPartCopy(&s3.UploadPartCopyInput{
+				Bucket:          aws.String(destinationObject.BucketName),
+				Key:             aws.String(destinationObject.Key),
+				UploadId:        upload.UploadId,
+				PartNumber:      aws.Int64(index + 1),
+				CopySource:      aws.String(copySource(sourceObject)),
+				CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", start, end)),
+
+				SSECustomerAlgorithm:           destinationSSE.customerAlgorithm,
+				SSECustomerKey:                 destinationSSE.customerKey,
+				CopySourceSSECustomerAlgorithm: sourceSSE.customerAlgorithm,
+				CopySourceSSECustomerKey:       sourceSSE.customerKey,
+			})
+			if err != nil {
+				failed.Store(true)
+				errs <- err
+				return
+			}
+
+			parts[index] = &s3.CompletedPart{
+				ETag:       output.CopyPartResult.ETag,
+				PartNumber: aws.Int64(index + 1),
+			}
+		}(index, start, end)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	// the error of the part is returned unchanged so that its S3 error code is mapped by the router
+	if err := <-errs; err != nil {
+		if _, abortErr := b.client.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(destinationObject.BucketName),
+			Key:      aws.String(destinationObject.Key),
+			UploadId: upload.UploadId,
+		}); abortErr != nil {
+			log.Errorf("Failed to abort the multipart upload %s of the copy of %s to %s : %v", aws.StringValue(upload.UploadId), sourceObject, destinationObject, abortErr)
+		}
+		return err
+	}
+
+	_, err = b.client.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+		Bucket:   aws.String(destinationObject.BucketName),
+		Key:      aws.String(destinationObject.Key),
+		UploadId: upload.UploadId,
+		MultipartUpload: &s3.CompletedMultipartUpload{
+			Parts: parts,
+		},
+	})
+
+	return err
+}
+
+// Retrieve the metadata of an object without downloading it
+func (b *S3Backend) StatObject(object BucketObject) (*ObjectInfo, error) {
+
+	sse, err := b.serverSideEncryption(object)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := b.client.HeadObject(&s3.HeadObjectInput{
+		Bucket:               aws.String(object.BucketName),
+		Key:                  aws.String(object.Key),
+		VersionId:            versionID(object),
+		SSECustomerAlgorithm: sse.customerAlgorithm,
+		SSECustomerKey:       sse.customerKey,
+	})
+
+	if err != nil {
+		// HeadObject has no response body, so S3 only returns a generic "NotFound" code
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "NotFound" {
+			return nil, awserr.New(s3.ErrCodeNoSuchKey, "No such key", err)
+		}
+		return nil, err
+	}
+
+	return &ObjectInfo{
+		Key:          object.Key,
+		Size:         aws.Int64Value(output.ContentLength),
+		ETag:         aws.StringValue(output.ETag),
+		ContentType:  aws.StringValue(output.ContentType),
+		LastModified: aws.TimeValue(output.LastModified),
+		Metadata:     aws.StringValueMap(output.Metadata),
+		VersionID:    aws.StringValue(output.VersionId),
+		StorageClass: aws.StringValue(output.StorageClass),
+		Restore:      parseRestoreStatus(aws.StringValue(output.Restore)),
+	}, nil
+}
+
+// parse the x-amz-restore header of an object : ongoing-request="false", expiry-date="Fri, 21 Dec 2012 00:00:00 GMT"
+// nil when the object has never been restored
+func parseRestoreStatus(header string) *RestoreStatus {
+	if header == "" {
+		return nil
+	}
+
+	status := &RestoreStatus{InProgress: strings.Contains(header, `ongoing-request="true"`)}
+
+	if _, expiry, found := strings.Cut(header, `expiry-date="`); found {
+		if expiry, _, found = strings.Cut(expiry, `"`); found {
+			if date, err := http.ParseTime(expiry); err == nil {
+				status.ExpiryDate = &date
+			}
+		}
+	}
+
+	return status
+}
+
+// List one page of objects of a bucket
+func (b *S3Backend) ListObjects(bucketName string, options ListOptions) (*ObjectListing, error) {
+
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucketName),
+	}
+
+	if options.Prefix != "" {
+		input.Prefix = aws.String(options.Prefix)
+	}
+	if options.Delimiter != "" {
+		input.Delimiter = aws.String(options.Delimiter)
+	}
+	if options.MaxKeys > 0 {
+		input.MaxKeys = aws.Int64(options.MaxKeys)
+	}
+	if options.ContinuationToken != "" {
+		input.ContinuationToken = aws.String(options.ContinuationToken)
+	}
+
+	output, err := b.client.ListObjectsV2(input)
+	if err != nil {
+		return nil, err
+	}
+
+	listing := &ObjectListing{
+		Objects:               make([]ObjectInfo, len(output.Contents)),
+		CommonPrefixes:        make([]string, len(output.CommonPrefixes)),
+		IsTruncated:           aws.BoolValue(output.IsTruncated),
+		NextContinuationToken: aws.StringValue(output.NextContinuationToken),
+	}
+
+	for index, element := range output.Contents {
+		listing.Objects[index] = ObjectInfo{
+			Key:          aws.StringValue(element.Key),
+			Size:         aws.Int64Value(element.Size),
+			ETag:         aws.StringValue(element.ETag),
+			LastModified: aws.TimeValue(element.LastModified),
+			StorageClass: aws.StringValue(element.StorageClass),
+		}
+	}
+
+	for index, element := range output.CommonPrefixes {
+		listing.CommonPrefixes[index] = aws.StringValue(element.Prefix)
+	}
+
+	return listing, nil
+}
+
+// Initiate a multipart upload of an object
+func (b *S3Backend) CreateMultipartUpload(object BucketObject) (string, error) {
+
+	sse, err := b.serverSideEncryption(object)
+	if err != nil {
+		return "", err
+	}
+
+	output, err := b.client.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
+		Bucket:               aws.String(object.BucketName),
+		Key:                  aws.String(object.Key),
+		ServerSideEncryption: sse.mode,
+		SSEKMSKeyId:          sse.kmsKeyID,
+		SSECustomerAlgorithm: sse.customerAlgorithm,
+		SSECustomerKey:       sse.customerKey,
+		StorageClass:         storageClass(object),
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return aws.StringValue(output.UploadId), nil
+}
+
+// Create a presigned url for an upload of one part of a multipart upload
+// With SSE-C, the client has to send the SSE-C headers used to create the multipart upload
+func (b *S3Backend) CreatePresignedURLForUploadPart(object BucketObject, uploadID string, partNumber int64, expire time.Duration) (*PresignedURL, error) {
+	sse, err := b.serverSideEncryption(object)
+	if err != nil {
+		return nil, err
+	}
+
+	req, _ := b.client.UploadPartRequest(&s3.UploadPartInput{
+		Bucket:               aws.String(object.BucketName),
+		Key:                  aws.String(object.Key),
+		UploadId:             aws.String(uploadID),
+		PartNumber:           aws.Int64(partNumber),
+		SSECustomerAlgorithm: sse.customerAlgorithm,
+		SSECustomerKey:       sse.customerKey,
+	})
+	req.NotHoist = true
+
+	url, signedHeaders, err := req.PresignRequest(expire)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PresignedURL{URL: url, Headers: presignedHeaders(signedHeaders)}, nil
+}
+
+// Complete a multipart upload, parts must be sorted by part number
+func (b *S3Backend) CompleteMultipartUpload(object BucketObject, uploadID string, parts []CompletedPart) error {
+
+	completedParts := make([]*s3.CompletedPart, len(parts))
+
+	for index, element := range parts {
+		completedParts[index] = &s3.CompletedPart{
+			PartNumber: aws.Int64(element.PartNumber),
+			ETag:       aws.String(element.ETag),
+		}
+	}
+
+	_, err := b.client.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+		Bucket:   aws.String(object.BucketName),
+		Key:      aws.String(object.Key),
+		UploadId: aws.String(uploadID),
+		MultipartUpload: &s3.CompletedMultipartUpload{
+			Parts: completedParts,
+		},
+	})
+
+	return err
+}
+
+// Abort a multipart upload
+func (b *S3Backend) AbortMultipartUpload(object BucketObject, uploadID string) error {
+
+	_, err := b.client.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(object.BucketName),
+		Key:      aws.String(object.Key),
+		UploadId: aws.String(uploadID),
+	})
+
+	return err
+}
+
+// Get the content of an object as a stream
+func (b *S3Backend) GetObject(object BucketObject, options GetOptions) (*ObjectContent, error) {
+
+	sse, err := b.serverSideEncryption(object)
+	if err != nil {
+		return nil, err
+	}
+
+	input := &s3.GetObjectInput{
+		Bucket:               aws.String(object.BucketName),
+		Key:                  aws.String(object.Key),
+		VersionId:            versionID(object),
+		SSECustomerAlgorithm: sse.customerAlgorithm,
+		SSECustomerKey:       sse.customerKey,
+	}
+
+	if options.Range != "" {
+		input.Range = aws.String(options.Range)
+	}
+	if options.IfNoneMatch != "" {
+		input.IfNoneMatch = aws.String(options.IfNoneMatch)
+	}
+	if !options.IfModifiedSince.IsZero() {
+		input.IfModifiedSince = aws.Time(options.IfModifiedSince)
+	}
+
+	output, err := b.client.GetObject(input)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ObjectContent{
+		ObjectInfo: ObjectInfo{
+			Key:          object.Key,
+			Size:         aws.Int64Value(output.ContentLength),
+			ETag:         aws.StringValue(output.ETag),
+			ContentType:  aws.StringValue(output.ContentType),
+			LastModified: aws.TimeValue(output.LastModified),
+			Metadata:     aws.StringValueMap(output.Metadata),
+			VersionID:    aws.StringValue(output.VersionId),
+		},
+		Body:         output.Body,
+		ContentRange: aws.StringValue(output.ContentRange),
+	}, nil
+}
+
+// Upload the content of an object, bodies larger than the part size are sent with a multipart upload
+// Note: the uploader buffers up to 5 parts in memory for a non seekable body
+func (b *S3Backend) PutObject(object BucketObject, body io.Reader, options PutOptions) (string, error) {
+
+	sse, err := b.serverSideEncryption(object)
+	if err != nil {
+		return "", err
+	}
+
+	uploader := s3manager.NewUploaderWithClient(b.client, func(u *s3manager.Uploader) {
+		// S3 rejects the parts smaller than 5MB except the last one
+		if options.PartSize > 0 {
+			u.PartSize = max(options.PartSize, s3manager.MinUploadPartSize)
+		}
+	})
+
+	input := &s3manager.UploadInput{
+		Bucket:               aws.String(object.BucketName),
+		Key:                  aws.String(object.Key),
+		Body:                 body,
+		ServerSideEncryption: sse.mode,
+		SSEKMSKeyId:          sse.kmsKeyID,
+		SSECustomerAlgorithm: sse.customerAlgorithm,
+		SSECustomerKey:       sse.customerKey,
+		StorageClass:         storageClass(object),
+	}
+
+	if options.ContentType != "" {
+		input.ContentType = aws.String(options.ContentType)
+	}
+	if len(options.Metadata) > 0 {
+		input.Metadata = aws.StringMap(options.Metadata)
+	}
+
+	output, err := uploader.Upload(input)
+	if err != nil {
+		return "", err
+	}
+
+	return aws.StringValue(output.ETag), nil
+}
+
+// Get the tags of an object
+func (b *S3Backend) GetObjectTagging(object BucketObject) (map[string]string, error) {
+
+	output, err := b.client.GetObjectTagging(&s3.GetObjectTaggingInput{
+		Bucket:    aws.String(object.BucketName),
+		Key:       aws.String(object.Key),
+		VersionId: versionID(object),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make(map[string]string, len(output.TagSet))
+
+	for _, tag := range output.TagSet {
+		tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+
+	return tags, nil
+}
+
+// Replace the tags of an object
+func (b *S3Backend) PutObjectTagging(object BucketObject, tags map[string]string) error {
+
+	tagSet := make([]*s3.Tag, 0, len(tags))
+
+	for key, value := range tags {
+		tagSet = append(tagSet, &s3.Tag{
+			Key:   aws.String(key),
+			Value: aws.String(value),
+		})
+	}
+
+	_, err := b.client.PutObjectTagging(&s3.PutObjectTaggingInput{
+		Bucket:    aws.String(object.BucketName),
+		Key:       aws.String(object.Key),
+		VersionId: versionID(object),
+		Tagging: &s3.Tagging{
+			TagSet: tagSet,
+		},
+	})
+
+	return err
+}
+
+// Remove all the tags of an object
+func (b *S3Backend) DeleteObjectTagging(object BucketObject) error {
+
+	_, err := b.client.DeleteObjectTagging(&s3.DeleteObjectTaggingInput{
+		Bucket:    aws.String(object.BucketName),
+		Key:       aws.String(object.Key),
+		VersionId: versionID(object),
+	})
+
+	return err
+}
+
+// markers of a version listing, serialized in the continuation token
+type versionMarkers struct {
+	KeyMarker       string `json:"k"`
+	VersionIDMarker string `json:"v"`
+}
+
+// List one page of the versions of the objects of a bucket
+func (b *S3Backend) ListObjectVersions(bucketName string, options ListOptions) (*VersionListing, error) {
+
+	input := &s3.ListObjectVersionsInput{
+		Bucket: aws.String(bucketName),
+	}
+
+	if options.Prefix != "" {
+		input.Prefix = aws.String(options.Prefix)
+	}
+	if options.Delimiter != "" {
+		input.Delimiter = aws.String(options.Delimiter)
+	}
+	if options.MaxKeys > 0 {
+		input.MaxKeys = aws.Int64(options.MaxKeys)
+	}
+	if options.ContinuationToken != "" {
+		var markers versionMarkers
+
+		token, err := base64.RawURLEncoding.DecodeString(options.ContinuationToken)
+		if err == nil {
+			err = json.Unmarshal(token, &markers)
+		}
+		if err != nil {
+			return nil, awserr.New("InvalidArgument", "The continuation token provided is incorrect", err)
+		}
+
+		input.KeyMarker = aws.String(markers.KeyMarker)
+		if markers.VersionIDMarker != "" {
+			input.VersionIdMarker = aws.String(markers.VersionIDMarker)
+		}
+	}
+
+	output, err := b.client.ListObjectVersions(input)
+	if err != nil {
+		return nil, err
+	}
+
+	listing := &VersionListing{
+		Versions:       make([]ObjectVersion, 0, len(output.Versions)+len(output.DeleteMarkers)),
+		CommonPrefixes: make([]string, len(output.CommonPrefixes)),
+		IsTruncated:    aws.BoolValue(output.IsTruncated),
+	}
+
+	for _, element := range output.Versions {
+		listing.Versions = append(listing.Versions, ObjectVersion{
+			ObjectInfo: ObjectInfo{
+				Key:          aws.StringValue(element.Key),
+				Size:         aws.Int64Value(element.Size),
+				ETag:         aws.StringValue(element.ETag),
+				LastModified: aws.TimeValue(element.LastModified),
+				VersionID:    aws.StringValue(element.VersionId),
+			},
+			IsLatest: aws.BoolValue(element.IsLatest),
+		})
+	}
+
+	for _, element := range output.DeleteMarkers {
+		listing.Versions = append(listing.Versions, ObjectVersion{
+			ObjectInfo: ObjectInfo{
+				Key:          aws.StringValue(element.Key),
+				LastModified: aws.TimeValue(element.LastModified),
+				VersionID:    aws.StringValue(element.VersionId),
+			},
+			IsLatest:       aws.BoolValue(element.IsLatest),
+			IsDeleteMarker: true,
+		})
+	}
+
+	// S3 returns the versions and the delete markers in two lists, they are merged in the order of S3 : by key then newest first
+	sort.SliceStable(listing.Versions, func(i, j int) bool {
+		if listing.Versions[i].Key != listing.Versions[j].Key {
+			return listing.Versions[i].Key < listing.Versions[j].Key
+		}
+		return listing.Versions[i].LastModified.After(listing.Versions[j].LastModified)
+	})
+
+	for index, element := range output.CommonPrefixes {
+		listing.CommonPrefixes[index] = aws.StringValue(element.Prefix)
+	}
+
+	if listing.IsTruncated {
+		token, err := json.Marshal(versionMarkers{
+			KeyMarker:       aws.StringValue(output.NextKeyMarker),
+			VersionIDMarker: aws.StringValue(output.NextVersionIdMarker),
+		})
+		if err != nil {
+			return nil, err
+		}
+		listing.NextContinuationToken = base64.RawURLEncoding.EncodeToString(token)
+	}
+
+	return listing, nil
+}
+
+// Restore temporarily an archived object, S3 answers 202 when the restore is started and 200 when the object is already restored
+func (b *S3Backend) RestoreObject(object BucketObject, options RestoreOptions) (bool, error) {
+
+	input := &s3.RestoreObjectInput{
+		Bucket:    aws.String(object.BucketName),
+		Key:       aws.String(object.Key),
+		VersionId: versionID(object),
+		RestoreRequest: &s3.RestoreRequest{
+			Days: aws.Int64(options.Days),
+		},
+	}
+
+	if options.Tier != "" {
+		input.RestoreRequest.GlacierJobParameters = &s3.GlacierJobParameters{Tier: aws.String(options.Tier)}
+	}
+
+	req, _ := b.client.RestoreObjectRequest(input)
+	if err := req.Send(); err != nil {
+		return false, err
+	}
+
+	return req.HTTPResponse.StatusCode == http.StatusAccepted, nil
+}
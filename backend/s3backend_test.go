@@ -0,0 +1,344 @@
+package backend
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Minimal S3 server for the copy and upload operations, the source object has the given size
+type fakeS3Server struct {
+	size int64
+
+	mutex     sync.Mutex
+	copied    bool
+	headers   http.Header
+	ranges    map[string]string
+	completed []int
+	aborted   bool
+	partSizes map[string]int
+	failPart  string
+	// error of the failed part and of the abort of the multipart upload
+	failCode   string
+	failStatus int
+	failAbort  bool
+}
+
+func (s *fakeS3Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	query := r.URL.Query()
+
+	switch {
+	case r.Method == http.MethodHead:
+		w.Header().Set("Content-Length", strconv.FormatInt(s.size, 10))
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("ETag", `"source"`)
+		w.WriteHeader(http.StatusOK)
+
+	case r.Method == http.MethodGet && query.Has("versions"):
+		fmt.Fprint(w, `<ListVersionsResult>`+
+			`<Version><Key>a</Key><VersionId>a2</VersionId><IsLatest>false</IsLatest><LastModified>2024-01-02T00:00:00.000Z</LastModified><Size>2</Size></Version>`+
+			`<Version><Key>a</Key><VersionId>a1</VersionId><IsLatest>false</IsLatest><LastModified>2024-01-01T00:00:00.000Z</LastModified><Size>1</Size></Version>`+
+			`<Version><Key>b</Key><VersionId>b2</VersionId><IsLatest>true</IsLatest><LastModified>2024-01-04T00:00:00.000Z</LastModified><Size>2</Size></Version>`+
+			`<Version><Key>b</Key><VersionId>b1</VersionId><IsLatest>false</IsLatest><LastModified>2024-01-01T00:00:00.000Z</LastModified><Size>1</Size></Version>`+
+			`<DeleteMarker><Key>a</Key><VersionId>a3</VersionId><IsLatest>true</IsLatest><LastModified>2024-01-03T00:00:00.000Z</LastModified></DeleteMarker>`+
+			`<DeleteMarker><Key>b</Key><VersionId>b3</VersionId><IsLatest>false</IsLatest><LastModified>2024-01-02T00:00:00.000Z</LastModified></DeleteMarker>`+
+			`</ListVersionsResult>`)
+
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		fmt.Fprint(w, `<InitiateMultipartUploadResult><Bucket>dest</Bucket><Key>big</Key><UploadId>upload-1</UploadId></InitiateMultipartUploadResult>`)
+
+	case r.Method == http.MethodPut && query.Has("partNumber"):
+		partNumber := query.Get("partNumber")
+		if partNumber == s.failPart {
+			if s.failCode == "" {
+				s.failCode, s.failStatus = "InternalError", http.StatusInternalServerError
+			}
+			w.WriteHeader(s.failStatus)
+			fmt.Fprintf(w, `<Error><Code>%s</Code><Message>fake error</Message></Error>`, s.failCode)
+			return
+		}
+		if r.Header.Get("X-Amz-Copy-Source") == "" {
+			// part of an upload
+			content, _ := io.ReadAll(r.Body)
+			s.partSizes[partNumber] = len(content)
+			w.Header().Set("ETag", `"etag-`+partNumber+`"`)
+			return
+		}
+		s.ranges[partNumber] = r.Header.Get("X-Amz-Copy-Source-Range")
+		fmt.Fprintf(w, `<CopyPartResult><ETag>"etag-%s"</ETag></CopyPartResult>`, partNumber)
+
+	case r.Method == http.MethodPut:
+		s.copied = true
+		s.headers = r.Header.Clone()
+		fmt.Fprint(w, `<CopyObjectResult><ETag>"copy"</ETag></CopyObjectResult>`)
+
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		var body struct {
+			Parts []struct {
+				PartNumber int
+			} `xml:"Part"`
+		}
+		bytes, _ := io.ReadAll(r.Body)
+		if err := xml.Unmarshal(bytes, &body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for _, part := range body.Parts {
+			s.completed = append(s.completed, part.PartNumber)
+		}
+		fmt.Fprint(w, `<CompleteMultipartUploadResult><ETag>"complete"</ETag></CompleteMultipartUploadResult>`)
+
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		if s.failAbort {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `<Error><Code>InternalError</Code><Message>fake error</Message></Error>`)
+			return
+		}
+		s.aborted = true
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func newTestS3Backend(t *testing.T, server *fakeS3Server, bucketEncryption ...map[string]Encryption) *S3Backend {
+	server.ranges = make(map[string]string)
+	server.partSizes = make(map[string]int)
+
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+
+	config := S3BackendConfig{
+		Host:             httpServer.URL,
+		Region:           "eu-west-1",
+		AccessKey:        "123456",
+		SecretKey:        "ABCDEFGH12345",
+		DisableSSL:       true,
+		S3ForcePathStyle: true,
+	}
+
+	if len(bucketEncryption) > 0 {
+		config.BucketEncryption = bucketEncryption[0]
+	}
+
+	s3Backend, err := newS3Backend([]S3BackendConfig{config})
+	require.NoError(t, err)
+
+	return s3Backend
+}
+
+func TestCopyObjectSingle(t *testing.T) {
+	server := &fakeS3Server{size: 1024}
+	s3Backend := newTestS3Backend(t, server)
+
+	err := s3Backend.CopyObject(BucketObject{BucketName: "source", Key: "/big"}, BucketObject{BucketName: "dest", Key: "/big"})
+	assert.NoError(t, err)
+	assert.True(t, server.copied)
+	assert.Empty(t, server.ranges)
+}
+
+func TestCopyObjectMultipart(t *testing.T) {
+	// 6GB and 1 byte => 12 parts of 512MB and a last part of 1 byte
+	server := &fakeS3Server{size: 6*1024*1024*1024 + 1}
+	s3Backend := newTestS3Backend(t, server)
+
+	err := s3Backend.CopyObject(BucketObject{BucketName: "source", Key: "/big"}, BucketObject{BucketName: "dest", Key: "/big"})
+	assert.NoError(t, err)
+	assert.False(t, server.copied)
+
+	assert.Len(t, server.ranges, 13)
+	assert.Equal(t, "bytes=0-536870911", server.ranges["1"])
+	assert.Equal(t, "bytes=536870912-1073741823", server.ranges["2"])
+	assert.Equal(t, "bytes=6442450944-6442450944", server.ranges["13"])
+
+	assert.Equal(t, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13}, server.completed)
+	assert.False(t, server.aborted)
+}
+
+func TestCopyObjectMultipartAbort(t *testing.T) {
+	server := &fakeS3Server{size: 6 * 1024 * 1024 * 1024, failPart: "3"}
+	s3Backend := newTestS3Backend(t, server)
+
+	err := s3Backend.CopyObject(BucketObject{BucketName: "source", Key: "/big"}, BucketObject{BucketName: "dest", Key: "/big"})
+	assert.Error(t, err)
+	assert.True(t, server.aborted)
+	assert.Empty(t, server.completed)
+}
+
+func TestCopyObjectMultipartFailedAbort(t *testing.T) {
+	// 100 parts, the first one fails
+	server := &fakeS3Server{size: 100 * 512 * 1024 * 1024, failPart: "1", failCode: "NoSuchKey", failStatus: http.StatusNotFound, failAbort: true}
+	s3Backend := newTestS3Backend(t, server)
+
+	// the error of the part is returned when the abort fails
+	err := s3Backend.CopyObject(BucketObject{BucketName: "source", Key: "/big"}, BucketObject{BucketName: "dest", Key: "/big"})
+	assert.Equal(t, "NoSuchKey", errorCode(err))
+	assert.Empty(t, server.completed)
+
+	// the copy of the parts stops after the failure
+	assert.Less(t, len(server.ranges), 99)
+}
+
+func TestPutObjectPartSize(t *testing.T) {
+	body := make([]byte, 2*s3manager.MinUploadPartSize+1)
+
+	// the part size of exactly 5MB is used, a smaller part size is raised to 5MB
+	for _, partSize := range []int64{s3manager.MinUploadPartSize, 1024} {
+		server := &fakeS3Server{}
+		s3Backend := newTestS3Backend(t, server)
+
+		_, err := s3Backend.PutObject(BucketObject{BucketName: "dest", Key: "/big"}, bytes.NewReader(body), PutOptions{PartSize: partSize})
+		require.NoError(t, err)
+
+		assert.Equal(t, map[string]int{"1": int(s3manager.MinUploadPartSize), "2": int(s3manager.MinUploadPartSize), "3": 1}, server.partSizes)
+		assert.Equal(t, []int{1, 2, 3}, server.completed)
+	}
+}
+
+func TestCopyObjectEncryption(t *testing.T) {
+	server := &fakeS3Server{size: 1024}
+	s3Backend := newTestS3Backend(t, server, map[string]Encryption{"dest": {Mode: EncryptionSSEKMS, KMSKeyID: "dest-key"}})
+
+	// default encryption of the bucket
+	err := s3Backend.CopyObject(BucketObject{BucketName: "source", Key: "/file"}, BucketObject{BucketName: "dest", Key: "/file"})
+	assert.NoError(t, err)
+	assert.Equal(t, EncryptionSSEKMS, server.headers.Get("X-Amz-Server-Side-Encryption"))
+	assert.Equal(t, "dest-key", server.headers.Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"))
+
+	// encryption of the request on a bucket without configured encryption
+	err = s3Backend.CopyObject(BucketObject{BucketName: "source", Key: "/file"}, BucketObject{BucketName: "source", Key: "/file2", Encryption: Encryption{Mode: EncryptionSSES3}})
+	assert.NoError(t, err)
+	assert.Equal(t, EncryptionSSES3, server.headers.Get("X-Amz-Server-Side-Encryption"))
+	assert.Empty(t, server.headers.Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"))
+}
+
+func TestCopyObjectEncryptionNotAllowed(t *testing.T) {
+	server := &fakeS3Server{size: 1024}
+	s3Backend := newTestS3Backend(t, server, map[string]Encryption{"dest": {Mode: EncryptionSSEKMS, KMSKeyID: "dest-key"}})
+
+	for _, encryption := range []Encryption{
+		{Mode: EncryptionSSES3},
+		{Mode: EncryptionSSEKMS, KMSKeyID: "other-key"},
+	} {
+		err := s3Backend.CopyObject(BucketObject{BucketName: "source", Key: "/file"}, BucketObject{BucketName: "dest", Key: "/file", Encryption: encryption})
+		if assert.Error(t, err) {
+			assert.Equal(t, ErrCodeInvalidEncryption, err.(awserr.Error).Code())
+		}
+	}
+	assert.False(t, server.copied)
+}
+
+func TestEncryptionParams(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString(make([]byte, 32))
+
+	params, err := Encryption{Mode: EncryptionSSEC, CustomerKey: key}.params()
+	assert.NoError(t, err)
+	assert.Equal(t, "AES256", aws.StringValue(params.customerAlgorithm))
+	assert.Len(t, aws.StringValue(params.customerKey), 32)
+	assert.Nil(t, params.mode)
+
+	_, err = Encryption{Mode: EncryptionSSEC, CustomerKey: base64.StdEncoding.EncodeToString(make([]byte, 16))}.params()
+	assert.Error(t, err)
+
+	_, err = Encryption{Mode: "unknown"}.params()
+	assert.Error(t, err)
+}
+
+func TestParseBucketEncryption(t *testing.T) {
+	result, err := ParseBucketEncryption("bucket1=AES256, bucket2=aws:kms:arn:aws:kms:eu-west-1:111122223333:key/1234,bucket3=aws:kms,bucket4=SSE-C")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]Encryption{
+		"bucket1": {Mode: EncryptionSSES3},
+		"bucket2": {Mode: EncryptionSSEKMS, KMSKeyID: "arn:aws:kms:eu-west-1:111122223333:key/1234"},
+		"bucket3": {Mode: EncryptionSSEKMS},
+		"bucket4": {Mode: EncryptionSSEC},
+	}, result)
+
+	result, err = ParseBucketEncryption("")
+	assert.NoError(t, err)
+	assert.Empty(t, result)
+
+	for _, value := range []string{"bucket1", "=AES256", "bucket1=DES"} {
+		_, err = ParseBucketEncryption(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestParseRestoreStatus(t *testing.T) {
+	assert.Nil(t, parseRestoreStatus(""))
+	assert.Equal(t, &RestoreStatus{InProgress: true}, parseRestoreStatus(`ongoing-request="true"`))
+
+	status := parseRestoreStatus(`ongoing-request="false", expiry-date="Fri, 21 Dec 2012 00:00:00 GMT"`)
+	if assert.NotNil(t, status) {
+		assert.False(t, status.InProgress)
+		assert.Equal(t, time.Date(2012, time.December, 21, 0, 0, 0, 0, time.UTC), *status.ExpiryDate)
+	}
+}
+
+func TestBatchDeleteError(t *testing.T) {
+	lockDenied := awserr.New("AccessDenied", "Access Denied because object protected by object lock.", nil)
+
+	err := batchDeleteError(&s3manager.BatchError{Errors: []s3manager.Error{
+		{OrigErr: lockDenied, Bucket: aws.String("bucket"), Key: aws.String("key1")},
+		{OrigErr: lockDenied, Bucket: aws.String("bucket"), Key: aws.String("key2")},
+	}})
+	if assert.IsType(t, &LockedObjectsError{}, err) {
+		assert.Equal(t, ErrCodeObjectLocked, err.(awserr.Error).Code())
+		assert.Equal(t, []string{"key1", "key2"}, err.(*LockedObjectsError).Keys)
+	}
+
+	// the other failures are kept in the original error of the locked objects error
+	accessDenied := s3manager.Error{OrigErr: awserr.New("AccessDenied", "Access Denied", nil), Bucket: aws.String("bucket"), Key: aws.String("key2")}
+	err = batchDeleteError(s3manager.NewBatchError("BatchedDeleteIncomplete", "some objects have failed to be deleted.", []s3manager.Error{
+		{OrigErr: lockDenied, Bucket: aws.String("bucket"), Key: aws.String("key1")},
+		accessDenied,
+	}))
+	if assert.IsType(t, &LockedObjectsError{}, err) {
+		assert.Equal(t, []string{"key1"}, err.(*LockedObjectsError).Keys)
+		if assert.IsType(t, &s3manager.BatchError{}, err.(*LockedObjectsError).OrigErr()) {
+			batchErr := err.(*LockedObjectsError).OrigErr().(*s3manager.BatchError)
+			assert.Equal(t, "BatchedDeleteIncomplete", batchErr.Code())
+			assert.Equal(t, s3manager.Errors{accessDenied}, batchErr.Errors)
+		}
+	}
+
+	// any other error is returned unchanged
+	batchErr := &s3manager.BatchError{Errors: []s3manager.Error{accessDenied}}
+	assert.Equal(t, batchErr, batchDeleteError(batchErr))
+	assert.Nil(t, batchDeleteError(nil))
+}
+
+func TestListObjectVersionsOrder(t *testing.T) {
+	b := newTestS3Backend(t, &fakeS3Server{})
+
+	listing, err := b.ListObjectVersions("bucket", ListOptions{})
+	require.NoError(t, err)
+
+	// the delete markers are merged with the versions by key then newest first
+	var versionIDs []string
+	for _, version := range listing.Versions {
+		versionIDs = append(versionIDs, version.VersionID)
+	}
+	assert.Equal(t, []string{"a3", "a2", "a1", "b2", "b3", "b1"}, versionIDs)
+	assert.True(t, listing.Versions[0].IsDeleteMarker)
+	assert.True(t, listing.Versions[0].IsLatest)
+	assert.True(t, listing.Versions[4].IsDeleteMarker)
+}
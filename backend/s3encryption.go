@@ -0,0 +1,107 @@
+// Server-side encryption of the S3 backend
+
+package backend
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+// ErrCodeInvalidEncryption is the error code returned when the encryption of a request is invalid or not allowed on the bucket
+const ErrCodeInvalidEncryption = "InvalidEncryption"
+
+// SSE-C key size in bytes (AES-256)
+const customerKeySize = 32
+
+// encryption parameters of the S3 requests, nil when not used
+type sseParams struct {
+	mode              *string
+	kmsKeyID          *string
+	customerAlgorithm *string
+	customerKey       *string
+}
+
+// resolve the encryption of an object : the encryption of the request or the encryption configured for the bucket
+// a request on a bucket with a configured encryption must use the same mode (and the same KMS key if configured)
+func (b *S3Backend) serverSideEncryption(object BucketObject) (sseParams, error) {
+	encryption := object.Encryption
+
+	if configured, ok := b.config.BucketEncryption[object.BucketName]; ok {
+		switch {
+		case encryption.Mode == "":
+			encryption.Mode = configured.Mode
+			encryption.KMSKeyID = configured.KMSKeyID
+		case encryption.Mode != configured.Mode:
+			return sseParams{}, awserr.New(ErrCodeInvalidEncryption, fmt.Sprintf("bucket %s requires %s encryption", object.BucketName, configured.Mode), nil)
+		case configured.KMSKeyID != "" && encryption.KMSKeyID != "" && encryption.KMSKeyID != configured.KMSKeyID:
+			return sseParams{}, awserr.New(ErrCodeInvalidEncryption, fmt.Sprintf("bucket %s requires the KMS key %s", object.BucketName, configured.KMSKeyID), nil)
+		case encryption.KMSKeyID == "":
+			encryption.KMSKeyID = configured.KMSKeyID
+		}
+	}
+
+	return encryption.params()
+}
+
+// S3 parameters of an encryption
+func (e Encryption) params() (sseParams, error) {
+	switch e.Mode {
+	case "":
+		return sseParams{}, nil
+	case EncryptionSSES3:
+		return sseParams{mode: aws.String(EncryptionSSES3)}, nil
+	case EncryptionSSEKMS:
+		params := sseParams{mode: aws.String(EncryptionSSEKMS)}
+		if e.KMSKeyID != "" {
+			params.kmsKeyID = aws.String(e.KMSKeyID)
+		}
+		return params, nil
+	case EncryptionSSEC:
+		// the SDK expects the raw key, it encodes it and computes its MD5
+		key, err := base64.StdEncoding.DecodeString(e.CustomerKey)
+		if err != nil || len(key) != customerKeySize {
+			return sseParams{}, awserr.New(ErrCodeInvalidEncryption, "SSE-C requires a base64 encoded 256 bits customer key", err)
+		}
+		return sseParams{customerAlgorithm: aws.String(EncryptionSSES3), customerKey: aws.String(string(key))}, nil
+	default:
+		return sseParams{}, awserr.New(ErrCodeInvalidEncryption, fmt.Sprintf("unknown encryption mode %q", e.Mode), nil)
+	}
+}
+
+// ParseBucketEncryption parses a list of bucket encryptions separated by commas
+// ex: mybucket=AES256,secure-bucket=aws:kms:arn:aws:kms:eu-west-1:111122223333:key/1234,private-bucket=SSE-C
+// the KMS key id is optional (default KMS key of the account when missing)
+func ParseBucketEncryption(s string) (map[string]Encryption, error) {
+	result := make(map[string]Encryption)
+
+	for _, element := range strings.Split(s, ",") {
+		if element = strings.TrimSpace(element); element == "" {
+			continue
+		}
+
+		bucket, mode, found := strings.Cut(element, "=")
+		if !found || bucket == "" {
+			return nil, fmt.Errorf("invalid bucket encryption %q, format is bucket=mode", element)
+		}
+
+		var encryption Encryption
+
+		switch {
+		case mode == EncryptionSSES3, mode == EncryptionSSEC, mode == EncryptionSSEKMS:
+			encryption.Mode = mode
+		case strings.HasPrefix(mode, EncryptionSSEKMS+":"):
+			encryption.Mode = EncryptionSSEKMS
+			encryption.KMSKeyID = strings.TrimPrefix(mode, EncryptionSSEKMS+":")
+		default:
+			return nil, fmt.Errorf("invalid encryption mode %q for bucket %s, must be %s, %s[:kmsKeyId] or %s", mode, bucket, EncryptionSSES3, EncryptionSSEKMS, EncryptionSSEC)
+		}
+
+		result[bucket] = encryption
+	}
+
+	return result, nil
+}
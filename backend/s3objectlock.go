@@ -0,0 +1,205 @@
+// Object Lock (retention and legal hold) of the S3 backend
+
+package backend
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// ErrCodeObjectLocked is the error code returned when objects can not be deleted because they are protected by Object Lock
+const ErrCodeObjectLocked = "ObjectLocked"
+
+// Object Lock retention modes
+const (
+	ObjectLockModeGovernance = "GOVERNANCE"
+	ObjectLockModeCompliance = "COMPLIANCE"
+)
+
+// error code returned by S3 when an object has no retention or no legal hold
+const errCodeNoSuchObjectLockConfiguration = "NoSuchObjectLockConfiguration"
+
+// LockedObjectsError is returned when objects can not be deleted because they are protected by Object Lock (retention or legal hold)
+// it implements awserr.Error with the code ErrCodeObjectLocked
+type LockedObjectsError struct {
+	Keys    []string
+	origErr error
+}
+
+// NewLockedObjectsError creates an error for the locked keys, origErr is the error returned by the backend
+func NewLockedObjectsError(keys []string, origErr error) *LockedObjectsError {
+	return &LockedObjectsError{Keys: keys, origErr: origErr}
+}
+
+func (e *LockedObjectsError) Code() string {
+	return ErrCodeObjectLocked
+}
+
+func (e *LockedObjectsError) Message() string {
+	return fmt.Sprintf("%d object(s) protected by Object Lock : %s", len(e.Keys), strings.Join(e.Keys, ", "))
+}
+
+func (e *LockedObjectsError) OrigErr() error {
+	return e.origErr
+}
+
+func (e *LockedObjectsError) Error() string {
+	return awserr.SprintError(e.Code(), e.Message(), "", e.origErr)
+}
+
+// S3 denies the deletion of a locked object with a generic AccessDenied code, only the message tells the reason
+// ex: Access Denied because object protected by object lock.
+func isObjectLockDenied(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == "AccessDenied" && strings.Contains(strings.ToLower(aerr.Message()), "object lock")
+}
+
+// convert the errors of a batch delete on locked objects to a LockedObjectsError, other errors are returned unchanged
+func batchDeleteError(err error) error {
+	batchErr, ok := err.(*s3manager.BatchError)
+	if !ok {
+		return err
+	}
+
+	var (
+		keys   []string
+		others []s3manager.Error
+	)
+
+	for _, element := range batchErr.Errors {
+		if isObjectLockDenied(element.OrigErr) {
+			keys = append(keys, aws.StringValue(element.Key))
+		} else {
+			others = append(others, element)
+		}
+	}
+
+	if len(keys) == 0 {
+		return err
+	}
+
+	// the other failures are kept in the original error of the locked objects error
+	if len(others) > 0 {
+		return NewLockedObjectsError(keys, s3manager.NewBatchError(batchErr.Code(), batchErr.Message(), others))
+	}
+
+	return NewLockedObjectsError(keys, err)
+}
+
+// delete objects one by one for the backends without batch delete, the locked objects are reported in a single LockedObjectsError
+// other errors stop the deletion
+func deleteOneByOne(objects []BucketObject, deleteObject func(object BucketObject) error) error {
+	var lockedErr *LockedObjectsError
+
+	for _, object := range objects {
+		err := deleteObject(object)
+		if locked, ok := err.(*LockedObjectsError); ok {
+			if lockedErr == nil {
+				lockedErr = NewLockedObjectsError(nil, locked.OrigErr())
+			}
+			lockedErr.Keys = append(lockedErr.Keys, locked.Keys...)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if lockedErr != nil {
+		return lockedErr
+	}
+	return nil
+}
+
+// Get the Object Lock retention of an object
+func (b *S3Backend) GetObjectRetention(object BucketObject) (*ObjectRetention, error) {
+
+	output, err := b.client.GetObjectRetention(&s3.GetObjectRetentionInput{
+		Bucket:    aws.String(object.BucketName),
+		Key:       aws.String(object.Key),
+		VersionId: versionID(object),
+	})
+
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == errCodeNoSuchObjectLockConfiguration {
+			return &ObjectRetention{}, nil
+		}
+		return nil, err
+	}
+
+	if output.Retention == nil {
+		return &ObjectRetention{}, nil
+	}
+
+	return &ObjectRetention{
+		Mode:            aws.StringValue(output.Retention.Mode),
+		RetainUntilDate: output.Retention.RetainUntilDate,
+	}, nil
+}
+
+// Set the Object Lock retention of an object
+func (b *S3Backend) PutObjectRetention(object BucketObject, retention ObjectRetention, bypassGovernance bool) error {
+
+	input := &s3.PutObjectRetentionInput{
+		Bucket:    aws.String(object.BucketName),
+		Key:       aws.String(object.Key),
+		VersionId: versionID(object),
+		Retention: &s3.ObjectLockRetention{},
+	}
+
+	if retention.Mode != "" {
+		input.Retention.Mode = aws.String(retention.Mode)
+	}
+	if retention.RetainUntilDate != nil {
+		input.Retention.RetainUntilDate = retention.RetainUntilDate
+	}
+	if bypassGovernance {
+		input.BypassGovernanceRetention = aws.Bool(true)
+	}
+
+	_, err := b.client.PutObjectRetention(input)
+
+	return err
+}
+
+// Get the legal hold status of an object
+func (b *S3Backend) GetObjectLegalHold(object BucketObject) (bool, error) {
+
+	output, err := b.client.GetObjectLegalHold(&s3.GetObjectLegalHoldInput{
+		Bucket:    aws.String(object.BucketName),
+		Key:       aws.String(object.Key),
+		VersionId: versionID(object),
+	})
+
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == errCodeNoSuchObjectLockConfiguration {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return output.LegalHold != nil && aws.StringValue(output.LegalHold.Status) == s3.ObjectLockLegalHoldStatusOn, nil
+}
+
+// Set or remove the legal hold of an object
+func (b *S3Backend) PutObjectLegalHold(object BucketObject, legalHold bool) error {
+
+	status := s3.ObjectLockLegalHoldStatusOff
+	if legalHold {
+		status = s3.ObjectLockLegalHoldStatusOn
+	}
+
+	_, err := b.client.PutObjectLegalHold(&s3.PutObjectLegalHoldInput{
+		Bucket:    aws.String(object.BucketName),
+		Key:       aws.String(object.Key),
+		VersionId: versionID(object),
+		LegalHold: &s3.ObjectLockLegalHold{Status: aws.String(status)},
+	})
+
+	return err
+}
@@ -0,0 +1,147 @@
+// S3 POST policy signing (signature version 4) for browser based uploads
+
+package backend
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+const (
+	postPolicyAlgorithm = "AWS4-HMAC-SHA256"
+	postPolicyService   = "s3"
+	postPolicyDate      = "20060102"
+	postPolicyDateTime  = "20060102T150405Z"
+)
+
+// Create a presigned POST policy for an upload of an object from a browser form
+// the encryption of the request or of the bucket is added to the fields and to the policy, SSE-C is not supported
+func (b *S3Backend) CreatePresignedPost(object BucketObject, expire time.Duration, conditions PostConditions) (*PresignedPost, error) {
+
+	sse, err := b.serverSideEncryption(object)
+	if err != nil {
+		return nil, err
+	}
+	if sse.customerKey != nil {
+		return nil, awserr.New(ErrCodeInvalidEncryption, "SSE-C is not supported by the POST policies", nil)
+	}
+
+	creds, err := b.client.Config.Credentials.Get()
+	if err != nil {
+		return nil, err
+	}
+
+	postURL, err := b.postURL(object.BucketName)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	region := b.client.SigningRegion
+	credential := fmt.Sprintf("%s/%s/%s/%s/aws4_request", creds.AccessKeyID, now.Format(postPolicyDate), region, postPolicyService)
+
+	// the sdk removes the leading "/" of the keys, do the same for the form
+	key := strings.TrimPrefix(object.Key, "/")
+
+	fields := map[string]string{
+		"key":              key,
+		"X-Amz-Algorithm":  postPolicyAlgorithm,
+		"X-Amz-Credential": credential,
+		"X-Amz-Date":       now.Format(postPolicyDateTime),
+	}
+
+	policyConditions := []interface{}{
+		map[string]string{"bucket": object.BucketName},
+		map[string]string{"x-amz-algorithm": postPolicyAlgorithm},
+		map[string]string{"x-amz-credential": credential},
+		map[string]string{"x-amz-date": fields["X-Amz-Date"]},
+	}
+
+	if strings.HasSuffix(key, "/") {
+		fields["key"] = key + "${filename}"
+		policyConditions = append(policyConditions, []string{"starts-with", "$key", key})
+	} else {
+		policyConditions = append(policyConditions, map[string]string{"key": key})
+	}
+
+	if creds.SessionToken != "" {
+		fields["X-Amz-Security-Token"] = creds.SessionToken
+		policyConditions = append(policyConditions, map[string]string{"x-amz-security-token": creds.SessionToken})
+	}
+
+	if sse.mode != nil {
+		fields["x-amz-server-side-encryption"] = aws.StringValue(sse.mode)
+		policyConditions = append(policyConditions, map[string]string{"x-amz-server-side-encryption": aws.StringValue(sse.mode)})
+	}
+	if sse.kmsKeyID != nil {
+		fields["x-amz-server-side-encryption-aws-kms-key-id"] = aws.StringValue(sse.kmsKeyID)
+		policyConditions = append(policyConditions, map[string]string{"x-amz-server-side-encryption-aws-kms-key-id": aws.StringValue(sse.kmsKeyID)})
+	}
+
+	if conditions.ContentLengthMax > 0 {
+		policyConditions = append(policyConditions, []interface{}{"content-length-range", conditions.ContentLengthMin, conditions.ContentLengthMax})
+	}
+
+	if conditions.ContentTypePrefix != "" {
+		policyConditions = append(policyConditions, []string{"starts-with", "$Content-Type", conditions.ContentTypePrefix})
+	}
+
+	policy, err := json.Marshal(map[string]interface{}{
+		"expiration": now.Add(expire).Format("2006-01-02T15:04:05.000Z"),
+		"conditions": policyConditions,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fields["Policy"] = base64.StdEncoding.EncodeToString(policy)
+	fields["X-Amz-Signature"] = signPostPolicy(creds.SecretAccessKey, now, region, fields["Policy"])
+
+	return &PresignedPost{
+		URL:    postURL,
+		Fields: fields,
+	}, nil
+}
+
+// url of the bucket the form has to be posted to, depends on path style or virtual hosted style
+func (b *S3Backend) postURL(bucketName string) (string, error) {
+	endpoint, err := url.Parse(b.client.Endpoint)
+	if err != nil {
+		return "", err
+	}
+
+	if aws.BoolValue(b.client.Config.S3ForcePathStyle) {
+		endpoint.Path = "/" + bucketName
+	} else {
+		endpoint.Host = bucketName + "." + endpoint.Host
+		endpoint.Path = "/"
+	}
+
+	return endpoint.String(), nil
+}
+
+// compute the signature version 4 of a base64 encoded policy
+func signPostPolicy(secretKey string, date time.Time, region string, policy string) string {
+	signingKey := hmacSHA256([]byte("AWS4"+secretKey), date.Format(postPolicyDate))
+	signingKey = hmacSHA256(signingKey, region)
+	signingKey = hmacSHA256(signingKey, postPolicyService)
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+
+	return hex.EncodeToString(hmacSHA256(signingKey, policy))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -1,6 +1,8 @@
 package middleware
 
 import (
+	"strings"
+
 	"github.com/gin-gonic/gin"
 	"github.com/mirakl/s3proxy/util"
 )
@@ -11,16 +13,35 @@ func respondWithError(code int, message string, c *gin.Context) {
 }
 
 // Creates authorization middleware for API auhtorization
+// the not secured paths ending with "*" are prefixes (ex: /public/*)
 func NewAuthorization(serverToken string, notsecured ...string) gin.HandlerFunc {
 
-	skip := util.Array2map(notsecured...)
+	var (
+		paths    []string
+		prefixes []string
+	)
+
+	for _, path := range notsecured {
+		if prefix, found := strings.CutSuffix(path, "*"); found {
+			prefixes = append(prefixes, prefix)
+		} else {
+			paths = append(paths, path)
+		}
+	}
+
+	skip := util.Array2map(paths...)
 
 	return func(c *gin.Context) {
 
 		path := c.Request.URL.Path
 
+		_, shouldSkip := skip[path]
+		for _, prefix := range prefixes {
+			shouldSkip = shouldSkip || strings.HasPrefix(path, prefix)
+		}
+
 		// check if server token is defined and path is secured
-		if _, shouldSkip := skip[path]; serverToken != "" && !shouldSkip {
+		if serverToken != "" && !shouldSkip {
 			accessToken := c.Request.Header.Get("Authorization")
 
 			if accessToken != serverToken {
@@ -0,0 +1,213 @@
+package router
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/gin-gonic/gin"
+	"github.com/mirakl/s3proxy/backend"
+)
+
+// parse the filename, disposition, contentType, cacheControl and contentLanguage query parameters of a presigned download
+func parseResponseHeaders(c *gin.Context) (backend.ResponseHeaders, error) {
+	var (
+		filename    = c.Query("filename")
+		disposition = c.Query("disposition")
+		contentType = c.Query("contentType")
+	)
+
+	headers := backend.ResponseHeaders{
+		ContentType:     contentType,
+		CacheControl:    c.Query("cacheControl"),
+		ContentLanguage: c.Query("contentLanguage"),
+	}
+
+	switch disposition {
+	case "":
+		if filename != "" {
+			disposition = "attachment"
+		}
+	case "inline", "attachment":
+	default:
+		return headers, errors.New("Invalid disposition " + disposition + ", must be inline or attachment")
+	}
+
+	if !utf8.ValidString(filename) {
+		return headers, errors.New("Invalid filename, must be UTF-8")
+	}
+
+	if contentType != "" {
+		if _, _, err := mime.ParseMediaType(contentType); err != nil {
+			return headers, errors.New("Invalid contentType " + contentType)
+		}
+	}
+
+	if disposition != "" {
+		headers.ContentDisposition = contentDisposition(disposition, filename)
+	}
+
+	return headers, nil
+}
+
+// build a Content-Disposition header, non-ASCII file names are encoded as defined by RFC 5987 (filename*)
+// with an ASCII fallback (filename) for the clients which do not support it
+func contentDisposition(disposition string, filename string) string {
+	if filename == "" {
+		return disposition
+	}
+
+	var (
+		fallback strings.Builder
+		encoded  strings.Builder
+		ascii    = true
+	)
+
+	for _, r := range filename {
+		switch {
+		case r >= utf8.RuneSelf:
+			ascii = false
+			fallback.WriteByte('_')
+		case r < 0x20 || r == 0x7f || r == '"' || r == '\\':
+			fallback.WriteByte('_')
+		default:
+			fallback.WriteRune(r)
+		}
+	}
+
+	if ascii {
+		return fmt.Sprintf("%s; filename=\"%s\"", disposition, fallback.String())
+	}
+
+	// attr-char of RFC 5987, every other byte is percent encoded
+	for _, b := range []byte(filename) {
+		if b < utf8.RuneSelf && (b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9' || strings.IndexByte("!#$&+-.^_`|~", b) >= 0) {
+			encoded.WriteByte(b)
+		} else {
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		}
+	}
+
+	return fmt.Sprintf("%s; filename=\"%s\"; filename*=UTF-8''%s", disposition, fallback.String(), encoded.String())
+}
+
+// parse the contentType, contentLength, contentMD5, checksumSHA256 and x-amz-meta-* query parameters of a presigned upload
+func parseUploadConstraints(c *gin.Context) (backend.UploadConstraints, error) {
+	var (
+		contentType    = c.Query("contentType")
+		contentLength  = c.Query("contentLength")
+		contentMD5     = c.Query("contentMD5")
+		checksumSHA256 = c.Query("checksumSHA256")
+	)
+
+	constraints := backend.UploadConstraints{
+		ContentType:    contentType,
+		ContentMD5:     contentMD5,
+		ChecksumSHA256: checksumSHA256,
+	}
+
+	if contentType != "" {
+		if _, _, err := mime.ParseMediaType(contentType); err != nil {
+			return constraints, errors.New("Invalid contentType " + contentType)
+		}
+	}
+
+	if contentLength != "" {
+		value, err := strconv.ParseInt(contentLength, 10, 64)
+		if err != nil || value <= 0 {
+			return constraints, errors.New("Invalid contentLength " + contentLength)
+		}
+		constraints.ContentLength = value
+	}
+
+	if contentMD5 != "" && !isBase64Digest(contentMD5, md5.Size) {
+		return constraints, errors.New("Invalid contentMD5 " + contentMD5 + ", must be a base64 encoded MD5 digest")
+	}
+
+	if checksumSHA256 != "" && !isBase64Digest(checksumSHA256, sha256.Size) {
+		return constraints, errors.New("Invalid checksumSHA256 " + checksumSHA256 + ", must be a base64 encoded SHA-256 digest")
+	}
+
+	for name, values := range c.Request.URL.Query() {
+		if name = strings.ToLower(name); strings.HasPrefix(name, metadataHeaderPrefix) && len(values) > 0 {
+			if name == metadataHeaderPrefix {
+				return constraints, errors.New("Invalid metadata parameter " + name + ", the name is missing")
+			}
+			if constraints.Metadata == nil {
+				constraints.Metadata = make(map[string]string)
+			}
+			constraints.Metadata[strings.TrimPrefix(name, metadataHeaderPrefix)] = values[0]
+		}
+	}
+
+	return constraints, nil
+}
+
+// check the value is the base64 encoding of a digest of the given size
+func isBase64Digest(value string, size int) bool {
+	digest, err := base64.StdEncoding.DecodeString(value)
+	return err == nil && len(digest) == size
+}
+
+// headers of the SSE-C customer keys, the keys are never accepted as query parameters to keep them out of the logs
+const (
+	customerKeyHeader           = "X-Amz-Server-Side-Encryption-Customer-Key"
+	copySourceCustomerKeyHeader = "X-Amz-Copy-Source-Server-Side-Encryption-Customer-Key"
+)
+
+// parse the sse and sseKmsKeyId query parameters and the SSE-C customer key header of a request
+// the mode is SSE-C when only the customer key is sent, the default encryption of the bucket is used when nothing is sent
+func parseEncryption(c *gin.Context) (backend.Encryption, error) {
+	encryption := backend.Encryption{
+		Mode:        c.Query("sse"),
+		KMSKeyID:    c.Query("sseKmsKeyId"),
+		CustomerKey: c.GetHeader(customerKeyHeader),
+	}
+
+	if encryption.Mode == "" && encryption.CustomerKey != "" {
+		encryption.Mode = backend.EncryptionSSEC
+	}
+
+	switch encryption.Mode {
+	case "", backend.EncryptionSSES3, backend.EncryptionSSEKMS, backend.EncryptionSSEC:
+	default:
+		return encryption, fmt.Errorf("Invalid sse %s, must be %s, %s or %s", encryption.Mode, backend.EncryptionSSES3, backend.EncryptionSSEKMS, backend.EncryptionSSEC)
+	}
+
+	if encryption.KMSKeyID != "" && encryption.Mode != backend.EncryptionSSEKMS {
+		return encryption, fmt.Errorf("Invalid sseKmsKeyId, only allowed with sse=%s", backend.EncryptionSSEKMS)
+	}
+
+	if encryption.Mode == backend.EncryptionSSEC && encryption.CustomerKey == "" {
+		return encryption, fmt.Errorf("Missing header %s for sse=%s", customerKeyHeader, backend.EncryptionSSEC)
+	}
+
+	if encryption.Mode != backend.EncryptionSSEC && encryption.CustomerKey != "" {
+		return encryption, fmt.Errorf("Invalid header %s, only allowed with sse=%s", customerKeyHeader, backend.EncryptionSSEC)
+	}
+
+	return encryption, nil
+}
+
+// the encryption of the source object of a copy, only SSE-C needs the key to read the source
+func parseCopySourceEncryption(c *gin.Context) backend.Encryption {
+	if key := c.GetHeader(copySourceCustomerKeyHeader); key != "" {
+		return backend.Encryption{Mode: backend.EncryptionSSEC, CustomerKey: key}
+	}
+	return backend.Encryption{}
+}
+
+// check if the error is an invalid encryption error of the backend and returns its message
+func invalidEncryption(err error) (string, bool) {
+	if err, ok := err.(awserr.Error); ok && err.Code() == backend.ErrCodeInvalidEncryption {
+		return err.Message(), true
+	}
+	return "", false
+}
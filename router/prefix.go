@@ -0,0 +1,156 @@
+package router
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mirakl/s3proxy/backend"
+)
+
+const (
+	// default and max. number of objects copied in parallel by a prefix copy
+	defaultPrefixCopyConcurrency = 10
+	maxPrefixCopyConcurrency     = 50
+)
+
+// FailedKey is a key whose operation failed with the error message
+type FailedKey struct {
+	Key   string `json:"key"`
+	Error string `json:"error"`
+}
+
+// PrefixCopySummary is the result of a prefix copy, keys are the source keys
+type PrefixCopySummary struct {
+	Copied  []string    `json:"copied"`
+	Skipped []string    `json:"skipped"`
+	Failed  []FailedKey `json:"failed"`
+}
+
+// Copy every object under the source prefix to the destination bucket, the source prefix of the keys being replaced by the destination prefix
+// When skipExisting is true, the objects already present in the destination with the same content (see sameContent) are not copied again
+// Returns an error only when the listing of the source fails, copy failures are reported in the summary
+func copyPrefix(s3Backend backend.Backend, sourceBucket string, sourcePrefix string, destinationBucket string, destinationPrefix string, concurrency int, skipExisting bool) (*PrefixCopySummary, error) {
+
+	summary := &PrefixCopySummary{
+		Copied:  []string{},
+		Skipped: []string{},
+		Failed:  []FailedKey{},
+	}
+
+	var (
+		mutex     sync.Mutex
+		wg        sync.WaitGroup
+		semaphore = make(chan struct{}, concurrency)
+	)
+
+	copyOne := func(object backend.ObjectInfo) {
+		defer wg.Done()
+		defer func() { <-semaphore }()
+
+		sourceObject := backend.BucketObject{BucketName: sourceBucket, Key: object.Key}
+		destinationObject := backend.BucketObject{BucketName: destinationBucket, Key: destinationPrefix + strings.TrimPrefix(object.Key, sourcePrefix)}
+
+		if skipExisting {
+			if info, err := s3Backend.StatObject(destinationObject); err == nil && sameContent(object, *info) {
+				mutex.Lock()
+				summary.Skipped = append(summary.Skipped, object.Key)
+				mutex.Unlock()
+				return
+			}
+		}
+
+		err := s3Backend.CopyObject(sourceObject, destinationObject)
+
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if err != nil {
+			log.Errorf("Failed to copy object %s %s to %s %s: %v", sourceBucket, object.Key, destinationBucket, destinationObject.Key, err)
+			_, message := copyErrorStatus(err, sourceBucket, object.Key, destinationBucket)
+			summary.Failed = append(summary.Failed, FailedKey{Key: object.Key, Error: message})
+			return
+		}
+
+		summary.Copied = append(summary.Copied, object.Key)
+	}
+
+	options := backend.ListOptions{Prefix: sourcePrefix}
+
+	for {
+		listing, err := s3Backend.ListObjects(sourceBucket, options)
+		if err != nil {
+			wg.Wait()
+			return nil, err
+		}
+
+		for _, object := range listing.Objects {
+			semaphore <- struct{}{}
+			wg.Add(1)
+			go copyOne(object)
+		}
+
+		if !listing.IsTruncated {
+			break
+		}
+
+		options.ContinuationToken = listing.NextContinuationToken
+	}
+
+	wg.Wait()
+
+	return summary, nil
+}
+
+// Returns true when the destination object has the content of the source object : same size and same ETag
+// The ETag of a multipart object ("<md5>-<number of parts>") depends on the size of the parts, it is only compared when neither object is multipart
+func sameContent(source backend.ObjectInfo, destination backend.ObjectInfo) bool {
+	if source.Size != destination.Size {
+		return false
+	}
+	if strings.Contains(source.ETag, "-") || strings.Contains(destination.ETag, "-") {
+		return true
+	}
+	return source.ETag == destination.ETag
+}
+
+// Delete every object under the prefix last modified before the date (no filter when zero) with batch deletes, one per listing page
+// In dry run mode, nothing is deleted. Returns the deleted keys (or the keys which would have been deleted)
+func deletePrefix(s3Backend backend.Backend, bucket string, prefix string, modifiedBefore time.Time, dryRun bool) ([]string, error) {
+
+	deleted := []string{}
+	options := backend.ListOptions{Prefix: prefix}
+
+	for {
+		listing, err := s3Backend.ListObjects(bucket, options)
+		if err != nil {
+			return deleted, err
+		}
+
+		objectsToDelete := make([]backend.BucketObject, 0, len(listing.Objects))
+
+		for _, object := range listing.Objects {
+			if modifiedBefore.IsZero() || object.LastModified.Before(modifiedBefore) {
+				objectsToDelete = append(objectsToDelete, backend.BucketObject{BucketName: bucket, Key: object.Key})
+			}
+		}
+
+		if len(objectsToDelete) > 0 && !dryRun {
+			if err := s3Backend.BatchDeleteObjects(objectsToDelete); err != nil {
+				return deleted, err
+			}
+		}
+
+		for _, object := range objectsToDelete {
+			deleted = append(deleted, object.Key)
+		}
+
+		if !listing.IsTruncated {
+			break
+		}
+
+		options.ContinuationToken = listing.NextContinuationToken
+	}
+
+	return deleted, nil
+}
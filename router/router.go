@@ -1,9 +1,16 @@
 package router
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/s3"
@@ -17,15 +24,45 @@ var (
 	log = logging.MustGetLogger("s3proxy")
 )
 
+// Config for the optional features of the router
+type Config struct {
+	// Stream the objects through s3proxy (GET and PUT /api/v1/object/:bucket/*key) for clients which cannot reach the backend
+	EnableStreaming bool
+
+	// Maximum size in bytes of a streamed upload, 0 for no limit
+	MaxUploadSize int64
+
+	// Streamed uploads larger than this size in bytes are sent with a multipart upload in parts of this size, backend default when 0
+	PartSize int64
+
+	// Filesystem backend whose signed URLs are served by /api/v1/fs/:bucket/*key, nil to disable the routes
+	FSBackend *backend.FSBackend
+
+	// Replicating backend whose status is served by /api/v1/replication/status, nil to disable the route
+	Replication *backend.ReplicatingBackend
+}
+
 // Create a gin router
-func NewGinEngine(ginMode string, version string, urlExpiration time.Duration, serverAPIKey string, s3Backend backend.Backend) *gin.Engine {
+func NewGinEngine(ginMode string, version string, urlExpiration time.Duration, serverAPIKey string, s3Backend backend.Backend, config ...Config) *gin.Engine {
+
+	var routerConfig Config
+
+	if len(config) > 0 {
+		routerConfig = config[0]
+	}
 
 	gin.SetMode(ginMode)
 
 	engine := gin.New()
 
+	// the signed URLs of the filesystem backend are authorized by their signature instead of the API key
+	notSecured := []string{"/"}
+	if routerConfig.FSBackend != nil {
+		notSecured = append(notSecured, backend.FSPathPrefix+"*")
+	}
+
 	// Use middleware for logger, authorization
-	engine.Use(middleware.NewLogger(log, "/"), middleware.NewRecovery(log), middleware.NewAuthorization(serverAPIKey, "/"))
+	engine.Use(middleware.NewLogger(log, "/"), middleware.NewRecovery(log), middleware.NewAuthorization(serverAPIKey, notSecured...))
 
 	// health check
 	engine.GET("/", func(c *gin.Context) {
@@ -49,14 +86,36 @@ func NewGinEngine(ginMode string, version string, urlExpiration time.Duration, s
 			return
 		}
 
-		url, err := s3Backend.CreatePresignedURLForUpload(backend.BucketObject{BucketName: bucket, Key: key}, urlExpiration)
+		constraints, err := parseUploadConstraints(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		encryption, err := parseEncryption(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		storageClass, err := parseStorageClass(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		presignedURL, err := s3Backend.CreatePresignedURLForUpload(backend.BucketObject{BucketName: bucket, Key: key, Encryption: encryption, StorageClass: storageClass}, urlExpiration, constraints)
+		if msg, ok := invalidEncryption(err); ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
 		if err != nil {
 			log.Errorf("Failed to create presigned PutObject URL for %s %v", key, bucket, err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create PutObject URL for " + key})
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"url": url})
+		c.JSON(http.StatusOK, presignedURL)
 	})
 
 	// create presigned url for a file download
@@ -66,6 +125,7 @@ func NewGinEngine(ginMode string, version string, urlExpiration time.Duration, s
 			bucket     = c.Param("bucket")
 			key        = c.Param("key")
 			expiration = c.Query("expiration")
+			versionID  = c.Query("versionId")
 		)
 
 		urlExpiration, err := parseExpiration(expiration, urlExpiration)
@@ -74,7 +134,33 @@ func NewGinEngine(ginMode string, version string, urlExpiration time.Duration, s
 			return
 		}
 
-		url, err := s3Backend.CreatePresignedURLForDownload(backend.BucketObject{BucketName: bucket, Key: key}, urlExpiration)
+		headers, err := parseResponseHeaders(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		encryption, err := parseEncryption(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		object := backend.BucketObject{BucketName: bucket, Key: key, VersionID: versionID, Encryption: encryption}
+
+		// an archived object can not be downloaded until it is restored
+		// on error (ex: not found), the url is created and the download reports the error
+		if info, err := s3Backend.StatObject(object); err == nil && info.IsArchived() {
+			msg := fmt.Sprintf("Object archived in %s, restore it before the download : bucket=%q, key=%q", info.StorageClass, bucket, key)
+			c.JSON(http.StatusConflict, gin.H{"error": msg, "storageClass": info.StorageClass, "restore": info.Restore})
+			return
+		}
+
+		url, err := s3Backend.CreatePresignedURLForDownload(object, urlExpiration, headers)
+		if msg, ok := invalidEncryption(err); ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
 		if err != nil {
 			log.Errorf("Failed to create presigned GetObject URL for %s %v", key, bucket, err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create GetObject URL for " + key})
@@ -84,6 +170,64 @@ func NewGinEngine(ginMode string, version string, urlExpiration time.Duration, s
 		c.JSON(http.StatusOK, gin.H{"url": url})
 	})
 
+	presignedPostAPIV1 := engine.Group("/api/v1/presigned/post")
+
+	// create presigned post policy for a file upload from a browser form
+	presignedPostAPIV1.POST("/:bucket/*key", func(c *gin.Context) {
+
+		var (
+			bucket            = c.Param("bucket")
+			key               = c.Param("key")
+			expiration        = c.Query("expiration")
+			contentLengthMin  = c.Query("contentLengthMin")
+			contentLengthMax  = c.Query("contentLengthMax")
+			contentTypePrefix = c.Query("contentTypePrefix")
+		)
+
+		urlExpiration, err := parseExpiration(expiration, urlExpiration)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse Duration " + expiration})
+			return
+		}
+
+		conditions := backend.PostConditions{
+			ContentTypePrefix: contentTypePrefix,
+		}
+
+		if contentLengthMin != "" || contentLengthMax != "" {
+			conditions.ContentLengthMin, err = strconv.ParseInt(contentLengthMin, 10, 64)
+			if contentLengthMin != "" && (err != nil || conditions.ContentLengthMin < 0) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid contentLengthMin " + contentLengthMin})
+				return
+			}
+
+			conditions.ContentLengthMax, err = strconv.ParseInt(contentLengthMax, 10, 64)
+			if err != nil || conditions.ContentLengthMax <= 0 || conditions.ContentLengthMax < conditions.ContentLengthMin {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid contentLengthMax " + contentLengthMax})
+				return
+			}
+		}
+
+		encryption, err := parseEncryption(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		post, err := s3Backend.CreatePresignedPost(backend.BucketObject{BucketName: bucket, Key: key, Encryption: encryption}, urlExpiration, conditions)
+		if msg, ok := invalidEncryption(err); ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+		if err != nil {
+			log.Errorf("Failed to create presigned POST policy for %s %s: %v", key, bucket, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create POST policy for " + key})
+			return
+		}
+
+		c.JSON(http.StatusOK, post)
+	})
+
 	objectAPIV1 := engine.Group("/api/v1/object")
 
 	type DeleteForm struct {
@@ -114,6 +258,10 @@ func NewGinEngine(ginMode string, version string, urlExpiration time.Duration, s
 
 		if err != nil {
 			log.Errorf("Failed to delete %d objects in bucket %s: %v", len(objectsToDelete), bucket, err)
+			if keys, ok := lockedKeys(err); ok {
+				c.JSON(http.StatusLocked, gin.H{"error": "Objects protected by Object Lock in bucket " + bucket, "code": backend.ErrCodeObjectLocked, "lockedKeys": keys})
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete objects " + bucket})
 			return
 		}
@@ -121,18 +269,75 @@ func NewGinEngine(ginMode string, version string, urlExpiration time.Duration, s
 		c.JSON(http.StatusOK, gin.H{"response": "ok"})
 	})
 
+	// delete every object under a prefix, optionally only the objects older than a duration
+	objectAPIV1.POST("/delete-prefix/:bucket", func(c *gin.Context) {
+
+		var (
+			bucket    = c.Param("bucket")
+			prefix    = c.Query("prefix")
+			olderThan = c.Query("olderThan")
+			dryRun    = c.Query("dryRun") == "true"
+		)
+
+		// never purge a whole bucket by mistake
+		if prefix == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Missing prefix"})
+			return
+		}
+
+		var modifiedBefore time.Time
+
+		if olderThan != "" {
+			duration, err := time.ParseDuration(olderThan)
+			if err != nil || duration <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse Duration " + olderThan})
+				return
+			}
+			modifiedBefore = time.Now().Add(-duration)
+		}
+
+		deleted, err := deletePrefix(s3Backend, bucket, prefix, modifiedBefore, dryRun)
+
+		if err != nil {
+			log.Errorf("Failed to delete objects in bucket %s with prefix %q after %d deletions: %v", bucket, prefix, len(deleted), err)
+
+			status, msg := http.StatusInternalServerError, fmt.Sprintf("Failed to delete objects : bucket=%q, prefix=%q", bucket, prefix)
+
+			if err, ok := err.(awserr.Error); ok && err.Code() == s3.ErrCodeNoSuchBucket {
+				status, msg = http.StatusNotFound, fmt.Sprintf("No such bucket : %q", bucket)
+			}
+
+			if keys, ok := lockedKeys(err); ok {
+				c.JSON(http.StatusLocked, gin.H{"error": "Objects protected by Object Lock in bucket " + bucket, "code": backend.ErrCodeObjectLocked, "lockedKeys": keys, "deleted": deleted})
+				return
+			}
+
+			c.JSON(status, gin.H{"error": msg, "deleted": deleted})
+
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"deleted": deleted, "dryRun": dryRun})
+	})
+
 	objectAPIV1.DELETE("/:bucket/*key", func(c *gin.Context) {
 
 		var (
-			bucket = c.Param("bucket")
-			key    = c.Param("key")
+			bucket    = c.Param("bucket")
+			key       = c.Param("key")
+			versionID = c.Query("versionId")
 		)
 
-		err := s3Backend.DeleteObject(backend.BucketObject{BucketName: bucket, Key: key})
+		err := s3Backend.DeleteObject(backend.BucketObject{BucketName: bucket, Key: key, VersionID: versionID})
 
 		if err != nil {
 			log.Errorf("Failed to delete object %s in bucket %s: %v", key, bucket, err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete object " + key})
+			if keys, ok := lockedKeys(err); ok {
+				c.JSON(http.StatusLocked, gin.H{"error": "Object protected by Object Lock " + key, "code": backend.ErrCodeObjectLocked, "lockedKeys": keys})
+				return
+			}
+			status, msg := objectErrorStatus(err, bucket, key, "Failed to delete object "+key)
+			c.JSON(status, gin.H{"error": msg})
 			return
 		}
 
@@ -146,6 +351,7 @@ func NewGinEngine(ginMode string, version string, urlExpiration time.Duration, s
 			sourceKey         = c.Param("key")
 			destinationBucket = c.Query("destBucket")
 			destinationKey    = c.Query("destKey")
+			sourceVersionID   = c.Query("versionId")
 		)
 
 		if destinationBucket == "" {
@@ -158,32 +364,1225 @@ func NewGinEngine(ginMode string, version string, urlExpiration time.Duration, s
 			return
 		}
 
-		err := s3Backend.CopyObject(backend.BucketObject{BucketName: sourceBucket, Key: sourceKey},
-			backend.BucketObject{BucketName: destinationBucket, Key: destinationKey})
+		encryption, err := parseEncryption(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		storageClass, err := parseStorageClass(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		err = s3Backend.CopyObject(backend.BucketObject{BucketName: sourceBucket, Key: sourceKey, VersionID: sourceVersionID, Encryption: parseCopySourceEncryption(c)},
+			backend.BucketObject{BucketName: destinationBucket, Key: destinationKey, Encryption: encryption, StorageClass: storageClass})
 
 		if err != nil {
 			log.Errorf("Failed to copy object %s %s to %s %s: %v", sourceBucket, sourceKey, destinationBucket, destinationKey, err)
 
-			status, msg := http.StatusInternalServerError, fmt.Sprintf("Failed to copy object : sourceBucket=%q, sourceKey=%q", sourceBucket, sourceKey)
+			status, msg := copyErrorStatus(err, sourceBucket, sourceKey, destinationBucket)
+
+			c.JSON(status, gin.H{"error": msg})
+
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"response": "ok"})
+	})
+
+	// copy every object under a prefix to a destination bucket and prefix
+	objectAPIV1.POST("/copy-prefix/:bucket", func(c *gin.Context) {
+
+		var (
+			sourceBucket      = c.Param("bucket")
+			sourcePrefix      = c.Query("prefix")
+			destinationBucket = c.Query("destBucket")
+			destinationPrefix = c.Query("destPrefix")
+			concurrency       = c.Query("concurrency")
+			skipExisting      = c.Query("skipExisting") == "true"
+		)
+
+		if sourcePrefix == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Missing prefix"})
+			return
+		}
+
+		if destinationBucket == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Missing destination bucket"})
+			return
+		}
+
+		if destinationPrefix == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Missing destination prefix"})
+			return
+		}
+
+		// the copies would be listed and copied again
+		if sourceBucket == destinationBucket && strings.HasPrefix(destinationPrefix, sourcePrefix) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Destination prefix must not be inside the source prefix"})
+			return
+		}
+
+		workers := defaultPrefixCopyConcurrency
+
+		if concurrency != "" {
+			value, err := strconv.Atoi(concurrency)
+			if err != nil || value < 1 || value > maxPrefixCopyConcurrency {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid concurrency %s, must be between 1 and %d", concurrency, maxPrefixCopyConcurrency)})
+				return
+			}
+			workers = value
+		}
+
+		summary, err := copyPrefix(s3Backend, sourceBucket, sourcePrefix, destinationBucket, destinationPrefix, workers, skipExisting)
+
+		if err != nil {
+			log.Errorf("Failed to list objects in bucket %s with prefix %q: %v", sourceBucket, sourcePrefix, err)
+
+			status, msg := http.StatusInternalServerError, fmt.Sprintf("Failed to list objects : bucket=%q, prefix=%q", sourceBucket, sourcePrefix)
+
+			if err, ok := err.(awserr.Error); ok && err.Code() == s3.ErrCodeNoSuchBucket {
+				status, msg = http.StatusNotFound, fmt.Sprintf("No such bucket : %q", sourceBucket)
+			}
+
+			c.JSON(status, gin.H{"error": msg})
+
+			return
+		}
+
+		status := http.StatusOK
+
+		// some copies failed
+		if len(summary.Failed) > 0 {
+			status = http.StatusMultiStatus
+		}
+
+		c.JSON(status, summary)
+	})
+
+	// move an object : copy to the destination, check the destination exists then delete the source
+	objectAPIV1.POST("/move/:bucket/*key", func(c *gin.Context) {
+
+		var (
+			sourceBucket      = c.Param("bucket")
+			sourceKey         = c.Param("key")
+			destinationBucket = c.Query("destBucket")
+			destinationKey    = c.Query("destKey")
+		)
+
+		if destinationBucket == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Missing destination bucket"})
+			return
+		}
+
+		if destinationKey == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Missing destination key"})
+			return
+		}
+
+		encryption, err := parseEncryption(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		sourceObject := backend.BucketObject{BucketName: sourceBucket, Key: sourceKey, Encryption: parseCopySourceEncryption(c)}
+		destinationObject := backend.BucketObject{BucketName: destinationBucket, Key: destinationKey, Encryption: encryption}
+
+		// moving an object on itself would delete it
+		if sourceObject.BucketName == destinationObject.BucketName && sourceObject.Key == destinationObject.Key {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Source and destination are the same object"})
+			return
+		}
+
+		if err := s3Backend.CopyObject(sourceObject, destinationObject); err != nil {
+			log.Errorf("Failed to move object %s %s to %s %s, copy failed: %v", sourceBucket, sourceKey, destinationBucket, destinationKey, err)
+
+			status, msg := copyErrorStatus(err, sourceBucket, sourceKey, destinationBucket)
+
+			c.JSON(status, gin.H{"error": msg, "step": "copy"})
+
+			return
+		}
+
+		if _, err := s3Backend.StatObject(destinationObject); err != nil {
+			log.Errorf("Failed to move object %s %s to %s %s, destination not found after copy: %v", sourceBucket, sourceKey, destinationBucket, destinationKey, err)
+
+			msg := fmt.Sprintf("Failed to verify copied object, source not deleted : destBucket=%q, destKey=%q", destinationBucket, destinationKey)
+
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg, "step": "verify"})
+
+			return
+		}
+
+		if err := s3Backend.DeleteObject(sourceObject); err != nil {
+			log.Errorf("Failed to move object %s %s to %s %s, delete failed: %v", sourceBucket, sourceKey, destinationBucket, destinationKey, err)
+
+			if keys, ok := lockedKeys(err); ok {
+				msg := fmt.Sprintf("Object copied but source object protected by Object Lock : sourceBucket=%q, sourceKey=%q", sourceBucket, sourceKey)
+				c.JSON(http.StatusLocked, gin.H{"error": msg, "code": backend.ErrCodeObjectLocked, "lockedKeys": keys, "step": "delete"})
+				return
+			}
+
+			status, msg := objectErrorStatus(err, sourceBucket, sourceKey, fmt.Sprintf("Object copied but failed to delete source object : sourceBucket=%q, sourceKey=%q", sourceBucket, sourceKey))
+
+			c.JSON(status, gin.H{"error": msg, "step": "delete"})
+
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"response": "ok"})
+	})
+
+	// restore a version of an object : the version is copied on top of the current version
+	objectAPIV1.POST("/restore-version/:bucket/*key", func(c *gin.Context) {
+
+		var (
+			bucket    = c.Param("bucket")
+			key       = c.Param("key")
+			versionID = c.Query("versionId")
+		)
+
+		if versionID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Missing versionId"})
+			return
+		}
+
+		encryption, err := parseEncryption(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		err = s3Backend.CopyObject(backend.BucketObject{BucketName: bucket, Key: key, VersionID: versionID, Encryption: parseCopySourceEncryption(c)},
+			backend.BucketObject{BucketName: bucket, Key: key, Encryption: encryption})
+
+		if err != nil {
+			log.Errorf("Failed to restore version %s of object %s in bucket %s: %v", versionID, key, bucket, err)
+			status, msg := objectErrorStatus(err, bucket, key, fmt.Sprintf("Failed to restore version : bucket=%q, key=%q, versionId=%q", bucket, key, versionID))
+			c.JSON(status, gin.H{"error": msg})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"response": "ok"})
+	})
+
+	// restore temporarily an archived object (GLACIER, DEEP_ARCHIVE), the restore status is returned by the metadata
+	objectAPIV1.POST("/restore/:bucket/*key", func(c *gin.Context) {
+
+		var (
+			bucket    = c.Param("bucket")
+			key       = c.Param("key")
+			days      = c.DefaultQuery("days", "1")
+			tier      = c.Query("tier")
+			versionID = c.Query("versionId")
+		)
+
+		options := backend.RestoreOptions{Tier: tier}
+
+		value, err := strconv.ParseInt(days, 10, 64)
+		if err != nil || value <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid days " + days})
+			return
+		}
+		options.Days = value
+
+		if tier != "" && !slices.Contains(s3.Tier_Values(), tier) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid tier %s, must be one of %s", tier, strings.Join(s3.Tier_Values(), ", "))})
+			return
+		}
+
+		started, err := s3Backend.RestoreObject(backend.BucketObject{BucketName: bucket, Key: key, VersionID: versionID}, options)
+
+		if err != nil {
+			status, msg := objectErrorStatus(err, bucket, key, fmt.Sprintf("Failed to restore object : bucket=%q, key=%q", bucket, key))
 
 			if err, ok := err.(awserr.Error); ok {
 				switch err.Code() {
-				case s3.ErrCodeNoSuchBucket:
-					status, msg = http.StatusNotFound, fmt.Sprintf("No such bucket : %q or %q", sourceBucket, destinationBucket)
-				case s3.ErrCodeNoSuchKey:
-					status, msg = http.StatusNotFound, fmt.Sprintf("No such key : %q", sourceKey)
+				case "RestoreAlreadyInProgress":
+					status, msg = http.StatusConflict, fmt.Sprintf("Restore already in progress : bucket=%q, key=%q", bucket, key)
+				case "InvalidObjectState":
+					status, msg = http.StatusConflict, fmt.Sprintf("Object not archived : bucket=%q, key=%q", bucket, key)
 				}
 			}
 
+			if status == http.StatusInternalServerError {
+				log.Errorf("Failed to restore object %s in bucket %s: %v", key, bucket, err)
+			}
+
 			c.JSON(status, gin.H{"error": msg})
 
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"response": "ok"})
+		if started {
+			c.JSON(http.StatusAccepted, gin.H{"response": "restore started"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"response": "already restored"})
 	})
 
-	return engine
+	objectAPIV1.GET("/meta/:bucket/*key", func(c *gin.Context) {
+
+		var (
+			bucket    = c.Param("bucket")
+			key       = c.Param("key")
+			versionID = c.Query("versionId")
+		)
+
+		encryption, err := parseEncryption(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		info, err := s3Backend.StatObject(backend.BucketObject{BucketName: bucket, Key: key, VersionID: versionID, Encryption: encryption})
+
+		if err != nil {
+			log.Errorf("Failed to retrieve metadata of object %s in bucket %s: %v", key, bucket, err)
+
+			status, msg := objectErrorStatus(err, bucket, key, fmt.Sprintf("Failed to retrieve metadata : bucket=%q, key=%q", bucket, key))
+
+			c.JSON(status, gin.H{"error": msg})
+
+			return
+		}
+
+		c.JSON(http.StatusOK, info)
+	})
+
+	if routerConfig.EnableStreaming {
+
+		// stream the content of an object
+		objectAPIV1.GET("/:bucket/*key", func(c *gin.Context) {
+
+			var (
+				bucket    = c.Param("bucket")
+				key       = c.Param("key")
+				versionID = c.Query("versionId")
+			)
+
+			encryption, err := parseEncryption(c)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			serveObject(c, s3Backend, backend.BucketObject{BucketName: bucket, Key: key, VersionID: versionID, Encryption: encryption}, backend.ResponseHeaders{})
+		})
+
+		// upload the content of an object from the request body
+		objectAPIV1.PUT("/:bucket/*key", func(c *gin.Context) {
+
+			var (
+				bucket = c.Param("bucket")
+				key    = c.Param("key")
+			)
+
+			if routerConfig.MaxUploadSize > 0 && c.Request.ContentLength > routerConfig.MaxUploadSize {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Body too large, max. size is %d bytes", routerConfig.MaxUploadSize)})
+				return
+			}
+
+			options := backend.PutOptions{
+				ContentType: c.GetHeader("Content-Type"),
+				Metadata:    make(map[string]string),
+				PartSize:    routerConfig.PartSize,
+			}
+
+			for name, values := range c.Request.Header {
+				if name = strings.ToLower(name); strings.HasPrefix(name, metadataHeaderPrefix) && len(values) > 0 {
+					options.Metadata[strings.TrimPrefix(name, metadataHeaderPrefix)] = values[0]
+				}
+			}
+
+			encryption, err := parseEncryption(c)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			body := &maxSizeReader{reader: c.Request.Body, limit: routerConfig.MaxUploadSize}
+
+			etag, err := s3Backend.PutObject(backend.BucketObject{BucketName: bucket, Key: key, Encryption: encryption}, body, options)
+
+			if err != nil {
+				if body.exceeded {
+					c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Body too large, max. size is %d bytes", routerConfig.MaxUploadSize)})
+					return
+				}
+
+				log.Errorf("Failed to put object %s in bucket %s: %v", key, bucket, err)
+
+				status, msg := http.StatusInternalServerError, fmt.Sprintf("Failed to put object : bucket=%q, key=%q", bucket, key)
+
+				if err, ok := err.(awserr.Error); ok {
+					switch err.Code() {
+					case s3.ErrCodeNoSuchBucket:
+						status, msg = http.StatusNotFound, fmt.Sprintf("No such bucket : %q", bucket)
+					case backend.ErrCodeInvalidEncryption:
+						status, msg = http.StatusBadRequest, err.Message()
+					}
+				}
+
+				c.JSON(status, gin.H{"error": msg})
+
+				return
+			}
+
+			c.JSON(http.StatusOK, gin.H{"etag": etag})
+		})
+	}
+
+	tagsAPIV1 := objectAPIV1.Group("/tags")
+
+	// get the tags of an object
+	tagsAPIV1.GET("/:bucket/*key", func(c *gin.Context) {
+
+		var (
+			bucket    = c.Param("bucket")
+			key       = c.Param("key")
+			versionID = c.Query("versionId")
+		)
+
+		tags, err := s3Backend.GetObjectTagging(backend.BucketObject{BucketName: bucket, Key: key, VersionID: versionID})
+
+		if err != nil {
+			log.Errorf("Failed to get tags of object %s in bucket %s: %v", key, bucket, err)
+			status, msg := objectErrorStatus(err, bucket, key, fmt.Sprintf("Failed to get tags : bucket=%q, key=%q", bucket, key))
+			c.JSON(status, gin.H{"error": msg})
+			return
+		}
+
+		c.JSON(http.StatusOK, tags)
+	})
+
+	// replace the tags of an object with the json map of the body
+	tagsAPIV1.PUT("/:bucket/*key", func(c *gin.Context) {
+
+		var (
+			bucket    = c.Param("bucket")
+			key       = c.Param("key")
+			versionID = c.Query("versionId")
+		)
+
+		var tags map[string]string
+		if err := c.ShouldBindJSON(&tags); err != nil {
+			log.Errorf("Failed to parse body %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse body " + err.Error()})
+			return
+		}
+
+		if err := validateTags(tags); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tags : " + err.Error()})
+			return
+		}
+
+		err := s3Backend.PutObjectTagging(backend.BucketObject{BucketName: bucket, Key: key, VersionID: versionID}, tags)
+
+		if err != nil {
+			log.Errorf("Failed to put tags of object %s in bucket %s: %v", key, bucket, err)
+			status, msg := objectErrorStatus(err, bucket, key, fmt.Sprintf("Failed to put tags : bucket=%q, key=%q", bucket, key))
+			c.JSON(status, gin.H{"error": msg})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"response": "ok"})
+	})
+
+	// remove all the tags of an object
+	tagsAPIV1.DELETE("/:bucket/*key", func(c *gin.Context) {
+
+		var (
+			bucket    = c.Param("bucket")
+			key       = c.Param("key")
+			versionID = c.Query("versionId")
+		)
+
+		err := s3Backend.DeleteObjectTagging(backend.BucketObject{BucketName: bucket, Key: key, VersionID: versionID})
+
+		if err != nil {
+			log.Errorf("Failed to delete tags of object %s in bucket %s: %v", key, bucket, err)
+			status, msg := objectErrorStatus(err, bucket, key, fmt.Sprintf("Failed to delete tags : bucket=%q, key=%q", bucket, key))
+			c.JSON(status, gin.H{"error": msg})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"response": "ok"})
+	})
+
+	retentionAPIV1 := objectAPIV1.Group("/retention")
+
+	// get the Object Lock retention of an object, empty when the object has no retention
+	retentionAPIV1.GET("/:bucket/*key", func(c *gin.Context) {
+
+		var (
+			bucket    = c.Param("bucket")
+			key       = c.Param("key")
+			versionID = c.Query("versionId")
+		)
+
+		retention, err := s3Backend.GetObjectRetention(backend.BucketObject{BucketName: bucket, Key: key, VersionID: versionID})
+
+		if err != nil {
+			log.Errorf("Failed to get retention of object %s in bucket %s: %v", key, bucket, err)
+			status, msg := objectLockErrorStatus(err, bucket, key, fmt.Sprintf("Failed to get retention : bucket=%q, key=%q", bucket, key))
+			c.JSON(status, gin.H{"error": msg})
+			return
+		}
+
+		c.JSON(http.StatusOK, retention)
+	})
+
+	// set the Object Lock retention of an object with the json body {"mode": "GOVERNANCE", "retainUntilDate": "2030-01-01T00:00:00Z"}
+	// an empty body {} removes the retention, shortening or removing a GOVERNANCE retention requires bypassGovernance=true
+	retentionAPIV1.PUT("/:bucket/*key", func(c *gin.Context) {
+
+		var (
+			bucket           = c.Param("bucket")
+			key              = c.Param("key")
+			versionID        = c.Query("versionId")
+			bypassGovernance = c.Query("bypassGovernance") == "true"
+		)
+
+		var retention backend.ObjectRetention
+		if err := c.ShouldBindJSON(&retention); err != nil {
+			log.Errorf("Failed to parse body %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse body " + err.Error()})
+			return
+		}
+
+		if err := validateRetention(retention); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid retention : " + err.Error()})
+			return
+		}
+
+		err := s3Backend.PutObjectRetention(backend.BucketObject{BucketName: bucket, Key: key, VersionID: versionID}, retention, bypassGovernance)
+
+		if err != nil {
+			log.Errorf("Failed to put retention of object %s in bucket %s: %v", key, bucket, err)
+			status, msg := objectLockErrorStatus(err, bucket, key, fmt.Sprintf("Failed to put retention : bucket=%q, key=%q", bucket, key))
+			c.JSON(status, gin.H{"error": msg})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"response": "ok"})
+	})
+
+	legalHoldAPIV1 := objectAPIV1.Group("/legal-hold")
+
+	// get the legal hold status of an object
+	legalHoldAPIV1.GET("/:bucket/*key", func(c *gin.Context) {
+
+		var (
+			bucket    = c.Param("bucket")
+			key       = c.Param("key")
+			versionID = c.Query("versionId")
+		)
+
+		legalHold, err := s3Backend.GetObjectLegalHold(backend.BucketObject{BucketName: bucket, Key: key, VersionID: versionID})
+
+		if err != nil {
+			log.Errorf("Failed to get legal hold of object %s in bucket %s: %v", key, bucket, err)
+			status, msg := objectLockErrorStatus(err, bucket, key, fmt.Sprintf("Failed to get legal hold : bucket=%q, key=%q", bucket, key))
+			c.JSON(status, gin.H{"error": msg})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"legalHold": legalHold})
+	})
+
+	// set or remove the legal hold of an object with the json body {"legalHold": true}
+	legalHoldAPIV1.PUT("/:bucket/*key", func(c *gin.Context) {
+
+		var (
+			bucket    = c.Param("bucket")
+			key       = c.Param("key")
+			versionID = c.Query("versionId")
+		)
+
+		var body struct {
+			LegalHold *bool `json:"legalHold" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			log.Errorf("Failed to parse body %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse body " + err.Error()})
+			return
+		}
+
+		err := s3Backend.PutObjectLegalHold(backend.BucketObject{BucketName: bucket, Key: key, VersionID: versionID}, *body.LegalHold)
+
+		if err != nil {
+			log.Errorf("Failed to put legal hold of object %s in bucket %s: %v", key, bucket, err)
+			status, msg := objectLockErrorStatus(err, bucket, key, fmt.Sprintf("Failed to put legal hold : bucket=%q, key=%q", bucket, key))
+			c.JSON(status, gin.H{"error": msg})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"response": "ok"})
+	})
+
+	if fsBackend := routerConfig.FSBackend; fsBackend != nil {
+
+		// the signed URLs of the filesystem backend are authorized by their signature instead of the API key
+		fsAPIV1 := engine.Group(backend.FSPathPrefix)
+
+		// download an object with a signed URL
+		fsAPIV1.GET("/:bucket/*key", func(c *gin.Context) {
+
+			var (
+				bucket    = c.Param("bucket")
+				key       = c.Param("key")
+				versionID = c.Query("versionId")
+			)
+
+			if err := fsBackend.VerifySignedURL(http.MethodGet, c.Request.URL); err != nil {
+				c.JSON(http.StatusForbidden, gin.H{"error": signatureErrorMessage(err)})
+				return
+			}
+
+			headers := backend.ResponseHeaders{
+				ContentDisposition: c.Query("response-content-disposition"),
+				ContentType:        c.Query("response-content-type"),
+				CacheControl:       c.Query("response-cache-control"),
+				ContentLanguage:    c.Query("response-content-language"),
+			}
+
+			serveObject(c, fsBackend, backend.BucketObject{BucketName: bucket, Key: key, VersionID: versionID}, headers)
+		})
+
+		// upload an object or a part of a multipart upload (uploadId and partNumber parameters) with a signed URL
+		// the signed constraints (contentType, contentLength, contentMD5, checksumSHA256) are checked
+		fsAPIV1.PUT("/:bucket/*key", func(c *gin.Context) {
+
+			var (
+				bucket   = c.Param("bucket")
+				key      = c.Param("key")
+				uploadID = c.Query("uploadId")
+				object   = backend.BucketObject{BucketName: bucket, Key: key}
+			)
+
+			if err := fsBackend.VerifySignedURL(http.MethodPut, c.Request.URL); err != nil {
+				c.JSON(http.StatusForbidden, gin.H{"error": signatureErrorMessage(err)})
+				return
+			}
+
+			if routerConfig.MaxUploadSize > 0 && c.Request.ContentLength > routerConfig.MaxUploadSize {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Body too large, max. size is %d bytes", routerConfig.MaxUploadSize)})
+				return
+			}
+
+			body := &maxSizeReader{reader: c.Request.Body, limit: routerConfig.MaxUploadSize}
+
+			var (
+				etag string
+				err  error
+			)
+
+			if uploadID != "" {
+				partNumber, parseErr := parsePartNumber(c.Query("partNumber"))
+				if parseErr != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": parseErr.Error()})
+					return
+				}
+
+				etag, err = fsBackend.UploadPart(object, uploadID, partNumber, body)
+			} else {
+				// the constraints are signed in the query
+				constraints, parseErr := parseUploadConstraints(c)
+				if parseErr != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": parseErr.Error()})
+					return
+				}
+
+				contentType := c.GetHeader("Content-Type")
+				if constraints.ContentType != "" && contentType != constraints.ContentType {
+					c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("Content-Type %q does not match the signed content type %q", contentType, constraints.ContentType)})
+					return
+				}
+
+				etag, err = fsBackend.UploadObject(object, body, backend.PutOptions{ContentType: contentType, Metadata: constraints.Metadata}, constraints)
+			}
+
+			if err != nil {
+				if body.exceeded {
+					c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Body too large, max. size is %d bytes", routerConfig.MaxUploadSize)})
+					return
+				}
+
+				status, msg := objectErrorStatus(err, bucket, key, fmt.Sprintf("Failed to upload object : bucket=%q, key=%q", bucket, key))
+
+				if err, ok := err.(awserr.Error); ok {
+					switch err.Code() {
+					case "IncompleteBody", "BadDigest":
+						status, msg = http.StatusBadRequest, err.Message()
+					case s3.ErrCodeNoSuchUpload:
+						status, msg = http.StatusNotFound, fmt.Sprintf("No such upload : %q", uploadID)
+					}
+				}
+
+				if status == http.StatusInternalServerError {
+					log.Errorf("Failed to upload object %s in bucket %s: %v", key, bucket, err)
+				}
+
+				c.JSON(status, gin.H{"error": msg})
+
+				return
+			}
+
+			c.Header("ETag", etag)
+			c.JSON(http.StatusOK, gin.H{"etag": etag})
+		})
+	}
+
+	listAPIV1 := engine.Group("/api/v1/list")
+
+	// list the objects of a bucket, one page at a time
+	listAPIV1.GET("/:bucket", func(c *gin.Context) {
+
+		bucket := c.Param("bucket")
+
+		options, err := parseListOptions(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		listing, err := s3Backend.ListObjects(bucket, options)
+
+		if err != nil {
+			log.Errorf("Failed to list objects in bucket %s with prefix %q: %v", bucket, options.Prefix, err)
+			status, msg := listErrorStatus(err, bucket, options, fmt.Sprintf("Failed to list objects : bucket=%q, prefix=%q", bucket, options.Prefix))
+			c.JSON(status, gin.H{"error": msg})
+			return
+		}
+
+		c.JSON(http.StatusOK, listing)
+	})
+
+	versionsAPIV1 := engine.Group("/api/v1/versions")
+
+	// list the versions of the objects of a bucket, one page at a time
+	versionsAPIV1.GET("/:bucket", func(c *gin.Context) {
+
+		bucket := c.Param("bucket")
+
+		options, err := parseListOptions(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		listing, err := s3Backend.ListObjectVersions(bucket, options)
+
+		if err != nil {
+			log.Errorf("Failed to list object versions in bucket %s with prefix %q: %v", bucket, options.Prefix, err)
+			status, msg := listErrorStatus(err, bucket, options, fmt.Sprintf("Failed to list object versions : bucket=%q, prefix=%q", bucket, options.Prefix))
+			c.JSON(status, gin.H{"error": msg})
+			return
+		}
+
+		c.JSON(http.StatusOK, listing)
+	})
+
+	multipartAPIV1 := engine.Group("/api/v1/multipart")
+
+	// initiate a multipart upload
+	multipartAPIV1.POST("/create/:bucket/*key", func(c *gin.Context) {
+
+		var (
+			bucket = c.Param("bucket")
+			key    = c.Param("key")
+		)
+
+		encryption, err := parseEncryption(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		storageClass, err := parseStorageClass(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		uploadID, err := s3Backend.CreateMultipartUpload(backend.BucketObject{BucketName: bucket, Key: key, Encryption: encryption, StorageClass: storageClass})
+
+		if err != nil {
+			log.Errorf("Failed to create multipart upload for object %s in bucket %s: %v", key, bucket, err)
+			status, msg := multipartErrorStatus(err, bucket, "", fmt.Sprintf("Failed to create multipart upload : bucket=%q, key=%q", bucket, key))
+			c.JSON(status, gin.H{"error": msg})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"uploadId": uploadID})
+	})
+
+	// create presigned urls for the upload of the parts of a multipart upload
+	multipartAPIV1.POST("/url/:bucket/*key", func(c *gin.Context) {
+
+		var (
+			bucket      = c.Param("bucket")
+			key         = c.Param("key")
+			uploadID    = c.Query("uploadId")
+			partNumbers = c.QueryArray("partNumber")
+			expiration  = c.Query("expiration")
+		)
+
+		if uploadID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Missing uploadId"})
+			return
+		}
+
+		if len(partNumbers) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Missing partNumber"})
+			return
+		}
+
+		urlExpiration, err := parseExpiration(expiration, urlExpiration)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse Duration " + expiration})
+			return
+		}
+
+		encryption, err := parseEncryption(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		urls := make(map[string]string, len(partNumbers))
+		headers := make(map[string]map[string]string, len(partNumbers))
+
+		for _, partNumber := range partNumbers {
+			number, err := parsePartNumber(partNumber)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid partNumber " + partNumber})
+				return
+			}
+
+			presignedURL, err := s3Backend.CreatePresignedURLForUploadPart(backend.BucketObject{BucketName: bucket, Key: key, Encryption: encryption}, uploadID, number, urlExpiration)
+			if msg, ok := invalidEncryption(err); ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+				return
+			}
+			if err != nil {
+				log.Errorf("Failed to create presigned UploadPart URL for %s %s part %d: %v", key, bucket, number, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create UploadPart URL for " + key})
+				return
+			}
+
+			urls[strconv.FormatInt(number, 10)] = presignedURL.URL
+			headers[strconv.FormatInt(number, 10)] = presignedURL.Headers
+		}
+
+		c.JSON(http.StatusOK, gin.H{"urls": urls, "headers": headers})
+	})
+
+	type CompleteMultipartForm struct {
+		Parts []backend.CompletedPart `json:"parts" binding:"required"`
+	}
+
+	// complete a multipart upload with the list of uploaded parts
+	multipartAPIV1.POST("/complete/:bucket/*key", func(c *gin.Context) {
+
+		var (
+			bucket   = c.Param("bucket")
+			key      = c.Param("key")
+			uploadID = c.Query("uploadId")
+		)
+
+		if uploadID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Missing uploadId"})
+			return
+		}
+
+		var body CompleteMultipartForm
+		if err := c.ShouldBindJSON(&body); err != nil {
+			log.Errorf("Failed to parse body %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse body " + err.Error()})
+			return
+		}
+
+		if len(body.Parts) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Missing parts"})
+			return
+		}
+
+		for _, part := range body.Parts {
+			if part.PartNumber < 1 || part.PartNumber > maxPartNumber || part.ETag == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid part : partNumber=%d, etag=%q", part.PartNumber, part.ETag)})
+				return
+			}
+		}
+
+		// S3 requires the parts in ascending order
+		sort.Slice(body.Parts, func(i, j int) bool {
+			return body.Parts[i].PartNumber < body.Parts[j].PartNumber
+		})
+
+		err := s3Backend.CompleteMultipartUpload(backend.BucketObject{BucketName: bucket, Key: key}, uploadID, body.Parts)
+
+		if err != nil {
+			log.Errorf("Failed to complete multipart upload %s for object %s in bucket %s: %v", uploadID, key, bucket, err)
+			status, msg := multipartErrorStatus(err, bucket, uploadID, fmt.Sprintf("Failed to complete multipart upload : bucket=%q, key=%q", bucket, key))
+			c.JSON(status, gin.H{"error": msg})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"response": "ok"})
+	})
+
+	// abort a multipart upload
+	multipartAPIV1.DELETE("/:bucket/*key", func(c *gin.Context) {
+
+		var (
+			bucket   = c.Param("bucket")
+			key      = c.Param("key")
+			uploadID = c.Query("uploadId")
+		)
+
+		if uploadID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Missing uploadId"})
+			return
+		}
+
+		err := s3Backend.AbortMultipartUpload(backend.BucketObject{BucketName: bucket, Key: key}, uploadID)
+
+		if err != nil {
+			log.Errorf("Failed to abort multipart upload %s for object %s in bucket %s: %v", uploadID, key, bucket, err)
+			status, msg := multipartErrorStatus(err, bucket, uploadID, fmt.Sprintf("Failed to abort multipart upload : bucket=%q, key=%q", bucket, key))
+			c.JSON(status, gin.H{"error": msg})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"response": "ok"})
+	})
+
+	if replication := routerConfig.Replication; replication != nil {
+
+		// state of the replication on the secondary backend : queued operations, lag and failures
+		engine.GET("/api/v1/replication/status", func(c *gin.Context) {
+			c.JSON(http.StatusOK, replication.Status())
+		})
+	}
+
+	return engine
+}
+
+// prefix of the headers forwarded as user metadata on a streamed upload
+const metadataHeaderPrefix = "x-amz-meta-"
+
+var errBodyTooLarge = errors.New("body too large")
+
+// Reader failing when more than limit bytes are read (no limit when 0)
+type maxSizeReader struct {
+	reader   io.Reader
+	limit    int64
+	read     int64
+	exceeded bool
+}
+
+func (r *maxSizeReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.read += int64(n)
+
+	if r.limit > 0 && r.read > r.limit {
+		r.exceeded = true
+		return n, errBodyTooLarge
+	}
+
+	return n, err
+}
+
+// parse the prefix, delimiter, max-keys and continuation-token query parameters of a listing
+func parseListOptions(c *gin.Context) (backend.ListOptions, error) {
+	options := backend.ListOptions{
+		Prefix:            c.Query("prefix"),
+		Delimiter:         c.Query("delimiter"),
+		ContinuationToken: c.Query("continuation-token"),
+	}
+
+	if maxKeys := c.Query("max-keys"); maxKeys != "" {
+		value, err := strconv.ParseInt(maxKeys, 10, 64)
+		if err != nil || value <= 0 {
+			return options, errors.New("Invalid max-keys " + maxKeys)
+		}
+		options.MaxKeys = value
+	}
+
+	return options, nil
+}
+
+// map the error of a listing to an http status and a message
+func listErrorStatus(err error, bucket string, options backend.ListOptions, fallback string) (int, string) {
+	if err, ok := err.(awserr.Error); ok {
+		switch err.Code() {
+		case s3.ErrCodeNoSuchBucket:
+			return http.StatusNotFound, fmt.Sprintf("No such bucket : %q", bucket)
+		case "InvalidArgument":
+			return http.StatusBadRequest, fmt.Sprintf("Invalid continuation-token : %q", options.ContinuationToken)
+		}
+	}
+
+	return http.StatusInternalServerError, fallback
+}
+
+// stream the content of an object, the range and conditional headers of the request are forwarded to the backend
+// the zero values of overrides are ignored
+func serveObject(c *gin.Context, s3Backend backend.Backend, object backend.BucketObject, overrides backend.ResponseHeaders) {
+
+	var (
+		bucket = object.BucketName
+		key    = object.Key
+	)
+
+	options := backend.GetOptions{
+		Range:       c.GetHeader("Range"),
+		IfNoneMatch: c.GetHeader("If-None-Match"),
+	}
+
+	if ifModifiedSince := c.GetHeader("If-Modified-Since"); ifModifiedSince != "" {
+		// an invalid date is ignored as specified by RFC 7232
+		if date, err := http.ParseTime(ifModifiedSince); err == nil {
+			options.IfModifiedSince = date
+		}
+	}
+
+	content, err := s3Backend.GetObject(object, options)
+
+	if err != nil {
+		status, msg := http.StatusInternalServerError, fmt.Sprintf("Failed to get object : bucket=%q, key=%q", bucket, key)
+
+		if err, ok := err.(awserr.Error); ok {
+			switch err.Code() {
+			case "NotModified":
+				c.Status(http.StatusNotModified)
+				return
+			case s3.ErrCodeNoSuchBucket:
+				status, msg = http.StatusNotFound, fmt.Sprintf("No such bucket : %q", bucket)
+			case s3.ErrCodeNoSuchKey:
+				status, msg = http.StatusNotFound, fmt.Sprintf("No such key : %q", key)
+			case errCodeNoSuchVersion:
+				status, msg = http.StatusNotFound, fmt.Sprintf("No such version of key : %q", key)
+			case "InvalidRange":
+				status, msg = http.StatusRequestedRangeNotSatisfiable, fmt.Sprintf("Invalid range : %q", options.Range)
+			case backend.ErrCodeInvalidEncryption:
+				status, msg = http.StatusBadRequest, err.Message()
+			}
+		}
+
+		if status == http.StatusInternalServerError {
+			log.Errorf("Failed to get object %s in bucket %s: %v", key, bucket, err)
+		}
+
+		c.JSON(status, gin.H{"error": msg})
+
+		return
+	}
+
+	defer func() {
+		if err := content.Body.Close(); err != nil {
+			log.Errorf("Failed to close object %s in bucket %s: %v", key, bucket, err)
+		}
+	}()
+
+	status := http.StatusOK
+	headers := map[string]string{
+		"Accept-Ranges": "bytes",
+		"ETag":          content.ETag,
+		"Last-Modified": content.LastModified.UTC().Format(http.TimeFormat),
+	}
+
+	if content.ContentRange != "" {
+		status = http.StatusPartialContent
+		headers["Content-Range"] = content.ContentRange
+	}
+
+	contentType := content.ContentType
+	if overrides.ContentType != "" {
+		contentType = overrides.ContentType
+	}
+
+	for name, value := range map[string]string{
+		"Content-Disposition": overrides.ContentDisposition,
+		"Cache-Control":       overrides.CacheControl,
+		"Content-Language":    overrides.ContentLanguage,
+	} {
+		if value != "" {
+			headers[name] = value
+		}
+	}
+
+	c.DataFromReader(status, content.Size, contentType, content.Body, headers)
+}
+
+// error code returned by S3 for an unknown version id, not defined in the s3 package
+const errCodeNoSuchVersion = "NoSuchVersion"
+
+// map the error of an operation on an object to an http status and a message
+func objectErrorStatus(err error, bucket string, key string, fallback string) (int, string) {
+	if err, ok := err.(awserr.Error); ok {
+		switch err.Code() {
+		case s3.ErrCodeNoSuchBucket:
+			return http.StatusNotFound, fmt.Sprintf("No such bucket : %q", bucket)
+		case s3.ErrCodeNoSuchKey:
+			return http.StatusNotFound, fmt.Sprintf("No such key : %q", key)
+		case errCodeNoSuchVersion:
+			return http.StatusNotFound, fmt.Sprintf("No such version of key : %q", key)
+		case backend.ErrCodeInvalidEncryption:
+			return http.StatusBadRequest, err.Message()
+		}
+	}
+
+	return http.StatusInternalServerError, fallback
+}
+
+// map the error of an Object Lock operation to an http status and a message
+// S3 returns InvalidRequest when Object Lock is not enabled on the bucket and AccessDenied when the retention can not be changed
+func objectLockErrorStatus(err error, bucket string, key string, fallback string) (int, string) {
+	if err, ok := err.(awserr.Error); ok {
+		switch err.Code() {
+		case "InvalidRequest":
+			return http.StatusBadRequest, err.Message()
+		case "AccessDenied":
+			return http.StatusForbidden, fmt.Sprintf("Access denied : bucket=%q, key=%q, %s", bucket, key, err.Message())
+		}
+	}
+
+	return objectErrorStatus(err, bucket, key, fallback)
+}
+
+// message of a rejected signed URL of the filesystem backend, the message of the other errors is not returned to the client
+func signatureErrorMessage(err error) string {
+	if err, ok := err.(awserr.Error); ok {
+		return err.Message()
+	}
+	return "Invalid signed URL"
+}
+
+// check if the error is a locked objects error of the backend and returns the locked keys
+func lockedKeys(err error) ([]string, bool) {
+	if err, ok := err.(*backend.LockedObjectsError); ok {
+		return err.Keys, true
+	}
+	return nil, false
+}
+
+// check the mode and the date of a retention, both are required except to remove the retention
+func validateRetention(retention backend.ObjectRetention) error {
+	switch retention.Mode {
+	case "":
+		if retention.RetainUntilDate != nil {
+			return errors.New("missing mode")
+		}
+		return nil
+	case backend.ObjectLockModeGovernance, backend.ObjectLockModeCompliance:
+	default:
+		return fmt.Errorf("mode %s, must be %s or %s", retention.Mode, backend.ObjectLockModeGovernance, backend.ObjectLockModeCompliance)
+	}
+
+	if retention.RetainUntilDate == nil {
+		return errors.New("missing retainUntilDate")
+	}
+
+	if !retention.RetainUntilDate.After(time.Now()) {
+		return errors.New("retainUntilDate must be in the future")
+	}
+
+	return nil
+}
+
+// map the error of a copy operation to an http status and a message
+func copyErrorStatus(err error, sourceBucket string, sourceKey string, destinationBucket string) (int, string) {
+	if err, ok := err.(awserr.Error); ok {
+		switch err.Code() {
+		case s3.ErrCodeNoSuchBucket:
+			return http.StatusNotFound, fmt.Sprintf("No such bucket : %q or %q", sourceBucket, destinationBucket)
+		case s3.ErrCodeNoSuchKey:
+			return http.StatusNotFound, fmt.Sprintf("No such key : %q", sourceKey)
+		case errCodeNoSuchVersion:
+			return http.StatusNotFound, fmt.Sprintf("No such version of key : %q", sourceKey)
+		case backend.ErrCodeInvalidEncryption:
+			return http.StatusBadRequest, err.Message()
+		}
+	}
+
+	return http.StatusInternalServerError, fmt.Sprintf("Failed to copy object : sourceBucket=%q, sourceKey=%q", sourceBucket, sourceKey)
+}
+
+// S3 limits of the object tags
+const (
+	maxTagCount       = 10
+	maxTagKeyLength   = 128
+	maxTagValueLength = 256
+)
+
+func validateTags(tags map[string]string) error {
+	if len(tags) > maxTagCount {
+		return fmt.Errorf("too many tags %d, max. is %d", len(tags), maxTagCount)
+	}
+
+	for key, value := range tags {
+		if key == "" || utf8.RuneCountInString(key) > maxTagKeyLength {
+			return fmt.Errorf("invalid tag key %q, length must be between 1 and %d", key, maxTagKeyLength)
+		}
+		if strings.HasPrefix(key, "aws:") {
+			return fmt.Errorf("invalid tag key %q, prefix aws: is reserved", key)
+		}
+		if utf8.RuneCountInString(value) > maxTagValueLength {
+			return fmt.Errorf("invalid tag value for key %q, max. length is %d", key, maxTagValueLength)
+		}
+	}
+
+	return nil
+}
+
+// maximum part number of a multipart upload allowed by S3
+const maxPartNumber = 10000
+
+func parsePartNumber(s string) (int64, error) {
+	number, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	if number < 1 || number > maxPartNumber {
+		return 0, fmt.Errorf("part number %d out of range [1, %d]", number, maxPartNumber)
+	}
+
+	return number, nil
+}
+
+// map the error of a multipart upload operation to an http status and a message
+func multipartErrorStatus(err error, bucket string, uploadID string, fallback string) (int, string) {
+	if err, ok := err.(awserr.Error); ok {
+		switch err.Code() {
+		case s3.ErrCodeNoSuchBucket:
+			return http.StatusNotFound, fmt.Sprintf("No such bucket : %q", bucket)
+		case s3.ErrCodeNoSuchUpload:
+			return http.StatusNotFound, fmt.Sprintf("No such upload : %q", uploadID)
+		case "InvalidPart", "InvalidPartOrder", "EntityTooSmall", backend.ErrCodeInvalidEncryption:
+			return http.StatusBadRequest, err.Message()
+		}
+	}
+
+	return http.StatusInternalServerError, fallback
+}
+
+// parse the storageClass query parameter, empty for the default storage class
+func parseStorageClass(c *gin.Context) (string, error) {
+	storageClass := c.Query("storageClass")
+
+	if storageClass != "" && !slices.Contains(s3.StorageClass_Values(), storageClass) {
+		return "", errors.New("Invalid storageClass " + storageClass + ", must be one of " + strings.Join(s3.StorageClass_Values(), ", "))
+	}
+
+	return storageClass, nil
 }
 
 func parseExpiration(s string, fallback time.Duration) (time.Duration, error) {
@@ -44,6 +44,42 @@ func initViper() {
 	die(viper.BindPFlag("use-minio", pflag.Lookup("use-minio")))
 	viper.SetDefault("use-minio", "")
 
+	pflag.StringP("use-filesystem", "f", "", "Use a local directory as backend by specifying its path, each bucket is a sub-directory (ex. /tmp/s3proxy)")
+	die(viper.BindPFlag("use-filesystem", pflag.Lookup("use-filesystem")))
+	viper.SetDefault("use-filesystem", "")
+
+	pflag.String("filesystem-url", "", "URL of s3proxy used in the URLs signed for the filesystem backend (default http://localhost:<http-port>)")
+	die(viper.BindPFlag("filesystem-url", pflag.Lookup("filesystem-url")))
+	viper.SetDefault("filesystem-url", "")
+
+	pflag.String("filesystem-signing-key", "", "Secret key of the URLs signed for the filesystem backend (default random key, the URLs are invalidated by a restart)")
+	die(viper.BindPFlag("filesystem-signing-key", pflag.Lookup("filesystem-signing-key")))
+	viper.SetDefault("filesystem-signing-key", "")
+
+	pflag.String("use-azure", "", "Use Azure Blob Storage as backend by specifying the Blob service URL (ex. https://myaccount.blob.core.windows.net or http://127.0.0.1:10000/devstoreaccount1 for Azurite)")
+	die(viper.BindPFlag("use-azure", pflag.Lookup("use-azure")))
+	viper.SetDefault("use-azure", "")
+
+	pflag.String("azure-account-name", "", "Name of the Azure storage account")
+	die(viper.BindPFlag("azure-account-name", pflag.Lookup("azure-account-name")))
+	viper.SetDefault("azure-account-name", "")
+
+	pflag.String("azure-account-key", "", "Base64 encoded key of the Azure storage account")
+	die(viper.BindPFlag("azure-account-key", pflag.Lookup("azure-account-key")))
+	viper.SetDefault("azure-account-key", "")
+
+	pflag.Duration("azure-copy-timeout", 5*time.Minute, "Max. duration of a copy on Azure, a copy still pending after it is aborted")
+	die(viper.BindPFlag("azure-copy-timeout", pflag.Lookup("azure-copy-timeout")))
+	viper.SetDefault("azure-copy-timeout", 5*time.Minute)
+
+	pflag.String("use-gcs", "", "Use Google Cloud Storage as backend by specifying the path of the JSON key file of a service account (ex. /etc/s3proxy/service-account.json)")
+	die(viper.BindPFlag("use-gcs", pflag.Lookup("use-gcs")))
+	viper.SetDefault("use-gcs", "")
+
+	pflag.String("gcs-endpoint", "", "URL of the Cloud Storage API (default https://storage.googleapis.com)")
+	die(viper.BindPFlag("gcs-endpoint", pflag.Lookup("gcs-endpoint")))
+	viper.SetDefault("gcs-endpoint", "")
+
 	pflag.StringP("minio-access-key", "a", "", "Minion AccessKey equivalent to a AWS_ACCESS_KEY_ID")
 	die(viper.BindPFlag("minio-access-key", pflag.Lookup("minio-access-key")))
 	viper.SetDefault("minio-access-key", "")
@@ -52,6 +88,78 @@ func initViper() {
 	die(viper.BindPFlag("minio-secret-key", pflag.Lookup("minio-secret-key")))
 	viper.SetDefault("minio-secret-key", "")
 
+	pflag.Bool("enable-streaming", false, "Stream the objects through s3proxy for clients which cannot reach the backend")
+	die(viper.BindPFlag("enable-streaming", pflag.Lookup("enable-streaming")))
+	viper.SetDefault("enable-streaming", false)
+
+	pflag.Int64("streaming-max-upload-size", 5*1024*1024*1024, "Maximum size in bytes of an upload streamed through s3proxy, 0 for no limit")
+	die(viper.BindPFlag("streaming-max-upload-size", pflag.Lookup("streaming-max-upload-size")))
+	viper.SetDefault("streaming-max-upload-size", 5*1024*1024*1024)
+
+	pflag.Int64("streaming-part-size", 16*1024*1024, "Uploads streamed through s3proxy larger than this size in bytes are sent with a multipart upload in parts of this size, min. 5MB on S3")
+	die(viper.BindPFlag("streaming-part-size", pflag.Lookup("streaming-part-size")))
+	viper.SetDefault("streaming-part-size", 16*1024*1024)
+
+	pflag.String("bucket-routes", "", "Backend of the buckets by bucket name or wildcard pattern, the other buckets use the backend selected by the --use-* options (ex. media=minio,archive-*=aws)")
+	die(viper.BindPFlag("bucket-routes", pflag.Lookup("bucket-routes")))
+	viper.SetDefault("bucket-routes", "")
+
+	pflag.String("bucket-aliases", "", "Physical bucket and optional key prefix of logical bucket names (ex. invoices=prod-invoices,reports=prod-documents/reports/)")
+	die(viper.BindPFlag("bucket-aliases", pflag.Lookup("bucket-aliases")))
+	viper.SetDefault("bucket-aliases", "")
+
+	pflag.Bool("strict-bucket-aliases", false, "Reject the buckets without alias instead of using them as physical buckets")
+	die(viper.BindPFlag("strict-bucket-aliases", pflag.Lookup("strict-bucket-aliases")))
+	viper.SetDefault("strict-bucket-aliases", false)
+
+	pflag.String("replication-backend", "", "Replicate the deletes and the copies on a secondary backend : aws, minio, filesystem, azure or gcs configured by its usual options")
+	die(viper.BindPFlag("replication-backend", pflag.Lookup("replication-backend")))
+	viper.SetDefault("replication-backend", "")
+
+	pflag.String("replication-aws-region", "", "Region of the secondary backend when it is AWS (ex. eu-central-1), allows to replicate from an AWS region to another")
+	die(viper.BindPFlag("replication-aws-region", pflag.Lookup("replication-aws-region")))
+	viper.SetDefault("replication-aws-region", "")
+
+	pflag.String("replication-mode", backend.ReplicationSync, "Replicate before answering (sync) or in background (async)")
+	die(viper.BindPFlag("replication-mode", pflag.Lookup("replication-mode")))
+	viper.SetDefault("replication-mode", backend.ReplicationSync)
+
+	pflag.String("replication-queue-dir", "", "Directory of the queue of the operations not yet replicated on the secondary backend (ex. /var/lib/s3proxy/replication)")
+	die(viper.BindPFlag("replication-queue-dir", pflag.Lookup("replication-queue-dir")))
+	viper.SetDefault("replication-queue-dir", "")
+
+	pflag.Duration("replication-retry-interval", 30*time.Second, "Interval between two retries of the failed replications")
+	die(viper.BindPFlag("replication-retry-interval", pflag.Lookup("replication-retry-interval")))
+	viper.SetDefault("replication-retry-interval", 30*time.Second)
+
+	pflag.Int("replication-max-attempts", 120, "Number of attempts of a failing replication before it is moved to the dead letters of the queue directory")
+	die(viper.BindPFlag("replication-max-attempts", pflag.Lookup("replication-max-attempts")))
+	viper.SetDefault("replication-max-attempts", 120)
+
+	pflag.String("failover-backend", "", "Issue the download URLs with a secondary backend while the primary backend is unhealthy : aws, minio, filesystem, azure or gcs configured by its usual options")
+	die(viper.BindPFlag("failover-backend", pflag.Lookup("failover-backend")))
+	viper.SetDefault("failover-backend", "")
+
+	pflag.String("failover-aws-region", "", "Region of the failover backend when it is AWS (ex. eu-central-1)")
+	die(viper.BindPFlag("failover-aws-region", pflag.Lookup("failover-aws-region")))
+	viper.SetDefault("failover-aws-region", "")
+
+	pflag.String("failover-health-bucket", "", "Bucket of both backends listed by the health checks of the failover")
+	die(viper.BindPFlag("failover-health-bucket", pflag.Lookup("failover-health-bucket")))
+	viper.SetDefault("failover-health-bucket", "")
+
+	pflag.Duration("failover-health-interval", 10*time.Second, "Interval between two health checks of the failover backends")
+	die(viper.BindPFlag("failover-health-interval", pflag.Lookup("failover-health-interval")))
+	viper.SetDefault("failover-health-interval", 10*time.Second)
+
+	pflag.Bool("failover-check-object", false, "Check that the object exists before issuing its download URL, the URL of the other backend is issued when it is missing")
+	die(viper.BindPFlag("failover-check-object", pflag.Lookup("failover-check-object")))
+	viper.SetDefault("failover-check-object", false)
+
+	pflag.String("bucket-encryption", "", "Server-side encryption enforced per bucket (ex. mybucket=AES256,secure-bucket=aws:kms:<kms key id>,private-bucket=SSE-C)")
+	die(viper.BindPFlag("bucket-encryption", pflag.Lookup("bucket-encryption")))
+	viper.SetDefault("bucket-encryption", "")
+
 	pflag.Parse()
 
 	viper.SetEnvPrefix("s3proxy")
@@ -77,14 +185,247 @@ func logStartupInfo() {
 
 		return str
 	}
-	log.Infof("s3proxy version:%v port:%v rsyslog:%v minio:%v api-key:%v", version,
+	log.Infof("s3proxy version:%v port:%v rsyslog:%v minio:%v filesystem:%v azure:%v gcs:%v api-key:%v streaming:%v bucket-encryption:%v bucket-routes:%v bucket-aliases:%v strict-bucket-aliases:%v replication:%v failover:%v", version,
 		viper.GetInt("http-port"),
 		formatFlag(viper.GetString("use-rsyslog"), false),
 		formatFlag(viper.GetString("use-minio"), false),
+		formatFlag(viper.GetString("use-filesystem"), false),
+		formatFlag(viper.GetString("use-azure"), false),
+		formatFlag(viper.GetString("use-gcs"), false),
 		formatFlag(viper.GetString("api-key"), true),
+		viper.GetBool("enable-streaming"),
+		formatFlag(viper.GetString("bucket-encryption"), false),
+		formatFlag(viper.GetString("bucket-routes"), false),
+		formatFlag(viper.GetString("bucket-aliases"), false),
+		viper.GetBool("strict-bucket-aliases"),
+		formatFlag(viper.GetString("replication-backend"), false),
+		formatFlag(viper.GetString("failover-backend"), false),
 	)
 }
 
+// names of the backends of the bucket routes
+const (
+	backendAWS        = "aws"
+	backendMinio      = "minio"
+	backendFilesystem = "filesystem"
+	backendAzure      = "azure"
+	backendGCS        = "gcs"
+)
+
+// name of the backend selected by the command line options, AWS when no other backend is configured
+func defaultBackendName() string {
+	switch {
+	case viper.GetString("use-filesystem") != "":
+		return backendFilesystem
+	case viper.GetString("use-azure") != "":
+		return backendAzure
+	case viper.GetString("use-gcs") != "":
+		return backendGCS
+	case viper.GetString("use-minio") != "":
+		return backendMinio
+	default:
+		return backendAWS
+	}
+}
+
+// backends configured by the command line options by name, a backend used by several wrappers (ex: the secondary backend
+// of the replication and of the failover) is created once
+type namedBackends map[string]backend.Backend
+
+// Returns the backend of the name, created by the first call
+func (backends namedBackends) get(name string, bucketEncryption map[string]backend.Encryption) (backend.Backend, error) {
+	if s3Backend, ok := backends[name]; ok {
+		return s3Backend, nil
+	}
+
+	s3Backend, err := newBackend(name, bucketEncryption)
+	if err != nil {
+		return nil, err
+	}
+	backends[name] = s3Backend
+
+	return s3Backend, nil
+}
+
+// Create a backend configured by the command line options, the bucket encryption is only supported by the AWS and Minio backends
+func newBackend(name string, bucketEncryption map[string]backend.Encryption) (backend.Backend, error) {
+	switch name {
+	case backendFilesystem:
+		if viper.GetString("use-filesystem") == "" {
+			return nil, fmt.Errorf("the filesystem backend requires --use-filesystem")
+		}
+		if len(bucketEncryption) > 0 {
+			return nil, fmt.Errorf("bucket encryption is not supported by the filesystem backend")
+		}
+
+		baseURL := viper.GetString("filesystem-url")
+		if baseURL == "" {
+			baseURL = fmt.Sprintf("http://localhost:%d", viper.GetInt("http-port"))
+		}
+
+		fsBackendConfig := backend.FSBackendConfig{
+			Root:       viper.GetString("use-filesystem"),
+			BaseURL:    baseURL,
+			SigningKey: []byte(viper.GetString("filesystem-signing-key")),
+		}
+
+		return backend.NewFSBackend(fsBackendConfig)
+
+	case backendAzure:
+		if viper.GetString("use-azure") == "" {
+			return nil, fmt.Errorf("the azure backend requires --use-azure")
+		}
+		if len(bucketEncryption) > 0 {
+			return nil, fmt.Errorf("bucket encryption is not supported by the Azure backend")
+		}
+
+		azureBackendConfig := backend.AzureBackendConfig{
+			Endpoint:    viper.GetString("use-azure"),
+			AccountName: viper.GetString("azure-account-name"),
+			AccountKey:  viper.GetString("azure-account-key"),
+			CopyTimeout: viper.GetDuration("azure-copy-timeout"),
+		}
+
+		return backend.NewAzureBackend(azureBackendConfig)
+
+	case backendGCS:
+		if viper.GetString("use-gcs") == "" {
+			return nil, fmt.Errorf("the gcs backend requires --use-gcs")
+		}
+		if len(bucketEncryption) > 0 {
+			return nil, fmt.Errorf("bucket encryption is not supported by the GCS backend")
+		}
+
+		gcsBackendConfig := backend.GCSBackendConfig{
+			Endpoint:        viper.GetString("gcs-endpoint"),
+			CredentialsFile: viper.GetString("use-gcs"),
+		}
+
+		return backend.NewGCSBackend(gcsBackendConfig)
+
+	case backendMinio:
+		if viper.GetString("use-minio") == "" {
+			return nil, fmt.Errorf("the minio backend requires --use-minio")
+		}
+
+		minioBackendConfig := backend.S3BackendConfig{
+			Host:             viper.GetString("use-minio"),
+			AccessKey:        viper.GetString("minio-access-key"),
+			SecretKey:        viper.GetString("minio-secret-key"),
+			DisableSSL:       true, // For minio : True
+			S3ForcePathStyle: true, // Form minio : True
+			BucketEncryption: bucketEncryption,
+		}
+
+		return backend.NewS3Backend(minioBackendConfig)
+
+	case backendAWS:
+		if len(bucketEncryption) > 0 {
+			return backend.NewS3Backend(backend.S3BackendConfig{BucketEncryption: bucketEncryption})
+		}
+		return backend.NewS3Backend()
+
+	default:
+		return nil, fmt.Errorf("unknown backend %s, must be %s, %s, %s, %s or %s", name, backendAWS, backendMinio, backendFilesystem, backendAzure, backendGCS)
+	}
+}
+
+// Create a routing backend with the backends named by the bucket routes, the buckets matching no route use the default backend
+// the bucket encryption is given to the AWS and Minio backends and must not concern a bucket of another backend
+func newRoutingBackend(bucketRoutes map[string]string, bucketEncryption map[string]backend.Encryption, backends namedBackends) (backend.Backend, error) {
+	routingBackendConfig := backend.RoutingBackendConfig{
+		Backends:       make(map[string]backend.Backend),
+		Routes:         bucketRoutes,
+		DefaultBackend: defaultBackendName(),
+	}
+
+	names := []string{routingBackendConfig.DefaultBackend}
+	for _, name := range bucketRoutes {
+		names = append(names, name)
+	}
+
+	for _, name := range names {
+		if _, ok := routingBackendConfig.Backends[name]; ok {
+			continue
+		}
+
+		encryption := bucketEncryption
+		if name != backendAWS && name != backendMinio {
+			encryption = nil
+		}
+
+		s3Backend, err := backends.get(name, encryption)
+		if err != nil {
+			return nil, err
+		}
+		routingBackendConfig.Backends[name] = s3Backend
+	}
+
+	routingBackend, err := backend.NewRoutingBackend(routingBackendConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	for bucket := range bucketEncryption {
+		if name, _ := routingBackend.BackendName(bucket); name != backendAWS && name != backendMinio {
+			return nil, fmt.Errorf("bucket encryption is not supported by the %s backend of the bucket %s", name, bucket)
+		}
+	}
+
+	return routingBackend, nil
+}
+
+// Create a secondary backend configured by its usual options or an AWS backend in another region, it can not be a backend
+// of the primary backend (primaryNames). The bucket encryption is given to the secondary backend when it is AWS or Minio
+func newSecondaryBackend(name string, region string, primaryNames map[string]bool, bucketEncryption map[string]backend.Encryption, backends namedBackends) (backend.Backend, error) {
+	if name != backendAWS && name != backendMinio {
+		bucketEncryption = nil
+	}
+
+	switch {
+	case name == backendAWS && region != "":
+		return backend.NewS3Backend(backend.S3BackendConfig{Region: region, BucketEncryption: bucketEncryption})
+	case primaryNames[name]:
+		return nil, fmt.Errorf("the secondary backend %s is a backend of the primary backend", name)
+	default:
+		return backends.get(name, bucketEncryption)
+	}
+}
+
+// Create a replicating backend in front of the primary backend
+func newReplicatingBackend(primary backend.Backend, primaryNames map[string]bool, bucketEncryption map[string]backend.Encryption, backends namedBackends) (*backend.ReplicatingBackend, error) {
+	secondary, err := newSecondaryBackend(viper.GetString("replication-backend"), viper.GetString("replication-aws-region"), primaryNames, bucketEncryption, backends)
+	if err != nil {
+		return nil, err
+	}
+
+	return backend.NewReplicatingBackend(backend.ReplicatingBackendConfig{
+		Primary:       primary,
+		Secondary:     secondary,
+		Mode:          viper.GetString("replication-mode"),
+		QueueDir:      viper.GetString("replication-queue-dir"),
+		RetryInterval: viper.GetDuration("replication-retry-interval"),
+		MaxAttempts:   viper.GetInt("replication-max-attempts"),
+	})
+}
+
+// Create a failover backend in front of the primary backend, its presigned download URLs are issued by the secondary backend
+// while the primary backend is unhealthy
+func newFailoverBackend(primary backend.Backend, primaryNames map[string]bool, bucketEncryption map[string]backend.Encryption, backends namedBackends) (*backend.FailoverBackend, error) {
+	secondary, err := newSecondaryBackend(viper.GetString("failover-backend"), viper.GetString("failover-aws-region"), primaryNames, bucketEncryption, backends)
+	if err != nil {
+		return nil, err
+	}
+
+	return backend.NewFailoverBackend(backend.FailoverBackendConfig{
+		Primary:             primary,
+		Secondary:           secondary,
+		HealthCheckBucket:   viper.GetString("failover-health-bucket"),
+		HealthCheckInterval: viper.GetDuration("failover-health-interval"),
+		CheckObject:         viper.GetBool("failover-check-object"),
+	})
+}
+
 func main() {
 	initViper()
 
@@ -98,28 +439,75 @@ func main() {
 	addr := fmt.Sprintf(":%d", viper.GetInt("http-port")) // ":8080"
 	serverAPIKey := viper.GetString("api-key")
 
-	var s3Backend backend.Backend
-	var err error
+	bucketEncryption, err := backend.ParseBucketEncryption(viper.GetString("bucket-encryption"))
+	if err != nil {
+		log.Errorf("Invalid bucket encryption : %v ", err)
+		os.Exit(1)
+	}
 
-	if viper.GetString("use-minio") != "" {
-		minioBackendConfig := backend.S3BackendConfig{
-			Host:             viper.GetString("use-minio"),
-			AccessKey:        viper.GetString("minio-access-key"),
-			SecretKey:        viper.GetString("minio-secret-key"),
-			DisableSSL:       true, // For minio : True
-			S3ForcePathStyle: true, // Form minio : True
-		}
+	bucketRoutes, err := backend.ParseBucketRoutes(viper.GetString("bucket-routes"))
+	if err != nil {
+		log.Errorf("Invalid bucket routes : %v ", err)
+		os.Exit(1)
+	}
 
-		s3Backend, err = backend.NewS3Backend(minioBackendConfig)
+	bucketAliases, err := backend.ParseBucketAliases(viper.GetString("bucket-aliases"))
+	if err != nil {
+		log.Errorf("Invalid bucket aliases : %v ", err)
+		os.Exit(1)
+	}
+
+	routerConfig := router.Config{
+		EnableStreaming: viper.GetBool("enable-streaming"),
+		MaxUploadSize:   viper.GetInt64("streaming-max-upload-size"),
+		PartSize:        viper.GetInt64("streaming-part-size"),
+	}
+
+	var (
+		s3Backend backend.Backend
+		backends  = make(namedBackends)
+	)
+
+	if len(bucketRoutes) > 0 {
+		s3Backend, err = newRoutingBackend(bucketRoutes, bucketEncryption, backends)
 	} else {
-		s3Backend, err = backend.NewS3Backend()
+		s3Backend, err = backends.get(defaultBackendName(), bucketEncryption)
+	}
+
+	// the secondary backends can not be a backend of the primary backend
+	primaryNames := make(map[string]bool, len(backends))
+	for name := range backends {
+		primaryNames[name] = true
+	}
+
+	if err == nil && viper.GetString("replication-backend") != "" {
+		routerConfig.Replication, err = newReplicatingBackend(s3Backend, primaryNames, bucketEncryption, backends)
+		s3Backend = routerConfig.Replication
+	}
+
+	var failover *backend.FailoverBackend
+	if err == nil && viper.GetString("failover-backend") != "" {
+		failover, err = newFailoverBackend(s3Backend, primaryNames, bucketEncryption, backends)
+		s3Backend = failover
+	}
+
+	// the signed URLs of the filesystem backend are served by the router
+	if fsBackend, ok := backends[backendFilesystem].(*backend.FSBackend); ok {
+		routerConfig.FSBackend = fsBackend
+	}
+	if err == nil && (len(bucketAliases) > 0 || viper.GetBool("strict-bucket-aliases")) {
+		s3Backend, err = backend.NewAliasBackend(backend.AliasBackendConfig{
+			Backend: s3Backend,
+			Aliases: bucketAliases,
+			Strict:  viper.GetBool("strict-bucket-aliases"),
+		})
 	}
 	if err != nil {
 		log.Errorf("Failed to intialize S3Backend : %v ", err)
 		os.Exit(1)
 	}
 
-	router := router.NewGinEngine(gin.ReleaseMode, version, urlExpiration, serverAPIKey, s3Backend)
+	router := router.NewGinEngine(gin.ReleaseMode, version, urlExpiration, serverAPIKey, s3Backend, routerConfig)
 
 	router.RedirectTrailingSlash = false // return 404 when a <path> is not found instead redirecting to <path> + "/"
 
@@ -152,5 +540,12 @@ func main() {
 		log.Fatalf("Server Shutdown : %v", err)
 	}
 
+	if routerConfig.Replication != nil {
+		routerConfig.Replication.Close()
+	}
+	if failover != nil {
+		failover.Close()
+	}
+
 	log.Info("Server exiting")
 }
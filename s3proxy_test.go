@@ -1,12 +1,25 @@
 package main
 
 import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/gin-gonic/gin"
 	"github.com/mirakl/s3proxy/backend"
 	"github.com/mirakl/s3proxy/backend/backendtest"
@@ -21,12 +34,14 @@ var (
 
 	expiration     = 15 * time.Minute
 	dummyBucket    = "dummybucket"
+	kmsBucket      = "kmsbucket"
 	dummyFile      = "/dummyfolder/dummyfile"
 	s3proxyVersion = "9.9.9"
 	awsRegion      = "eu-west-1"
 	accessKey      = "123456"
 	secretKey      = "ABCDEFGH12345"
 	serverAPIKey   = "ABCD-123"
+	maxUploadSize  = int64(1024)
 )
 
 // Launch gin server with a fake backend implementation
@@ -34,15 +49,16 @@ func setup() {
 	var err error
 
 	s3backend, err = backendtest.NewS3FakeBackend(backend.S3BackendConfig{
-		Region:    awsRegion,
-		AccessKey: accessKey,
-		SecretKey: secretKey,
+		Region:           awsRegion,
+		AccessKey:        accessKey,
+		SecretKey:        secretKey,
+		BucketEncryption: map[string]backend.Encryption{kmsBucket: {Mode: backend.EncryptionSSEKMS, KMSKeyID: "kms-key"}},
 	})
 	if err != nil {
 		os.Exit(1)
 	}
 
-	r = router.NewGinEngine(gin.TestMode, s3proxyVersion, expiration, "", s3backend)
+	r = router.NewGinEngine(gin.TestMode, s3proxyVersion, expiration, "", s3backend, router.Config{EnableStreaming: true, MaxUploadSize: maxUploadSize})
 	r.RedirectTrailingSlash = false // return 404 when a <path> is not found instead redirecting to <path> + "/"
 }
 
@@ -83,6 +99,89 @@ func TestCreateUrlForUploadOK(t *testing.T) {
 	assert.Contains(t, url, "X-Amz-Expires=900")
 }
 
+// Generate a presigned url for an upload with signed constraints
+func TestCreateUrlForUploadWithConstraints(t *testing.T) {
+	params := url.Values{
+		"contentType":       {"application/pdf"},
+		"contentLength":     {"1024"},
+		"contentMD5":        {"1B2M2Y8AsgTpgAmY7PhCfg=="},
+		"checksumSHA256":    {"47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="},
+		"x-amz-meta-tenant": {"tenant1"},
+	}
+	w := s3proxytest.ServeCreatePresignedURLForUploadWithParams(t, r, dummyBucket, dummyFile, params, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	objmap := unmarshallJSON(t, w.Body.Bytes())
+	assert.Equal(t, map[string]interface{}{
+		"Content-Type":          "application/pdf",
+		"Content-Length":        "1024",
+		"Content-Md5":           "1B2M2Y8AsgTpgAmY7PhCfg==",
+		"X-Amz-Checksum-Sha256": "47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=",
+		"X-Amz-Meta-Tenant":     "tenant1",
+	}, objmap["headers"])
+
+	presignedURL, err := url.Parse(objmap["url"].(string))
+	assert.NoError(t, err)
+	assert.Equal(t, "content-length;content-md5;content-type;host;x-amz-checksum-sha256;x-amz-meta-tenant", presignedURL.Query().Get("X-Amz-SignedHeaders"))
+}
+
+func TestCreateUrlForUploadWithConstraints400BadRequest(t *testing.T) {
+	for _, params := range []url.Values{
+		{"contentType": {"application/"}},
+		{"contentLength": {"0"}},
+		{"contentMD5": {"not-md5"}},
+		{"checksumSHA256": {"1B2M2Y8AsgTpgAmY7PhCfg=="}},
+		{"x-amz-meta-": {"value"}},
+	} {
+		w := s3proxytest.ServeCreatePresignedURLForUploadWithParams(t, r, dummyBucket, dummyFile, params, "")
+		assert.Equal(t, http.StatusBadRequest, w.Code, params.Encode())
+	}
+}
+
+// Generate a presigned url for an upload with server-side encryption
+func TestCreateUrlForUploadWithEncryption(t *testing.T) {
+	// default encryption of the bucket
+	w := s3proxytest.ServeCreatePresignedURLForUpload(t, r, kmsBucket, dummyFile, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, map[string]interface{}{
+		"X-Amz-Server-Side-Encryption":                "aws:kms",
+		"X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id": "kms-key",
+	}, unmarshallJSON(t, w.Body.Bytes())["headers"])
+
+	w = s3proxytest.ServeCreatePresignedURLForUploadWithParams(t, r, dummyBucket, dummyFile, url.Values{"sse": {"AES256"}}, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, map[string]interface{}{"X-Amz-Server-Side-Encryption": "AES256"}, unmarshallJSON(t, w.Body.Bytes())["headers"])
+
+	// SSE-C, the client has to replay the key headers
+	customerKey := base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+	w = s3proxytest.ServeHTTPWithHeaders(t, r, http.MethodPost, "/api/v1/presigned/url/"+dummyBucket+dummyFile, map[string]string{"X-Amz-Server-Side-Encryption-Customer-Key": customerKey}, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	headers := unmarshallJSON(t, w.Body.Bytes())["headers"].(map[string]interface{})
+	assert.Equal(t, "AES256", headers["X-Amz-Server-Side-Encryption-Customer-Algorithm"])
+	assert.Equal(t, customerKey, headers["X-Amz-Server-Side-Encryption-Customer-Key"])
+	assert.NotEmpty(t, headers["X-Amz-Server-Side-Encryption-Customer-Key-Md5"])
+}
+
+func TestCreateUrlForUploadWithEncryption400BadRequest(t *testing.T) {
+	// the bucket enforces SSE-KMS
+	w := s3proxytest.ServeCreatePresignedURLForUploadWithParams(t, r, kmsBucket, dummyFile, url.Values{"sse": {"AES256"}}, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	for _, params := range []url.Values{
+		{"sse": {"DES"}},
+		{"sse": {"AES256"}, "sseKmsKeyId": {"kms-key"}},
+		{"sse": {"SSE-C"}},
+	} {
+		w = s3proxytest.ServeCreatePresignedURLForUploadWithParams(t, r, dummyBucket, dummyFile, params, "")
+		assert.Equal(t, http.StatusBadRequest, w.Code, params.Encode())
+	}
+
+	// SSE-C key too short
+	w = s3proxytest.ServeHTTPWithHeaders(t, r, http.MethodPost, "/api/v1/presigned/url/"+dummyBucket+dummyFile, map[string]string{"X-Amz-Server-Side-Encryption-Customer-Key": "c2hvcnQ="}, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
 // Generate a presigned url for a download
 func TestCreateUrlForDownloadOK(t *testing.T) {
 	w := s3proxytest.ServeCreatePresignedURLForDownload(t, r, dummyBucket, dummyFile, "")
@@ -96,6 +195,146 @@ func TestCreateUrlForDownloadOK(t *testing.T) {
 	assert.Contains(t, url, "X-Amz-Expires=900")
 }
 
+// Generate a presigned url for a download with response header overrides
+func TestCreateUrlForDownloadWithResponseHeaders(t *testing.T) {
+	params := url.Values{"filename": {"rapport été.pdf"}, "contentType": {"application/pdf"}, "cacheControl": {"no-cache"}, "contentLanguage": {"fr"}}
+	w := s3proxytest.ServeCreatePresignedURLForDownloadWithParams(t, r, dummyBucket, dummyFile, params, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	presignedURL, err := url.Parse(unmarshallJSON(t, w.Body.Bytes())["url"].(string))
+	assert.NoError(t, err)
+
+	query := presignedURL.Query()
+	assert.Equal(t, `attachment; filename="rapport _t_.pdf"; filename*=UTF-8''rapport%20%C3%A9t%C3%A9.pdf`, query.Get("response-content-disposition"))
+	assert.Equal(t, "application/pdf", query.Get("response-content-type"))
+	assert.Equal(t, "no-cache", query.Get("response-cache-control"))
+	assert.Equal(t, "fr", query.Get("response-content-language"))
+	assert.Contains(t, query.Get("X-Amz-SignedHeaders"), "host")
+
+	params = url.Values{"filename": {`report "2024".pdf`}, "disposition": {"inline"}}
+	w = s3proxytest.ServeCreatePresignedURLForDownloadWithParams(t, r, dummyBucket, dummyFile, params, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	presignedURL, err = url.Parse(unmarshallJSON(t, w.Body.Bytes())["url"].(string))
+	assert.NoError(t, err)
+	assert.Equal(t, `inline; filename="report _2024_.pdf"`, presignedURL.Query().Get("response-content-disposition"))
+}
+
+func TestCreateUrlForDownloadWithResponseHeaders400BadRequest(t *testing.T) {
+	w := s3proxytest.ServeCreatePresignedURLForDownloadWithParams(t, r, dummyBucket, dummyFile, url.Values{"disposition": {"download"}}, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = s3proxytest.ServeCreatePresignedURLForDownloadWithParams(t, r, dummyBucket, dummyFile, url.Values{"contentType": {"application/"}}, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+// An archived object can not be downloaded until it is restored
+func TestCreateUrlForDownloadArchived(t *testing.T) {
+	w := s3proxytest.ServeCreatePresignedURLForDownload(t, r, dummyBucket, "/archived", "")
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "GLACIER", unmarshallJSON(t, w.Body.Bytes())["storageClass"])
+
+	w = s3proxytest.ServeCreatePresignedURLForDownload(t, r, dummyBucket, "/restoring", "")
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = s3proxytest.ServeCreatePresignedURLForDownload(t, r, dummyBucket, "/restored", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+// Generate a presigned url for an upload in a storage class
+func TestCreateUrlForUploadWithStorageClass(t *testing.T) {
+	w := s3proxytest.ServeCreatePresignedURLForUploadWithParams(t, r, dummyBucket, dummyFile, url.Values{"storageClass": {"DEEP_ARCHIVE"}}, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, map[string]interface{}{"X-Amz-Storage-Class": "DEEP_ARCHIVE"}, unmarshallJSON(t, w.Body.Bytes())["headers"])
+
+	w = s3proxytest.ServeCreatePresignedURLForUploadWithParams(t, r, dummyBucket, dummyFile, url.Values{"storageClass": {"COLD"}}, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+// Generate a presigned post policy for a browser upload
+func TestCreatePresignedPostOK(t *testing.T) {
+	params := url.Values{"contentLengthMin": {"1"}, "contentLengthMax": {"1048576"}, "contentTypePrefix": {"image/"}, "expiration": {"1h"}}
+	w := s3proxytest.ServeCreatePresignedPost(t, r, dummyBucket, dummyFile, params, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	objmap := unmarshallJSON(t, w.Body.Bytes())
+	assert.Contains(t, objmap["url"], dummyBucket)
+
+	fields := objmap["fields"].(map[string]interface{})
+	assert.Equal(t, "dummyfolder/dummyfile", fields["key"])
+	assert.Equal(t, "AWS4-HMAC-SHA256", fields["X-Amz-Algorithm"])
+	assert.Contains(t, fields["X-Amz-Credential"], accessKey)
+	assert.Contains(t, fields["X-Amz-Credential"], awsRegion)
+	assert.NotEmpty(t, fields["X-Amz-Date"])
+	assert.Len(t, fields["X-Amz-Signature"], 64)
+
+	policy, err := base64.StdEncoding.DecodeString(fields["Policy"].(string))
+	assert.Nil(t, err)
+
+	policymap := unmarshallJSON(t, policy)
+	assert.NotEmpty(t, policymap["expiration"])
+	assert.Contains(t, policymap["conditions"], []interface{}{"content-length-range", float64(1), float64(1048576)})
+	assert.Contains(t, policymap["conditions"], []interface{}{"starts-with", "$Content-Type", "image/"})
+	assert.Contains(t, policymap["conditions"], map[string]interface{}{"key": "dummyfolder/dummyfile"})
+}
+
+// Generate a presigned post policy enforcing the encryption of the bucket
+func TestCreatePresignedPostWithEncryption(t *testing.T) {
+	w := s3proxytest.ServeCreatePresignedPost(t, r, kmsBucket, dummyFile, nil, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	fields := unmarshallJSON(t, w.Body.Bytes())["fields"].(map[string]interface{})
+	assert.Equal(t, "aws:kms", fields["x-amz-server-side-encryption"])
+	assert.Equal(t, "kms-key", fields["x-amz-server-side-encryption-aws-kms-key-id"])
+
+	policy, err := base64.StdEncoding.DecodeString(fields["Policy"].(string))
+	assert.Nil(t, err)
+
+	conditions := unmarshallJSON(t, policy)["conditions"]
+	assert.Contains(t, conditions, map[string]interface{}{"x-amz-server-side-encryption": "aws:kms"})
+	assert.Contains(t, conditions, map[string]interface{}{"x-amz-server-side-encryption-aws-kms-key-id": "kms-key"})
+
+	// another encryption than the encryption of the bucket is rejected
+	w = s3proxytest.ServeCreatePresignedPost(t, r, kmsBucket, dummyFile, url.Values{"sse": {"AES256"}}, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// SSE-C is not supported
+	customerKey := base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+	w = s3proxytest.ServeHTTPWithHeaders(t, r, http.MethodPost, "/api/v1/presigned/post/"+dummyBucket+dummyFile, map[string]string{"X-Amz-Server-Side-Encryption-Customer-Key": customerKey}, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, unmarshallJSON(t, w.Body.Bytes())["error"], "SSE-C")
+}
+
+// Generate a presigned post policy where the browser chooses the file name under a key prefix
+func TestCreatePresignedPostKeyPrefixOK(t *testing.T) {
+	w := s3proxytest.ServeCreatePresignedPost(t, r, dummyBucket, "/dummyfolder/", nil, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	objmap := unmarshallJSON(t, w.Body.Bytes())
+	fields := objmap["fields"].(map[string]interface{})
+	assert.Equal(t, "dummyfolder/${filename}", fields["key"])
+
+	policy, err := base64.StdEncoding.DecodeString(fields["Policy"].(string))
+	assert.Nil(t, err)
+
+	policymap := unmarshallJSON(t, policy)
+	assert.Contains(t, policymap["conditions"], []interface{}{"starts-with", "$key", "dummyfolder/"})
+}
+
+func TestCreatePresignedPost400BadRequest(t *testing.T) {
+	w := s3proxytest.ServeCreatePresignedPost(t, r, dummyBucket, dummyFile, url.Values{"expiration": {"abc"}}, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = s3proxytest.ServeCreatePresignedPost(t, r, dummyBucket, dummyFile, url.Values{"contentLengthMin": {"10"}}, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = s3proxytest.ServeCreatePresignedPost(t, r, dummyBucket, dummyFile, url.Values{"contentLengthMin": {"10"}, "contentLengthMax": {"5"}}, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = s3proxytest.ServeCreatePresignedPost(t, r, dummyBucket, dummyFile, url.Values{"contentLengthMax": {"abc"}}, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
 // Check the delete API, should always return 200 even if the object is not present
 func TestDeleteOK(t *testing.T) {
 	for i := 0; i < 2; i++ {
@@ -107,6 +346,15 @@ func TestDeleteOK(t *testing.T) {
 	}
 }
 
+func TestDeleteObjectVersionNotFound(t *testing.T) {
+	w := s3proxytest.ServeHTTP(t, r, http.MethodDelete, "/api/v1/object/"+dummyBucket+dummyFile+"?versionId=notfound", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, unmarshallJSON(t, w.Body.Bytes())["error"], "No such version")
+
+	w = s3proxytest.ServeDeleteObject(t, r, "notfound", dummyFile, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
 func TestBulkDeleteOK(t *testing.T) {
 	w := s3proxytest.ServeBulkDeleteObject(t, r, dummyBucket, []string{"/toto/file1", "/toto/file2", "/toto/file2"}, "")
 	assert.Equal(t, http.StatusOK, w.Code)
@@ -120,6 +368,69 @@ func TestBulkDelete400BadRequest(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 }
 
+func TestDeleteLockedObject(t *testing.T) {
+	w := s3proxytest.ServeDeleteObject(t, r, dummyBucket, "/locked/file1", "")
+	assert.Equal(t, http.StatusLocked, w.Code)
+
+	objmap := unmarshallJSON(t, w.Body.Bytes())
+	assert.Equal(t, "ObjectLocked", objmap["code"])
+	assert.Equal(t, []interface{}{"/locked/file1"}, objmap["lockedKeys"])
+}
+
+func TestBulkDeleteLockedObjects(t *testing.T) {
+	w := s3proxytest.ServeBulkDeleteObject(t, r, dummyBucket, []string{"/toto/file1", "/locked/file1", "/locked/file2"}, "")
+	assert.Equal(t, http.StatusLocked, w.Code)
+
+	objmap := unmarshallJSON(t, w.Body.Bytes())
+	assert.Equal(t, "ObjectLocked", objmap["code"])
+	assert.Equal(t, []interface{}{"/locked/file1", "/locked/file2"}, objmap["lockedKeys"])
+
+	w = s3proxytest.ServeDeletePrefix(t, r, dummyBucket, url.Values{"prefix": {"locked/"}}, "")
+	assert.Equal(t, http.StatusLocked, w.Code)
+
+	objmap = unmarshallJSON(t, w.Body.Bytes())
+	assert.Equal(t, "ObjectLocked", objmap["code"])
+	assert.Len(t, objmap["lockedKeys"], 3)
+}
+
+func TestDeletePrefixOK(t *testing.T) {
+	w := s3proxytest.ServeDeletePrefix(t, r, dummyBucket, url.Values{"prefix": {"tmp/"}}, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	objmap := unmarshallJSON(t, w.Body.Bytes())
+	assert.Equal(t, []interface{}{"tmp/file1", "tmp/file2", "tmp/file3"}, objmap["deleted"])
+	assert.Equal(t, false, objmap["dryRun"])
+}
+
+// objects of the fake backend have been modified in 2018
+func TestDeletePrefixOlderThan(t *testing.T) {
+	w := s3proxytest.ServeDeletePrefix(t, r, dummyBucket, url.Values{"prefix": {"tmp/"}, "olderThan": {"24h"}, "dryRun": {"true"}}, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	objmap := unmarshallJSON(t, w.Body.Bytes())
+	assert.Len(t, objmap["deleted"], 3)
+	assert.Equal(t, true, objmap["dryRun"])
+
+	w = s3proxytest.ServeDeletePrefix(t, r, dummyBucket, url.Values{"prefix": {"tmp/"}, "olderThan": {"876000h"}}, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	objmap = unmarshallJSON(t, w.Body.Bytes())
+	assert.Empty(t, objmap["deleted"])
+}
+
+func TestDeletePrefix400BadRequest(t *testing.T) {
+	w := s3proxytest.ServeDeletePrefix(t, r, dummyBucket, nil, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = s3proxytest.ServeDeletePrefix(t, r, dummyBucket, url.Values{"prefix": {"tmp/"}, "olderThan": {"abc"}}, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestDeletePrefixNoSuchBucket(t *testing.T) {
+	w := s3proxytest.ServeDeletePrefix(t, r, "notfound", url.Values{"prefix": {"tmp/"}}, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
 func TestCopyOK(t *testing.T) {
 	w := s3proxytest.ServeCopyObject(t, r, dummyBucket, dummyFile, dummyBucket, dummyFile+"2", "")
 	assert.Equal(t, http.StatusOK, w.Code)
@@ -166,76 +477,1067 @@ func TestCopyNoSuchKey(t *testing.T) {
 	assert.Contains(t, objmap["error"], "No such key")
 }
 
-// Check if we are getting a 500 when we have a panic. Should be handle by the recovery middleware
-// we are using delete action which fires a fake panic when "error" is in the key
-func TestRecoveryMiddleware(t *testing.T) {
-	w := s3proxytest.ServeDeleteObject(t, r, dummyBucket, "/error", "")
-	assert.Equal(t, http.StatusInternalServerError, w.Code)
+func TestCopyPrefixOK(t *testing.T) {
+	params := url.Values{"prefix": {"tenant1/"}, "destBucket": {dummyBucket}, "destPrefix": {"tenant2/"}}
+	w := s3proxytest.ServeCopyPrefix(t, r, dummyBucket, params, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	objmap := unmarshallJSON(t, w.Body.Bytes())
+	assert.ElementsMatch(t, []interface{}{"tenant1/file1", "tenant1/file2", "tenant1/file3"}, objmap["copied"])
+	assert.Empty(t, objmap["skipped"])
+	assert.Empty(t, objmap["failed"])
 }
 
-// Some 404 checks
-func Test404(t *testing.T) {
+// the fake backend returns the same ETag for every object so all the objects already exist in the destination
+func TestCopyPrefixSkipExisting(t *testing.T) {
+	params := url.Values{"prefix": {"tenant1/"}, "destBucket": {dummyBucket}, "destPrefix": {"tenant2/"}, "skipExisting": {"true"}, "concurrency": {"2"}}
+	w := s3proxytest.ServeCopyPrefix(t, r, dummyBucket, params, "")
+	assert.Equal(t, http.StatusOK, w.Code)
 
-	// missing elements in path
-	w := s3proxytest.ServeHTTP(t, r, http.MethodGet, "/api/v1/presigned/url/dummybucket", "")
-	assert.Equal(t, http.StatusNotFound, w.Code)
+	objmap := unmarshallJSON(t, w.Body.Bytes())
+	assert.Empty(t, objmap["copied"])
+	assert.Len(t, objmap["skipped"], 3)
+}
 
-	w = s3proxytest.ServeHTTP(t, r, http.MethodGet, "/api/v1/presigned/url", "")
-	assert.Equal(t, http.StatusNotFound, w.Code)
+func TestCopyPrefixFailed(t *testing.T) {
+	params := url.Values{"prefix": {"notfound/"}, "destBucket": {dummyBucket}, "destPrefix": {"tenant2/"}}
+	w := s3proxytest.ServeCopyPrefix(t, r, dummyBucket, params, "")
+	assert.Equal(t, http.StatusMultiStatus, w.Code)
 
-	w = s3proxytest.ServeHTTP(t, r, http.MethodGet, "/api/v1/presigned/url/coucou", "")
+	objmap := unmarshallJSON(t, w.Body.Bytes())
+	assert.Empty(t, objmap["copied"])
+	assert.Len(t, objmap["failed"], 3)
+	assert.Contains(t, objmap["failed"], map[string]interface{}{"key": "notfound/file1", "error": `No such key : "notfound/file1"`})
+
+	w = s3proxytest.ServeCopyPrefix(t, r, "notfound", url.Values{"prefix": {"tenant1/"}, "destBucket": {dummyBucket}, "destPrefix": {"tenant2/"}}, "")
 	assert.Equal(t, http.StatusNotFound, w.Code)
+}
 
-	w = s3proxytest.ServeHTTP(t, r, http.MethodPost, "/api/v1/presigned/coucou", "")
+// the objects are skipped when the destination has the same size and, unless one of them is multipart, the same ETag
+func TestCopyPrefixSkipExistingContent(t *testing.T) {
+	memoryBackend := backendtest.NewMemoryBackend(backendtest.MemoryBackendConfig{Buckets: []string{dummyBucket}})
+	r := router.NewGinEngine(gin.TestMode, s3proxyVersion, expiration, "", memoryBackend, router.Config{})
+
+	put := func(key string, content string) {
+		_, err := memoryBackend.PutObject(backend.BucketObject{BucketName: dummyBucket, Key: key}, strings.NewReader(content), backend.PutOptions{})
+		assert.Nil(t, err)
+	}
+
+	put("src/same", "hello")
+	put("dst/same", "hello")
+	put("src/changed", "hello")
+	put("dst/changed", "world")
+	put("src/resized", "hello")
+	put("dst/resized", "hello!")
+	put("dst/multipart", "hello world")
+	put("src/failed", "hello")
+
+	// the source is a multipart object and the destination a single part object with the same content
+	multipart := backend.BucketObject{BucketName: dummyBucket, Key: "src/multipart"}
+	uploadID, err := memoryBackend.CreateMultipartUpload(multipart)
+	assert.Nil(t, err)
+	var parts []backend.CompletedPart
+	for index, content := range []string{"hello", " world"} {
+		etag, err := memoryBackend.UploadPart(multipart, uploadID, int64(index+1), []byte(content))
+		assert.Nil(t, err)
+		parts = append(parts, backend.CompletedPart{PartNumber: int64(index + 1), ETag: etag})
+	}
+	assert.Nil(t, memoryBackend.CompleteMultipartUpload(multipart, uploadID, parts))
+
+	// the internal error of a copy is not returned to the client
+	memoryBackend.SetErrors(backendtest.MemoryError{Method: "CopyObject", Key: "src/failed", Err: errors.New("connection refused by 10.0.0.1")})
+
+	params := url.Values{"prefix": {"src/"}, "destBucket": {dummyBucket}, "destPrefix": {"dst/"}, "skipExisting": {"true"}}
+	w := s3proxytest.ServeCopyPrefix(t, r, dummyBucket, params, "")
+	assert.Equal(t, http.StatusMultiStatus, w.Code)
+
+	objmap := unmarshallJSON(t, w.Body.Bytes())
+	assert.ElementsMatch(t, []interface{}{"src/changed", "src/resized"}, objmap["copied"])
+	assert.ElementsMatch(t, []interface{}{"src/same", "src/multipart"}, objmap["skipped"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"key": "src/failed", "error": `Failed to copy object : sourceBucket="dummybucket", sourceKey="src/failed"`}}, objmap["failed"])
+
+	content, _ := memoryBackend.Content(dummyBucket, "dst/changed")
+	assert.Equal(t, "hello", string(content))
+}
+
+func TestCopyPrefix400BadRequest(t *testing.T) {
+	w := s3proxytest.ServeCopyPrefix(t, r, dummyBucket, url.Values{"destBucket": {dummyBucket}, "destPrefix": {"tenant2/"}}, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = s3proxytest.ServeCopyPrefix(t, r, dummyBucket, url.Values{"prefix": {"tenant1/"}, "destPrefix": {"tenant2/"}}, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = s3proxytest.ServeCopyPrefix(t, r, dummyBucket, url.Values{"prefix": {"tenant1/"}, "destBucket": {dummyBucket}}, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = s3proxytest.ServeCopyPrefix(t, r, dummyBucket, url.Values{"prefix": {"tenant1/"}, "destBucket": {dummyBucket}, "destPrefix": {"tenant1/copy/"}}, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = s3proxytest.ServeCopyPrefix(t, r, dummyBucket, url.Values{"prefix": {"tenant1/"}, "destBucket": {dummyBucket}, "destPrefix": {"tenant2/"}, "concurrency": {"0"}}, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestMoveOK(t *testing.T) {
+	w := s3proxytest.ServeMoveObject(t, r, dummyBucket, dummyFile, dummyBucket, dummyFile+"2", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	objmap := unmarshallJSON(t, w.Body.Bytes())
+	assert.Contains(t, objmap["response"], "ok")
+}
+
+func TestMove400BadRequest(t *testing.T) {
+	w := s3proxytest.ServeMoveObject(t, r, dummyBucket, dummyFile, "", dummyFile+"2", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = s3proxytest.ServeMoveObject(t, r, dummyBucket, dummyFile, dummyBucket, "", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = s3proxytest.ServeMoveObject(t, r, dummyBucket, dummyFile, dummyBucket, dummyFile, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestMoveFailedStep(t *testing.T) {
+	w := s3proxytest.ServeMoveObject(t, r, dummyBucket, "/notfound", dummyBucket, dummyFile+"2", "")
 	assert.Equal(t, http.StatusNotFound, w.Code)
 
-	w = s3proxytest.ServeHTTP(t, r, http.MethodDelete, "/api/v1/presigned/", "")
+	objmap := unmarshallJSON(t, w.Body.Bytes())
+	assert.Contains(t, objmap["error"], "No such key")
+	assert.Equal(t, "copy", objmap["step"])
+
+	w = s3proxytest.ServeMoveObject(t, r, dummyBucket, dummyFile, dummyBucket, "/notfound", "")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	objmap = unmarshallJSON(t, w.Body.Bytes())
+	assert.Equal(t, "verify", objmap["step"])
+
+	w = s3proxytest.ServeMoveObject(t, r, dummyBucket, "/forbidden", dummyBucket, dummyFile+"2", "")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	objmap = unmarshallJSON(t, w.Body.Bytes())
+	assert.Contains(t, objmap["error"], "failed to delete source object")
+	assert.Equal(t, "delete", objmap["step"])
+
+	w = s3proxytest.ServeMoveObject(t, r, dummyBucket, "/locked/file1", dummyBucket, dummyFile+"2", "")
+	assert.Equal(t, http.StatusLocked, w.Code)
+
+	objmap = unmarshallJSON(t, w.Body.Bytes())
+	assert.Equal(t, "ObjectLocked", objmap["code"])
+	assert.Equal(t, []interface{}{"/locked/file1"}, objmap["lockedKeys"])
+	assert.Equal(t, "delete", objmap["step"])
+}
+
+func TestStatObjectOK(t *testing.T) {
+	w := s3proxytest.ServeStatObject(t, r, dummyBucket, dummyFile, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	objmap := unmarshallJSON(t, w.Body.Bytes())
+	assert.Equal(t, dummyFile, objmap["key"])
+	assert.Equal(t, float64(1024), objmap["size"])
+	assert.NotEmpty(t, objmap["etag"])
+	assert.Equal(t, "binary/octet-stream", objmap["contentType"])
+	assert.NotEmpty(t, objmap["lastModified"])
+	assert.Equal(t, map[string]interface{}{"Owner": "s3proxy"}, objmap["metadata"])
+}
+
+func TestStatObjectNoSuchKey(t *testing.T) {
+	w := s3proxytest.ServeStatObject(t, r, dummyBucket, "/notfound", "")
 	assert.Equal(t, http.StatusNotFound, w.Code)
 
-	// check unsupported method
-	w = s3proxytest.ServeHTTP(t, r, http.MethodPut, "/api/v1/object/dummybucket/dummyfolder/dummyfile", "")
+	objmap := unmarshallJSON(t, w.Body.Bytes())
+	assert.Contains(t, objmap["error"], "No such key")
+
+	w = s3proxytest.ServeStatObject(t, r, "notfound", dummyFile, "")
 	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	objmap = unmarshallJSON(t, w.Body.Bytes())
+	assert.Contains(t, objmap["error"], "No such bucket")
 }
 
-// Check authorization with valid api key
-func TestAuthorizationOK(t *testing.T) {
+func TestObjectTaggingOK(t *testing.T) {
+	w := s3proxytest.ServeGetObjectTagging(t, r, dummyBucket, dummyFile, "")
+	assert.Equal(t, http.StatusOK, w.Code)
 
-	// create a server with api key protection
-	r = router.NewGinEngine(gin.ReleaseMode, s3proxyVersion, urlExpiration, serverAPIKey, s3backend)
+	objmap := unmarshallJSON(t, w.Body.Bytes())
+	assert.Equal(t, "internal", objmap["classification"])
 
-	// ping endpoint should not be protected
-	w := s3proxytest.ServeHTTP(t, r, http.MethodGet, "/", "")
+	w = s3proxytest.ServePutObjectTagging(t, r, dummyBucket, dummyFile, map[string]string{"retention": "10y", "tenant": "tenant1"}, "")
 	assert.Equal(t, http.StatusOK, w.Code)
 
-	// Other endpoints should be protected
-	w = s3proxytest.ServeCreatePresignedURLForUpload(t, r, dummyBucket, dummyFile, serverAPIKey)
+	w = s3proxytest.ServeDeleteObjectTagging(t, r, dummyBucket, dummyFile, "")
 	assert.Equal(t, http.StatusOK, w.Code)
+}
 
-	w = s3proxytest.ServeCreatePresignedURLForDownload(t, r, dummyBucket, dummyFile, serverAPIKey)
+func TestObjectTagging400BadRequest(t *testing.T) {
+	tooMany := make(map[string]string)
+	for i := 0; i < 11; i++ {
+		tooMany[fmt.Sprintf("tag%d", i)] = "value"
+	}
+
+	for _, tags := range []map[string]string{
+		tooMany,
+		{"": "value"},
+		{strings.Repeat("k", 129): "value"},
+		{"key": strings.Repeat("v", 257)},
+		{"aws:reserved": "value"},
+	} {
+		w := s3proxytest.ServePutObjectTagging(t, r, dummyBucket, dummyFile, tags, "")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	}
+
+	w := s3proxytest.ServeHTTPWithBody(t, r, http.MethodPut, "/api/v1/object/tags/"+dummyBucket+dummyFile, strings.NewReader("[1, 2]"), 6, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestObjectRetentionOK(t *testing.T) {
+	w := s3proxytest.ServeGetObjectRetention(t, r, dummyBucket, "/locked/file1", "")
 	assert.Equal(t, http.StatusOK, w.Code)
 
-	w = s3proxytest.ServeDeleteObject(t, r, dummyBucket, dummyFile, serverAPIKey)
+	objmap := unmarshallJSON(t, w.Body.Bytes())
+	assert.Equal(t, "COMPLIANCE", objmap["mode"])
+	assert.Equal(t, "2099-01-01T00:00:00Z", objmap["retainUntilDate"])
+
+	w = s3proxytest.ServeGetObjectRetention(t, r, dummyBucket, dummyFile, "")
 	assert.Equal(t, http.StatusOK, w.Code)
-}
+	assert.Empty(t, unmarshallJSON(t, w.Body.Bytes()))
 
-// Check authorization verification with missing api key
-func TestAuthorization401(t *testing.T) {
+	retainUntilDate := time.Now().Add(24 * time.Hour)
 
-	// create a server with api key protection
-	r = router.NewGinEngine(gin.ReleaseMode, s3proxyVersion, urlExpiration, serverAPIKey, s3backend)
+	w = s3proxytest.ServePutObjectRetention(t, r, dummyBucket, dummyFile, backend.ObjectRetention{Mode: "GOVERNANCE", RetainUntilDate: &retainUntilDate}, false, "")
+	assert.Equal(t, http.StatusOK, w.Code)
 
-	// ping endpoint should not be protected
-	w := s3proxytest.ServeHTTP(t, r, http.MethodGet, "/", "")
+	// removal
+	w = s3proxytest.ServePutObjectRetention(t, r, dummyBucket, dummyFile, backend.ObjectRetention{}, true, "")
 	assert.Equal(t, http.StatusOK, w.Code)
+}
 
-	// Other endpoints should be protected
-	w = s3proxytest.ServeCreatePresignedURLForUpload(t, r, dummyBucket, dummyFile, "")
-	assert.Equal(t, http.StatusUnauthorized, w.Code)
+func TestObjectRetention400BadRequest(t *testing.T) {
+	var (
+		past   = time.Now().Add(-time.Hour)
+		future = time.Now().Add(time.Hour)
+	)
 
-	w = s3proxytest.ServeCreatePresignedURLForDownload(t, r, dummyBucket, dummyFile, "")
-	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	for _, retention := range []backend.ObjectRetention{
+		{Mode: "GOVERNANCE"},
+		{Mode: "FOREVER", RetainUntilDate: &future},
+		{Mode: "COMPLIANCE", RetainUntilDate: &past},
+		{RetainUntilDate: &future},
+	} {
+		w := s3proxytest.ServePutObjectRetention(t, r, dummyBucket, dummyFile, retention, false, "")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	}
+}
 
-	w = s3proxytest.ServeDeleteObject(t, r, dummyBucket, dummyFile, "")
+func TestObjectRetentionErrors(t *testing.T) {
+	future := time.Now().Add(time.Hour)
+
+	w := s3proxytest.ServePutObjectRetention(t, r, dummyBucket, "/locked/file1", backend.ObjectRetention{Mode: "GOVERNANCE", RetainUntilDate: &future}, false, "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = s3proxytest.ServeGetObjectRetention(t, r, dummyBucket, "/notfound", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = s3proxytest.ServePutObjectRetention(t, r, "notfound", dummyFile, backend.ObjectRetention{}, false, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestObjectLegalHoldOK(t *testing.T) {
+	w := s3proxytest.ServeGetObjectLegalHold(t, r, dummyBucket, "/locked/file1", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, true, unmarshallJSON(t, w.Body.Bytes())["legalHold"])
+
+	w = s3proxytest.ServeGetObjectLegalHold(t, r, dummyBucket, dummyFile, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, false, unmarshallJSON(t, w.Body.Bytes())["legalHold"])
+
+	w = s3proxytest.ServePutObjectLegalHold(t, r, dummyBucket, dummyFile, true, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = s3proxytest.ServePutObjectLegalHold(t, r, dummyBucket, "/notfound", false, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = s3proxytest.ServeHTTPWithBody(t, r, http.MethodPut, "/api/v1/object/legal-hold/"+dummyBucket+dummyFile, strings.NewReader("{}"), 2, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestObjectTaggingNoSuchKey(t *testing.T) {
+	w := s3proxytest.ServeGetObjectTagging(t, r, dummyBucket, "/notfound", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = s3proxytest.ServePutObjectTagging(t, r, dummyBucket, "/notfound", map[string]string{"tenant": "tenant1"}, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = s3proxytest.ServeDeleteObjectTagging(t, r, "notfound", dummyFile, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestListObjectsOK(t *testing.T) {
+	w := s3proxytest.ServeListObjects(t, r, dummyBucket, url.Values{"prefix": {"dummyfolder/"}, "delimiter": {"/"}}, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	objmap := unmarshallJSON(t, w.Body.Bytes())
+	assert.Len(t, objmap["objects"], 3)
+	assert.Equal(t, []interface{}{"dummyfolder/folder/"}, objmap["commonPrefixes"])
+	assert.Equal(t, false, objmap["isTruncated"])
+
+	object := objmap["objects"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "dummyfolder/file1", object["key"])
+}
+
+func TestListObjectsPagination(t *testing.T) {
+	w := s3proxytest.ServeListObjects(t, r, dummyBucket, url.Values{"max-keys": {"2"}}, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	objmap := unmarshallJSON(t, w.Body.Bytes())
+	assert.Len(t, objmap["objects"], 2)
+	assert.Equal(t, true, objmap["isTruncated"])
+	assert.NotEmpty(t, objmap["nextContinuationToken"])
+
+	w = s3proxytest.ServeListObjects(t, r, dummyBucket, url.Values{"max-keys": {"2"}, "continuation-token": {objmap["nextContinuationToken"].(string)}}, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	objmap = unmarshallJSON(t, w.Body.Bytes())
+	assert.Len(t, objmap["objects"], 1)
+	assert.Equal(t, false, objmap["isTruncated"])
+}
+
+func TestListObjects400BadRequest(t *testing.T) {
+	w := s3proxytest.ServeListObjects(t, r, dummyBucket, url.Values{"max-keys": {"abc"}}, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = s3proxytest.ServeListObjects(t, r, dummyBucket, url.Values{"continuation-token": {"abc"}}, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestListObjectsNoSuchBucket(t *testing.T) {
+	w := s3proxytest.ServeListObjects(t, r, "notfound", nil, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	objmap := unmarshallJSON(t, w.Body.Bytes())
+	assert.Contains(t, objmap["error"], "No such bucket")
+}
+
+func TestMultipartUploadOK(t *testing.T) {
+	w := s3proxytest.ServeCreateMultipartUpload(t, r, dummyBucket, dummyFile, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	objmap := unmarshallJSON(t, w.Body.Bytes())
+	uploadID := objmap["uploadId"].(string)
+	assert.NotEmpty(t, uploadID)
+
+	w = s3proxytest.ServeCreatePresignedURLForUploadPart(t, r, dummyBucket, dummyFile, uploadID, []string{"1", "2"}, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	objmap = unmarshallJSON(t, w.Body.Bytes())
+	urls := objmap["urls"].(map[string]interface{})
+	assert.Len(t, urls, 2)
+	assert.Contains(t, urls["1"], dummyFile)
+	assert.Contains(t, urls["1"], "partNumber=1")
+	assert.Contains(t, urls["2"], "partNumber=2")
+	assert.Contains(t, urls["2"], "uploadId="+uploadID)
+	assert.Contains(t, urls["2"], "X-Amz-Signature")
+	assert.Equal(t, map[string]interface{}{"1": map[string]interface{}{}, "2": map[string]interface{}{}}, objmap["headers"])
+
+	// SSE-C, the client has to replay the key headers with each part
+	customerKey := base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+	w = s3proxytest.ServeHTTPWithHeaders(t, r, http.MethodPost, "/api/v1/multipart/url/"+dummyBucket+dummyFile+"?uploadId="+uploadID+"&partNumber=1", map[string]string{"X-Amz-Server-Side-Encryption-Customer-Key": customerKey}, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	headers := unmarshallJSON(t, w.Body.Bytes())["headers"].(map[string]interface{})["1"].(map[string]interface{})
+	assert.Equal(t, "AES256", headers["X-Amz-Server-Side-Encryption-Customer-Algorithm"])
+	assert.Equal(t, customerKey, headers["X-Amz-Server-Side-Encryption-Customer-Key"])
+	assert.NotEmpty(t, headers["X-Amz-Server-Side-Encryption-Customer-Key-Md5"])
+
+	parts := []backend.CompletedPart{{PartNumber: 2, ETag: "etag2"}, {PartNumber: 1, ETag: "etag1"}}
+	w = s3proxytest.ServeCompleteMultipartUpload(t, r, dummyBucket, dummyFile, uploadID, parts, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = s3proxytest.ServeAbortMultipartUpload(t, r, dummyBucket, dummyFile, uploadID, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestMultipartUpload400BadRequest(t *testing.T) {
+	w := s3proxytest.ServeCreatePresignedURLForUploadPart(t, r, dummyBucket, dummyFile, "", []string{"1"}, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = s3proxytest.ServeCreatePresignedURLForUploadPart(t, r, dummyBucket, dummyFile, "fake-upload-id", nil, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = s3proxytest.ServeCreatePresignedURLForUploadPart(t, r, dummyBucket, dummyFile, "fake-upload-id", []string{"0"}, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = s3proxytest.ServeCreatePresignedURLForUploadPart(t, r, dummyBucket, dummyFile, "fake-upload-id", []string{"10001"}, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = s3proxytest.ServeCompleteMultipartUpload(t, r, dummyBucket, dummyFile, "fake-upload-id", nil, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = s3proxytest.ServeCompleteMultipartUpload(t, r, dummyBucket, dummyFile, "fake-upload-id", []backend.CompletedPart{{PartNumber: 1}}, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = s3proxytest.ServeAbortMultipartUpload(t, r, dummyBucket, dummyFile, "", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestMultipartUploadNotFound(t *testing.T) {
+	w := s3proxytest.ServeCreateMultipartUpload(t, r, "notfound", dummyFile, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	objmap := unmarshallJSON(t, w.Body.Bytes())
+	assert.Contains(t, objmap["error"], "No such bucket")
+
+	parts := []backend.CompletedPart{{PartNumber: 1, ETag: "etag1"}}
+	w = s3proxytest.ServeCompleteMultipartUpload(t, r, dummyBucket, dummyFile, "notfound", parts, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	objmap = unmarshallJSON(t, w.Body.Bytes())
+	assert.Contains(t, objmap["error"], "No such upload")
+
+	w = s3proxytest.ServeAbortMultipartUpload(t, r, dummyBucket, dummyFile, "notfound", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestGetObjectOK(t *testing.T) {
+	w := s3proxytest.ServeGetObject(t, r, dummyBucket, dummyFile, nil, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, backendtest.FakeObjectContent, w.Body.String())
+	assert.Equal(t, "binary/octet-stream", w.Header().Get("Content-Type"))
+	assert.Equal(t, strconv.Itoa(len(backendtest.FakeObjectContent)), w.Header().Get("Content-Length"))
+	assert.NotEmpty(t, w.Header().Get("ETag"))
+	assert.Equal(t, "Mon, 01 Jan 2018 00:00:00 GMT", w.Header().Get("Last-Modified"))
+}
+
+func TestGetObjectRange(t *testing.T) {
+	w := s3proxytest.ServeGetObject(t, r, dummyBucket, dummyFile, map[string]string{"Range": "bytes=0-6"}, "")
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, backendtest.FakeObjectContent[0:7], w.Body.String())
+	assert.Equal(t, "7", w.Header().Get("Content-Length"))
+	assert.Equal(t, fmt.Sprintf("bytes 0-6/%d", len(backendtest.FakeObjectContent)), w.Header().Get("Content-Range"))
+
+	w = s3proxytest.ServeGetObject(t, r, dummyBucket, dummyFile, map[string]string{"Range": "bytes=1000-2000"}, "")
+	assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, w.Code)
+}
+
+func TestGetObjectNotModified(t *testing.T) {
+	w := s3proxytest.ServeGetObject(t, r, dummyBucket, dummyFile, nil, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = s3proxytest.ServeGetObject(t, r, dummyBucket, dummyFile, map[string]string{"If-None-Match": w.Header().Get("ETag")}, "")
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+}
+
+func TestGetObjectNoSuchKey(t *testing.T) {
+	w := s3proxytest.ServeGetObject(t, r, dummyBucket, "/notfound", nil, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	objmap := unmarshallJSON(t, w.Body.Bytes())
+	assert.Contains(t, objmap["error"], "No such key")
+}
+
+func TestListObjectVersionsOK(t *testing.T) {
+	w := s3proxytest.ServeListObjectVersions(t, r, dummyBucket, url.Values{"prefix": {"dummyfolder/"}}, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	objmap := unmarshallJSON(t, w.Body.Bytes())
+	assert.Len(t, objmap["versions"], 9)
+	assert.Equal(t, false, objmap["isTruncated"])
+
+	versions := objmap["versions"].([]interface{})
+	deleteMarker := versions[0].(map[string]interface{})
+	assert.Equal(t, "dummyfolder/file1", deleteMarker["key"])
+	assert.Equal(t, "v3", deleteMarker["versionId"])
+	assert.Equal(t, true, deleteMarker["isLatest"])
+	assert.Equal(t, true, deleteMarker["isDeleteMarker"])
+
+	version := versions[1].(map[string]interface{})
+	assert.Equal(t, "v2", version["versionId"])
+	assert.Equal(t, false, version["isDeleteMarker"])
+}
+
+func TestListObjectVersions400BadRequest(t *testing.T) {
+	w := s3proxytest.ServeListObjectVersions(t, r, dummyBucket, url.Values{"max-keys": {"-1"}}, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = s3proxytest.ServeListObjectVersions(t, r, dummyBucket, url.Values{"continuation-token": {"invalid"}}, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestListObjectVersionsNoSuchBucket(t *testing.T) {
+	w := s3proxytest.ServeListObjectVersions(t, r, "notfound", nil, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestStatObjectVersion(t *testing.T) {
+	w := s3proxytest.ServeHTTP(t, r, http.MethodGet, "/api/v1/object/meta/"+dummyBucket+dummyFile+"?versionId=v1", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "v1", unmarshallJSON(t, w.Body.Bytes())["versionId"])
+
+	w = s3proxytest.ServeHTTP(t, r, http.MethodGet, "/api/v1/object/meta/"+dummyBucket+dummyFile+"?versionId=notfound", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestRestoreObjectVersionOK(t *testing.T) {
+	w := s3proxytest.ServeRestoreObjectVersion(t, r, dummyBucket, dummyFile, "v1", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestRestoreObjectVersion400BadRequest(t *testing.T) {
+	w := s3proxytest.ServeRestoreObjectVersion(t, r, dummyBucket, dummyFile, "", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestRestoreObjectVersionNotFound(t *testing.T) {
+	w := s3proxytest.ServeRestoreObjectVersion(t, r, dummyBucket, dummyFile, "notfound", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = s3proxytest.ServeRestoreObjectVersion(t, r, dummyBucket, "/notfound", "v1", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestCopyObjectWithStorageClass(t *testing.T) {
+	w := s3proxytest.ServeHTTP(t, r, http.MethodPost, "/api/v1/object/copy/"+dummyBucket+dummyFile+"?destBucket="+dummyBucket+"&destKey=/archive/file&storageClass=GLACIER", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = s3proxytest.ServeHTTP(t, r, http.MethodPost, "/api/v1/object/copy/"+dummyBucket+dummyFile+"?destBucket="+dummyBucket+"&destKey=/archive/file&storageClass=COLD", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestRestoreObject(t *testing.T) {
+	w := s3proxytest.ServeRestoreObject(t, r, dummyBucket, "/archived", url.Values{"days": {"7"}, "tier": {"Bulk"}}, "")
+	assert.Equal(t, http.StatusAccepted, w.Code)
+
+	w = s3proxytest.ServeRestoreObject(t, r, dummyBucket, "/restored", nil, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = s3proxytest.ServeStatObject(t, r, dummyBucket, "/restored", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	objmap := unmarshallJSON(t, w.Body.Bytes())
+	assert.Equal(t, "GLACIER", objmap["storageClass"])
+	assert.Equal(t, map[string]interface{}{"inProgress": false, "expiryDate": "2018-01-02T00:00:00Z"}, objmap["restore"])
+}
+
+func TestRestoreObject409Conflict(t *testing.T) {
+	// already in progress
+	w := s3proxytest.ServeRestoreObject(t, r, dummyBucket, "/restoring", nil, "")
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// not archived
+	w = s3proxytest.ServeRestoreObject(t, r, dummyBucket, dummyFile, nil, "")
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestRestoreObject400BadRequest(t *testing.T) {
+	w := s3proxytest.ServeRestoreObject(t, r, dummyBucket, "/archived", url.Values{"days": {"0"}}, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = s3proxytest.ServeRestoreObject(t, r, dummyBucket, "/archived", url.Values{"tier": {"Fast"}}, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestRestoreObjectNotFound(t *testing.T) {
+	w := s3proxytest.ServeRestoreObject(t, r, dummyBucket, "/notfound", nil, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestPutObjectOK(t *testing.T) {
+	body := []byte("s3proxy streamed upload")
+	w := s3proxytest.ServePutObject(t, r, dummyBucket, dummyFile, body, map[string]string{"Content-Type": "text/plain", "X-Amz-Meta-Owner": "s3proxy"}, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	objmap := unmarshallJSON(t, w.Body.Bytes())
+	assert.Equal(t, fmt.Sprintf("\"%x\"", md5.Sum(body)), objmap["etag"])
+}
+
+func TestPutObjectTooLarge(t *testing.T) {
+	body := make([]byte, maxUploadSize+1)
+
+	w := s3proxytest.ServePutObject(t, r, dummyBucket, dummyFile, body, nil, "")
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	// without content length, the size is checked while streaming
+	engine := router.NewGinEngine(gin.TestMode, s3proxyVersion, expiration, "", s3backend, router.Config{EnableStreaming: true, MaxUploadSize: maxUploadSize})
+	req, err := http.NewRequest(http.MethodPut, "/api/v1/object/"+dummyBucket+dummyFile, io.NopCloser(bytes.NewReader(body)))
+	assert.Nil(t, err)
+	req.ContentLength = -1
+
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+}
+
+func TestPutObjectNoSuchBucket(t *testing.T) {
+	w := s3proxytest.ServePutObject(t, r, "notfound", dummyFile, []byte("content"), nil, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+// Streaming is disabled by default
+func TestStreamingDisabled(t *testing.T) {
+	engine := router.NewGinEngine(gin.TestMode, s3proxyVersion, expiration, "", s3backend)
+
+	w := s3proxytest.ServeGetObject(t, engine, dummyBucket, dummyFile, nil, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = s3proxytest.ServePutObject(t, engine, dummyBucket, dummyFile, []byte("content"), nil, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+// Create a router with a filesystem backend and the API key, the signed URLs are served without the API key
+func newFSRouter(t *testing.T) *gin.Engine {
+	root := t.TempDir()
+	assert.Nil(t, os.Mkdir(filepath.Join(root, dummyBucket), 0o755))
+
+	fsBackend, err := backend.NewFSBackend(backend.FSBackendConfig{Root: root, BaseURL: "http://localhost:8080"})
+	assert.Nil(t, err)
+
+	return router.NewGinEngine(gin.TestMode, s3proxyVersion, expiration, serverAPIKey, fsBackend, router.Config{FSBackend: fsBackend, MaxUploadSize: maxUploadSize})
+}
+
+func TestFSSignedURLs(t *testing.T) {
+	r := newFSRouter(t)
+
+	w := s3proxytest.ServeCreatePresignedURLForUploadWithParams(t, r, dummyBucket, dummyFile, url.Values{"contentType": {"text/plain"}, "x-amz-meta-tenant": {"tenant1"}}, serverAPIKey)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	uploadURL := unmarshallJSON(t, w.Body.Bytes())["url"].(string)
+	assert.True(t, strings.HasPrefix(uploadURL, "http://localhost:8080/api/v1/fs/"+dummyBucket+dummyFile+"?"))
+
+	// the content type is signed
+	w = s3proxytest.ServeSignedURL(t, r, http.MethodPut, uploadURL, []byte("content"), map[string]string{"Content-Type": "text/html"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = s3proxytest.ServeSignedURL(t, r, http.MethodPut, uploadURL, []byte("content"), map[string]string{"Content-Type": "text/plain"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEmpty(t, w.Header().Get("ETag"))
+
+	// the signature does not allow a download
+	w = s3proxytest.ServeSignedURL(t, r, http.MethodGet, uploadURL, nil, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = s3proxytest.ServeStatObject(t, r, dummyBucket, dummyFile, serverAPIKey)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, map[string]interface{}{"tenant": "tenant1"}, unmarshallJSON(t, w.Body.Bytes())["metadata"])
+
+	w = s3proxytest.ServeCreatePresignedURLForDownloadWithParams(t, r, dummyBucket, dummyFile, url.Values{"filename": {"file.txt"}}, serverAPIKey)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	downloadURL := unmarshallJSON(t, w.Body.Bytes())["url"].(string)
+
+	w = s3proxytest.ServeSignedURL(t, r, http.MethodGet, downloadURL, nil, map[string]string{"Range": "bytes=0-3"})
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "cont", w.Body.String())
+	assert.Equal(t, "text/plain", w.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="file.txt"`, w.Header().Get("Content-Disposition"))
+
+	w = s3proxytest.ServeSignedURL(t, r, http.MethodGet, strings.Replace(downloadURL, "signature=", "signature=0", 1), nil, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = s3proxytest.ServeDeleteObject(t, r, dummyBucket, dummyFile, serverAPIKey)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = s3proxytest.ServeSignedURL(t, r, http.MethodGet, downloadURL, nil, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+// the API key is required on the paths of the signed URLs when the filesystem routes are disabled
+func TestFSRoutesDisabled(t *testing.T) {
+	engine := router.NewGinEngine(gin.TestMode, s3proxyVersion, expiration, serverAPIKey, s3backend, router.Config{})
+
+	w := s3proxytest.ServeSignedURL(t, engine, http.MethodGet, "http://localhost:8080/api/v1/fs/"+dummyBucket+dummyFile, nil, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestFSMultipartUpload(t *testing.T) {
+	r := newFSRouter(t)
+
+	w := s3proxytest.ServeCreateMultipartUpload(t, r, dummyBucket, dummyFile, serverAPIKey)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	uploadID := unmarshallJSON(t, w.Body.Bytes())["uploadId"].(string)
+
+	w = s3proxytest.ServeCreatePresignedURLForUploadPart(t, r, dummyBucket, dummyFile, uploadID, []string{"1", "2"}, serverAPIKey)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var urls struct {
+		URLs map[string]string `json:"urls"`
+	}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &urls))
+	assert.Len(t, urls.URLs, 2)
+
+	var parts []backend.CompletedPart
+
+	for partNumber := int64(1); partNumber <= 2; partNumber++ {
+		w = s3proxytest.ServeSignedURL(t, r, http.MethodPut, urls.URLs[strconv.FormatInt(partNumber, 10)], []byte(fmt.Sprintf("part%d ", partNumber)), nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		parts = append(parts, backend.CompletedPart{PartNumber: partNumber, ETag: w.Header().Get("ETag")})
+	}
+
+	w = s3proxytest.ServeCompleteMultipartUpload(t, r, dummyBucket, dummyFile, uploadID, parts, serverAPIKey)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = s3proxytest.ServeStatObject(t, r, dummyBucket, dummyFile, serverAPIKey)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, float64(12), unmarshallJSON(t, w.Body.Bytes())["size"])
+}
+
+// Create a router with an in-memory backend containing the objects of the keys (the content of an object is its key)
+func newMemoryRouter(t *testing.T, keys ...string) (*gin.Engine, *backendtest.MemoryBackend) {
+	memoryBackend := backendtest.NewMemoryBackend(backendtest.MemoryBackendConfig{Buckets: []string{dummyBucket, "otherbucket"}})
+
+	for _, key := range keys {
+		_, err := memoryBackend.PutObject(backend.BucketObject{BucketName: dummyBucket, Key: key}, strings.NewReader(key), backend.PutOptions{ContentType: "text/plain"})
+		assert.Nil(t, err)
+	}
+	memoryBackend.ResetCalls()
+
+	return router.NewGinEngine(gin.TestMode, s3proxyVersion, expiration, "", memoryBackend, router.Config{EnableStreaming: true}), memoryBackend
+}
+
+func TestMemoryDeleteObjects(t *testing.T) {
+	r, memoryBackend := newMemoryRouter(t, "/file1", "/file2", "/file3")
+
+	w := s3proxytest.ServeDeleteObject(t, r, dummyBucket, "/file1", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"/file2", "/file3"}, memoryBackend.Keys(dummyBucket))
+
+	w = s3proxytest.ServeBulkDeleteObject(t, r, dummyBucket, []string{"/file2", "/file3", "/missing"}, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, memoryBackend.Keys(dummyBucket))
+
+	calls := memoryBackend.CallsOf("BatchDeleteObjects")
+	if assert.Len(t, calls, 1) {
+		assert.Len(t, calls[0].Objects, 3)
+	}
+}
+
+func TestMemoryDeleteLockedObject(t *testing.T) {
+	r, memoryBackend := newMemoryRouter(t, "/file1", "/file2")
+
+	assert.Nil(t, memoryBackend.PutObjectLegalHold(backend.BucketObject{BucketName: dummyBucket, Key: "/file1"}, true))
+
+	w := s3proxytest.ServeBulkDeleteObject(t, r, dummyBucket, []string{"/file1", "/file2"}, "")
+	assert.Equal(t, http.StatusLocked, w.Code)
+	assert.Equal(t, []interface{}{"/file1"}, unmarshallJSON(t, w.Body.Bytes())["lockedKeys"])
+	assert.Equal(t, []string{"/file1"}, memoryBackend.Keys(dummyBucket))
+
+	w = s3proxytest.ServePutObjectLegalHold(t, r, dummyBucket, "/file1", false, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = s3proxytest.ServeDeleteObject(t, r, dummyBucket, "/file1", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, memoryBackend.Keys(dummyBucket))
+}
+
+func TestMemoryCopyAndMoveObject(t *testing.T) {
+	r, memoryBackend := newMemoryRouter(t, "/file1")
+
+	w := s3proxytest.ServeCopyObject(t, r, dummyBucket, "/file1", "otherbucket", "/copy", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	content, found := memoryBackend.Content("otherbucket", "/copy")
+	assert.True(t, found)
+	assert.Equal(t, "/file1", string(content))
+
+	w = s3proxytest.ServeMoveObject(t, r, dummyBucket, "/file1", dummyBucket, "/moved", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"/moved"}, memoryBackend.Keys(dummyBucket))
+
+	w = s3proxytest.ServeGetObject(t, r, dummyBucket, "/moved", nil, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "/file1", w.Body.String())
+	assert.Equal(t, "text/plain", w.Header().Get("Content-Type"))
+
+	w = s3proxytest.ServeCopyObject(t, r, dummyBucket, "/file1", dummyBucket, "/copy", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestMemoryPrefixOperations(t *testing.T) {
+	r, memoryBackend := newMemoryRouter(t, "tenant1/a", "tenant1/b", "tenant2/c")
+
+	w := s3proxytest.ServeCopyPrefix(t, r, dummyBucket, url.Values{"prefix": {"tenant1/"}, "destBucket": {"otherbucket"}, "destPrefix": {"archive/"}}, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"archive/a", "archive/b"}, memoryBackend.Keys("otherbucket"))
+
+	w = s3proxytest.ServeDeletePrefix(t, r, dummyBucket, url.Values{"prefix": {"tenant1/"}}, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"tenant2/c"}, memoryBackend.Keys(dummyBucket))
+}
+
+func TestMemoryInjectedErrors(t *testing.T) {
+	r, memoryBackend := newMemoryRouter(t, "/file1", "/file2")
+
+	memoryBackend.SetErrors(
+		backendtest.MemoryError{Method: "DeleteObject", Key: "/file1", Err: errors.New("disk failure")},
+		backendtest.MemoryError{Method: "CopyObject", Err: awserr.New(s3.ErrCodeNoSuchBucket, "No such bucket", nil)},
+	)
+
+	w := s3proxytest.ServeDeleteObject(t, r, dummyBucket, "/file1", "")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	w = s3proxytest.ServeDeleteObject(t, r, dummyBucket, "/file2", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = s3proxytest.ServeCopyObject(t, r, dummyBucket, "/file1", dummyBucket, "/copy", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// nothing has been copied and the failed delete did not delete anything
+	assert.Equal(t, []string{"/file1"}, memoryBackend.Keys(dummyBucket))
+	assert.Len(t, memoryBackend.CallsOf("DeleteObject"), 2)
+
+	memoryBackend.SetErrors()
+
+	w = s3proxytest.ServeDeleteObject(t, r, dummyBucket, "/file1", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, memoryBackend.Keys(dummyBucket))
+}
+
+func TestRoutingBackend(t *testing.T) {
+	awsBackend := backendtest.NewMemoryBackend(backendtest.MemoryBackendConfig{Buckets: []string{dummyBucket}})
+	minioBackend := backendtest.NewMemoryBackend(backendtest.MemoryBackendConfig{Buckets: []string{"media-eu", "media-us"}})
+
+	routingBackend, err := backend.NewRoutingBackend(backend.RoutingBackendConfig{
+		Backends:       map[string]backend.Backend{"aws": awsBackend, "minio": minioBackend},
+		Routes:         map[string]string{"media-*": "minio"},
+		DefaultBackend: "aws",
+	})
+	assert.Nil(t, err)
+
+	r := router.NewGinEngine(gin.TestMode, s3proxyVersion, expiration, "", routingBackend, router.Config{EnableStreaming: true})
+
+	_, err = minioBackend.PutObject(backend.BucketObject{BucketName: "media-eu", Key: "/file1"}, strings.NewReader("file1"), backend.PutOptions{ContentType: "text/plain"})
+	assert.Nil(t, err)
+
+	// copy between two backends
+	w := s3proxytest.ServeCopyObject(t, r, "media-eu", "/file1", dummyBucket, "/file1", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	content, found := awsBackend.Content(dummyBucket, "/file1")
+	assert.True(t, found)
+	assert.Equal(t, "file1", string(content))
+	assert.Empty(t, minioBackend.CallsOf("CopyObject"))
+
+	// copy in the same backend
+	w = s3proxytest.ServeCopyObject(t, r, "media-eu", "/file1", "media-us", "/file1", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, minioBackend.CallsOf("CopyObject"), 1)
+
+	// the locked objects of both backends are reported
+	assert.Nil(t, awsBackend.PutObjectLegalHold(backend.BucketObject{BucketName: dummyBucket, Key: "/file1"}, true))
+	assert.Nil(t, minioBackend.PutObjectLegalHold(backend.BucketObject{BucketName: "media-eu", Key: "/file1"}, true))
+
+	err = routingBackend.BatchDeleteObjects([]backend.BucketObject{
+		{BucketName: dummyBucket, Key: "/file1"},
+		{BucketName: "media-eu", Key: "/file1"},
+		{BucketName: "media-us", Key: "/file1"},
+	})
+	if lockedErr, ok := err.(*backend.LockedObjectsError); assert.True(t, ok) {
+		assert.Equal(t, []string{"/file1", "/file1"}, lockedErr.Keys)
+	}
+	assert.Empty(t, minioBackend.Keys("media-us"))
+
+	// the buckets matching no route are served by the default backend
+	w = s3proxytest.ServeStatObject(t, r, "unknown-bucket", "/file1", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Len(t, awsBackend.CallsOf("StatObject"), 1)
+}
+
+func TestFailoverBackend(t *testing.T) {
+	primary := backendtest.NewMemoryBackend(backendtest.MemoryBackendConfig{Buckets: []string{dummyBucket}})
+	secondary := backendtest.NewMemoryBackend(backendtest.MemoryBackendConfig{Buckets: []string{dummyBucket}})
+
+	_, err := secondary.PutObject(backend.BucketObject{BucketName: dummyBucket, Key: dummyFile}, strings.NewReader("content"), backend.PutOptions{ContentType: "text/plain"})
+	assert.Nil(t, err)
+
+	failoverBackend, err := backend.NewFailoverBackend(backend.FailoverBackendConfig{
+		Primary:             primary,
+		Secondary:           secondary,
+		HealthCheckBucket:   dummyBucket,
+		HealthCheckInterval: 5 * time.Millisecond,
+		FailureThreshold:    2,
+	})
+	assert.Nil(t, err)
+	defer failoverBackend.Close()
+
+	r := router.NewGinEngine(gin.TestMode, s3proxyVersion, expiration, "", failoverBackend, router.Config{})
+
+	down := errors.New("connection refused")
+	primary.SetErrors(
+		backendtest.MemoryError{Method: "ListObjects", Err: down},
+		backendtest.MemoryError{Method: "StatObject", Err: down},
+		backendtest.MemoryError{Method: "CreatePresignedURLForDownload", Err: down},
+	)
+
+	assert.Eventually(t, func() bool {
+		return s3proxytest.ServeCreatePresignedURLForDownload(t, r, dummyBucket, dummyFile, "").Code == http.StatusOK
+	}, time.Second, 5*time.Millisecond)
+
+	// the archived check of the download is done by the secondary backend, the primary backend is not called
+	primary.ResetCalls()
+	secondary.ResetCalls()
+	w := s3proxytest.ServeCreatePresignedURLForDownload(t, r, dummyBucket, dummyFile, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, primary.CallsOf("StatObject"))
+	assert.Empty(t, primary.CallsOf("CreatePresignedURLForDownload"))
+	assert.Len(t, secondary.CallsOf("StatObject"), 1)
+}
+
+func TestAliasBackend(t *testing.T) {
+	memoryBackend := backendtest.NewMemoryBackend(backendtest.MemoryBackendConfig{Buckets: []string{"prod-documents"}})
+
+	aliasBackend, err := backend.NewAliasBackend(backend.AliasBackendConfig{
+		Backend: memoryBackend,
+		Aliases: map[string]backend.BucketAlias{"invoices": {Bucket: "prod-documents", Prefix: "invoices/"}},
+		Strict:  true,
+	})
+	assert.Nil(t, err)
+
+	r := router.NewGinEngine(gin.TestMode, s3proxyVersion, expiration, "", aliasBackend, router.Config{EnableStreaming: true})
+
+	w := s3proxytest.ServePutObject(t, r, "invoices", "/2023/jan.pdf", []byte("january"), nil, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"/invoices/2023/jan.pdf"}, memoryBackend.Keys("prod-documents"))
+
+	w = s3proxytest.ServeListObjects(t, r, "invoices", url.Values{"prefix": {"/2023/"}}, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	objects := unmarshallJSON(t, w.Body.Bytes())["objects"].([]interface{})
+	if assert.Len(t, objects, 1) {
+		assert.Equal(t, "/2023/jan.pdf", objects[0].(map[string]interface{})["key"])
+	}
+
+	// the locked keys are logical keys
+	assert.Nil(t, memoryBackend.PutObjectLegalHold(backend.BucketObject{BucketName: "prod-documents", Key: "/invoices/2023/jan.pdf"}, true))
+
+	w = s3proxytest.ServeBulkDeleteObject(t, r, "invoices", []string{"/2023/jan.pdf"}, "")
+	assert.Equal(t, http.StatusLocked, w.Code)
+	assert.Equal(t, []interface{}{"/2023/jan.pdf"}, unmarshallJSON(t, w.Body.Bytes())["lockedKeys"])
+
+	// the physical bucket is not reachable in strict mode
+	w = s3proxytest.ServeStatObject(t, r, "prod-documents", "/invoices/2023/jan.pdf", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestReplicatingBackend(t *testing.T) {
+	primary := backendtest.NewMemoryBackend(backendtest.MemoryBackendConfig{Buckets: []string{dummyBucket}})
+	secondary := backendtest.NewMemoryBackend(backendtest.MemoryBackendConfig{Buckets: []string{dummyBucket}})
+
+	for _, key := range []string{"/file1", "/file2", "/file3"} {
+		for _, memoryBackend := range []*backendtest.MemoryBackend{primary, secondary} {
+			_, err := memoryBackend.PutObject(backend.BucketObject{BucketName: dummyBucket, Key: key}, strings.NewReader(key), backend.PutOptions{})
+			assert.Nil(t, err)
+		}
+	}
+
+	replicatingBackend, err := backend.NewReplicatingBackend(backend.ReplicatingBackendConfig{
+		Primary:   primary,
+		Secondary: secondary,
+		QueueDir:  t.TempDir(),
+	})
+	assert.Nil(t, err)
+	defer replicatingBackend.Close()
+
+	r := router.NewGinEngine(gin.TestMode, s3proxyVersion, expiration, serverAPIKey, replicatingBackend, router.Config{Replication: replicatingBackend})
+
+	// the locked object of the primary backend is not deleted on the secondary backend
+	assert.Nil(t, primary.PutObjectLegalHold(backend.BucketObject{BucketName: dummyBucket, Key: "/file1"}, true))
+
+	w := s3proxytest.ServeBulkDeleteObject(t, r, dummyBucket, []string{"/file1", "/file2"}, serverAPIKey)
+	assert.Equal(t, http.StatusLocked, w.Code)
+	assert.Equal(t, []string{"/file1", "/file3"}, secondary.Keys(dummyBucket))
+
+	secondary.SetErrors(backendtest.MemoryError{Method: "DeleteObject", Err: errors.New("region unavailable")})
+
+	w = s3proxytest.ServeDeleteObject(t, r, dummyBucket, "/file3", serverAPIKey)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = s3proxytest.ServeHTTP(t, r, http.MethodGet, "/api/v1/replication/status", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = s3proxytest.ServeHTTP(t, r, http.MethodGet, "/api/v1/replication/status", serverAPIKey)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	status := unmarshallJSON(t, w.Body.Bytes())
+	assert.Equal(t, "sync", status["mode"])
+	assert.Equal(t, float64(1), status["replicated"])
+	assert.Equal(t, float64(1), status["queuedOperations"])
+	assert.Contains(t, status["lastError"], "region unavailable")
+}
+
+// Check if we are getting a 500 when we have a panic. Should be handle by the recovery middleware
+// we are using delete action which fires a fake panic when "error" is in the key
+func TestRecoveryMiddleware(t *testing.T) {
+	w := s3proxytest.ServeDeleteObject(t, r, dummyBucket, "/error", "")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+// Some 404 checks
+func Test404(t *testing.T) {
+
+	// missing elements in path
+	w := s3proxytest.ServeHTTP(t, r, http.MethodGet, "/api/v1/presigned/url/dummybucket", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = s3proxytest.ServeHTTP(t, r, http.MethodGet, "/api/v1/presigned/url", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = s3proxytest.ServeHTTP(t, r, http.MethodGet, "/api/v1/presigned/url/coucou", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = s3proxytest.ServeHTTP(t, r, http.MethodPost, "/api/v1/presigned/coucou", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = s3proxytest.ServeHTTP(t, r, http.MethodDelete, "/api/v1/presigned/", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// check unsupported method
+	w = s3proxytest.ServeHTTP(t, r, http.MethodPatch, "/api/v1/object/dummybucket/dummyfolder/dummyfile", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+// Check authorization with valid api key
+func TestAuthorizationOK(t *testing.T) {
+
+	// create a server with api key protection
+	r = router.NewGinEngine(gin.ReleaseMode, s3proxyVersion, urlExpiration, serverAPIKey, s3backend)
+
+	// ping endpoint should not be protected
+	w := s3proxytest.ServeHTTP(t, r, http.MethodGet, "/", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Other endpoints should be protected
+	w = s3proxytest.ServeCreatePresignedURLForUpload(t, r, dummyBucket, dummyFile, serverAPIKey)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = s3proxytest.ServeCreatePresignedURLForDownload(t, r, dummyBucket, dummyFile, serverAPIKey)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = s3proxytest.ServeDeleteObject(t, r, dummyBucket, dummyFile, serverAPIKey)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = s3proxytest.ServeListObjects(t, r, dummyBucket, nil, serverAPIKey)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+// Check authorization verification with missing api key
+func TestAuthorization401(t *testing.T) {
+
+	// create a server with api key protection
+	r = router.NewGinEngine(gin.ReleaseMode, s3proxyVersion, urlExpiration, serverAPIKey, s3backend)
+
+	// ping endpoint should not be protected
+	w := s3proxytest.ServeHTTP(t, r, http.MethodGet, "/", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Other endpoints should be protected
+	w = s3proxytest.ServeCreatePresignedURLForUpload(t, r, dummyBucket, dummyFile, "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = s3proxytest.ServeCreatePresignedURLForDownload(t, r, dummyBucket, dummyFile, "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = s3proxytest.ServeDeleteObject(t, r, dummyBucket, dummyFile, "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = s3proxytest.ServeListObjects(t, r, dummyBucket, nil, "")
 	assert.Equal(t, http.StatusUnauthorized, w.Code)
 
 }
@@ -153,14 +153,63 @@ func ServeHTTP(t *testing.T, r *gin.Engine, method string, url string, authoriza
 	return ServeHTTPWithBody(t, r, method, url, nil, 0, authorization)
 }
 
+func ServeHTTPWithHeaders(t *testing.T, r *gin.Engine, method string, url string, headers map[string]string, authorization string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+
+	req, err := http.NewRequest(method, url, nil)
+	assert.Nil(t, err)
+
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	r.ServeHTTP(w, req)
+
+	return w
+}
+
 func ServeCreatePresignedURLForUpload(t *testing.T, r *gin.Engine, bucket string, key string, authorization string) *httptest.ResponseRecorder {
 	return ServeHTTP(t, r, http.MethodPost, fmt.Sprintf("/api/v1/presigned/url/%v%v", bucket, key), authorization)
 }
 
+func ServeCreatePresignedURLForUploadWithParams(t *testing.T, r *gin.Engine, bucket string, key string, params url.Values, authorization string) *httptest.ResponseRecorder {
+	queryParams := ""
+
+	if len(params) > 0 {
+		queryParams = "?" + params.Encode()
+	}
+
+	return ServeHTTP(t, r, http.MethodPost, fmt.Sprintf("/api/v1/presigned/url/%v%v%v", bucket, key, queryParams), authorization)
+}
+
 func ServeCreatePresignedURLForDownload(t *testing.T, r *gin.Engine, bucket string, key string, authorization string) *httptest.ResponseRecorder {
 	return ServeHTTP(t, r, http.MethodGet, fmt.Sprintf("/api/v1/presigned/url/%v%v", bucket, key), authorization)
 }
 
+func ServeCreatePresignedURLForDownloadWithParams(t *testing.T, r *gin.Engine, bucket string, key string, params url.Values, authorization string) *httptest.ResponseRecorder {
+	queryParams := ""
+
+	if len(params) > 0 {
+		queryParams = "?" + params.Encode()
+	}
+
+	return ServeHTTP(t, r, http.MethodGet, fmt.Sprintf("/api/v1/presigned/url/%v%v%v", bucket, key, queryParams), authorization)
+}
+
+func ServeCreatePresignedPost(t *testing.T, r *gin.Engine, bucket string, key string, params url.Values, authorization string) *httptest.ResponseRecorder {
+	queryParams := ""
+
+	if len(params) > 0 {
+		queryParams = "?" + params.Encode()
+	}
+
+	return ServeHTTP(t, r, http.MethodPost, fmt.Sprintf("/api/v1/presigned/post/%v%v%v", bucket, key, queryParams), authorization)
+}
+
 func ServeDeleteObject(t *testing.T, r *gin.Engine, bucket string, key string, authorization string) *httptest.ResponseRecorder {
 	return ServeHTTP(t, r, http.MethodDelete, fmt.Sprintf("/api/v1/object/%v%v", bucket, key), authorization)
 }
@@ -194,6 +243,216 @@ func ServeCopyObject(t *testing.T, r *gin.Engine, sourceBucket string, sourceKey
 	return ServeHTTP(t, r, http.MethodPost, fmt.Sprintf("/api/v1/object/copy/%v%v%v", sourceBucket, sourceKey, queryParams), authorization)
 }
 
+func ServeGetObject(t *testing.T, r *gin.Engine, bucket string, key string, headers map[string]string, authorization string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("/api/v1/object/%v%v", bucket, key), nil)
+	assert.Nil(t, err)
+
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	r.ServeHTTP(w, req)
+
+	return w
+}
+
+func ServePutObject(t *testing.T, r *gin.Engine, bucket string, key string, body []byte, headers map[string]string, authorization string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+
+	req, err := http.NewRequest(http.MethodPut, fmt.Sprintf("/api/v1/object/%v%v", bucket, key), bytes.NewReader(body))
+	assert.Nil(t, err)
+
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	r.ServeHTTP(w, req)
+
+	return w
+}
+
+func ServeStatObject(t *testing.T, r *gin.Engine, bucket string, key string, authorization string) *httptest.ResponseRecorder {
+	return ServeHTTP(t, r, http.MethodGet, fmt.Sprintf("/api/v1/object/meta/%v%v", bucket, key), authorization)
+}
+
+func ServeListObjects(t *testing.T, r *gin.Engine, bucket string, params url.Values, authorization string) *httptest.ResponseRecorder {
+	queryParams := ""
+
+	if len(params) > 0 {
+		queryParams = "?" + params.Encode()
+	}
+
+	return ServeHTTP(t, r, http.MethodGet, fmt.Sprintf("/api/v1/list/%v%v", bucket, queryParams), authorization)
+}
+
+func ServeCreateMultipartUpload(t *testing.T, r *gin.Engine, bucket string, key string, authorization string) *httptest.ResponseRecorder {
+	return ServeHTTP(t, r, http.MethodPost, fmt.Sprintf("/api/v1/multipart/create/%v%v", bucket, key), authorization)
+}
+
+func ServeCreatePresignedURLForUploadPart(t *testing.T, r *gin.Engine, bucket string, key string, uploadID string, partNumbers []string, authorization string) *httptest.ResponseRecorder {
+	params := make(url.Values)
+
+	if uploadID != "" {
+		params.Set("uploadId", uploadID)
+	}
+	for _, partNumber := range partNumbers {
+		params.Add("partNumber", partNumber)
+	}
+
+	return ServeHTTP(t, r, http.MethodPost, fmt.Sprintf("/api/v1/multipart/url/%v%v?%v", bucket, key, params.Encode()), authorization)
+}
+
+func ServeCompleteMultipartUpload(t *testing.T, r *gin.Engine, bucket string, key string, uploadID string, parts []backend.CompletedPart, authorization string) *httptest.ResponseRecorder {
+	body, err := jsonlib.Marshal(map[string]interface{}{"parts": parts})
+	assert.Nil(t, err)
+
+	return ServeHTTPWithBody(t, r, http.MethodPost, fmt.Sprintf("/api/v1/multipart/complete/%v%v?uploadId=%v", bucket, key, url.QueryEscape(uploadID)), bytes.NewReader(body), len(body), authorization)
+}
+
+func ServeAbortMultipartUpload(t *testing.T, r *gin.Engine, bucket string, key string, uploadID string, authorization string) *httptest.ResponseRecorder {
+	return ServeHTTP(t, r, http.MethodDelete, fmt.Sprintf("/api/v1/multipart/%v%v?uploadId=%v", bucket, key, url.QueryEscape(uploadID)), authorization)
+}
+
+func ServeDeletePrefix(t *testing.T, r *gin.Engine, bucket string, params url.Values, authorization string) *httptest.ResponseRecorder {
+	queryParams := ""
+
+	if len(params) > 0 {
+		queryParams = "?" + params.Encode()
+	}
+
+	return ServeHTTP(t, r, http.MethodPost, fmt.Sprintf("/api/v1/object/delete-prefix/%v%v", bucket, queryParams), authorization)
+}
+
+func ServeCopyPrefix(t *testing.T, r *gin.Engine, sourceBucket string, params url.Values, authorization string) *httptest.ResponseRecorder {
+	queryParams := ""
+
+	if len(params) > 0 {
+		queryParams = "?" + params.Encode()
+	}
+
+	return ServeHTTP(t, r, http.MethodPost, fmt.Sprintf("/api/v1/object/copy-prefix/%v%v", sourceBucket, queryParams), authorization)
+}
+
+func ServeMoveObject(t *testing.T, r *gin.Engine, sourceBucket string, sourceKey string, destinationBucket string, destinationKey string, authorization string) *httptest.ResponseRecorder {
+	params := make(url.Values)
+
+	if destinationBucket != "" {
+		params.Set("destBucket", destinationBucket)
+	}
+	if destinationKey != "" {
+		params.Set("destKey", destinationKey)
+	}
+
+	queryParams := ""
+
+	if len(params) > 0 {
+		queryParams = "?" + params.Encode()
+	}
+
+	return ServeHTTP(t, r, http.MethodPost, fmt.Sprintf("/api/v1/object/move/%v%v%v", sourceBucket, sourceKey, queryParams), authorization)
+}
+
+func ServeListObjectVersions(t *testing.T, r *gin.Engine, bucket string, params url.Values, authorization string) *httptest.ResponseRecorder {
+	queryParams := ""
+
+	if len(params) > 0 {
+		queryParams = "?" + params.Encode()
+	}
+
+	return ServeHTTP(t, r, http.MethodGet, fmt.Sprintf("/api/v1/versions/%v%v", bucket, queryParams), authorization)
+}
+
+func ServeRestoreObjectVersion(t *testing.T, r *gin.Engine, bucket string, key string, versionID string, authorization string) *httptest.ResponseRecorder {
+	queryParams := ""
+
+	if versionID != "" {
+		queryParams = "?" + url.Values{"versionId": {versionID}}.Encode()
+	}
+
+	return ServeHTTP(t, r, http.MethodPost, fmt.Sprintf("/api/v1/object/restore-version/%v%v%v", bucket, key, queryParams), authorization)
+}
+
+func ServeRestoreObject(t *testing.T, r *gin.Engine, bucket string, key string, params url.Values, authorization string) *httptest.ResponseRecorder {
+	queryParams := ""
+
+	if len(params) > 0 {
+		queryParams = "?" + params.Encode()
+	}
+
+	return ServeHTTP(t, r, http.MethodPost, fmt.Sprintf("/api/v1/object/restore/%v%v%v", bucket, key, queryParams), authorization)
+}
+
+func ServeGetObjectTagging(t *testing.T, r *gin.Engine, bucket string, key string, authorization string) *httptest.ResponseRecorder {
+	return ServeHTTP(t, r, http.MethodGet, fmt.Sprintf("/api/v1/object/tags/%v%v", bucket, key), authorization)
+}
+
+func ServePutObjectTagging(t *testing.T, r *gin.Engine, bucket string, key string, tags map[string]string, authorization string) *httptest.ResponseRecorder {
+	body, err := jsonlib.Marshal(tags)
+	assert.Nil(t, err)
+
+	return ServeHTTPWithBody(t, r, http.MethodPut, fmt.Sprintf("/api/v1/object/tags/%v%v", bucket, key), bytes.NewReader(body), len(body), authorization)
+}
+
+func ServeDeleteObjectTagging(t *testing.T, r *gin.Engine, bucket string, key string, authorization string) *httptest.ResponseRecorder {
+	return ServeHTTP(t, r, http.MethodDelete, fmt.Sprintf("/api/v1/object/tags/%v%v", bucket, key), authorization)
+}
+
+func ServeGetObjectRetention(t *testing.T, r *gin.Engine, bucket string, key string, authorization string) *httptest.ResponseRecorder {
+	return ServeHTTP(t, r, http.MethodGet, fmt.Sprintf("/api/v1/object/retention/%v%v", bucket, key), authorization)
+}
+
+func ServePutObjectRetention(t *testing.T, r *gin.Engine, bucket string, key string, retention backend.ObjectRetention, bypassGovernance bool, authorization string) *httptest.ResponseRecorder {
+	body, err := jsonlib.Marshal(retention)
+	assert.Nil(t, err)
+
+	queryParams := ""
+	if bypassGovernance {
+		queryParams = "?bypassGovernance=true"
+	}
+
+	return ServeHTTPWithBody(t, r, http.MethodPut, fmt.Sprintf("/api/v1/object/retention/%v%v%v", bucket, key, queryParams), bytes.NewReader(body), len(body), authorization)
+}
+
+func ServeGetObjectLegalHold(t *testing.T, r *gin.Engine, bucket string, key string, authorization string) *httptest.ResponseRecorder {
+	return ServeHTTP(t, r, http.MethodGet, fmt.Sprintf("/api/v1/object/legal-hold/%v%v", bucket, key), authorization)
+}
+
+func ServePutObjectLegalHold(t *testing.T, r *gin.Engine, bucket string, key string, legalHold bool, authorization string) *httptest.ResponseRecorder {
+	body, err := jsonlib.Marshal(map[string]bool{"legalHold": legalHold})
+	assert.Nil(t, err)
+
+	return ServeHTTPWithBody(t, r, http.MethodPut, fmt.Sprintf("/api/v1/object/legal-hold/%v%v", bucket, key), bytes.NewReader(body), len(body), authorization)
+}
+
+// send a request to a URL signed by the filesystem backend, only the path and the query of the URL are used
+func ServeSignedURL(t *testing.T, r *gin.Engine, method string, signedURL string, body []byte, headers map[string]string) *httptest.ResponseRecorder {
+	u, err := url.Parse(signedURL)
+	assert.Nil(t, err)
+
+	w := httptest.NewRecorder()
+
+	req, err := http.NewRequest(method, u.RequestURI(), bytes.NewReader(body))
+	assert.Nil(t, err)
+
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	r.ServeHTTP(w, req)
+
+	return w
+}
+
 func CatchPanic() {
 	// if panic, recover first
 	err := recover()
@@ -0,0 +1,94 @@
+//go:build integration
+// +build integration
+
+// Integration test of the Azure backend with the Azurite emulator
+package test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mirakl/s3proxy/backend"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// well-known account of Azurite, the container is created by the createcontainers service of docker-compose.yml
+var azuriteBackendConfig = backend.AzureBackendConfig{
+	Endpoint:    "http://azurite:10000/devstoreaccount1",
+	AccountName: "devstoreaccount1",
+	AccountKey:  "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw==",
+}
+
+const azuriteContainer = "s3proxy-container"
+
+// send a request to a presigned URL and returns the response body
+func sendPresigned(t *testing.T, method string, presignedURL string, headers map[string]string, body []byte) []byte {
+	req, err := http.NewRequest(method, presignedURL, bytes.NewReader(body))
+	require.NoError(t, err)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	response, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer response.Body.Close()
+
+	data, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+	require.Less(t, response.StatusCode, 300, "%s %s : %s", method, presignedURL, data)
+
+	return data
+}
+
+func TestAzureIntegration(t *testing.T) {
+	b, err := backend.NewAzureBackend(azuriteBackendConfig)
+	require.NoError(t, err)
+
+	source := backend.BucketObject{BucketName: azuriteContainer, Key: "/folder/file.txt"}
+
+	// upload and download with the SAS URLs
+	upload, err := b.CreatePresignedURLForUpload(source, time.Minute, backend.UploadConstraints{ContentType: "text/plain"})
+	require.NoError(t, err)
+	sendPresigned(t, http.MethodPut, upload.URL, upload.Headers, []byte("hello azurite"))
+
+	downloadURL, err := b.CreatePresignedURLForDownload(source, time.Minute, backend.ResponseHeaders{ContentDisposition: "attachment"})
+	require.NoError(t, err)
+	assert.Equal(t, "hello azurite", string(sendPresigned(t, http.MethodGet, downloadURL, nil, nil)))
+
+	info, err := b.StatObject(source)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len("hello azurite")), info.Size)
+	assert.Equal(t, "text/plain", info.ContentType)
+
+	// copy, its source is read by Azurite with a SAS
+	copied := backend.BucketObject{BucketName: azuriteContainer, Key: "/copy/file.txt"}
+	require.NoError(t, b.CopyObject(source, copied))
+
+	content, err := b.GetObject(copied, backend.GetOptions{})
+	require.NoError(t, err)
+	data, _ := io.ReadAll(content.Body)
+	content.Body.Close()
+	assert.Equal(t, "hello azurite", string(data))
+
+	_, err = b.PutObject(backend.BucketObject{BucketName: azuriteContainer, Key: "/other.txt"}, strings.NewReader("other"), backend.PutOptions{})
+	require.NoError(t, err)
+
+	err = b.CopyObject(backend.BucketObject{BucketName: azuriteContainer, Key: "/missing"}, copied)
+	assert.Equal(t, "NoSuchKey", errorCode(err))
+
+	// delete and batch delete
+	require.NoError(t, b.DeleteObject(source))
+	_, err = b.StatObject(source)
+	assert.Equal(t, "NoSuchKey", errorCode(err))
+
+	require.NoError(t, b.BatchDeleteObjects([]backend.BucketObject{copied, {BucketName: azuriteContainer, Key: "/other.txt"}, source}))
+
+	listing, err := b.ListObjects(azuriteContainer, backend.ListOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, listing.Objects)
+}
@@ -0,0 +1,105 @@
+//go:build integration
+// +build integration
+
+// Integration test of the GCS backend with fake-gcs-server
+package test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mirakl/s3proxy/backend"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// the bucket is created by the creategcsbuckets service of docker-compose.yml
+const (
+	fakeGCSEndpoint = "http://fake-gcs-server:4443"
+	fakeGCSBucket   = "s3proxy-bucket"
+)
+
+// create a GCS backend with a generated service account, fake-gcs-server does not check the tokens and the signatures
+// the tokens are served by a local token endpoint
+func newFakeGCSBackend(t *testing.T) *backend.GCSBackend {
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"fake-token","expires_in":3600}`))
+	}))
+	t.Cleanup(tokenServer.Close)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	credentials, err := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"client_email": "s3proxy@s3proxy-test.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":    tokenServer.URL,
+	})
+	require.NoError(t, err)
+
+	credentialsFile := filepath.Join(t.TempDir(), "credentials.json")
+	require.NoError(t, os.WriteFile(credentialsFile, credentials, 0o600))
+
+	b, err := backend.NewGCSBackend(backend.GCSBackendConfig{Endpoint: fakeGCSEndpoint, CredentialsFile: credentialsFile})
+	require.NoError(t, err)
+
+	return b
+}
+
+func TestGCSIntegration(t *testing.T) {
+	b := newFakeGCSBackend(t)
+
+	source := backend.BucketObject{BucketName: fakeGCSBucket, Key: "/folder/file.txt"}
+
+	// upload and download with the signed URLs
+	upload, err := b.CreatePresignedURLForUpload(source, time.Minute, backend.UploadConstraints{ContentType: "text/plain"})
+	require.NoError(t, err)
+	sendPresigned(t, http.MethodPut, upload.URL, upload.Headers, []byte("hello gcs"))
+
+	downloadURL, err := b.CreatePresignedURLForDownload(source, time.Minute, backend.ResponseHeaders{})
+	require.NoError(t, err)
+	assert.Equal(t, "hello gcs", string(sendPresigned(t, http.MethodGet, downloadURL, nil, nil)))
+
+	info, err := b.StatObject(source)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len("hello gcs")), info.Size)
+
+	// copy with a rewrite
+	copied := backend.BucketObject{BucketName: fakeGCSBucket, Key: "/copy/file.txt"}
+	require.NoError(t, b.CopyObject(source, copied))
+
+	content, err := b.GetObject(copied, backend.GetOptions{})
+	require.NoError(t, err)
+	data, _ := io.ReadAll(content.Body)
+	content.Body.Close()
+	assert.Equal(t, "hello gcs", string(data))
+
+	_, err = b.PutObject(backend.BucketObject{BucketName: fakeGCSBucket, Key: "/other.txt"}, strings.NewReader("other"), backend.PutOptions{})
+	require.NoError(t, err)
+
+	// delete and batch delete
+	require.NoError(t, b.DeleteObject(source))
+	_, err = b.StatObject(source)
+	assert.Equal(t, "NoSuchKey", errorCode(err))
+
+	require.NoError(t, b.BatchDeleteObjects([]backend.BucketObject{copied, {BucketName: fakeGCSBucket, Key: "/other.txt"}, source}))
+
+	listing, err := b.ListObjects(fakeGCSBucket, backend.ListOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, listing.Objects)
+}
@@ -2,7 +2,7 @@
 // +build integration
 
 // Integration test used for testing s3proxy code of this repository
-// with the following running backends : minio and rsyslog
+// with the following running backends : minio, rsyslog, azurite and fake-gcs-server
 package test
 
 import (
@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"testing"
 
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/gin-gonic/gin"
 	"github.com/mirakl/s3proxy/backend"
 	"github.com/mirakl/s3proxy/logger"
@@ -64,3 +65,11 @@ func TestIntegration(t *testing.T) {
 
 	s3proxytest.RunSimpleScenarioForS3proxy(t, s3proxyHost)
 }
+
+// S3 error code of an error of a backend
+func errorCode(err error) string {
+	if err, ok := err.(awserr.Error); ok {
+		return err.Code()
+	}
+	return ""
+}